@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	imgTagRE      = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	imgAltRE      = regexp.MustCompile(`(?i)\salt\s*=`)
+	titleAttrRE   = regexp.MustCompile(`(?i)\stitle\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	spacerImageRE = regexp.MustCompile(`(?i)\ssrc\s*=\s*["']?[^"'\s>]*(?:spacer|blank|pixel|transparent|clear)[^"'\s>/]*\.gif`)
+	// Captions right after an image: text after a line break, or an element
+	// styled as a caption
+	brCaptionRE    = regexp.MustCompile(`(?is)^\s*(?:</a>\s*)?<br\s*/?>\s*([^<]{1,120})<`)
+	classCaptionRE = regexp.MustCompile(`(?is)<(?:figcaption|\w+\b[^>]*\bclass\s*=\s*["']?[^"'>]*caption)[^>]*>\s*([^<]{1,120})<`)
+	headingTagRE   = regexp.MustCompile(`(?i)<(/?)h([1-6])\b`)
+	tableTagRE     = regexp.MustCompile(`(?i)<(/?)table\b[^>]*>`)
+	roleAttrRE     = regexp.MustCompile(`(?i)\srole\s*=`)
+	linkElementRE  = regexp.MustCompile(`(?is)<a\b[^>]*\bhref\b[^>]*>.*?</a\s*>`)
+	tableHeaderRE  = regexp.MustCompile(`(?i)<th\b`)
+)
+
+// Bytes after an image searched for its caption
+const captionWindow = 300
+
+// navSeparators are the characters left between the links of a navigation
+// bar
+const navSeparators = " \t\r\n |·•»«<>[]()-–—:/"
+
+// Accessibility returns the rewrite adding missing alt texts from nearby
+// captions, fixing skipped heading levels and labelling navigation tables,
+// or nil without -accessibility
+func (opts *Options) Accessibility() (pageRewrite, error) {
+	if !opts.A11y {
+		return nil, nil
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		changed := false
+		for _, fix := range []func([]byte) ([]byte, bool){addImageAlts, fixHeadingOrder, labelNavTables} {
+			var ok bool
+			if b, ok = fix(b); ok {
+				changed = true
+			}
+		}
+		return b, changed
+	}, nil
+}
+
+// addImageAlts gives images without alt attribute the text of their title
+// attribute or of a caption following them. Spacer images get an empty alt
+// so that screen readers skip them. Other images are left alone.
+func addImageAlts(b []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	last := 0
+	for _, loc := range imgTagRE.FindAllIndex(b, -1) {
+		tag := b[loc[0]:loc[1]]
+		if imgAltRE.Match(tag) {
+			continue
+		}
+		alt, ok := imageCaption(tag, b[loc[1]:min(len(b), loc[1]+captionWindow)])
+		if !ok {
+			continue
+		}
+		out.Write(b[last:loc[0]])
+		out.Write(insertAttr(tag, `alt="`+alt+`"`))
+		last = loc[1]
+	}
+	if last == 0 {
+		return b, false
+	}
+	out.Write(b[last:])
+	return out.Bytes(), true
+}
+
+// imageCaption returns the alt text of an image, escaped for an attribute
+// value, from its tag and the page text following it
+func imageCaption(tag, after []byte) (string, bool) {
+	if m := titleAttrRE.FindSubmatch(tag); m != nil {
+		if title := strings.TrimSpace(string(m[1]) + string(m[2]) + string(m[3])); title != "" {
+			return attrText(title), true
+		}
+	}
+	if spacerImageRE.Match(tag) {
+		return "", true
+	}
+	if next := imgTagRE.FindIndex(after); next != nil {
+		after = after[:next[0]]
+	}
+	for _, re := range []*regexp.Regexp{brCaptionRE, classCaptionRE} {
+		if m := re.FindSubmatch(after); m != nil {
+			if caption := strings.Join(strings.Fields(string(m[1])), " "); caption != "" {
+				return attrText(caption), true
+			}
+		}
+	}
+	return "", false
+}
+
+// attrEscaper escapes text for a double-quoted attribute value
+var attrEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;", "<", "&lt;", ">", "&gt;")
+
+// attrText escapes page text, which may hold character references, for a
+// double-quoted attribute value
+func attrText(s string) string {
+	return attrEscaper.Replace(html.UnescapeString(s))
+}
+
+// fixHeadingOrder renumbers headings that skip levels, e.g. an h4 following
+// an h2 becomes an h3, keeping closing tags in step
+func fixHeadingOrder(b []byte) ([]byte, bool) {
+	out := append([]byte(nil), b...)
+	changed := false
+	last := 0
+	open := map[byte][]byte{} // stack of the new levels of open headings by old level
+	for _, m := range headingTagRE.FindAllSubmatchIndex(b, -1) {
+		level := b[m[4]]
+		if m[3] > m[2] {
+			if stack := open[level]; len(stack) > 0 {
+				out[m[4]] = stack[len(stack)-1]
+				open[level] = stack[:len(stack)-1]
+			}
+			continue
+		}
+		fixed := level
+		if last > 0 && int(level-'0') > last+1 {
+			fixed = byte('0' + last + 1)
+		}
+		open[level] = append(open[level], fixed)
+		if fixed != level {
+			out[m[4]] = fixed
+			changed = true
+		}
+		last = int(fixed - '0')
+	}
+	if !changed {
+		return b, false
+	}
+	return out, true
+}
+
+// labelNavTables marks tables holding nothing but links, such as the
+// Previous | Next bars of legacy help pages, as navigation
+func labelNavTables(b []byte) ([]byte, bool) {
+	var inserts []int
+	var stack []int
+	nested := map[int]bool{}
+	for _, m := range tableTagRE.FindAllSubmatchIndex(b, -1) {
+		if m[3] == m[2] {
+			for _, start := range stack {
+				nested[start] = true
+			}
+			stack = append(stack, m[0])
+			continue
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		start := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		tagEnd := start + bytes.IndexByte(b[start:], '>') + 1
+		if !nested[start] && !roleAttrRE.Match(b[start:tagEnd]) && isNavTable(b[tagEnd:m[0]]) {
+			inserts = append(inserts, start)
+		}
+	}
+	if len(inserts) == 0 {
+		return b, false
+	}
+	var out bytes.Buffer
+	last := 0
+	for _, start := range inserts {
+		tagEnd := start + bytes.IndexByte(b[start:], '>') + 1
+		out.Write(b[last:start])
+		out.Write(insertAttr(b[start:tagEnd], `role="navigation" aria-label="Navigation"`))
+		last = tagEnd
+	}
+	out.Write(b[last:])
+	return out.Bytes(), true
+}
+
+// isNavTable reports whether the content of a table is at least two links
+// and separators between them
+func isNavTable(content []byte) bool {
+	if tableHeaderRE.Match(content) || len(linkElementRE.FindAllIndex(content, 2)) < 2 {
+		return false
+	}
+	rest := tagRE.ReplaceAll(linkElementRE.ReplaceAll(content, nil), nil)
+	return strings.Trim(html.UnescapeString(string(rest)), navSeparators) == ""
+}
+
+// insertAttr adds attr to the end of a start tag
+func insertAttr(tag []byte, attr string) []byte {
+	end, closing := len(tag)-1, ">"
+	if end > 0 && tag[end-1] == '/' {
+		end, closing = end-1, " />"
+	}
+	var out bytes.Buffer
+	out.Write(bytes.TrimRight(tag[:end], " \t\r\n"))
+	out.WriteString(" " + attr + closing)
+	return out.Bytes()
+}
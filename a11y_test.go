@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAddImageAlts(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{`<img src="a.gif" title="Main window">`, `<img src="a.gif" title="Main window" alt="Main window">`},
+		{`<img src="a.gif"><br>Figure 1: The &quot;Open&quot; dialog</p>`, `<img src="a.gif" alt="Figure 1: The &quot;Open&quot; dialog"><br>Figure 1: The &quot;Open&quot; dialog</p>`},
+		{`<figure><img src="a.gif" /><figcaption>Toolbar</figcaption></figure>`, `<figure><img src="a.gif" alt="Toolbar" /><figcaption>Toolbar</figcaption></figure>`},
+		{`<p><img src="a.gif"></p><p class="caption">Toolbar</p>`, `<p><img src="a.gif" alt="Toolbar"></p><p class="caption">Toolbar</p>`},
+		{`<img src="images/spacer.gif" width=1>`, `<img src="images/spacer.gif" width=1 alt="">`},
+		{`<img src="a.gif" alt="">`, `<img src="a.gif" alt="">`},
+		{`<img src="a.gif"> Some text.`, `<img src="a.gif"> Some text.`},
+		{`<img src="a.gif"><img src="b.gif"><br>Second</p>`, `<img src="a.gif"><img src="b.gif" alt="Second"><br>Second</p>`},
+	} {
+		out, _ := addImageAlts([]byte(test.in))
+		Test{string(out), test.out}.Compare(t)
+	}
+}
+
+func TestFixHeadingOrder(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{`<h1>A</h1><h3>B</h3><h4>C</h4><h2>D</h2>`, `<h1>A</h1><h2>B</h2><h3>C</h3><h2>D</h2>`},
+		{`<H2>A</H2><H4 class="x">B</H4>`, `<H2>A</H2><H3 class="x">B</H3>`},
+		{`<h1>A</h1><h2>B</h2>`, `<h1>A</h1><h2>B</h2>`},
+	} {
+		out, changed := fixHeadingOrder([]byte(test.in))
+		Test{string(out), test.out}.Compare(t)
+		Test{changed, test.in != test.out}.Compare(t)
+	}
+}
+
+func TestLabelNavTables(t *testing.T) {
+	for _, test := range []struct {
+		in, out string
+	}{
+		{`<table><tr><td><a href="a.htm">Previous</a> | <a href="b.htm">Next</a></td></tr></table>`,
+			`<table role="navigation" aria-label="Navigation"><tr><td><a href="a.htm">Previous</a> | <a href="b.htm">Next</a></td></tr></table>`},
+		{`<table><tr><td><a href="a.htm">A</a></td><td>Some value</td><td><a href="b.htm">B</a></td></tr></table>`,
+			`<table><tr><td><a href="a.htm">A</a></td><td>Some value</td><td><a href="b.htm">B</a></td></tr></table>`},
+		{`<table role="presentation"><tr><td><a href="a.htm">A</a><a href="b.htm">B</a></td></tr></table>`,
+			`<table role="presentation"><tr><td><a href="a.htm">A</a><a href="b.htm">B</a></td></tr></table>`},
+		{`<table><tr><td><table><tr><td><a href="a.htm">A</a>&nbsp;<a href="b.htm">B</a></td></tr></table></td></tr></table>`,
+			`<table><tr><td><table role="navigation" aria-label="Navigation"><tr><td><a href="a.htm">A</a>&nbsp;<a href="b.htm">B</a></td></tr></table></td></tr></table>`},
+	} {
+		out, _ := labelNavTables([]byte(test.in))
+		Test{string(out), test.out}.Compare(t)
+	}
+}
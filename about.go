@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	aboutFile = "chm2docset-about.html"
+
+	aboutTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>About {{.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 3em; color: #333; }
+h1 { font-weight: 300; font-size: 2em; }
+dt { font-weight: bold; margin-top: .6em; }
+code { font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>About {{.Name}}</h1>
+<dl>
+<dt>Source</dt><dd>{{.Source}}{{if .SourceTitle}} ({{.SourceTitle}}){{end}}</dd>
+{{if .Version}}<dt>Version</dt><dd>{{.Version}}</dd>
+{{end}}<dt>Converted</dt><dd>{{.Date}} by chm2docset{{if .Converter}} {{.Converter}}{{end}}</dd>
+<dt>Options</dt><dd>{{if .Options}}{{range .Options}}<code>{{.}}</code> {{end}}{{else}}none{{end}}</dd>
+{{with .Report}}<dt>Pages</dt><dd>{{.Pages}}</dd>
+<dt>Index entries</dt><dd>{{.Entries}}</dd>
+{{if .Skipped}}<dt>Pages left out of the index</dt><dd>{{len .Skipped}}</dd>
+{{end}}{{if .Missing}}<dt>Missing pages</dt><dd>{{len .Missing}}</dd>
+{{end}}{{if .Warnings}}<dt>Warnings</dt><dd>{{len .Warnings}}</dd>
+{{end}}{{end}}</dl>
+</body>
+</html>
+`
+)
+
+var aboutTmpl = template.Must(template.New("about").Parse(aboutTemplate))
+
+// WriteAbout writes, under -about, a page describing the source and how it
+// was converted, taken from the conversion report, and links it from the
+// bottom of the start page
+func (opts *Options) WriteAbout() error {
+	if !opts.About {
+		return nil
+	}
+	source := opts.SourceFilename()
+	if opts.combined() {
+		names := make([]string, len(opts.Sources))
+		for i, s := range opts.Sources {
+			names[i] = filepath.Base(s)
+		}
+		source = strings.Join(names, ", ")
+	}
+	var buf bytes.Buffer
+	err := aboutTmpl.Execute(&buf, struct {
+		Name, Source, SourceTitle, Version, Date, Converter string
+		Options                                             []string
+		Report                                              *SourceReport
+	}{
+		Name:        opts.Title(),
+		Source:      source,
+		SourceTitle: opts.systemTitle,
+		Version:     opts.DocsetVersion,
+		Date:        time.Now().UTC().Format("2006-01-02 15:04 MST"),
+		Converter:   converterVersion(),
+		Options:     opts.commandLineOptions(),
+		Report:      opts.totalReport(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(opts.ContentPath(), aboutFile), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	page := pageOf(opts.IndexFilePath())
+	path := filepath.Join(opts.ContentPath(), filepath.FromSlash(page))
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Start page %s not found, %s is not linked", page, aboutFile)
+		return nil
+	}
+	link := fmt.Sprintf("<p class=\"chm2docset-about\"><a href=\"%s\">About this documentation set</a></p>\n",
+		html.EscapeString(escapeLink(relativeLink(page, aboutFile))))
+	return os.WriteFile(path, insertInBody(b, "", link), 0644)
+}
+
+// commandLineOptions returns the flags given on the command line as
+// -name=value, sorted by name
+func (opts *Options) commandLineOptions() []string {
+	var options []string
+	for name := range opts.setFlags {
+		f := flag.CommandLine.Lookup(name)
+		if f == nil {
+			continue
+		}
+		options = append(options, fmt.Sprintf("-%s=%s", name, f.Value))
+	}
+	sort.Strings(options)
+	return options
+}
+
+// converterVersion returns the module version chm2docset was built from,
+// or "" for a development build
+func converterVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" || info.Main.Version == "(devel)" {
+		return ""
+	}
+	return info.Main.Version
+}
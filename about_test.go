@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteAbout(t *testing.T) {
+	defer cleanTmp()
+	cleanTmp()
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", Name: "Baz", DocsetVersion: "1.2", indexFile: "sub/start.htm"}
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/sub", 0755)
+	os.WriteFile(content+"/sub/start.htm", []byte("<html><body>Start</body></html>"), 0644)
+
+	Test{opts.WriteAbout(), nil}.Compare(t)
+	_, err := os.Stat(content + "/" + aboutFile)
+	Test{os.IsNotExist(err), true}.Compare(t)
+
+	defer func(fs *flag.FlagSet) { flag.CommandLine = fs }(flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet("chm2docset", flag.ContinueOnError)
+	flag.CommandLine.BoolVar(&opts.About, "about", false, "")
+	flag.CommandLine.StringVar(&opts.DocsetVersion, "docset-version", "", "")
+	opts.About, opts.DocsetVersion = true, "1.2"
+	opts.systemTitle = "Baz Reference"
+	opts.setFlags = map[string]bool{"about": true, "docset-version": true, "no-such-flag": true}
+	opts.report = opts.newReport()
+	opts.sourceReport().Pages = 12
+	opts.sourceReport().Entries = 34
+	opts.sourceReport().Warnings = []string{"w"}
+	Test{opts.WriteAbout(), nil}.Compare(t)
+
+	b, _ := os.ReadFile(content + "/" + aboutFile)
+	about := string(b)
+	for _, s := range []string{
+		"<h1>About Baz</h1>",
+		"<dd>baz.chm (Baz Reference)</dd>",
+		"<dt>Version</dt><dd>1.2</dd>",
+		"<code>-about=true</code> <code>-docset-version=1.2</code>",
+		"<dt>Pages</dt><dd>12</dd>",
+		"<dt>Index entries</dt><dd>34</dd>",
+		"<dt>Warnings</dt><dd>1</dd>",
+	} {
+		Test{strings.Contains(about, s), true}.Compare(t)
+	}
+	Test{strings.Contains(about, "Missing pages"), false}.Compare(t)
+
+	b, _ = os.ReadFile(content + "/sub/start.htm")
+	Test{string(b), "<html><body>Start<p class=\"chm2docset-about\"><a href=\"../" + aboutFile + "\">About this documentation set</a></p>\n</body></html>"}.Compare(t)
+}
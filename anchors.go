@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	idAttrRE     = regexp.MustCompile(`(?i)(?:^|\s)id\s*=\s*["']?([^"'\s>]+)`)
+	nameAnchorRE = regexp.MustCompile(`(?i)<a\s(?:[^>]*\s)?name\s*=\s*["']?([^"'\s>]+)`)
+	tagRE        = regexp.MustCompile(`<[^>]*>`)
+	slugRE       = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// idInsertion adds an id attribute to the opening tag ending at End
+type idInsertion struct {
+	End int // offset of the tag's closing '>'
+	ID  string
+}
+
+// insertIDs returns b with every insertion applied
+func insertIDs(b []byte, insertions []idInsertion) []byte {
+	sort.Slice(insertions, func(i, j int) bool { return insertions[i].End < insertions[j].End })
+	var out bytes.Buffer
+	last := 0
+	for _, ins := range insertions {
+		out.Write(b[last:ins.End])
+		fmt.Fprintf(&out, ` id="%s"`, ins.ID)
+		last = ins.End
+	}
+	out.Write(b[last:])
+	return out.Bytes()
+}
+
+// uniqueAnchor returns prefix-slug(name), suffixed with a counter if it
+// is already used
+func uniqueAnchor(prefix, name string, used map[string]bool) string {
+	slug := strings.Trim(slugRE.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		slug = "item"
+	}
+	anchor := prefix + slug
+	for i := 2; used[anchor]; i++ {
+		anchor = fmt.Sprintf("%s%s-%d", prefix, slug, i)
+	}
+	return anchor
+}
+
+// cellText returns the plain text of an HTML fragment
+func cellText(b []byte, charset string) string {
+	text := tagRE.ReplaceAllString(decodeCharset(b, charset), "")
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+var annotationHeader = []string{"path", "name", "type", "new_name", "new_type"}
+
+// annotation is a manual change of an index entry. An empty Name removes
+// the entry.
+type annotation struct {
+	Name, Type string
+}
+
+// annotationKey identifies an entry as produced by the index passes
+type annotationKey struct {
+	Path, Name, Type string
+}
+
+// readAnnotations reads an annotation file written by -export-annotations
+func readAnnotations(path string) (map[annotationKey]annotation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = len(annotationHeader)
+	annotations := map[annotationKey]annotation{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && record[0] == annotationHeader[0] {
+			continue
+		}
+		key := annotationKey{record[0], record[1], record[2]}
+		a := annotation{record[3], record[4]}
+		if a.Type == "" {
+			a.Type = key.Type
+		}
+		annotations[key] = a
+	}
+	return annotations, nil
+}
+
+// annotateIndex exports the index to -export-annotations, then applies the
+// changes listed in -apply-annotations. Exported rows carry the changes
+// being applied, so the file can be edited further and applied again.
+func (opts *Options) annotateIndex(tx *sql.Tx) error {
+	var annotations map[annotationKey]annotation
+	if opts.ApplyAnnotations != "" {
+		var err error
+		if annotations, err = readAnnotations(opts.ApplyAnnotations); err != nil {
+			return fmt.Errorf("reading annotations: %w", err)
+		}
+	}
+
+	rows, err := tx.Query("SELECT id, path, name, type FROM searchIndex")
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		id  int64
+		key annotationKey
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.key.Path, &e.key.Name, &e.key.Type); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if opts.ExportAnnotations != "" {
+		keys := make([]annotationKey, len(entries))
+		for i, e := range entries {
+			keys[i] = e.key
+		}
+		if err := writeAnnotations(opts.ExportAnnotations, keys, annotations); err != nil {
+			return fmt.Errorf("exporting annotations: %w", err)
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	applied, removed := 0, 0
+	for _, e := range entries {
+		a, ok := annotations[e.key]
+		if !ok {
+			continue
+		}
+		applied++
+		if a.Name == "" {
+			if _, err := tx.Exec("DELETE FROM searchIndex WHERE id = ?", e.id); err != nil {
+				return err
+			}
+			removed++
+		} else if a.Name != e.key.Name || a.Type != e.key.Type {
+			if _, err := tx.Exec("UPDATE OR REPLACE searchIndex SET name = ?, type = ? WHERE id = ?", a.Name, a.Type, e.id); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Applied %d annotations", applied)
+	opts.addEntries(-removed)
+	if stale := len(annotations) - applied; stale > 0 {
+		opts.warnf("%d annotations match no entry of the index", stale)
+	}
+	return nil
+}
+
+// writeAnnotations writes one row per entry, with the new name and type
+// taken from annotations where present
+func writeAnnotations(path string, keys []annotationKey, annotations map[annotationKey]annotation) error {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(annotationHeader)
+	for _, k := range keys {
+		a, ok := annotations[k]
+		if !ok {
+			a = annotation{k.Name, k.Type}
+		}
+		w.Write([]string{k.Path, k.Name, k.Type, a.Name, a.Type})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+func annotateTestIndex(t *testing.T, opts *Options) []string {
+	opts.CreateDirectory()
+	os.Remove(opts.DatabasePath())
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	tx, _ := db.Begin()
+	for _, e := range [][]string{
+		{"TForm", "Guide", "vcl/tform.htm"},
+		{"Overview", "Guide", "index.htm"},
+		{"Obsolete", "Guide", "old.htm"},
+	} {
+		tx.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, ?, ?)", e[0], e[1], e[2])
+	}
+	if err := opts.annotateIndex(tx); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	tx.Commit()
+
+	rows, _ := db.Query("SELECT name || ':' || type FROM searchIndex ORDER BY name")
+	defer rows.Close()
+	var entries []string
+	for rows.Next() {
+		var e string
+		rows.Scan(&e)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAnnotationRoundTrip(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{
+		SourcePath:        "/foo/bar/baz.chm",
+		Outdir:            "tmp/Sample.docset",
+		ExportAnnotations: "tmp/annotations.csv",
+	}
+	annotateTestIndex(t, opts)
+	b, _ := os.ReadFile("tmp/annotations.csv")
+	Test{string(b), `path,name,type,new_name,new_type
+index.htm,Overview,Guide,Overview,Guide
+old.htm,Obsolete,Guide,Obsolete,Guide
+vcl/tform.htm,TForm,Guide,TForm,Guide
+`}.Compare(t)
+
+	edited := strings.NewReplacer(
+		"TForm,Guide,TForm,Guide", "TForm,Guide,TForm,Class",
+		"Obsolete,Guide,Obsolete,Guide", "Obsolete,Guide,,",
+	).Replace(string(b)) + "gone.htm,Gone,Guide,Gone,Class\n"
+	os.WriteFile("tmp/edited.csv", []byte(edited), 0644)
+
+	opts.ApplyAnnotations = "tmp/edited.csv"
+	opts.ExportAnnotations = "tmp/again.csv"
+	opts.report = opts.newReport()
+	entries := annotateTestIndex(t, opts)
+	Test{entries, []string{"Overview:Guide", "TForm:Class"}}.DeepEqual(t)
+	Test{len(opts.sourceReport().Warnings), 1}.Compare(t)
+
+	// The export keeps the changes, so they survive the next conversion
+	b, _ = os.ReadFile("tmp/again.csv")
+	Test{string(b), `path,name,type,new_name,new_type
+index.htm,Overview,Guide,Overview,Guide
+old.htm,Obsolete,Guide,,Guide
+vcl/tform.htm,TForm,Guide,TForm,Class
+`}.Compare(t)
+}
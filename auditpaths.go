@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// badEscapeRE matches a '%' not starting an escape sequence
+var badEscapeRE = regexp.MustCompile(`%(?:[^0-9A-Fa-f]|[0-9A-Fa-f][^0-9A-Fa-f]|[0-9A-Fa-f]?$)`)
+
+// pathProblem is an index path, or the start page, Dash is likely to fail on
+type pathProblem struct {
+	Path    string
+	Problem string
+	// Entries counts the index entries with the path, 0 for the start page
+	Entries int
+}
+
+func (p pathProblem) String() string {
+	if p.Entries == 0 {
+		return fmt.Sprintf("start page %s: %s", p.Path, p.Problem)
+	}
+	return fmt.Sprintf("%s: %s (index entries: %d)", p.Path, p.Problem, p.Entries)
+}
+
+// auditPathsCommand implements the audit-paths subcommand
+func auditPathsCommand(args []string) error {
+	flags := flag.NewFlagSet("audit-paths", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s audit-paths docset\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+
+	problems, err := auditPaths(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d risky paths", len(problems))
+	}
+	fmt.Println("Index paths OK")
+	return nil
+}
+
+// auditPaths reads the index and start page of a finished docset, by this
+// tool or another converter, without modifying it, and returns the paths
+// Dash is likely to fail on: unescaped characters, backslashes, absolute
+// paths, paths leading outside Documents and pages that are missing or
+// differ in case
+func auditPaths(dir string) ([]pathProblem, error) {
+	opts := &Options{Outdir: dir}
+	if !fileExists(opts.DatabasePath()) {
+		return nil, fmt.Errorf("%s has no docSet.dsidx", dir)
+	}
+	db, err := sql.Open(sqliteDriver, "file:"+filepath.ToSlash(opts.DatabasePath())+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Content files by lower-cased path, to tell a page differing in case
+	// from a missing one
+	files := map[string]string{}
+	basePath := opts.ContentPath()
+	err = filepath.WalkDir(basePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files[strings.ToLower(rel)] = rel
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var problems []pathProblem
+	if b, err := os.ReadFile(opts.PlistPath()); err == nil {
+		for _, m := range plistEntryRE.FindAllStringSubmatch(string(b), -1) {
+			if m[1] == "dashIndexFilePath" {
+				start := html.UnescapeString(m[2])
+				if problem := auditPath(start, files); problem != "" {
+					problems = append(problems, pathProblem{Path: start, Problem: problem})
+				}
+			}
+		}
+	}
+
+	rows, err := db.Query("SELECT path, COUNT(*) FROM searchIndex GROUP BY path ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("reading docSet.dsidx: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p string
+		var n int
+		if err := rows.Scan(&p, &n); err != nil {
+			return nil, err
+		}
+		if problem := auditPath(p, files); problem != "" {
+			problems = append(problems, pathProblem{Path: p, Problem: problem, Entries: n})
+		}
+	}
+	return problems, rows.Err()
+}
+
+// auditPath returns what makes an index path risky, or "". Paths with a
+// scheme, such as online pages, are left alone.
+func auditPath(p string, files map[string]string) string {
+	switch {
+	case p == "":
+		return "empty path"
+	case strings.Contains(p, `\`):
+		return "backslash in path"
+	case absPathRE.MatchString(p):
+		return "absolute path"
+	case schemeRE.MatchString(p):
+		return ""
+	case strings.ContainsFunc(p, func(r rune) bool { return r < ' ' || r == ' ' || r == 0x7f }):
+		return "unescaped space or control character"
+	case strings.Count(p, "#") > 1:
+		return "unescaped '#' in path"
+	case strings.Contains(stripFragment(p), "?"):
+		return "unescaped '?' in path"
+	case badEscapeRE.MatchString(stripFragment(p)):
+		return "unescaped '%' in path"
+	}
+	page, err := url.PathUnescape(stripFragment(p))
+	if err != nil {
+		return "invalid escape in path"
+	}
+	if clean := path.Clean(page); clean == ".." || strings.HasPrefix(clean, "../") {
+		return "outside Documents"
+	}
+	page = path.Clean(page)
+	found, ok := files[strings.ToLower(page)]
+	switch {
+	case !ok:
+		return "page is missing"
+	case found != page:
+		return fmt.Sprintf("page is named %s; case-sensitive systems miss it", found)
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestAuditPath(t *testing.T) {
+	files := map[string]string{"test1.htm": "test1.htm", "sub/a b.htm": "sub/a b.htm", "case.htm": "Case.htm"}
+	for _, test := range []struct {
+		path, problem string
+	}{
+		{"test1.htm", ""},
+		{"test1.htm#anchor", ""},
+		{"sub/a%20b.htm", ""},
+		{"https://example.com/x.htm", ""},
+		{"sub/a b.htm", "unescaped space or control character"},
+		{`sub\a%20b.htm`, "backslash in path"},
+		{"/home/me/test1.htm", "absolute path"},
+		{"file:///c:/test1.htm", "absolute path"},
+		{"test1.htm#a#b", "unescaped '#' in path"},
+		{"test1.htm?x", "unescaped '?' in path"},
+		{"100%.htm", "unescaped '%' in path"},
+		{"../test1.htm", "outside Documents"},
+		{"sub/../../x.htm", "outside Documents"},
+		{"missing.htm", "page is missing"},
+		{"case.htm", "page is named Case.htm; case-sensitive systems miss it"},
+		{"", "empty path"},
+	} {
+		Test{test.path + ": " + auditPath(test.path, files), test.path + ": " + test.problem}.Compare(t)
+	}
+}
+
+func TestAuditPaths(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Platform: "sample"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.CreateDatabase()
+	opts.ChooseIndexFile()
+	opts.WritePlist()
+
+	problems, err := auditPaths("tmp/Sample.docset")
+	Test{err, nil}.Compare(t)
+	Test{len(problems), 0}.Compare(t)
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	db.Exec("INSERT INTO searchIndex(name, type, path) VALUES ('A', 'Guide', 'dir\\test1.htm'), ('B', 'Guide', 'dir\\test1.htm'), ('C', 'Guide', '../x.htm')")
+	db.Close()
+	problems, _ = auditPaths("tmp/Sample.docset")
+	Test{len(problems), 2}.Compare(t)
+	if len(problems) == 2 {
+		Test{problems[0].String(), "../x.htm: outside Documents (index entries: 1)"}.Compare(t)
+		Test{problems[1].String(), `dir\test1.htm: backslash in path (index entries: 2)`}.Compare(t)
+	}
+
+	_, err = auditPaths("tmp/None.docset")
+	Test{err.Error(), "tmp/None.docset has no docSet.dsidx"}.Compare(t)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// readManifest returns the input files listed in a manifest file.
+// Blank lines and lines starting with # are ignored; relative paths are
+// resolved against the manifest's directory.
+func readManifest(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	var sources []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		sources = append(sources, line)
+	}
+	return sources, scanner.Err()
+}
+
+// Builds returns one Options per source, each producing its own docset, or
+// a single one under -combine
+func (opts *Options) Builds() ([]*Options, error) {
+	if err := opts.checkFormat(); err != nil {
+		return nil, err
+	}
+	if _, err := opts.extractor(); err != nil {
+		return nil, err
+	}
+	if opts.combined() {
+		if err := opts.checkCombine(); err != nil {
+			return nil, err
+		}
+		return []*Options{opts}, nil
+	}
+	if len(opts.Sources) <= 1 {
+		if err := opts.applySidecar(); err != nil {
+			return nil, err
+		}
+		return splitLanguageBuilds([]*Options{opts})
+	}
+	if strings.HasSuffix(opts.Outdir, ".docset") {
+		return nil, fmt.Errorf("-out must be a directory when converting %d files", len(opts.Sources))
+	}
+	if opts.ExportAnnotations != "" {
+		return nil, fmt.Errorf("-export-annotations needs a single input file")
+	}
+	if opts.Ctags != "" {
+		return nil, fmt.Errorf("-ctags needs a single input file")
+	}
+	if opts.DeepLinks != "" {
+		return nil, fmt.Errorf("-deep-links needs a single input file")
+	}
+	if opts.SourceMap != "" {
+		return nil, fmt.Errorf("-source-map needs a single input file")
+	}
+
+	builds := make([]*Options, 0, len(opts.Sources))
+	seen := map[string]string{}
+	for _, source := range opts.Sources {
+		build := *opts
+		build.SourcePath = source
+		build.Sources = nil
+		if err := build.applySidecar(); err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[build.DocsetPath()]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", prev, source, build.DocsetPath())
+		}
+		seen[build.DocsetPath()] = source
+		builds = append(builds, &build)
+	}
+	return splitLanguageBuilds(builds)
+}
+
+// buildCache holds extraction results shared by the conversions of a batch.
+// Sources with identical content are extracted once into a private directory
+// and copied into every docset that needs them.
+type buildCache struct {
+	temp        *tempRoot
+	dir         string
+	mu          sync.Mutex
+	hashes      map[string]string // source path -> content hash
+	refs        map[string]int    // content hash -> number of builds
+	extractions map[string]*extraction
+}
+
+type extraction struct {
+	done chan struct{}
+	path string
+	err  error
+	// titles holds the titles read while extracting, keyed by paths below
+	// path and thus valid in every copy
+	titles *streamedTitles
+}
+
+// newBuildCache hashes every source so that duplicates can be shared
+func newBuildCache(builds []*Options) (*buildCache, error) {
+	cache := &buildCache{
+		temp:        builds[0].temp,
+		hashes:      map[string]string{},
+		refs:        map[string]int{},
+		extractions: map[string]*extraction{},
+	}
+	for _, build := range builds {
+		// Directories and projects are copied by every build
+		if build.isSourceDir() || build.isProject() {
+			continue
+		}
+		sum, err := fileHash(build.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("hashing %s: %w", build.SourcePath, err)
+		}
+		cache.hashes[build.SourcePath] = sum
+		cache.refs[sum]++
+		build.sourceHash = sum
+	}
+	return cache, nil
+}
+
+// Extract extracts the source of opts into its content path, reusing the
+// result of a previous extraction of identical content when possible
+func (c *buildCache) Extract(opts *Options) error {
+	if c == nil {
+		return opts.ExtractSource()
+	}
+	sum, ok := c.hashes[opts.SourcePath]
+	if !ok || c.refs[sum] < 2 {
+		return opts.ExtractSource()
+	}
+
+	c.mu.Lock()
+	e, ok := c.extractions[sum]
+	if !ok {
+		e = &extraction{done: make(chan struct{})}
+		c.extractions[sum] = e
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		e.path, e.titles, e.err = c.extractShared(opts, sum)
+		close(e.done)
+	}
+	<-e.done
+	if e.err != nil {
+		return e.err
+	}
+	opts.streamed = e.titles.clone()
+	return copyTree(e.path, opts.ContentPath())
+}
+
+// extractShared extracts the source of opts once for every build with the
+// same content, returning where it went and the titles read meanwhile
+func (c *buildCache) extractShared(opts *Options, sum string) (string, *streamedTitles, error) {
+	c.mu.Lock()
+	if c.dir == "" {
+		dir, err := c.temp.Dir("shared")
+		if err != nil {
+			c.mu.Unlock()
+			return "", nil, err
+		}
+		c.dir = dir
+	}
+	c.mu.Unlock()
+
+	shared := *opts
+	shared.Outdir = filepath.Join(c.dir, sum+".docset")
+	if err := shared.CreateDirectory(); err != nil {
+		return "", nil, err
+	}
+	if err := shared.ExtractSource(); err != nil {
+		return "", nil, err
+	}
+	return shared.ContentPath(), shared.streamed, nil
+}
+
+// Close removes shared extraction results
+func (c *buildCache) Close() error {
+	if c == nil || c.dir == "" || c.temp.Keep() {
+		return nil
+	}
+	return os.RemoveAll(c.dir)
+}
+
+// runBuilds converts every build on a pool of jobs workers
+func runBuilds(builds []*Options, jobs int) error {
+	if len(builds) == 1 {
+		return builds[0].Convert(nil)
+	}
+	cache, err := newBuildCache(builds)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	if jobs < 1 {
+		jobs = autoJobs(builds)
+	}
+	queue := make(chan *Options)
+	errs := make([]error, len(builds))
+	index := map[*Options]int{}
+	for i, build := range builds {
+		index[build] = i
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs && i < len(builds); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for build := range queue {
+				log.Printf("Converting %s", build.SourcePath)
+				if err := build.Convert(cache); err != nil {
+					errs[index[build]] = fmt.Errorf("%s: %w", build.SourcePath, err)
+				}
+			}
+		}()
+	}
+	for _, build := range builds {
+		queue <- build
+	}
+	close(queue)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// fileHash returns the hex encoded SHA-256 of a file
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyTree copies the regular files below source into dest
+func copyTree(source, dest string) error {
+	return filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
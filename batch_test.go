@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/manifest.txt", []byte("# docs\nfoo.chm\n\n  /abs/bar.chm  \n"), 0644)
+	sources, err := readManifest("tmp/manifest.txt")
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{sources, []string{filepath.Join("tmp", "foo.chm"), "/abs/bar.chm"}}.DeepEqual(t)
+}
+
+func TestNewOptionsManifest(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/manifest.txt", []byte("/foo/a.chm\n/foo/b.chm\n"), 0644)
+	os.Args = []string{"chm2docset", "-manifest", "tmp/manifest.txt", "-jobs", "3"}
+	opts := NewOptions()
+	for _, test := range []Test{
+		{opts.SourcePath, "/foo/a.chm"},
+		{opts.Jobs, 3},
+		{len(opts.Sources), 2},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestBuilds(t *testing.T) {
+	opts := &Options{
+		Outdir:  "/qux",
+		Sources: []string{"/foo/a.chm", "/bar/b.chm"},
+	}
+	builds, err := opts.Builds()
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{len(builds), 2}.Compare(t)
+	Test{builds[0].DocsetPath(), "/qux/a.docset"}.Compare(t)
+	Test{builds[1].DocsetPath(), "/qux/b.docset"}.Compare(t)
+
+	opts.Sources = []string{"/foo/a.chm", "/bar/a.chm"}
+	if _, err := opts.Builds(); err == nil {
+		t.Errorf("Expected error for colliding outputs")
+	}
+
+	opts.Outdir = "/qux/foo.docset"
+	opts.Sources = []string{"/foo/a.chm", "/bar/b.chm"}
+	if _, err := opts.Builds(); err == nil {
+		t.Errorf("Expected error for docset output with several sources")
+	}
+
+	opts.Outdir = "/qux"
+	opts.SourceMap = "/qux/map.csv"
+	_, err = opts.Builds()
+	Test{err.Error(), "-source-map needs a single input file"}.Compare(t)
+}
+
+func TestBuildCacheSharesExtraction(t *testing.T) {
+	os.MkdirAll("tmp/in", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/in/a.chm", []byte("same"), 0644)
+	os.WriteFile("tmp/in/b.chm", []byte("same"), 0644)
+	useFixtureBin()
+	opts := &Options{Outdir: "tmp/out", Sources: []string{"tmp/in/a.chm", "tmp/in/b.chm"}, Extractor: extractorChmlib}
+	builds, _ := opts.Builds()
+	cache, err := newBuildCache(builds)
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	defer cache.Close()
+	Test{cache.refs[cache.hashes["tmp/in/a.chm"]], 2}.Compare(t)
+	for _, build := range builds {
+		build.CreateDirectory()
+		if err := cache.Extract(build); err != nil {
+			t.Errorf("Expected nil but got %v", err)
+		}
+	}
+	Test{len(cache.extractions), 1}.Compare(t)
+}
+
+func TestBuildCacheSharesTitles(t *testing.T) {
+	os.MkdirAll("tmp/in", 0755)
+	defer cleanTmp()
+	b, _ := os.ReadFile("_fixtures/sample.chm")
+	os.WriteFile("tmp/in/a.chm", b, 0644)
+	os.WriteFile("tmp/in/b.chm", b, 0644)
+	opts := &Options{Outdir: "tmp/out", Sources: []string{"tmp/in/a.chm", "tmp/in/b.chm"}}
+	builds, _ := opts.Builds()
+	cache, _ := newBuildCache(builds)
+	defer cache.Close()
+	for _, build := range builds {
+		build.CreateDirectory()
+		Test{cache.Extract(build), nil}.Compare(t)
+		Test{len(build.streamed.titles), 3}.Compare(t)
+	}
+	// Every build moves its own pages
+	Test{builds[0].streamed != builds[1].streamed, true}.Compare(t)
+}
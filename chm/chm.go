@@ -0,0 +1,284 @@
+// Package chm reads Microsoft Compiled HTML Help (ITSF) files.
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrFormat is returned when the file is not a valid CHM file
+	ErrFormat = errors.New("chm: invalid format")
+	// ErrProtected is returned for files whose content is encrypted or
+	// wrapped by e-book protection and cannot be extracted
+	ErrProtected = errors.New("chm: protected content")
+)
+
+// Storage sections of unprotected files: section 0 and the LZX section 1
+var plainSections = map[string]bool{"uncompressed": true, "mscompressed": true}
+
+// File describes an object stored in a CHM file
+type File struct {
+	Name    string
+	Section int
+	Offset  uint64
+	Length  uint64
+}
+
+// IsDir reports whether the entry is a directory
+func (f File) IsDir() bool {
+	return strings.HasSuffix(f.Name, "/")
+}
+
+// IsContent reports whether the entry is a regular content file, as opposed
+// to a directory or one of the internal #/$ system files. System files sit
+// at the root and, unlike pages such as /#intro.htm, have no extension.
+func (f File) IsContent() bool {
+	if f.IsDir() || !strings.HasPrefix(f.Name, "/") || len(f.Name) < 2 {
+		return false
+	}
+	if f.Name[1] != '#' && f.Name[1] != '$' {
+		return true
+	}
+	top := strings.SplitN(f.Name[1:], "/", 2)[0]
+	return strings.Contains(top, ".")
+}
+
+// Reader gives access to the directory and files of a CHM file
+type Reader struct {
+	r             io.ReaderAt
+	closer        io.Closer
+	Version       uint32
+	LanguageID    uint32
+	contentOffset uint64
+	files         []File
+	byName        map[string]int
+	section1      *lzxSection
+	// size is the size of the file, or -1 if r does not tell
+	size int64
+
+	// MemoryLimit bounds the decompressed data held in memory, in bytes: the
+	// LZX frames kept for reading on and the files read whole while
+	// extracting, larger ones being streamed to disk. 0 means no limit.
+	MemoryLimit int64
+}
+
+// Open opens the named CHM file
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.closer = f
+	return r, nil
+}
+
+// NewReader reads the ITSF headers and directory listing from r
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	hdr := make([]byte, 0x60)
+	n, err := r.ReadAt(hdr, 0)
+	if n < 0x58 {
+		if err == nil || err == io.EOF {
+			err = ErrFormat
+		}
+		return nil, err
+	}
+	switch {
+	case string(hdr[:8]) == "ITOLITLS":
+		return nil, fmt.Errorf("%w: Microsoft Reader (LIT) e-book", ErrProtected)
+	case string(hdr[:2]) == "MZ":
+		return nil, fmt.Errorf("%w: e-book compiled into an executable", ErrProtected)
+	case string(hdr[:4]) != "ITSF":
+		return nil, ErrFormat
+	}
+	c := &Reader{
+		r:          r,
+		Version:    binary.LittleEndian.Uint32(hdr[0x04:]),
+		LanguageID: binary.LittleEndian.Uint32(hdr[0x14:]),
+		byName:     map[string]int{},
+		size:       sizeOf(r),
+	}
+	dirOffset := binary.LittleEndian.Uint64(hdr[0x48:])
+	dirLength := binary.LittleEndian.Uint64(hdr[0x50:])
+	if c.Version >= 3 && n >= 0x60 {
+		c.contentOffset = binary.LittleEndian.Uint64(hdr[0x58:])
+	} else {
+		c.contentOffset = dirOffset + dirLength
+	}
+	if err := c.readDirectory(dirOffset, dirLength); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sizeOf returns the size of the data behind r, or -1
+func sizeOf(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return -1
+}
+
+// readDirectory parses the ITSP header and every PMGL listing chunk
+func (c *Reader) readDirectory(offset, length uint64) error {
+	if length < 0x54 || length > 1<<31 || offset+length < offset {
+		return ErrFormat
+	}
+	// The lengths come from the header; a directory past the end of the
+	// file is rejected before allocating it
+	if c.size >= 0 && offset+length > uint64(c.size) {
+		return ErrFormat
+	}
+	if c.size < 0 {
+		if _, err := c.r.ReadAt(make([]byte, 1), int64(offset+length-1)); err != nil {
+			return ErrFormat
+		}
+	}
+	dir := make([]byte, length)
+	if n, err := c.r.ReadAt(dir, int64(offset)); n < len(dir) {
+		if err == nil || err == io.EOF {
+			err = ErrFormat
+		}
+		return err
+	}
+	if string(dir[:4]) != "ITSP" {
+		return ErrFormat
+	}
+	headerLen := binary.LittleEndian.Uint32(dir[0x08:])
+	chunkSize := binary.LittleEndian.Uint32(dir[0x10:])
+	numChunks := binary.LittleEndian.Uint32(dir[0x2c:])
+	if chunkSize < 0x14 || uint64(headerLen)+uint64(chunkSize)*uint64(numChunks) > length {
+		return ErrFormat
+	}
+
+	for i := uint32(0); i < numChunks; i++ {
+		start := headerLen + i*chunkSize
+		chunk := dir[start : start+chunkSize]
+		if string(chunk[:4]) != "PMGL" {
+			continue
+		}
+		free := binary.LittleEndian.Uint32(chunk[0x04:])
+		if free > chunkSize-0x14 {
+			return ErrFormat
+		}
+		if err := c.readListing(chunk[0x14 : chunkSize-free]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Reader) readListing(b []byte) error {
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		nameLen, err := readEncint(r)
+		if err != nil {
+			return err
+		}
+		if nameLen == 0 || nameLen > uint64(r.Len()) {
+			return ErrFormat
+		}
+		name := make([]byte, nameLen)
+		io.ReadFull(r, name)
+		section, err := readEncint(r)
+		if err != nil {
+			return err
+		}
+		offset, err := readEncint(r)
+		if err != nil {
+			return err
+		}
+		length, err := readEncint(r)
+		if err != nil {
+			return err
+		}
+		c.byName[strings.ToLower(string(name))] = len(c.files)
+		c.files = append(c.files, File{
+			Name:    string(name),
+			Section: int(section),
+			Offset:  offset,
+			Length:  length,
+		})
+	}
+	return nil
+}
+
+// readEncint reads a big-endian 7-bit variable length integer
+func readEncint(r io.ByteReader) (uint64, error) {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, ErrFormat
+		}
+		v = v<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, ErrFormat
+}
+
+// Protection describes the DRM or encryption markers found in the directory,
+// or returns "" if there are none. Protected files have storage sections
+// besides the uncompressed and LZX ones, or DRM storage.
+func (c *Reader) Protection() string {
+	for _, f := range c.files {
+		name := strings.ToLower(f.Name)
+		if strings.HasPrefix(name, "/drmstorage/") || !f.IsContent() && strings.Contains(name, "drm") {
+			return fmt.Sprintf("DRM storage %s", f.Name)
+		}
+		if section, ok := strings.CutPrefix(name, "::dataspace/storage/"); ok {
+			section, _, _ = strings.Cut(section, "/")
+			if section != "" && !plainSections[section] {
+				return fmt.Sprintf("content section %q with an unknown transform", section)
+			}
+		}
+		if f.Section > 1 {
+			return fmt.Sprintf("%s stored in content section %d", f.Name, f.Section)
+		}
+	}
+	return ""
+}
+
+// Files returns every directory entry sorted by name
+func (c *Reader) Files() []File {
+	files := make([]File, len(c.files))
+	copy(files, c.files)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// Stat looks up an entry by name; lookups are case-insensitive like the
+// HTML Help viewer's
+func (c *Reader) Stat(name string) (File, bool) {
+	i, ok := c.byName[strings.ToLower(name)]
+	if !ok {
+		return File{}, false
+	}
+	return c.files[i], true
+}
+
+// Close closes the underlying file if the reader was created by Open
+func (c *Reader) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
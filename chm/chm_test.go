@@ -0,0 +1,334 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// encint encodes v as a big-endian 7-bit variable length integer.
+func encint(v uint64) []byte {
+	b := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+// buildCHM returns an ITSF v3 image storing files uncompressed in section 0.
+func buildCHM(files map[string][]byte) []byte {
+	return buildCHMSections(files, nil)
+}
+
+// buildCHMSections returns an ITSF v3 image storing files in section 0 and
+// listing the entries of other sections as given.
+func buildCHMSections(files map[string][]byte, listed map[string]File) []byte {
+	const chunkSize = 0x1000
+	names := make([]string, 0, len(files)+len(listed))
+	for name := range files {
+		names = append(names, name)
+	}
+	for name := range listed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var content bytes.Buffer
+	var chunks [][]byte
+	var entries bytes.Buffer
+	flush := func() {
+		chunk := make([]byte, chunkSize)
+		copy(chunk, "PMGL")
+		binary.LittleEndian.PutUint32(chunk[4:], uint32(chunkSize-0x14-entries.Len()))
+		copy(chunk[0x14:], entries.Bytes())
+		chunks = append(chunks, chunk)
+		entries.Reset()
+	}
+	for _, name := range names {
+		var e bytes.Buffer
+		e.Write(encint(uint64(len(name))))
+		e.WriteString(name)
+		if f, ok := listed[name]; ok {
+			e.Write(encint(uint64(f.Section)))
+			e.Write(encint(f.Offset))
+			e.Write(encint(f.Length))
+		} else {
+			e.Write(encint(0))
+			e.Write(encint(uint64(content.Len())))
+			e.Write(encint(uint64(len(files[name]))))
+		}
+		if entries.Len()+e.Len() > chunkSize-0x14 {
+			flush()
+		}
+		entries.Write(e.Bytes())
+		content.Write(files[name])
+	}
+	flush()
+
+	dir := make([]byte, 0x54)
+	copy(dir, "ITSP")
+	binary.LittleEndian.PutUint32(dir[0x04:], 1)
+	binary.LittleEndian.PutUint32(dir[0x08:], 0x54)
+	binary.LittleEndian.PutUint32(dir[0x10:], chunkSize)
+	binary.LittleEndian.PutUint32(dir[0x14:], 2)
+	binary.LittleEndian.PutUint32(dir[0x18:], 1)
+	binary.LittleEndian.PutUint32(dir[0x1c:], 0xffffffff)
+	binary.LittleEndian.PutUint32(dir[0x24:], uint32(len(chunks)-1))
+	binary.LittleEndian.PutUint32(dir[0x2c:], uint32(len(chunks)))
+	for _, chunk := range chunks {
+		dir = append(dir, chunk...)
+	}
+
+	hdr := make([]byte, 0x60)
+	copy(hdr, "ITSF")
+	binary.LittleEndian.PutUint32(hdr[0x04:], 3)
+	binary.LittleEndian.PutUint32(hdr[0x08:], 0x60)
+	binary.LittleEndian.PutUint32(hdr[0x14:], 0x409)
+	dirOffset := uint64(len(hdr))
+	binary.LittleEndian.PutUint64(hdr[0x48:], dirOffset)
+	binary.LittleEndian.PutUint64(hdr[0x50:], uint64(len(dir)))
+	binary.LittleEndian.PutUint64(hdr[0x58:], dirOffset+uint64(len(dir)))
+
+	out := append(hdr, dir...)
+	return append(out, content.Bytes()...)
+}
+
+func TestReaderFiles(t *testing.T) {
+	image := buildCHM(map[string][]byte{
+		"/index.htm":     []byte("<html></html>"),
+		"/sub/":          nil,
+		"/sub/page.htm":  []byte("page"),
+		"/#SYSTEM":       []byte{0, 0, 0, 0},
+		"::DataSpace/Na": []byte{1},
+	})
+	r, err := NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	var names []string
+	var content []string
+	for _, f := range r.Files() {
+		names = append(names, f.Name)
+		if f.IsContent() {
+			content = append(content, f.Name)
+		}
+	}
+	if want := []string{"/#SYSTEM", "/index.htm", "/sub/", "/sub/page.htm", "::DataSpace/Na"}; !equal(names, want) {
+		t.Errorf(`Expected "%v" but got "%v"`, want, names)
+	}
+	if want := []string{"/index.htm", "/sub/page.htm"}; !equal(content, want) {
+		t.Errorf(`Expected "%v" but got "%v"`, want, content)
+	}
+	if r.LanguageID != 0x409 {
+		t.Errorf(`Expected "%v" but got "%v"`, 0x409, r.LanguageID)
+	}
+	f, ok := r.Stat("/SUB/Page.htm")
+	if !ok || f.Length != 4 || f.Section != 0 {
+		t.Errorf("Expected case-insensitive lookup but got %v %v", f, ok)
+	}
+}
+
+func TestReaderManyChunks(t *testing.T) {
+	files := map[string][]byte{}
+	for i := 0; i < 500; i++ {
+		files["/dir/a-rather-long-file-name-to-fill-chunks-"+string(rune('a'+i%26))+string(rune('a'+i/26))+".htm"] = []byte("x")
+	}
+	r, err := NewReader(bytes.NewReader(buildCHM(files)))
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	if len(r.Files()) != 500 {
+		t.Errorf(`Expected "%v" but got "%v"`, 500, len(r.Files()))
+	}
+}
+
+func TestReaderInvalid(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a chm file at all"))); err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+	image := buildCHM(map[string][]byte{"/a.htm": nil})
+	copy(image, "XXXX")
+	if _, err := NewReader(bytes.NewReader(image)); err != ErrFormat {
+		t.Errorf(`Expected "%v" but got "%v"`, ErrFormat, err)
+	}
+}
+
+// readerAtOnly hides the Size method of the reader it wraps
+type readerAtOnly struct{ r *bytes.Reader }
+
+func (r readerAtOnly) ReadAt(p []byte, off int64) (int, error) { return r.r.ReadAt(p, off) }
+
+func TestReaderOversized(t *testing.T) {
+	image := buildCHM(map[string][]byte{"/a.htm": []byte("a")})
+	// A directory claiming to be 1 GB long, past the end of the file
+	binary.LittleEndian.PutUint64(image[0x50:], 1<<30)
+	for _, r := range []io.ReaderAt{bytes.NewReader(image), readerAtOnly{bytes.NewReader(image)}} {
+		if _, err := NewReader(r); err != ErrFormat {
+			t.Errorf(`Expected "%v" but got "%v"`, ErrFormat, err)
+		}
+	}
+
+	// A file claiming to be 1 GB long is read as far as the file goes
+	image = buildCHMSections(map[string][]byte{"/a.htm": []byte("a")}, map[string]File{"/big.htm": {Section: 0, Length: 1 << 30}})
+	r, err := NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := r.ReadFile("/big.htm"); !errors.Is(err, ErrFormat) {
+		t.Errorf(`Expected "%v" but got "%v"`, ErrFormat, err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Expected at most 1 MB allocated but got %d bytes", allocated)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var update = flag.Bool("update", false, "rewrite fixture files under _fixtures")
+
+// TestUpdateFixtures regenerates the CHM fixtures used by the command tests.
+func TestUpdateFixtures(t *testing.T) {
+	if !*update {
+		t.Skip("run with -update to regenerate fixtures")
+	}
+	image := buildCHM(map[string][]byte{
+		"/index.htm": []byte(`<html><head><title>Index</title></head><body>
+<a href="page.htm">page</a>
+<a href="sub/lost.htm#top">lost</a>
+<a href="missing.htm">missing</a>
+<a href="http://example.com/">external</a>
+<img src="img/logo.gif">
+</body></html>`),
+		"/page.htm":     []byte(`<html><head><title>Page</title></head><body><a href="index.htm">back</a></body></html>`),
+		"/sub/":         nil,
+		"/sub/lost.htm": []byte(`<html><head><title>Lost</title></head><body><a href="../page.htm">up</a></body></html>`),
+		"/img/":         nil,
+		"/img/logo.gif": []byte("GIF89a"),
+		"/#SYSTEM": systemRecords(map[uint16][]byte{
+			systemDefaultTopic: []byte("page.htm\x00"),
+			systemTitle:        []byte("Sample \xc4nderungen\x00"),
+		}),
+	})
+	if err := os.WriteFile("../_fixtures/sample.chm", image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	image = buildCHM(map[string][]byte{
+		"/en/":           nil,
+		"/en/index.htm":  []byte(`<html><head><title>Welcome</title></head><body><img src="../img/logo.gif">This is the manual of the product and its tools.</body></html>`),
+		"/en/setup.htm":  []byte(`<html><head><title>Setup</title></head><body>Install the tools with the setup program.</body></html>`),
+		"/de/":           nil,
+		"/de/index.htm":  []byte(`<html><head><title>Willkommen</title></head><body><img src="../img/logo.gif">Das ist die Anleitung und sie wird nicht mit der Software geliefert.</body></html>`),
+		"/1036/":         nil,
+		"/1036/page.htm": []byte(`<html><head><title>Accueil</title></head><body>Bonjour</body></html>`),
+		"/img/":          nil,
+		"/img/logo.gif":  []byte("GIF89a"),
+		"/#SYSTEM": systemRecords(map[uint16][]byte{
+			systemDefaultTopic: []byte("en/index.htm\x00"),
+			systemTitle:        []byte("Product\x00"),
+		}),
+	})
+	if err := os.WriteFile("../_fixtures/multilang.chm", image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A master CHM merging the contents of a child CHM beside it
+	if err := os.MkdirAll("../_fixtures/merged", 0755); err != nil {
+		t.Fatal(err)
+	}
+	image = buildCHM(map[string][]byte{
+		"/index.htm": []byte(`<html><head><title>Suite</title></head><body><a href="ms-its:Child.chm::/topics/open.htm#usage">open</a> <a href="mk:@MSITStore:missing.chm::/a.htm">missing</a></body></html>`),
+		"/master.hhc": []byte(`<html><body><ul>
+<li><object type="text/sitemap"><param name="Name" value="Suite"><param name="Local" value="index.htm"></object>
+<object type="text/sitemap"><param name="Merge" value="child.chm::/child.hhc"></object>
+<object type="text/sitemap"><param name="Merge" value="missing.chm::/missing.hhc"></object>
+</ul></body></html>`),
+	})
+	if err := os.WriteFile("../_fixtures/merged/master.chm", image, 0644); err != nil {
+		t.Fatal(err)
+	}
+	image = buildCHM(map[string][]byte{
+		"/topics/":         nil,
+		"/topics/open.htm": []byte(`<html><head><title>Open</title></head><body><a href="ms-its:master.chm::/index.htm">suite</a></body></html>`),
+		"/child.hhc": []byte(`<html><body><ul>
+<li><object type="text/sitemap"><param name="Name" value="Open"><param name="Local" value="topics/open.htm"></object>
+</ul></body></html>`),
+		"/child.hhk": []byte(`<html><body><ul>
+<li><object type="text/sitemap"><param name="Name" value="open"><param name="Local" value="/topics/open.htm"></object>
+</ul></body></html>`),
+	})
+	if err := os.WriteFile("../_fixtures/merged/Child.chm", image, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileIsContent(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content bool
+	}{
+		{"/#SYSTEM", false},
+		{"/$FIftiMain", false},
+		{"/$WWKeywordLinks/Property", false},
+		{"/#intro.htm", true},
+		{"/sub/#notes.htm", true},
+		{"/lang/C#.htm", true},
+		{"/sub/", false},
+		{"::DataSpace/Na", false},
+	} {
+		if got := (File{Name: test.name}).IsContent(); got != test.content {
+			t.Errorf(`Expected "%v" but got "%v" for %s`, test.content, got, test.name)
+		}
+	}
+}
+
+func TestReaderProtection(t *testing.T) {
+	for _, test := range []struct {
+		files      []string
+		protection string
+	}{
+		{[]string{"/index.htm", "/hydrmechanics.htm", "::DataSpace/Storage/MSCompressed/Content"}, ""},
+		{[]string{"/index.htm", "::DataSpace/Storage/Encrypted/Content"}, `content section "encrypted" with an unknown transform`},
+		{[]string{"/index.htm", "/DRMStorage/DRMSealed"}, "DRM storage /DRMStorage/DRMSealed"},
+	} {
+		files := map[string][]byte{}
+		for _, name := range test.files {
+			files[name] = []byte("x")
+		}
+		r, err := NewReader(bytes.NewReader(buildCHM(files)))
+		if err != nil {
+			t.Fatalf("Expected nil but got %v", err)
+		}
+		if got := r.Protection(); got != test.protection {
+			t.Errorf(`Expected "%v" but got "%v"`, test.protection, got)
+		}
+	}
+
+	for _, image := range [][]byte{
+		append([]byte("ITOLITLS"), make([]byte, 0x60)...),
+		append([]byte("MZ"), make([]byte, 0x60)...),
+	} {
+		if _, err := NewReader(bytes.NewReader(image)); !errors.Is(err, ErrProtected) {
+			t.Errorf(`Expected "%v" but got "%v"`, ErrProtected, err)
+		}
+	}
+}
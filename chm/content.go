@@ -0,0 +1,324 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Internal files describing the LZX-compressed content section 1
+const (
+	compressedContent = "::DataSpace/Storage/MSCompressed/Content"
+	compressedControl = "::DataSpace/Storage/MSCompressed/ControlData"
+	compressedResets  = "::DataSpace/Storage/MSCompressed/Transform/{7FC28940-9D31-11D0-9B27-00A0C91E9C7C}/InstanceData/ResetTable"
+)
+
+// lzxSection decodes content section 1. The frames decoded since the last
+// reset are kept, as files are usually read in offset order, up to the
+// MemoryLimit of the reader: older frames are dropped then and decoded
+// again from the reset should they be needed.
+type lzxSection struct {
+	content        File
+	frameLen       uint64
+	length         uint64
+	compressedLen  uint64
+	resets         []uint64 // compressed offset of every frame
+	framesPerReset int
+	decoder        *lzxDecoder
+
+	group  int
+	frames [][]byte
+	// base is the index in the group of frames[0], cached the length of
+	// frames in bytes
+	base   int
+	cached int64
+}
+
+// ReadFile returns the content of a file stored in section 0 or 1
+func (c *Reader) ReadFile(name string) ([]byte, error) {
+	f, ok := c.Stat(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return c.read(f)
+}
+
+// Copy writes the content of a file to w and returns its length. Unlike
+// ReadFile it does not hold the whole file in memory, so that files of any
+// size can be read under a MemoryLimit.
+func (c *Reader) Copy(w io.Writer, name string) (int64, error) {
+	f, ok := c.Stat(name)
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return c.copy(w, f)
+}
+
+func (c *Reader) read(f File) ([]byte, error) {
+	if f.Length > 1<<31 {
+		return nil, ErrFormat
+	}
+	var b bytes.Buffer
+	// The length comes from the directory; the buffer grows beyond what
+	// the section can hold only as data really arrives
+	b.Grow(int(min(f.Length, c.available(f))))
+	if _, err := c.copy(&b, f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// available returns the most bytes the section of f can hold from its
+// offset on, to bound buffers sized by the length the directory gives, or 0
+// if that is not known
+func (c *Reader) available(f File) uint64 {
+	var end uint64
+	switch f.Section {
+	case 0:
+		if c.size >= 0 {
+			end = uint64(c.size) - min(c.contentOffset, uint64(c.size))
+		}
+	case 1:
+		if s, err := c.lzx(); err == nil {
+			// Every frame decodes to at most frameLen bytes
+			end = uint64(len(s.resets)) * s.frameLen
+		}
+	}
+	if f.Offset >= end {
+		return 0
+	}
+	return end - f.Offset
+}
+
+// lzx returns the LZX section, opening it on first use
+func (c *Reader) lzx() (*lzxSection, error) {
+	if c.section1 == nil {
+		s, err := c.openLZXSection()
+		if err != nil {
+			return nil, err
+		}
+		c.section1 = s
+	}
+	return c.section1, nil
+}
+
+func (c *Reader) copy(w io.Writer, f File) (int64, error) {
+	switch f.Section {
+	case 0:
+		n, err := io.Copy(w, io.NewSectionReader(c.r, int64(c.contentOffset+f.Offset), int64(f.Length)))
+		if err == nil && uint64(n) != f.Length {
+			err = fmt.Errorf("%w: %s is truncated", ErrFormat, f.Name)
+		}
+		return n, err
+	case 1:
+		s, err := c.lzx()
+		if err != nil {
+			return 0, err
+		}
+		return s.copy(c, w, f.Offset, f.Length)
+	}
+	return 0, fmt.Errorf("%w: %s is stored in content section %d", ErrProtected, f.Name, f.Section)
+}
+
+// openLZXSection reads the LZX parameters and the reset table
+func (c *Reader) openLZXSection() (*lzxSection, error) {
+	content, ok := c.Stat(compressedContent)
+	if !ok || content.Section != 0 {
+		return nil, fmt.Errorf("%w: no compressed content", ErrFormat)
+	}
+	control, err := c.ReadFile(compressedControl)
+	if err != nil {
+		return nil, err
+	}
+	if len(control) < 0x18 || string(control[4:8]) != "LZXC" {
+		return nil, fmt.Errorf("%w: invalid LZX control data", ErrFormat)
+	}
+	version := binary.LittleEndian.Uint32(control[0x08:])
+	resetInterval := uint64(binary.LittleEndian.Uint32(control[0x0c:]))
+	windowSize := uint64(binary.LittleEndian.Uint32(control[0x10:]))
+	if version == 2 {
+		resetInterval *= 0x8000
+		windowSize *= 0x8000
+	}
+	windowBits := uint(bits.TrailingZeros64(windowSize))
+	if windowSize == 0 || windowSize&(windowSize-1) != 0 || windowBits < 15 || windowBits > 21 {
+		return nil, fmt.Errorf("%w: unsupported LZX window of %d bytes", ErrFormat, windowSize)
+	}
+
+	table, err := c.ReadFile(compressedResets)
+	if err != nil {
+		return nil, err
+	}
+	if len(table) < 0x28 {
+		return nil, fmt.Errorf("%w: invalid LZX reset table", ErrFormat)
+	}
+	count := uint64(binary.LittleEndian.Uint32(table[0x04:]))
+	entrySize := uint64(binary.LittleEndian.Uint32(table[0x08:]))
+	tableOffset := uint64(binary.LittleEndian.Uint32(table[0x0c:]))
+	s := &lzxSection{
+		content:       content,
+		length:        binary.LittleEndian.Uint64(table[0x10:]),
+		compressedLen: binary.LittleEndian.Uint64(table[0x18:]),
+		frameLen:      binary.LittleEndian.Uint64(table[0x20:]),
+		decoder:       newLZXDecoder(windowBits),
+		group:         -1,
+	}
+	if entrySize != 8 || tableOffset+count*8 > uint64(len(table)) || s.frameLen == 0 || s.frameLen > windowSize {
+		return nil, fmt.Errorf("%w: invalid LZX reset table", ErrFormat)
+	}
+	for i := uint64(0); i < count; i++ {
+		s.resets = append(s.resets, binary.LittleEndian.Uint64(table[tableOffset+i*8:]))
+	}
+	s.framesPerReset = max(int(resetInterval/s.frameLen), 1)
+	return s, nil
+}
+
+// copy writes length bytes at offset of the decompressed section to w,
+// a frame at a time
+func (s *lzxSection) copy(c *Reader, w io.Writer, offset, length uint64) (int64, error) {
+	if offset+length > s.length || offset+length < offset {
+		return 0, fmt.Errorf("%w: file past the end of the compressed section", ErrFormat)
+	}
+	var written int64
+	for pos := offset; pos < offset+length; {
+		i := int(pos / s.frameLen)
+		frame, err := s.frame(c, i)
+		if err != nil {
+			return written, err
+		}
+		start := pos - uint64(i)*s.frameLen
+		end := min(uint64(len(frame)), start+offset+length-pos)
+		n, err := w.Write(frame[start:end])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		pos += end - start
+	}
+	return written, nil
+}
+
+// frame decodes frame i, starting from the last reset before it
+func (s *lzxSection) frame(c *Reader, i int) ([]byte, error) {
+	if i >= len(s.resets) {
+		return nil, fmt.Errorf("%w: frame %d missing from the reset table", ErrFormat, i)
+	}
+	group := i / s.framesPerReset
+	index := i - group*s.framesPerReset
+	if group != s.group || index < s.base {
+		// Frames dropped from the cache are decoded again from the reset
+		s.decoder.reset()
+		s.group, s.frames, s.base, s.cached = group, nil, 0, 0
+	}
+	for first := group * s.framesPerReset; first+s.base+len(s.frames) <= i; {
+		n := first + s.base + len(s.frames)
+		start := s.resets[n]
+		end := s.compressedLen
+		if n+1 < len(s.resets) {
+			end = s.resets[n+1]
+		}
+		if end < start || end > s.content.Length {
+			return nil, fmt.Errorf("%w: invalid LZX reset table", ErrFormat)
+		}
+		in := make([]byte, end-start)
+		if _, err := c.r.ReadAt(in, int64(c.contentOffset+s.content.Offset+start)); err != nil && err != io.EOF {
+			return nil, err
+		}
+		outLen := min(s.frameLen, s.length-uint64(n)*s.frameLen)
+		frame, err := s.decoder.decodeFrame(in, int(outLen))
+		if err != nil {
+			s.group = -1
+			return nil, fmt.Errorf("frame %d: %w", n, err)
+		}
+		s.frames = append(s.frames, frame)
+		s.cached += int64(len(frame))
+		for c.MemoryLimit > 0 && s.cached > c.MemoryLimit && len(s.frames) > 1 {
+			s.cached -= int64(len(s.frames[0]))
+			s.frames[0] = nil
+			s.frames, s.base = s.frames[1:], s.base+1
+		}
+	}
+	return s.frames[index-s.base], nil
+}
+
+// Extract writes every content file below dir and returns their number.
+// Names climbing out of dir are skipped.
+func (c *Reader) Extract(dir string) (int, error) {
+	return c.ExtractMatching(dir, nil)
+}
+
+// ExtractMatching is like Extract but writes only the content files whose
+// name, without the leading slash, keep reports true for. A nil keep
+// writes every file.
+func (c *Reader) ExtractMatching(dir string, keep func(name string) bool) (int, error) {
+	return c.ExtractEach(dir, keep, nil)
+}
+
+// ExtractEach is like ExtractMatching and also passes the name and content
+// of every file written to visit, so that callers can scan the files while
+// they are in memory rather than reading them back. A nil visit is ignored,
+// as are files larger than MemoryLimit.
+func (c *Reader) ExtractEach(dir string, keep func(name string) bool, visit func(name string, b []byte)) (int, error) {
+	files := c.Files()
+	// Reading in offset order decodes every compressed frame once
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Section != files[j].Section {
+			return files[i].Section < files[j].Section
+		}
+		return files[i].Offset < files[j].Offset
+	})
+	count := 0
+	for _, f := range files {
+		if !f.IsContent() {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(f.Name, "/"))
+		if !filepath.IsLocal(filepath.FromSlash(rel)) || keep != nil && !keep(rel) {
+			continue
+		}
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return count, err
+		}
+		if c.MemoryLimit > 0 && f.Length > uint64(c.MemoryLimit) {
+			// Too large to hold, so streamed and not visited
+			if err := c.writeFile(p, f); err != nil {
+				return count, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			count++
+			continue
+		}
+		b, err := c.read(f)
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			return count, err
+		}
+		if visit != nil {
+			visit(rel, b)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// writeFile streams the content of f into the file p
+func (c *Reader) writeFile(p string, f File) error {
+	out, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := c.copy(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,441 @@
+package chm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LZX as used by the MSCompressed section of CHM files. Output is produced
+// in frames of 0x8000 bytes, each decoded from the compressed bytes listed
+// in the reset table; the decoder state carries over between frames until
+// the next reset.
+
+const (
+	lzxMinMatch        = 2
+	lzxNumChars        = 256
+	lzxPretreeSize     = 20
+	lzxAlignedSize     = 8
+	lzxNumPrimaryLens  = 7
+	lzxLengthTreeSize  = 249
+	lzxMaxCodeLen      = 16
+	lzxBlockVerbatim   = 1
+	lzxBlockAligned    = 2
+	lzxBlockUncompress = 3
+)
+
+var lzxExtraBits, lzxPositionBase [51]uint32
+
+func init() {
+	j := uint32(0)
+	for i := 0; i < 51; i += 2 {
+		lzxExtraBits[i] = j
+		if i+1 < 51 {
+			lzxExtraBits[i+1] = j
+		}
+		if i != 0 && j < 17 {
+			j++
+		}
+	}
+	j = 0
+	for i := range lzxPositionBase {
+		lzxPositionBase[i] = j
+		j += 1 << lzxExtraBits[i]
+	}
+}
+
+// lzxPositionSlots returns the number of position slots for a window
+func lzxPositionSlots(windowBits uint) int {
+	switch {
+	case windowBits == 20:
+		return 42
+	case windowBits == 21:
+		return 50
+	default:
+		return int(windowBits) * 2
+	}
+}
+
+// bitReader reads the LZX bit stream: 16-bit little-endian words consumed
+// from the most significant bit. Reading past the end yields zeros.
+type bitReader struct {
+	in   []byte
+	pos  int
+	buf  uint64
+	bits uint
+}
+
+func (b *bitReader) ensure(n uint) {
+	for b.bits < n {
+		var w uint64
+		if b.pos+1 < len(b.in) {
+			w = uint64(binary.LittleEndian.Uint16(b.in[b.pos:]))
+		}
+		b.pos += 2
+		b.buf |= w << (48 - b.bits)
+		b.bits += 16
+	}
+}
+
+func (b *bitReader) peek(n uint) uint32 {
+	b.ensure(n)
+	return uint32(b.buf >> (64 - n))
+}
+
+func (b *bitReader) remove(n uint) {
+	b.buf <<= n
+	b.bits -= n
+}
+
+func (b *bitReader) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	v := b.peek(n)
+	b.remove(n)
+	return v
+}
+
+// align drops the rest of the current word, or the next word if the stream
+// is aligned, as required before the header of an uncompressed block
+func (b *bitReader) align() {
+	if b.bits == 0 {
+		b.pos += 2
+	}
+	b.buf, b.bits = 0, 0
+}
+
+// huffman is a canonical Huffman code decoded by table lookup
+type huffman struct {
+	bits  uint
+	table []uint32 // symbol<<8 | code length, 0 for unused codes
+}
+
+// build assigns canonical codes to the code lengths. Incomplete codes are
+// accepted; decoding an unassigned code fails.
+func (h *huffman) build(lens []uint8) error {
+	h.bits = 0
+	for _, l := range lens {
+		h.bits = max(h.bits, uint(l))
+	}
+	size := 1 << h.bits
+	if cap(h.table) >= size {
+		h.table = h.table[:size]
+		clear(h.table)
+	} else {
+		h.table = make([]uint32, size)
+	}
+	code := 0
+	for l := uint(1); l <= h.bits; l++ {
+		for sym, sl := range lens {
+			if uint(sl) != l {
+				continue
+			}
+			span := 1 << (h.bits - l)
+			start := code << (h.bits - l)
+			if start+span > size {
+				return fmt.Errorf("%w: over-subscribed Huffman code", ErrFormat)
+			}
+			for i := start; i < start+span; i++ {
+				h.table[i] = uint32(sym)<<8 | uint32(l)
+			}
+			code++
+		}
+		code <<= 1
+	}
+	return nil
+}
+
+func (h *huffman) decode(b *bitReader) (int, error) {
+	if h.bits == 0 {
+		return 0, fmt.Errorf("%w: empty Huffman code", ErrFormat)
+	}
+	e := h.table[b.peek(h.bits)]
+	if e == 0 {
+		return 0, fmt.Errorf("%w: invalid Huffman code", ErrFormat)
+	}
+	b.remove(uint(e & 0xff))
+	return int(e >> 8), nil
+}
+
+// lzxDecoder holds the state carried between the frames of a reset interval
+type lzxDecoder struct {
+	window     []byte
+	windowPos  int
+	mainSize   int
+	r          [3]uint32
+	headerRead bool
+
+	blockType      int
+	blockLength    int
+	blockRemaining int
+
+	mainLens, lengthLens, pretreeLens, alignedLens []uint8
+	main, length, pretree, aligned                 huffman
+
+	intelStarted  bool
+	intelFileSize int32
+	intelCurPos   int32
+	framesRead    int
+}
+
+func newLZXDecoder(windowBits uint) *lzxDecoder {
+	d := &lzxDecoder{
+		window:      make([]byte, 1<<windowBits),
+		mainSize:    lzxNumChars + lzxPositionSlots(windowBits)*8,
+		pretreeLens: make([]uint8, lzxPretreeSize),
+		alignedLens: make([]uint8, lzxAlignedSize),
+	}
+	d.mainLens = make([]uint8, d.mainSize)
+	d.lengthLens = make([]uint8, lzxLengthTreeSize)
+	d.reset()
+	return d
+}
+
+// reset starts a new reset interval
+func (d *lzxDecoder) reset() {
+	d.r = [3]uint32{1, 1, 1}
+	d.headerRead = false
+	d.blockType, d.blockLength, d.blockRemaining = 0, 0, 0
+	d.intelStarted, d.intelCurPos, d.framesRead = false, 0, 0
+	d.windowPos = 0
+	clear(d.mainLens)
+	clear(d.lengthLens)
+}
+
+// readLengths updates lens[first:last] from the pretree-coded deltas
+func (d *lzxDecoder) readLengths(b *bitReader, lens []uint8, first, last int) error {
+	for i := range d.pretreeLens {
+		d.pretreeLens[i] = uint8(b.read(4))
+	}
+	if err := d.pretree.build(d.pretreeLens); err != nil {
+		return err
+	}
+	delta := func(x, z int) uint8 {
+		z = int(lens[x]) - z
+		if z < 0 {
+			z += 17
+		}
+		return uint8(z)
+	}
+	for x := first; x < last; {
+		z, err := d.pretree.decode(b)
+		if err != nil {
+			return err
+		}
+		run, value := 1, uint8(0)
+		switch z {
+		case 17:
+			run = int(b.read(4)) + 4
+		case 18:
+			run = int(b.read(5)) + 20
+		case 19:
+			run = int(b.read(1)) + 4
+			if z, err = d.pretree.decode(b); err != nil {
+				return err
+			}
+			value = delta(x, z)
+		default:
+			value = delta(x, z)
+		}
+		for run = min(run, last-x); run > 0; run-- {
+			lens[x] = value
+			x++
+		}
+	}
+	return nil
+}
+
+// readBlockHeader starts the next block
+func (d *lzxDecoder) readBlockHeader(b *bitReader) error {
+	if d.blockType == lzxBlockUncompress {
+		if d.blockLength&1 != 0 {
+			b.pos++
+		}
+		b.buf, b.bits = 0, 0
+	}
+	d.blockType = int(b.read(3))
+	d.blockLength = int(b.read(16))<<8 | int(b.read(8))
+	d.blockRemaining = d.blockLength
+
+	switch d.blockType {
+	case lzxBlockAligned:
+		for i := range d.alignedLens {
+			d.alignedLens[i] = uint8(b.read(3))
+		}
+		if err := d.aligned.build(d.alignedLens); err != nil {
+			return err
+		}
+		fallthrough
+	case lzxBlockVerbatim:
+		if err := d.readLengths(b, d.mainLens, 0, lzxNumChars); err != nil {
+			return err
+		}
+		if err := d.readLengths(b, d.mainLens, lzxNumChars, d.mainSize); err != nil {
+			return err
+		}
+		if err := d.main.build(d.mainLens); err != nil {
+			return err
+		}
+		if d.mainLens[0xe8] != 0 {
+			d.intelStarted = true
+		}
+		if err := d.readLengths(b, d.lengthLens, 0, lzxLengthTreeSize); err != nil {
+			return err
+		}
+		return d.length.build(d.lengthLens)
+	case lzxBlockUncompress:
+		d.intelStarted = true
+		b.align()
+		if b.pos+12 > len(b.in) {
+			return fmt.Errorf("%w: truncated LZX block", ErrFormat)
+		}
+		for i := range d.r {
+			d.r[i] = binary.LittleEndian.Uint32(b.in[b.pos+4*i:])
+		}
+		b.pos += 12
+		return nil
+	}
+	return fmt.Errorf("%w: unknown LZX block type %d", ErrFormat, d.blockType)
+}
+
+// decodeFrame decodes outLen bytes from the compressed bytes of a frame
+func (d *lzxDecoder) decodeFrame(in []byte, outLen int) ([]byte, error) {
+	b := &bitReader{in: in}
+	mask := len(d.window) - 1
+	if !d.headerRead {
+		d.intelFileSize = 0
+		if b.read(1) != 0 {
+			d.intelFileSize = int32(b.read(16)<<16 | b.read(16))
+		}
+		d.headerRead = true
+	}
+
+	start := d.windowPos & mask
+	togo := outLen
+	for togo > 0 {
+		if d.blockRemaining == 0 {
+			if err := d.readBlockHeader(b); err != nil {
+				return nil, err
+			}
+		}
+		run := min(d.blockRemaining, togo)
+		togo -= run
+		d.blockRemaining -= run
+		d.windowPos &= mask
+		if d.windowPos+run > len(d.window) {
+			return nil, fmt.Errorf("%w: LZX run past the window", ErrFormat)
+		}
+
+		if d.blockType == lzxBlockUncompress {
+			if b.pos+run > len(b.in) {
+				return nil, fmt.Errorf("%w: truncated LZX block", ErrFormat)
+			}
+			copy(d.window[d.windowPos:], b.in[b.pos:b.pos+run])
+			b.pos += run
+			d.windowPos += run
+			continue
+		}
+		for run > 0 {
+			sym, err := d.main.decode(b)
+			if err != nil {
+				return nil, err
+			}
+			if sym < lzxNumChars {
+				d.window[d.windowPos] = byte(sym)
+				d.windowPos++
+				run--
+				continue
+			}
+			sym -= lzxNumChars
+			matchLen := sym & 7
+			if matchLen == lzxNumPrimaryLens {
+				footer, err := d.length.decode(b)
+				if err != nil {
+					return nil, err
+				}
+				matchLen += footer
+			}
+			matchLen += lzxMinMatch
+
+			slot := sym >> 3
+			var offset uint32
+			switch {
+			case slot > 2:
+				extra := uint(lzxExtraBits[slot])
+				offset = lzxPositionBase[slot] - 2
+				if d.blockType == lzxBlockAligned && extra >= 3 {
+					offset += b.read(extra-3) << 3
+					aligned, err := d.aligned.decode(b)
+					if err != nil {
+						return nil, err
+					}
+					offset += uint32(aligned)
+				} else {
+					offset += b.read(extra)
+				}
+				d.r[2], d.r[1], d.r[0] = d.r[1], d.r[0], offset
+			case slot == 0:
+				offset = d.r[0]
+			case slot == 1:
+				offset = d.r[1]
+				d.r[1], d.r[0] = d.r[0], offset
+			default:
+				offset = d.r[2]
+				d.r[2], d.r[0] = d.r[0], offset
+			}
+
+			if d.windowPos+matchLen > len(d.window) {
+				return nil, fmt.Errorf("%w: LZX match past the window", ErrFormat)
+			}
+			src := d.windowPos - int(offset)
+			for i := 0; i < matchLen; i++ {
+				d.window[d.windowPos+i] = d.window[(src+i)&mask]
+			}
+			d.windowPos += matchLen
+			run -= matchLen
+		}
+		// A match may overrun the run; the excess belongs to the block
+		if run < 0 {
+			if -run > d.blockRemaining {
+				return nil, fmt.Errorf("%w: LZX match past the block", ErrFormat)
+			}
+			d.blockRemaining += run
+			togo += run
+		}
+	}
+	if togo != 0 {
+		return nil, fmt.Errorf("%w: LZX match past the frame", ErrFormat)
+	}
+
+	out := make([]byte, outLen)
+	copy(out, d.window[start:start+outLen])
+	d.translateE8(out)
+	return out, nil
+}
+
+// translateE8 undoes the x86 CALL translation of executable content
+func (d *lzxDecoder) translateE8(out []byte) {
+	curPos := d.intelCurPos
+	d.intelCurPos += int32(len(out))
+	if !d.intelStarted || d.intelFileSize == 0 || d.framesRead >= 32768 || len(out) <= 10 {
+		d.framesRead++
+		return
+	}
+	d.framesRead++
+	for i := 0; i < len(out)-10; i++ {
+		if out[i] != 0xe8 {
+			curPos++
+			continue
+		}
+		abs := int32(binary.LittleEndian.Uint32(out[i+1:]))
+		if abs >= -curPos && abs < d.intelFileSize {
+			rel := abs + d.intelFileSize
+			if abs >= 0 {
+				rel = abs - curPos
+			}
+			binary.LittleEndian.PutUint32(out[i+1:], uint32(rel))
+		}
+		i += 4
+		curPos += 5
+	}
+}
@@ -0,0 +1,427 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// bitWriter writes the LZX bit stream: bits from the most significant one
+// into 16-bit little-endian words.
+type bitWriter struct {
+	out  []byte
+	acc  uint32
+	bits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | (v>>uint(i))&1
+		w.bits++
+		if w.bits == 16 {
+			w.out = binary.LittleEndian.AppendUint16(w.out, uint16(w.acc))
+			w.acc, w.bits = 0, 0
+		}
+	}
+}
+
+// flush pads the stream to a word
+func (w *bitWriter) flush() {
+	if w.bits > 0 {
+		w.write(0, 16-w.bits)
+	}
+}
+
+// canonicalCodes returns the codes the decoder assigns to lens
+func canonicalCodes(lens []uint8) []uint32 {
+	codes := make([]uint32, len(lens))
+	code := uint32(0)
+	for l := uint8(1); l <= lzxMaxCodeLen; l++ {
+		for sym, sl := range lens {
+			if sl == l {
+				codes[sym] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// lzxEncoder compresses data as frames of fixed trees: codes of equal
+// length for every main tree symbol and 7-bit codes for the first 128
+// lengths. Reset groups cycle through verbatim, aligned and uncompressed
+// blocks.
+type lzxEncoder struct {
+	w         bitWriter
+	r         [3]uint32
+	window    int
+	mainBits  uint
+	mainLens  []uint8
+	mainCodes []uint32
+	lenLens   []uint8
+	lenCodes  []uint32
+}
+
+func newLZXEncoder(windowBits uint) *lzxEncoder {
+	e := &lzxEncoder{window: 1 << windowBits}
+	mainSize := lzxNumChars + lzxPositionSlots(windowBits)*8
+	e.mainBits = uint(bits.Len(uint(mainSize - 1)))
+	e.mainLens = bytes.Repeat([]byte{uint8(e.mainBits)}, mainSize)
+	e.mainCodes = canonicalCodes(e.mainLens)
+	e.lenLens = make([]uint8, lzxLengthTreeSize)
+	for i := 0; i < 128; i++ {
+		e.lenLens[i] = 7
+	}
+	e.lenCodes = canonicalCodes(e.lenLens)
+	return e
+}
+
+// pretree writes a pretree giving every symbol a 5-bit code
+func (e *lzxEncoder) pretree() []uint32 {
+	lens := bytes.Repeat([]byte{5}, lzxPretreeSize)
+	for _, l := range lens {
+		e.w.write(uint32(l), 4)
+	}
+	return canonicalCodes(lens)
+}
+
+// writeTrees writes the main and length trees as deltas from zero
+func (e *lzxEncoder) writeTrees() {
+	for _, part := range [][2]int{{0, lzxNumChars}, {lzxNumChars, len(e.mainLens)}} {
+		codes := e.pretree()
+		for _, l := range e.mainLens[part[0]:part[1]] {
+			e.w.write(codes[(17-int(l))%17], 5)
+		}
+	}
+	codes := e.pretree()
+	// Four lengths of 7 as a run, then 124 single ones and 121 zeros
+	e.w.write(codes[19], 5)
+	e.w.write(0, 1)
+	e.w.write(codes[10], 5)
+	for i := 4; i < 128; i++ {
+		e.w.write(codes[10], 5)
+	}
+	e.w.write(codes[18], 5)
+	e.w.write(31, 5)
+	e.w.write(codes[18], 5)
+	e.w.write(31, 5)
+	e.w.write(codes[17], 5)
+	e.w.write(15, 4)
+}
+
+// encode compresses data and returns the stream and the reset table entries
+func (e *lzxEncoder) encode(data []byte, frameLen, framesPerReset int) ([]byte, []uint64) {
+	var resets []uint64
+	groupLen := frameLen * framesPerReset
+	for g := 0; g*groupLen < len(data); g++ {
+		group := data[g*groupLen : min((g+1)*groupLen, len(data))]
+		e.r = [3]uint32{1, 1, 1}
+		last := map[string]int{}
+		blockType := []int{lzxBlockVerbatim, lzxBlockAligned, lzxBlockUncompress}[g%3]
+		for f := 0; f*frameLen < len(group); f++ {
+			resets = append(resets, uint64(len(e.w.out)))
+			frameEnd := min((f+1)*frameLen, len(group))
+			if f == 0 {
+				e.w.write(0, 1) // no E8 translation
+				e.w.write(uint32(blockType), 3)
+				e.w.write(uint32(len(group)>>8), 16)
+				e.w.write(uint32(len(group)&0xff), 8)
+				switch blockType {
+				case lzxBlockAligned:
+					for i := 0; i < lzxAlignedSize; i++ {
+						e.w.write(3, 3)
+					}
+					fallthrough
+				case lzxBlockVerbatim:
+					e.writeTrees()
+				case lzxBlockUncompress:
+					if e.w.bits == 0 {
+						e.w.write(0, 16)
+					}
+					e.w.flush()
+					for _, r := range e.r {
+						e.w.out = binary.LittleEndian.AppendUint32(e.w.out, r)
+					}
+				}
+			}
+			if blockType == lzxBlockUncompress {
+				e.w.out = append(e.w.out, group[f*frameLen:frameEnd]...)
+				continue
+			}
+			e.encodeFrame(group, f*frameLen, frameEnd, blockType == lzxBlockAligned, last)
+			e.w.flush()
+		}
+	}
+	return e.w.out, resets
+}
+
+// encodeFrame writes literals and the longest earlier matches within the
+// reset group and the frame: nearby ones, and the last occurrence of the
+// next 6 bytes for far ones
+func (e *lzxEncoder) encodeFrame(group []byte, start, end int, aligned bool, last map[string]int) {
+	for pos := start; pos < end; {
+		bestLen, bestOff := 0, 0
+		try := func(from int) {
+			n := 0
+			for pos+n < end && n < 136 && group[from+n] == group[pos+n] {
+				n++
+			}
+			if n > bestLen || n == bestLen && uint32(pos-from) == e.r[0] {
+				bestLen, bestOff = n, pos-from
+			}
+		}
+		for from := max(pos-300, 0); from < pos; from++ {
+			try(from)
+		}
+		if pos+6 <= len(group) {
+			if from, ok := last[string(group[pos:pos+6])]; ok && pos-from <= e.window-3 {
+				try(from)
+			}
+		}
+		n := 1
+		if bestLen < 3 {
+			e.w.write(e.mainCodes[group[pos]], e.mainBits)
+		} else {
+			e.match(bestLen, uint32(bestOff), aligned)
+			n = bestLen
+		}
+		for ; n > 0; n-- {
+			if pos+6 <= len(group) {
+				last[string(group[pos:pos+6])] = pos
+			}
+			pos++
+		}
+	}
+}
+
+func (e *lzxEncoder) match(length int, offset uint32, aligned bool) {
+	var slot int
+	var extra, extraBits uint32
+	switch offset {
+	case e.r[0]:
+		slot = 0
+	case e.r[1]:
+		slot = 1
+		e.r[1], e.r[0] = e.r[0], offset
+	case e.r[2]:
+		slot = 2
+		e.r[2], e.r[0] = e.r[0], offset
+	default:
+		formatted := offset + 2
+		for slot = 3; slot+1 < len(lzxPositionBase) && lzxPositionBase[slot+1] <= formatted; slot++ {
+		}
+		extraBits = lzxExtraBits[slot]
+		extra = formatted - lzxPositionBase[slot]
+		e.r[2], e.r[1], e.r[0] = e.r[1], e.r[0], offset
+	}
+	header := min(length-lzxMinMatch, lzxNumPrimaryLens)
+	e.w.write(e.mainCodes[lzxNumChars+slot*8+header], e.mainBits)
+	if header == lzxNumPrimaryLens {
+		e.w.write(e.lenCodes[length-lzxMinMatch-lzxNumPrimaryLens], 7)
+	}
+	if aligned && extraBits >= 3 {
+		e.w.write(extra>>3, uint(extraBits-3))
+		e.w.write(extra&7, 3) // aligned codes of length 3 are the identity
+	} else {
+		e.w.write(extra, uint(extraBits))
+	}
+}
+
+// buildCompressedCHM returns a CHM storing files in the LZX section
+func buildCompressedCHM(files map[string][]byte, windowBits uint, framesPerReset int) []byte {
+	const frameLen = 0x8000
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var stream []byte
+	listed := map[string]File{}
+	for _, name := range names {
+		listed[name] = File{Section: 1, Offset: uint64(len(stream)), Length: uint64(len(files[name]))}
+		stream = append(stream, files[name]...)
+	}
+	compressed, resets := newLZXEncoder(windowBits).encode(stream, frameLen, framesPerReset)
+
+	control := make([]byte, 0x1c)
+	binary.LittleEndian.PutUint32(control, 6)
+	copy(control[4:], "LZXC")
+	binary.LittleEndian.PutUint32(control[0x08:], 2)
+	binary.LittleEndian.PutUint32(control[0x0c:], uint32(frameLen*framesPerReset/0x8000))
+	binary.LittleEndian.PutUint32(control[0x10:], 1<<windowBits/0x8000)
+	binary.LittleEndian.PutUint32(control[0x14:], 1)
+
+	table := make([]byte, 0x28)
+	binary.LittleEndian.PutUint32(table[0x00:], 2)
+	binary.LittleEndian.PutUint32(table[0x04:], uint32(len(resets)))
+	binary.LittleEndian.PutUint32(table[0x08:], 8)
+	binary.LittleEndian.PutUint32(table[0x0c:], 0x28)
+	binary.LittleEndian.PutUint64(table[0x10:], uint64(len(stream)))
+	binary.LittleEndian.PutUint64(table[0x18:], uint64(len(compressed)))
+	binary.LittleEndian.PutUint64(table[0x20:], uint64(frameLen))
+	for _, r := range resets {
+		table = binary.LittleEndian.AppendUint64(table, r)
+	}
+
+	return buildCHMSections(map[string][]byte{
+		compressedContent: compressed,
+		compressedControl: control,
+		compressedResets:  table,
+	}, listed)
+}
+
+// testPages returns compressible pages with some random bytes
+func testPages(n int) map[string][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	files := map[string][]byte{}
+	for i := 0; i < n; i++ {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "<html><head><title>Page %d</title></head><body>\n", i)
+		for j := 0; j < rnd.Intn(400); j++ {
+			fmt.Fprintf(&b, "<p>Paragraph %d of page %d: %x</p>\n", j, i, rnd.Int63())
+		}
+		b.WriteString("</body></html>\n")
+		files[fmt.Sprintf("/pages/page%03d.htm", i)] = b.Bytes()
+	}
+	return files
+}
+
+func TestReadCompressed(t *testing.T) {
+	files := testPages(200)
+	files["/empty.htm"] = nil
+	for _, test := range []struct {
+		windowBits     uint
+		framesPerReset int
+	}{
+		{15, 1}, {16, 1}, {16, 2}, {16, 4}, {17, 2}, {20, 8}, {21, 8},
+	} {
+		image := buildCompressedCHM(files, test.windowBits, test.framesPerReset)
+		r, err := NewReader(bytes.NewReader(image))
+		if err != nil {
+			t.Fatalf("Expected nil but got %v", err)
+		}
+		if r.Protection() != "" {
+			t.Errorf("Expected no protection but got %v", r.Protection())
+		}
+		// Out of offset order, to decode groups again
+		for _, name := range []string{"/pages/page199.htm", "/pages/page000.htm", "/pages/page131.htm", "/pages/page057.htm", "/empty.htm"} {
+			b, err := r.ReadFile(name)
+			if err != nil {
+				t.Fatalf("Expected nil but got %v", err)
+			}
+			if !bytes.Equal(b, files[name]) {
+				t.Errorf("Content of %s differs with a window of 2^%d and %d frames per reset", name, test.windowBits, test.framesPerReset)
+			}
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	files := testPages(20)
+	files["/../escape.htm"] = []byte("x")
+	files["/#SYSTEM"] = []byte("x")
+	r, err := NewReader(bytes.NewReader(buildCompressedCHM(files, 16, 2)))
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	dir := t.TempDir()
+	n, err := r.Extract(filepath.Join(dir, "out"))
+	if err != nil || n != 20 {
+		t.Fatalf("Expected 20 files but got %v %v", n, err)
+	}
+	for name, content := range files {
+		b, err := os.ReadFile(filepath.Join(dir, "out", filepath.FromSlash(name[1:])))
+		if name[1] == '.' || name[1] == '#' {
+			if err == nil {
+				t.Errorf("Expected %s to be skipped", name)
+			}
+			continue
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("Content of %s differs: %v", name, err)
+		}
+	}
+}
+
+func TestExtractMatching(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(buildCompressedCHM(testPages(20), 16, 2)))
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	var names []string
+	n, err := r.ExtractMatching(t.TempDir(), func(name string) bool {
+		names = append(names, name)
+		return name == "pages/page001.htm"
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 file but got %v %v", n, err)
+	}
+	if len(names) != 20 || names[0][0] == '/' {
+		t.Errorf("Expected 20 names without a leading slash but got %v", names)
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	r, _ := NewReader(bytes.NewReader(buildCHMSections(map[string][]byte{"/a.htm": []byte("a")},
+		map[string]File{"/b.htm": {Section: 1, Length: 1}, "/c.htm": {Section: 2, Length: 1}})))
+	if _, err := r.ReadFile("/missing.htm"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf(`Expected "%v" but got "%v"`, os.ErrNotExist, err)
+	}
+	if _, err := r.ReadFile("/b.htm"); !errors.Is(err, ErrFormat) {
+		t.Errorf(`Expected "%v" but got "%v"`, ErrFormat, err)
+	}
+	if _, err := r.ReadFile("/c.htm"); !errors.Is(err, ErrProtected) {
+		t.Errorf(`Expected "%v" but got "%v"`, ErrProtected, err)
+	}
+	if b, err := r.ReadFile("/A.htm"); err != nil || string(b) != "a" {
+		t.Errorf(`Expected "a" but got "%s" %v`, b, err)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	files := testPages(200)
+	big := bytes.Repeat([]byte("<p>large page</p>\n"), 10000)
+	files["/big.htm"] = big
+	r, err := NewReader(bytes.NewReader(buildCompressedCHM(files, 16, 64)))
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	// A single frame is kept, so earlier frames are decoded again
+	r.MemoryLimit = 0x8000
+	for _, name := range []string{"/pages/page199.htm", "/pages/page000.htm", "/big.htm", "/pages/page131.htm"} {
+		var b bytes.Buffer
+		n, err := r.Copy(&b, name)
+		if err != nil || n != int64(len(files[name])) {
+			t.Fatalf("Expected %d bytes but got %v %v", len(files[name]), n, err)
+		}
+		if !bytes.Equal(b.Bytes(), files[name]) {
+			t.Errorf("Content of %s differs", name)
+		}
+		if r.section1.cached > r.MemoryLimit {
+			t.Errorf("Expected at most %d bytes cached but got %d", r.MemoryLimit, r.section1.cached)
+		}
+	}
+
+	var visited []string
+	dir := t.TempDir()
+	n, err := r.ExtractEach(dir, nil, func(name string, b []byte) { visited = append(visited, name) })
+	if err != nil || n != len(files) {
+		t.Fatalf("Expected %d files but got %v %v", len(files), n, err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "big.htm"))
+	if err != nil || !bytes.Equal(b, big) {
+		t.Errorf("Content of big.htm differs: %v", err)
+	}
+	// The large page is streamed rather than visited
+	if len(visited) != len(files)-1 {
+		t.Errorf("Expected %d visited files but got %d", len(files)-1, len(visited))
+	}
+}
@@ -0,0 +1,88 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// systemFile holds the project settings the CHM was compiled with
+const systemFile = "/#SYSTEM"
+
+// Codes of the #SYSTEM records read by System
+const (
+	systemContents     = 0
+	systemIndex        = 1
+	systemDefaultTopic = 2
+	systemTitle        = 3
+	systemLocale       = 4
+	systemWindow       = 5
+	systemCompiledFile = 6
+	systemCompiler     = 9
+)
+
+// System holds the settings of the #SYSTEM file. Strings are as stored,
+// in the ANSI code page of LanguageID.
+type System struct {
+	ContentsFile  string // .hhc file
+	IndexFile     string // .hhk file
+	DefaultTopic  string
+	Title         string
+	DefaultWindow string
+	CompiledFile  string
+	Compiler      string // e.g. HHA Version 4.74.8702
+	LanguageID    uint32
+	Version       uint32 // of the #SYSTEM format
+}
+
+// System reads the #SYSTEM file. It returns an error wrapping
+// os.ErrNotExist if the CHM has none.
+func (c *Reader) System() (System, error) {
+	var s System
+	b, err := c.ReadFile(systemFile)
+	if err != nil {
+		return s, err
+	}
+	if len(b) < 4 {
+		return s, fmt.Errorf("%w: invalid #SYSTEM", ErrFormat)
+	}
+	s.Version = binary.LittleEndian.Uint32(b)
+	for b = b[4:]; len(b) >= 4; {
+		code := binary.LittleEndian.Uint16(b)
+		length := int(binary.LittleEndian.Uint16(b[2:]))
+		if 4+length > len(b) {
+			return s, fmt.Errorf("%w: #SYSTEM record %d is truncated", ErrFormat, code)
+		}
+		data := b[4 : 4+length]
+		b = b[4+length:]
+		switch code {
+		case systemContents:
+			s.ContentsFile = cString(data)
+		case systemIndex:
+			s.IndexFile = cString(data)
+		case systemDefaultTopic:
+			s.DefaultTopic = cString(data)
+		case systemTitle:
+			s.Title = cString(data)
+		case systemLocale:
+			if len(data) >= 4 {
+				s.LanguageID = binary.LittleEndian.Uint32(data)
+			}
+		case systemWindow:
+			s.DefaultWindow = cString(data)
+		case systemCompiledFile:
+			s.CompiledFile = cString(data)
+		case systemCompiler:
+			s.Compiler = cString(data)
+		}
+	}
+	return s, nil
+}
+
+// cString returns b up to its first NUL
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,73 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// systemRecords returns a #SYSTEM file holding the given records
+func systemRecords(records map[uint16][]byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	for code := uint16(0); code < 16; code++ {
+		data, ok := records[code]
+		if !ok {
+			continue
+		}
+		binary.Write(&b, binary.LittleEndian, code)
+		binary.Write(&b, binary.LittleEndian, uint16(len(data)))
+		b.Write(data)
+	}
+	return b.Bytes()
+}
+
+func TestSystem(t *testing.T) {
+	locale := make([]byte, 28)
+	binary.LittleEndian.PutUint32(locale, 0x0419)
+	r, err := NewReader(bytes.NewReader(buildCHM(map[string][]byte{
+		"/#SYSTEM": systemRecords(map[uint16][]byte{
+			systemContents:     []byte("toc.hhc\x00"),
+			systemIndex:        []byte("index.hhk\x00"),
+			systemDefaultTopic: []byte("html/intro.htm\x00"),
+			systemTitle:        []byte("Reference \xd1\xef\xf0\xe0\xe2\xea\xe0\x00"),
+			systemLocale:       locale,
+			systemCompiledFile: []byte("ref\x00"),
+			systemCompiler:     []byte("HHA Version 4.74.8702\x00"),
+		}),
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.System()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := System{
+		ContentsFile: "toc.hhc",
+		IndexFile:    "index.hhk",
+		DefaultTopic: "html/intro.htm",
+		Title:        "Reference \xd1\xef\xf0\xe0\xe2\xea\xe0",
+		CompiledFile: "ref",
+		Compiler:     "HHA Version 4.74.8702",
+		LanguageID:   0x0419,
+		Version:      3,
+	}
+	if s != expected {
+		t.Errorf("Expected %+v but got %+v", expected, s)
+	}
+}
+
+func TestSystemErrors(t *testing.T) {
+	r, _ := NewReader(bytes.NewReader(buildCHM(map[string][]byte{"/index.htm": nil})))
+	if _, err := r.System(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist but got %v", err)
+	}
+	truncated := systemRecords(map[uint16][]byte{systemTitle: []byte("Title\x00")})
+	r, _ = NewReader(bytes.NewReader(buildCHM(map[string][]byte{"/#SYSTEM": truncated[:len(truncated)-2]})))
+	if _, err := r.System(); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat but got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package chm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// tocIdxFile holds the binary table of contents the CHM compiler writes
+// when the project asks for one
+const tocIdxFile = "/#TOCIDX"
+
+// Flags of a #TOCIDX entry
+const (
+	tocTopic    = 0x2 // the entry names a #TOPICS index rather than a #STRINGS offset
+	tocChildren = 0x4 // the entry has children
+)
+
+// maxTOCDepth bounds the nesting of #TOCIDX entries, which point at each
+// other by offset and may loop in damaged files
+const maxTOCDepth = 64
+
+// TOCEntry is an entry of the binary table of contents
+type TOCEntry struct {
+	Title    string
+	Local    string
+	Children []TOCEntry
+}
+
+// BinaryTOC reads the table of contents from #TOCIDX, for CHMs compiled
+// without their .hhc. Entries pointing at a topic take its title and page
+// from the topic table; the others are headings named in #STRINGS. Titles
+// are as stored, in the ANSI code page of the CHM. It returns an error
+// wrapping os.ErrNotExist if the CHM has no binary table of contents.
+//
+// The file starts with the offset of the first top-level entry. An entry
+// holds two WORDs, then DWORDs for its flags, its topic index or #STRINGS
+// offset, the offset of its parent, of its next sibling and, if it has
+// children, of its first child. Offsets of 0 end a list.
+func (c *Reader) BinaryTOC() ([]TOCEntry, error) {
+	idx, err := c.ReadFile(tocIdxFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 4 {
+		return nil, fmt.Errorf("%w: invalid #TOCIDX", ErrFormat)
+	}
+	topics, err := c.Topics()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	strs, err := c.ReadFile(stringsFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	visited := map[uint32]bool{}
+	var siblings func(offset uint32, depth int) ([]TOCEntry, error)
+	siblings = func(offset uint32, depth int) ([]TOCEntry, error) {
+		if depth > maxTOCDepth {
+			return nil, fmt.Errorf("%w: #TOCIDX is nested too deeply", ErrFormat)
+		}
+		var entries []TOCEntry
+		for ; offset != 0; offset = binary.LittleEndian.Uint32(idx[offset+16:]) {
+			if visited[offset] {
+				return nil, fmt.Errorf("%w: #TOCIDX entry at %#x is reached twice", ErrFormat, offset)
+			}
+			visited[offset] = true
+			if uint64(offset)+20 > uint64(len(idx)) {
+				return nil, fmt.Errorf("%w: #TOCIDX entry at %#x is truncated", ErrFormat, offset)
+			}
+			flags := binary.LittleEndian.Uint32(idx[offset+4:])
+			ref := binary.LittleEndian.Uint32(idx[offset+8:])
+			var e TOCEntry
+			if flags&tocTopic != 0 {
+				if uint64(ref) >= uint64(len(topics)) {
+					return nil, fmt.Errorf("%w: #TOCIDX entry at %#x points past #TOPICS", ErrFormat, offset)
+				}
+				e.Title, e.Local = topics[ref].Title, topics[ref].Local
+			} else {
+				e.Title = stringAt(strs, uint64(ref))
+			}
+			if flags&tocChildren != 0 {
+				if uint64(offset)+24 > uint64(len(idx)) {
+					return nil, fmt.Errorf("%w: #TOCIDX entry at %#x is truncated", ErrFormat, offset)
+				}
+				children, err := siblings(binary.LittleEndian.Uint32(idx[offset+20:]), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				e.Children = children
+			}
+			entries = append(entries, e)
+		}
+		return entries, nil
+	}
+	return siblings(binary.LittleEndian.Uint32(idx), 0)
+}
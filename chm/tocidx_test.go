@@ -0,0 +1,118 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// binaryTOCFiles returns the #TOCIDX file and topic tables of entries.
+// Entries with a Local become topics; the others are #STRINGS headings.
+func binaryTOCFiles(entries []TOCEntry) map[string][]byte {
+	var topics []Topic
+	var walk func([]TOCEntry)
+	walk = func(entries []TOCEntry) {
+		for _, e := range entries {
+			if e.Local != "" {
+				topics = append(topics, Topic{Title: e.Title, Local: e.Local})
+			}
+			walk(e.Children)
+		}
+	}
+	walk(entries)
+	files := topicTables(topics)
+	strs := bytes.NewBuffer(files[stringsFile])
+
+	idx := make([]byte, 4)
+	topic := 0
+	var write func(entries []TOCEntry, parent uint32) uint32
+	write = func(entries []TOCEntry, parent uint32) uint32 {
+		first := uint32(0)
+		prev := -1
+		for _, e := range entries {
+			offset := len(idx)
+			if first == 0 {
+				first = uint32(offset)
+			}
+			if prev >= 0 {
+				binary.LittleEndian.PutUint32(idx[prev+16:], uint32(offset))
+			}
+			prev = offset
+			size := 20
+			flags := uint32(0)
+			if len(e.Children) > 0 {
+				size, flags = 24, flags|tocChildren
+			}
+			idx = append(idx, make([]byte, size)...)
+			ref := uint32(strs.Len())
+			if e.Local != "" {
+				flags |= tocTopic
+				ref = uint32(topic)
+				topic++
+			} else {
+				strs.WriteString(e.Title + "\x00")
+			}
+			binary.LittleEndian.PutUint32(idx[offset+4:], flags)
+			binary.LittleEndian.PutUint32(idx[offset+8:], ref)
+			binary.LittleEndian.PutUint32(idx[offset+12:], parent)
+			if len(e.Children) > 0 {
+				child := write(e.Children, uint32(offset))
+				binary.LittleEndian.PutUint32(idx[offset+20:], child)
+			}
+		}
+		return first
+	}
+	binary.LittleEndian.PutUint32(idx, write(entries, 0))
+	files[tocIdxFile] = idx
+	files[stringsFile] = strs.Bytes()
+	return files
+}
+
+func TestBinaryTOC(t *testing.T) {
+	expected := []TOCEntry{
+		{Title: "Introduction", Local: "intro.htm"},
+		{Title: "Reference", Children: []TOCEntry{
+			{Title: "Functions", Local: "ref/functions.htm", Children: []TOCEntry{
+				{Title: "open", Local: "ref/open.htm"},
+			}},
+			{Title: "Types", Local: "ref/types.htm"},
+		}},
+		{Title: "Index", Local: "index.htm"},
+	}
+	r, err := NewReader(bytes.NewReader(buildCHM(binaryTOCFiles(expected))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toc, err := r.BinaryTOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(toc, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, toc)
+	}
+}
+
+func TestBinaryTOCErrors(t *testing.T) {
+	r, _ := NewReader(bytes.NewReader(buildCHM(map[string][]byte{"/index.htm": nil})))
+	if _, err := r.BinaryTOC(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist but got %v", err)
+	}
+
+	files := binaryTOCFiles([]TOCEntry{{Title: "A", Local: "a.htm"}, {Title: "B", Local: "b.htm"}})
+	loop := files[tocIdxFile]
+	binary.LittleEndian.PutUint32(loop[4+20+16:], 4) // B is followed by A again
+	r, _ = NewReader(bytes.NewReader(buildCHM(files)))
+	if _, err := r.BinaryTOC(); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat for a loop but got %v", err)
+	}
+
+	files = binaryTOCFiles([]TOCEntry{{Title: "A", Local: "a.htm"}})
+	files[tocIdxFile] = files[tocIdxFile][:12]
+	r, _ = NewReader(bytes.NewReader(buildCHM(files)))
+	if _, err := r.BinaryTOC(); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat for a truncated entry but got %v", err)
+	}
+}
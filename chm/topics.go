@@ -0,0 +1,67 @@
+package chm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Internal files of the topic table
+const (
+	topicsFile  = "/#TOPICS"
+	stringsFile = "/#STRINGS"
+	urlTblFile  = "/#URLTBL"
+	urlStrFile  = "/#URLSTR"
+)
+
+// Topic is an entry of the topic table the CHM compiler writes for full
+// text search results: a page and its title
+type Topic struct {
+	Title string
+	Local string
+}
+
+// Topics reads the topic table from #TOPICS, resolving titles through
+// #STRINGS and pages through #URLTBL and #URLSTR. Titles are as stored, in
+// the ANSI code page of the CHM; Local uses forward slashes and has no
+// leading slash. It returns an error wrapping os.ErrNotExist if the CHM has
+// no topic table.
+func (c *Reader) Topics() ([]Topic, error) {
+	tables := map[string][]byte{}
+	for _, name := range []string{topicsFile, urlTblFile, urlStrFile, stringsFile} {
+		b, err := c.ReadFile(name)
+		if err != nil && name != stringsFile {
+			return nil, err
+		}
+		tables[name] = b
+	}
+	topics, urlTbl, urlStr, strs := tables[topicsFile], tables[urlTblFile], tables[urlStrFile], tables[stringsFile]
+
+	var out []Topic
+	for i := 0; i+16 <= len(topics); i += 16 {
+		var t Topic
+		if title := binary.LittleEndian.Uint32(topics[i+4:]); title != 0xffffffff {
+			t.Title = stringAt(strs, uint64(title))
+		}
+		url := uint64(binary.LittleEndian.Uint32(topics[i+8:]))
+		if url+12 > uint64(len(urlTbl)) {
+			return nil, fmt.Errorf("%w: topic %d points past #URLTBL", ErrFormat, i/16)
+		}
+		local := uint64(binary.LittleEndian.Uint32(urlTbl[url+8:])) + 8
+		if local >= uint64(len(urlStr)) {
+			return nil, fmt.Errorf("%w: topic %d points past #URLSTR", ErrFormat, i/16)
+		}
+		t.Local = strings.TrimPrefix(strings.ReplaceAll(stringAt(urlStr, local), `\`, "/"), "/")
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// stringAt returns the NUL-terminated string at offset of b, or "" if the
+// offset is out of range
+func stringAt(b []byte, offset uint64) string {
+	if offset >= uint64(len(b)) {
+		return ""
+	}
+	return cString(b[offset:])
+}
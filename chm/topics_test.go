@@ -0,0 +1,80 @@
+package chm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// topicTables returns the #TOPICS, #STRINGS, #URLTBL and #URLSTR files
+// listing topics
+func topicTables(topics []Topic) map[string][]byte {
+	var tps, strs, tbl, urls bytes.Buffer
+	strs.WriteByte(0)
+	urls.WriteByte(0)
+	put := func(b *bytes.Buffer, v uint32) { binary.Write(b, binary.LittleEndian, v) }
+	for i, t := range topics {
+		title := uint32(0xffffffff)
+		if t.Title != "" {
+			title = uint32(strs.Len())
+			strs.WriteString(t.Title + "\x00")
+		}
+		put(&tps, 0)
+		put(&tps, title)
+		put(&tps, uint32(tbl.Len()))
+		put(&tps, 6)
+
+		put(&tbl, 0)
+		put(&tbl, uint32(i))
+		put(&tbl, uint32(urls.Len()))
+		put(&urls, 0)
+		put(&urls, 0)
+		urls.WriteString(t.Local + "\x00")
+	}
+	return map[string][]byte{
+		topicsFile:  tps.Bytes(),
+		stringsFile: strs.Bytes(),
+		urlTblFile:  tbl.Bytes(),
+		urlStrFile:  urls.Bytes(),
+	}
+}
+
+func TestTopics(t *testing.T) {
+	files := topicTables([]Topic{
+		{Title: "Introduction", Local: "html/intro.htm"},
+		{Local: `html\untitled.htm`},
+		{Title: "Reference", Local: "/ref.htm"},
+	})
+	r, err := NewReader(bytes.NewReader(buildCHM(files)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics, err := r.Topics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Topic{
+		{Title: "Introduction", Local: "html/intro.htm"},
+		{Local: "html/untitled.htm"},
+		{Title: "Reference", Local: "ref.htm"},
+	}
+	if !reflect.DeepEqual(topics, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, topics)
+	}
+}
+
+func TestTopicsErrors(t *testing.T) {
+	r, _ := NewReader(bytes.NewReader(buildCHM(map[string][]byte{"/index.htm": nil})))
+	if _, err := r.Topics(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist but got %v", err)
+	}
+	files := topicTables([]Topic{{Title: "Introduction", Local: "intro.htm"}})
+	files[urlTblFile] = files[urlTblFile][:8]
+	r, _ = NewReader(bytes.NewReader(buildCHM(files)))
+	if _, err := r.Topics(); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat but got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package chm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Check holds the outcome of Verify
+type Check struct {
+	Files    int     // files read
+	Frames   int     // LZX frames decoded
+	Problems []error // truncated or corrupt entries and frames
+}
+
+// Verify reads every file of the CHM and decodes every frame of its
+// compressed section, to tell a damaged CHM from a failing conversion. It
+// collects the problems found rather than stopping at the first one. A file
+// of a corrupt frame is reported along with the frame.
+func (c *Reader) Verify() Check {
+	var check Check
+	if c.section1 == nil {
+		if _, ok := c.Stat(compressedContent); ok {
+			s, err := c.openLZXSection()
+			if err != nil {
+				check.Problems = append(check.Problems, fmt.Errorf("compressed section: %w", err))
+			}
+			c.section1 = s
+		}
+	}
+	if s := c.section1; s != nil {
+		for i := 0; i < len(s.resets); i++ {
+			if uint64(i)*s.frameLen >= s.length {
+				break
+			}
+			if _, err := s.frame(c, i); err != nil {
+				check.Problems = append(check.Problems, fmt.Errorf("compressed section: %w", err))
+				// The frames up to the next reset depend on this one
+				i = (i/s.framesPerReset+1)*s.framesPerReset - 1
+				continue
+			}
+			check.Frames++
+		}
+	}
+
+	files := c.Files()
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Section != files[j].Section {
+			return files[i].Section < files[j].Section
+		}
+		return files[i].Offset < files[j].Offset
+	})
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if f.Section == 1 && c.section1 == nil {
+			check.Problems = append(check.Problems, fmt.Errorf("%s: %w: no compressed section", f.Name, ErrFormat))
+			continue
+		}
+		if _, err := c.read(f); err != nil {
+			check.Problems = append(check.Problems, fmt.Errorf("%s: %w", f.Name, err))
+			continue
+		}
+		check.Files++
+	}
+	return check
+}
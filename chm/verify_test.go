@@ -0,0 +1,35 @@
+package chm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	files := testPages(50)
+	image := buildCompressedCHM(files, 16, 2)
+	r, err := NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := r.Verify()
+	if len(check.Problems) != 0 || check.Files != len(files)+3 || check.Frames == 0 {
+		t.Errorf("Expected %d files and no problems but got %+v", len(files)+3, check)
+	}
+
+	// Cut into the compressed content
+	r, err = NewReader(bytes.NewReader(image[:len(image)-len(image)/4]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := r.Verify()
+	if len(damaged.Problems) == 0 || damaged.Files >= check.Files || damaged.Frames >= check.Frames {
+		t.Errorf("Expected problems but got %+v", damaged)
+	}
+	for _, problem := range damaged.Problems {
+		if !errors.Is(problem, ErrFormat) {
+			t.Errorf("Expected ErrFormat but got %v", problem)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"html"
@@ -10,18 +12,20 @@ import (
 	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"text/template"
-
-	_ "modernc.org/sqlite"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/ianaindex"
-	"golang.org/x/text/transform"
+
+	"chm2docset/chm"
+	"chm2docset/docset"
 )
 
 var (
@@ -31,9 +35,11 @@ var (
 	titleRE       = regexp.MustCompile(`(?i)<title[^>]*>([^<]+)</title>`)
 
 	// Regex for parsing HHK/HHC sitemap files
-	sitemapObjectRE = regexp.MustCompile(`(?is)<object[^>]*>(.*?)</object>`)
-	paramNameRE     = regexp.MustCompile(`(?i)<param\s+name=["']?Name["']?\s+value=["']?([^"'>]+)["']?`)
-	paramLocalRE    = regexp.MustCompile(`(?i)<param\s+name=["']?Local["']?\s+value=["']?([^"'>]+)["']?`)
+	paramNameRE  = regexp.MustCompile(`(?i)<param\s+name=["']?Name["']?\s+value=["']?([^"'>]+)["']?`)
+	paramLocalRE = regexp.MustCompile(`(?i)<param\s+name=["']?Local["']?\s+value=["']?([^"'>]+)["']?`)
+
+	plistTmpl = template.Must(template.New("plist").Parse(plistTemplate))
+	dbSchema  = docset.Schema(docset.DefaultTable)
 )
 
 const (
@@ -42,23 +48,26 @@ const (
 <plist version="1.0">
   <dict>
     <key>dashIndexFilePath</key>
-    <string>Welcome.htm</string>
+    <string>{{.IndexFilePath}}</string>
     <key>CFBundleIdentifier</key>
     <string>{{.BundleIdentifier}}</string>
     <key>CFBundleName</key>
-    <string>{{.Basename}}</string>
+    <string>{{.Title}}</string>
     <key>DocSetPlatformFamily</key>
-    <string>{{.Platform}}</string>
+    <string>{{.Platform}}</string>{{if .IsDashDocset}}{{with .Keyword}}
+    <key>DashDocSetKeyword</key>
+    <string>{{.}}</string>{{end}}
     <key>isDashDocset</key>
-    <true/>
+    <true/>{{end}}{{if .IsAppleDocset}}
+    <key>DocSetPublisherIdentifier</key>
+    <string>io.ngs.documentation</string>
+    <key>DocSetPublisherName</key>
+    <string>chm2docset</string>{{with .DocsetVersion}}
+    <key>CFBundleVersion</key>
+    <string>{{.}}</string>{{end}}{{end}}
   </dict>
 </plist>`
 
-	dbSchema = `
-	CREATE TABLE searchIndex(id INTEGER PRIMARY KEY, name TEXT, type TEXT, path TEXT);
-	CREATE UNIQUE INDEX anchor ON searchIndex (name, type, path);
-	`
-
 	// Limit file reading to the first 64KB to find the title.
 	// This covers standard HTML <head> sections without reading the full file.
 	headerReadLimit = 64 * 1024
@@ -67,8 +76,24 @@ const (
 	defaultSitemapEncoding = "windows-1251"
 )
 
+// commands maps subcommand names to their implementations
+var commands = map[string]func(args []string) error{
+	"audit-paths":  auditPathsCommand,
+	"daemon":       daemonCommand,
+	"info":         infoCommand,
+	"list":         listCommand,
+	"verify":       verifyCommand,
+	"verify-links": verifyLinksCommand,
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: %s [options] [inputfile]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s audit-paths docset\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s daemon [-listen 127.0.0.1:8080]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s info inputfile\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s list inputfile\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s verify docset|inputfile\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s verify-links inputfile\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -78,30 +103,266 @@ type Options struct {
 	Outdir     string
 	Platform   string
 	SourcePath string
+	Manifest   string
+	Jobs       int
+	Aliases    bool
+	FoldAlias  bool
+	StripNums  bool
+	TOCNames   bool
+	Glossary   bool
+	Constants  bool
+	Commands   bool
+	Equations  bool
+	Classify   bool
+	TypeRules  string
+	Report     string
+	OnlyTypes  string
+	DropTypes  string
+
+	Deprecated       string
+	DeprecatedMarker string
+	DetectDeprecated bool
+	LowPriority      string
+	Lang             string
+	Language         string
+	SplitLanguages   bool
+	DocsetVersion    string
+	About            bool
+	DefaultType      string
+	Tgz              bool
+	LowercasePaths   bool
+	RedirectStubs    bool
+	SourcePriority   string
+	Duplicates       string
+	DirTypes         string
+	StartContents    string
+	Stages           string
+	CommitEvery      int
+	Keywords         stringList
+	Preset           string
+	Name             string
+	Icon             string
+	Excludes         stringList
+	Skip             stringList
+	KeepHelperPages  bool
+	Timings          bool
+	DiffReport       bool
+	Nav              bool
+	BreadcrumbBar    bool
+	FlattenFrameset  bool
+	FromDir          bool
+	Combine          bool
+	Estimate         bool
+	A11y             bool
+	RepairLinks      bool
+	Strict           bool
+	KeepTemp         bool
+	Extractor        string
+	HLPHelper        string
+	DownloadDir      string
+	ExtractTimeout   time.Duration
+	MemoryLimit      int64
+	ExtractOnly      stringList
+	ExtractSkip      stringList
+	ExtraFiles       stringList
+	PathPrefix       string
+	Format           string
+	SkipDir          string
+
+	ExportAnnotations string
+	ApplyAnnotations  string
+	Ctags             string
+	DeepLinks         string
+	DeepLinkTypes     string
+	SourceMap         string
+
+	// Sources lists every input of a batch build, SourcePath being the first
+	Sources []string
+
+	// temp holds the intermediate files shared by all builds of a run
+	temp *tempRoot
+	// sourceHash is the SHA-256 of the source file when a batch computed it
+	sourceHash string
+
+	// setFlags holds the names of the flags given on the command line
+	setFlags map[string]bool
+
+	report    *DocsetReport
+	indexFile string
+	renames   *pathMap
+	// contentFiles maps the files of the content directory to themselves
+	// for case-insensitive lookups while indexing
+	contentFiles *pathMap
+	skipped      map[string]bool
+	sourceRanks  map[string]int
+	// duplicatePolicies holds the -duplicates policy of every entry source
+	duplicatePolicies map[string]string
+	// dirTypes holds the -dir-types prefixes, longest first
+	dirTypes []dirType
+	// typeRules holds the rules read from -type-rules
+	typeRules []typeRule
+	entries   map[entryKey]entryOrigin
+	// pages shares page reads between the index passes
+	pages *pageCache
+	// streamed holds the titles of the pages read while extracting them
+	streamed *streamedTitles
+	// systemTitle and defaultTopic come from the #SYSTEM file of the CHM
+	systemTitle  string
+	defaultTopic string
+	// topics holds the titled pages of the topic table of the CHM
+	topics []chm.Topic
+	// languageDirs holds the directories of the language converted under
+	// -split-languages, otherLanguageDirs those of the others
+	languageDirs      []string
+	otherLanguageDirs []string
+	// mergedCHMs holds the source and the child CHMs merged into it, or
+	// the sources of a combined docset, by lower-cased file name; children
+	// that were not found are nil
+	mergedCHMs map[string]*mergedCHM
+	// helpIDs maps the lower-cased topic ids of a Help Viewer package to
+	// their pages
+	helpIDs map[string]string
 }
 
-// parseFlags handles CLI arguments and returns Options
-func parseFlags() *Options {
-	opts := &Options{}
-	flag.StringVar(&opts.Platform, "platform", "unknown", "DocSet Platform Family")
-	flag.StringVar(&opts.Outdir, "out", "./", "Output directory or file path")
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// initFlags resets the command line flag set
+func initFlags() {
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	flag.Usage = usage
+}
+
+// NewOptions handles CLI arguments and returns Options
+func NewOptions() *Options {
+	initFlags()
+	opts := &Options{}
+	opts.defineFlags(flag.CommandLine)
 	flag.Parse()
-	args := flag.Args()
-	if len(args) != 1 {
+	opts.setFlags = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { opts.setFlags[f.Name] = true })
+	if err := opts.applyPreset(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	opts.Sources = flag.Args()
+	if opts.Manifest != "" {
+		sources, err := readManifest(opts.Manifest)
+		if err != nil {
+			log.Fatalf("Error: reading manifest: %v", err)
+		}
+		opts.Sources = append(opts.Sources, sources...)
+	}
+	if len(opts.Sources) == 0 {
 		return nil
 	}
-	opts.SourcePath = args[0]
+	opts.SourcePath = opts.Sources[0]
+	return opts
+}
+
+// defaultOptions returns Options holding the default of every flag, for
+// conversions configured other than by the command line
+func defaultOptions() *Options {
+	opts := &Options{}
+	opts.defineFlags(flag.NewFlagSet("defaults", flag.ContinueOnError))
 	return opts
 }
 
+// defineFlags defines the conversion flags on flags, setting every option
+// to its default
+func (opts *Options) defineFlags(flags *flag.FlagSet) {
+	flags.StringVar(&opts.Platform, "platform", "unknown", "DocSet Platform Family")
+	flags.StringVar(&opts.Outdir, "out", "./", "Output directory or file path")
+	flags.StringVar(&opts.Manifest, "manifest", "", "File listing input files to convert, one per line")
+	flags.IntVar(&opts.Jobs, "jobs", 0, "Number of conversions, and of pages within one, to process concurrently; 0 chooses from the size of the sources")
+	flags.BoolVar(&opts.Aliases, "aliases", false, "Add alias entries for symbol names without arguments or qualifiers")
+	flags.BoolVar(&opts.FoldAlias, "fold-aliases", false, "Add alias entries for names with accents or umlauts spelled without them")
+	flags.BoolVar(&opts.StripNums, "strip-numbering", false, "Remove section numbers such as 3.2.1 from the start of entry names")
+	flags.BoolVar(&opts.TOCNames, "toc-hierarchy", false, "Index nested table of contents entries as Sections named \"Chapter > Topic\"")
+	flags.BoolVar(&opts.Glossary, "glossary", false, "Index the terms of glossary pages as Define entries")
+	flags.BoolVar(&opts.Constants, "constants", false, "Index constant and error code tables as Constant/Error entries")
+	flags.BoolVar(&opts.Commands, "commands", false, "Index commands and switches of command reference pages")
+	flags.BoolVar(&opts.Classify, "classify", false, "Guess the types of entries otherwise given -default-type, e.g. Function or Class, from their names and paths")
+	flags.StringVar(&opts.DefaultType, "default-type", "Guide", "Type of the index entries of sitemaps and page titles, e.g. Section or Sample")
+	flags.StringVar(&opts.TypeRules, "type-rules", "", "YAML file of rules giving entries whose name or path matches a regexp a type")
+	flags.BoolVar(&opts.Equations, "equations", false, "Index formula images and MathML by their alt text as Section entries")
+	flags.StringVar(&opts.Report, "report", "", "Write a JSON conversion report to this file")
+	flags.StringVar(&opts.OnlyTypes, "only-types", "", "Comma separated entry types to keep in the index, e.g. Class,Method")
+	flags.StringVar(&opts.DropTypes, "drop-types", "", "Comma separated entry types to remove from the index, e.g. Guide")
+	flags.StringVar(&opts.Deprecated, "deprecated", "", "Regexp matching names or paths of entries to mark as deprecated")
+	flags.StringVar(&opts.DeprecatedMarker, "deprecated-marker", "(deprecated)", "Marker appended to names of deprecated entries, e.g. ⚠")
+	flags.BoolVar(&opts.DetectDeprecated, "detect-deprecated", false, "Mark entries of pages with a Deprecated/Obsolete banner as deprecated")
+	flags.StringVar(&opts.LowPriority, "low-priority", "", "Regexp matching names or paths of entries to rank lower in search")
+	flags.StringVar(&opts.Language, "language", "", "Comma separated languages, e.g. en, of the pages to index; pages detected to be in others are left out")
+	flags.BoolVar(&opts.SplitLanguages, "split-languages", false, "Convert a CHM holding translations in top-level directories into one docset per language")
+	flags.StringVar(&opts.Lang, "lang", "", "Set <html lang> on pages lacking it: a language tag, or auto to use the CHM locale")
+	flags.BoolVar(&opts.About, "about", false, "Write an About page describing the source and the conversion, linked from the start page")
+	flags.BoolVar(&opts.Tgz, "tgz", false, "Also write the docset as a .tgz archive next to it, as Dash feeds serve docsets")
+	flags.StringVar(&opts.DocsetVersion, "docset-version", "", "Version shown on the generated cover page")
+	flags.BoolVar(&opts.LowercasePaths, "lowercase", false, "Rename all files to lower case and rewrite links to them")
+	flags.BoolVar(&opts.RedirectStubs, "redirect-stubs", false, "Write a redirect page at the old path of every renamed page")
+	flags.StringVar(&opts.Name, "name", "", "Docset name (default: name of the input file)")
+	flags.StringVar(&opts.Icon, "icon", "", "PNG icon of the docset")
+	flags.Var(&opts.Excludes, "exclude", "Regexp matching paths of pages to leave out of the index; repeat to add several")
+	flags.StringVar(&opts.Format, "format", formatDocset, "Output format: "+strings.Join(formatNames(), ", "))
+	flags.StringVar(&opts.PathPrefix, "path-prefix", "", "Directory prepended to index paths and root-relative links, e.g. docs/, for Documents served from a web server subdirectory")
+	flags.StringVar(&opts.Extractor, "extractor", extractorBuiltin, "CHM extractor: "+strings.Join(extractorNames(), ", "))
+	flags.StringVar(&opts.HLPHelper, "hlp-helper", defaultHLPHelper, "Program converting WinHelp .hlp files to HTML, run as PROGRAM input.hlp outdir")
+	flags.StringVar(&opts.DownloadDir, "download-dir", "", "Directory keeping the files of sources given as URLs (default: the user cache directory)")
+	flags.Var(&opts.ExtractOnly, "extract-only", "Glob of CHM files to extract, e.g. api/*; others are left out. Repeat to add several")
+	flags.Var(&opts.ExtractSkip, "extract-skip", "Glob of CHM files not to extract, e.g. *.pdf; repeat to add several")
+	flags.Var(&opts.ExtraFiles, "extra-file", "Render the text/template TEMPLATE into the docset bundle at PATH, given as TEMPLATE=PATH; repeat to add several")
+	flags.Int64Var(&opts.MemoryLimit, "memory-limit", defaultMemoryLimit, "MiB of decompressed CHM data and indexed pages to hold in memory at once, 0 for no limit")
+	flags.DurationVar(&opts.ExtractTimeout, "extract-timeout", defaultExtractTimeout, "Stop an external extractor running longer than this")
+	flags.BoolVar(&opts.Strict, "strict", false, "Fail on page errors, broken links and pages not decoding from their charset instead of skipping them with a warning")
+	flags.BoolVar(&opts.KeepTemp, "keep-temp", false, "Keep the temporary files of the conversion for debugging")
+	flags.BoolVar(&opts.Combine, "combine", false, "Combine all input files into one docset named by -name, each in a directory of its own")
+	flags.BoolVar(&opts.Estimate, "estimate", false, "Print the pages, index entries and size a conversion would produce, read from the CHM directory and sitemaps, and exit")
+	flags.BoolVar(&opts.FromDir, "from-dir", false, "Build the docset from already extracted directories given in place of CHM files")
+	flags.BoolVar(&opts.FlattenFrameset, "flatten-frames", false, "Replace frameset pages by their content frame and drop link targets naming frames")
+	flags.BoolVar(&opts.RepairLinks, "fix-links", false, "Repair links to missing files that differ from an extracted file in case, .htm/.html or an extra directory level")
+	flags.BoolVar(&opts.A11y, "accessibility", false, "Add missing alt texts from captions, fix skipped heading levels and label navigation tables")
+	flags.BoolVar(&opts.BreadcrumbBar, "breadcrumbs", false, "Add a trail of the enclosing table of contents entries to the top of every page")
+	flags.BoolVar(&opts.Nav, "nav", false, "Add previous, up and next links in table of contents order to every page")
+	flags.BoolVar(&opts.Timings, "timings", false, "Print the time spent in each conversion stage and index pass")
+	flags.BoolVar(&opts.DiffReport, "diff-report", false, "List regressions against the report kept in the docset by the previous conversion")
+	flags.BoolVar(&opts.KeepHelperPages, "keep-helper-pages", false, "Keep print variants and popup pages in the index")
+	flags.Var(&opts.Skip, "skip", "Page to leave out of the index, remembered for later conversions of the same CHM; repeat to add several")
+	flags.StringVar(&opts.SkipDir, "skip-dir", "", "Directory of the skip-lists (default: chm2docset/skip in the user config directory)")
+	flags.StringVar(&opts.Ctags, "ctags", "", "Write the index entries as a ctags file to this path")
+	flags.StringVar(&opts.DeepLinks, "deep-links", "", "Write a dash:// link for every index entry to this CSV file")
+	flags.StringVar(&opts.DeepLinkTypes, "deep-link-types", "", "Comma-separated entry types to write deep links for (default: all)")
+	flags.StringVar(&opts.SourceMap, "source-map", "", "Write every index entry with the CHM object its page was extracted from to this CSV file")
+	flags.StringVar(&opts.ExportAnnotations, "export-annotations", "", "Write the index entries to this CSV file for editing")
+	flags.StringVar(&opts.ApplyAnnotations, "apply-annotations", "", "Apply the entry names and types edited in this CSV file")
+	flags.StringVar(&opts.Preset, "preset", "", "Configure the output for a docset reader: "+strings.Join(presetNames(), ", "))
+	flags.Var(&opts.Keywords, "keyword", "Search keyword of the docset, e.g. vcl; repeat to add several")
+	flags.IntVar(&opts.CommitEvery, "commit-every", defaultCommitEvery, "Number of index writes per database commit, 0 to commit once at the end")
+	flags.StringVar(&opts.Stages, "stages", "", "Comma separated conversion stages to run, in order: "+strings.Join(pipelineStages, ", ")+" (default: all of them); sanitize and anchor select the rewrite and index stages running those passes")
+	flags.StringVar(&opts.StartContents, "start-contents", "", "List the table of contents on a nearly empty start page: replace opens on a generated contents page, append adds the list to the page")
+	flags.StringVar(&opts.DirTypes, "dir-types", "", "Comma-separated PREFIX=TYPE items typing the entries of pages below a directory otherwise given -default-type, e.g. reference/functions/=Function")
+	flags.StringVar(&opts.Duplicates, "duplicates", duplicateIgnore, "What to do with an entry whose name, type and path are indexed already: POLICY or SOURCE=POLICY items, comma-separated; policies are "+strings.Join(duplicatePolicies, ", "))
+	flags.StringVar(&opts.SourcePriority, "source-priority", defaultSourcePriority, "Entry sources in order of precedence when they index a name and path with different types")
+}
+
 // SourceFilename returns source file name
 func (opts *Options) SourceFilename() string {
 	return filepath.Base(opts.SourcePath)
 }
 
-// Basename returns file basename
+// Basename returns the docset name, by default the file basename
 func (opts *Options) Basename() string {
+	if opts.Name != "" {
+		return opts.Name
+	}
 	fn := opts.SourceFilename()
 	return strings.TrimSuffix(fn, filepath.Ext(fn))
 }
@@ -134,21 +395,51 @@ func (opts *Options) BundleIdentifier() string {
 	return "io.ngs.documentation." + safeBundleRE.ReplaceAllString(opts.Basename(), "")
 }
 
-// WritePlist writes plist file
-func (opts *Options) WritePlist() error {
-	t, err := template.New("plist").Parse(plistTemplate)
-	if err != nil {
-		return fmt.Errorf("parse template: %w", err)
+// Keyword returns the search keywords of the docset separated by commas
+func (opts *Options) Keyword() string {
+	keywords := make([]string, 0, len(opts.Keywords))
+	for _, k := range opts.Keywords {
+		if k = strings.TrimSuffix(strings.TrimSpace(k), ":"); k != "" {
+			keywords = append(keywords, k)
+		}
 	}
+	return strings.Join(keywords, ",")
+}
+
+// PlistContent returns content of Info.plist
+func (opts *Options) PlistContent() string {
+	var buf bytes.Buffer
+	if err := plistTmpl.Execute(&buf, opts); err != nil {
+		return ""
+	}
+	return buf.String()
+}
 
+// WritePlist writes plist file
+func (opts *Options) WritePlist() error {
 	var buf bytes.Buffer
-	if err := t.Execute(&buf, opts); err != nil {
+	if err := plistTmpl.Execute(&buf, opts); err != nil {
 		return fmt.Errorf("execute template: %w", err)
 	}
 
 	return os.WriteFile(opts.PlistPath(), buf.Bytes(), 0644)
 }
 
+// CopyIcon copies the -icon file into the docset
+func (opts *Options) CopyIcon() error {
+	if opts.Icon == "" {
+		return nil
+	}
+	if !strings.EqualFold(filepath.Ext(opts.Icon), ".png") {
+		return fmt.Errorf("%s is not a PNG file", opts.Icon)
+	}
+	b, err := os.ReadFile(opts.Icon)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(opts.DocsetPath(), "icon.png"), b, 0644)
+}
+
 // Clean removes existing output
 func (opts *Options) Clean() error {
 	return os.RemoveAll(opts.DocsetPath())
@@ -159,210 +450,540 @@ func (opts *Options) CreateDirectory() error {
 	return os.MkdirAll(opts.ContentPath(), 0755)
 }
 
-// ExtractSource extracts source to destination
+// ExtractSource extracts source to destination with the -extractor backend,
+// falling back to the other extractors installed. Source directories and
+// .hhp projects are copied instead.
 func (opts *Options) ExtractSource() error {
-	source := filepath.Clean(opts.SourcePath)
-	destination := filepath.Clean(opts.ContentPath())
+	switch {
+	case opts.combined():
+		return opts.extractCombined()
+	case opts.isSourceDir():
+		return opts.copySourceDir()
+	case opts.isProject():
+		return opts.copyProject()
+	}
+	// Titles are read from the pages while they are extracted
+	opts.streamed = newStreamedTitles()
+	return opts.extractFile(opts.SourcePath, opts.ContentPath())
+}
 
-	var bin string
-	var args []string
+// extractFile extracts a CHM into destination with the configured
+// extractor, trying the others in turn when it is missing or fails, and
+// leaves out the files rejected by -extract-only and -extract-skip. Help
+// Viewer, WinHelp and Help 2 files have extractors of their own.
+func (opts *Options) extractFile(source, destination string) error {
+	e, err := opts.extractor()
+	if err != nil {
+		return err
+	}
+	keep, err := opts.extractFilter()
+	if err != nil {
+		return err
+	}
+	builtin := e == extractors[extractorBuiltin]
+	switch {
+	case isMSHCFile(source) && builtin:
+		err = opts.runExtractor(zipExtractor{}, source, destination, keep)
+	case isHLPFile(source) && builtin:
+		err = opts.runExtractor(opts.hlpExtractor(), source, destination, keep)
+	case isHelp2File(source) && builtin:
+		// The built-in reader only reads CHM containers
+		sevenZip := extractors[extractor7z]
+		if _, err := sevenZip.(sevenZipExtractor).bin(); err != nil {
+			return fmt.Errorf("%w; HxS files are extracted with 7-Zip", err)
+		}
+		err = opts.runExtractor(sevenZip, source, destination, keep)
+	default:
+		err = opts.extractChain(source, destination, keep)
+	}
+	if err != nil {
+		return err
+	}
+	if keep == nil {
+		return nil
+	}
+	_, err = pruneExtracted(destination, keep)
+	return err
+}
 
-	if runtime.GOOS == "windows" {
-		bin = "hh.exe"
-		args = []string{"-decompile", destination, source}
-	} else {
-		bin = "extract_chmLib"
-		args = []string{source, destination}
+// extractChain tries the extractors on a CHM in turn: -extractor first,
+// then the others in extractorOrder. Extractors whose program is missing
+// are skipped, and the next is tried when one fails or writes no pages.
+// Protected files stop the chain, as no extractor can read them.
+func (opts *Options) extractChain(source, destination string, keep func(name string) bool) error {
+	first := opts.Extractor
+	if first == "" {
+		first = extractorBuiltin
 	}
+	names := []string{first}
+	for _, name := range extractorOrder {
+		if name != first {
+			names = append(names, name)
+		}
+	}
+
+	var errs []error
+	extracted := false
+	for _, name := range names {
+		e := extractors[name]
+		if b, ok := e.(builtinExtractor); ok {
+			b.memoryLimit = opts.memoryLimit()
+			e = b
+		}
+		if a, ok := e.(availableExtractor); ok {
+			if err := a.available(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if len(errs) > 0 {
+			log.Printf("Trying the %s extractor", name)
+			// Files and titles of an extractor that failed are dropped
+			opts.streamed.reset()
+			if err := os.RemoveAll(destination); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(destination, 0755); err != nil {
+				return err
+			}
+		}
+		err := opts.runExtractor(e, source, destination, keep)
+		if errors.Is(err, chm.ErrProtected) {
+			return err
+		}
+		if err != nil {
+			log.Printf("The %s extractor failed: %v", name, err)
+			errs = append(errs, err)
+			continue
+		}
+		extracted = true
+		if hasPages(destination) {
+			if len(errs) > 0 {
+				log.Printf("Extracted %s with the %s extractor", source, name)
+			}
+			return nil
+		}
+		log.Printf("The %s extractor wrote no pages", name)
+		errs = append(errs, fmt.Errorf("%s: %w", name, errNoPages))
+	}
+	if extracted {
+		// CheckExtracted reports the missing pages
+		return nil
+	}
+	return errors.Join(errs...)
+}
 
-	// Check if the binary exists in PATH
-	if _, err := exec.LookPath(bin); err != nil {
-		return fmt.Errorf("dependency missing: %s is required but not found in PATH: %w", bin, err)
+// runExtractor runs e, filtering while extracting when it supports it
+func (opts *Options) runExtractor(e Extractor, source, destination string, keep func(name string) bool) error {
+	timeout := opts.ExtractTimeout
+	if timeout <= 0 {
+		timeout = defaultExtractTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch c := e.(type) {
+	case commandExtractor:
+		c.temp = opts.temp
+		e = c
+	case sevenZipExtractor:
+		c.temp = opts.temp
+		e = c
+	}
+	if s, ok := e.(streamingExtractor); ok && opts.streamed != nil && destination == opts.ContentPath() {
+		return s.ExtractStreaming(ctx, source, destination, keep, opts.streamed.add)
+	}
+	if f, ok := e.(filteredExtractor); ok && keep != nil {
+		return f.ExtractFiltered(ctx, source, destination, keep)
 	}
+	return e.Extract(ctx, source, destination)
+}
+
+// errNoPages is returned when extraction succeeded but produced no pages
+var errNoPages = errors.New("no pages were extracted")
 
-	cmd := exec.Command(bin, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// Exit codes of failures that need action on the input file. Usage errors
+// exit with 2 and other errors with 1.
+const (
+	exitProtected = 3
+	exitNoPages   = 4
+)
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("command execution failed (%s): %w", bin, err)
+// CheckSource fails with chm.ErrProtected if the source is DRM-protected
+// or encrypted, which the extractors would silently turn into an empty
+// docset. Files the reader cannot parse are left to the extractor.
+func (opts *Options) CheckSource() error {
+	if opts.combined() {
+		for _, source := range opts.Sources {
+			part := Options{SourcePath: source}
+			if err := part.CheckSource(); err != nil {
+				return fmt.Errorf("%s: %w", source, err)
+			}
+		}
+		return nil
+	}
+	if isHelp2File(opts.SourcePath) {
+		// The reader would take its container for a protected e-book
+		return nil
+	}
+	r, err := chm.Open(opts.SourcePath)
+	if errors.Is(err, chm.ErrProtected) {
+		return fmt.Errorf("%w; remove the protection with the publisher's tools before converting", err)
+	}
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	if protection := r.Protection(); protection != "" {
+		return fmt.Errorf("%w: %s; remove the protection with the publisher's tools before converting", chm.ErrProtected, protection)
 	}
+	return nil
+}
 
+// CheckExtracted fails if the content directory holds no pages
+func (opts *Options) CheckExtracted() error {
+	if !hasPages(opts.ContentPath()) {
+		return fmt.Errorf("%w from %s; it may be damaged, protected, or hold no HTML topics", errNoPages, opts.SourcePath)
+	}
 	return nil
 }
 
+// hasPages reports whether there is an HTML page below dir
+func hasPages(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && isHTMLFile(path) {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// exitCode returns the process exit code for an error of run
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, chm.ErrProtected):
+		return exitProtected
+	case errors.Is(err, errNoPages):
+		return exitNoPages
+	}
+	return 1
+}
+
 // decodeToUTF8 attempts to detect the encoding from the meta tag and decode to UTF-8.
 func decodeToUTF8(b []byte, fallback string) string {
+	return decodeCharset(b, detectCharset(b, fallback))
+}
+
+// detectCharset returns the charset declared by a meta tag, or fallback if none
+func detectCharset(b []byte, fallback string) string {
 	searchLimit := len(b)
 	if searchLimit > 4096 {
 		searchLimit = 4096
 	}
 	match := metaCharsetRE.FindSubmatch(b[:searchLimit])
-	var charsetName string
 	if len(match) < 2 {
-		if fallback != "" {
-			charsetName = fallback
-		} else {
-			return string(b)
-		}
-	} else {
-		charsetName = strings.ToLower(string(match[1]))
+		return fallback
 	}
-	if charsetName == "utf-8" || charsetName == "utf8" {
+	return strings.ToLower(string(match[1]))
+}
+
+// decodeCharset decodes b from the named charset to UTF-8, returning it
+// unchanged if the charset is unknown
+func decodeCharset(b []byte, charsetName string) string {
+	if charsetName == "" || charsetName == "utf-8" || charsetName == "utf8" {
 		return string(b)
 	}
-	enc, err := getEncoding(charsetName)
-	if err != nil {
+	p := decoderPoolFor(charsetName)
+	if p.err != nil || p.enc == nil {
 		return string(b)
 	}
-	reader := transform.NewReader(bytes.NewReader(b), enc.NewDecoder())
-	decodedBytes, err := io.ReadAll(reader)
+	dec := p.decoders.Get().(*encoding.Decoder)
+	defer p.decoders.Put(dec)
+	decodedBytes, err := dec.Bytes(b)
 	if err != nil {
 		return string(b)
 	}
 	return string(decodedBytes)
 }
 
-func getEncoding(name string) (encoding.Encoding, error) {
-	enc, err := ianaindex.MIME.Encoding(name)
-	if err != nil {
-		enc, err = ianaindex.IANA.Encoding(name)
+// decoderPool holds the encoding of a charset and reusable decoders for it.
+// Decoders are stateful, so each is used by one goroutine at a time.
+type decoderPool struct {
+	enc      encoding.Encoding
+	err      error
+	decoders sync.Pool
+}
+
+// decoderPools caches a decoderPool per charset name across conversions
+var decoderPools sync.Map
+
+// decoderPoolFor returns the cached decoders of a charset, resolving its
+// name in the IANA index on first use
+func decoderPoolFor(name string) *decoderPool {
+	if p, ok := decoderPools.Load(name); ok {
+		return p.(*decoderPool)
 	}
-	return enc, err
+	p := &decoderPool{}
+	p.enc, p.err = ianaindex.MIME.Encoding(name)
+	if p.err != nil {
+		p.enc, p.err = ianaindex.IANA.Encoding(name)
+	}
+	if enc := p.enc; enc != nil {
+		p.decoders.New = func() interface{} { return enc.NewDecoder() }
+	}
+	actual, _ := decoderPools.LoadOrStore(name, p)
+	return actual.(*decoderPool)
 }
 
 // extractTitle reads the file header, handles encoding, and finds the HTML title
-func extractTitle(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+func extractTitle(pages *pageCache, path string) (string, error) {
+	var b []byte
+	if pages != nil {
+		page, err := pages.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		b = page[:min(len(page), headerReadLimit)]
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if b, err = io.ReadAll(io.LimitReader(f, headerReadLimit)); err != nil {
+			return "", err
+		}
 	}
-	defer f.Close()
+	return headerTitle(b)
+}
 
-	b, err := io.ReadAll(io.LimitReader(f, headerReadLimit))
-	if err != nil {
-		return "", err
-	}
+// headerTitle returns the title of a page from its first headerReadLimit
+// bytes
+func headerTitle(b []byte) (string, error) {
 	content := decodeToUTF8(b, "")
 	match := titleRE.FindStringSubmatch(content)
 	if len(match) >= 2 {
 		title := html.UnescapeString(match[1])
+		if !utf8.ValidString(title) {
+			return "", errDecode
+		}
 		return strings.Join(strings.Fields(title), " "), nil
 	}
 	return "", nil
 }
 
-// CreateDatabase creates database and initiates indexing
+// CreateDatabase builds the search index in memory and writes it to the
+// docset database
 func (opts *Options) CreateDatabase() error {
-	os.Remove(opts.DatabasePath())
+	ranks, err := parseSourcePriority(opts.SourcePriority)
+	if err != nil {
+		return err
+	}
+	opts.sourceRanks = ranks
+	if opts.duplicatePolicies, err = parseDuplicatePolicies(opts.Duplicates); err != nil {
+		return err
+	}
+	if opts.dirTypes, err = parseDirTypes(opts.DirTypes); err != nil {
+		return err
+	}
+	if err := opts.loadTypeRules(); err != nil {
+		return err
+	}
+	opts.entries = map[entryKey]entryOrigin{}
+	if err := opts.indexContentFiles(); err != nil {
+		return fmt.Errorf("listing content: %w", err)
+	}
 
-	db, err := sql.Open("sqlite", opts.DatabasePath())
+	db, err := sql.Open(sqliteDriver, ":memory:")
 	if err != nil {
 		return fmt.Errorf("open db: %w", err)
 	}
 	defer db.Close()
+	// Every connection to :memory: opens a database of its own
+	db.SetMaxOpenConns(1)
 
 	if _, err = db.Exec(dbSchema); err != nil {
 		return fmt.Errorf("create schema: %w", err)
 	}
 
+	err = opts.buildIndex(db)
+	// Entries committed before a failure are kept
+	if derr := dumpDatabase(db, opts.DatabasePath()); err == nil && derr != nil {
+		err = fmt.Errorf("writing db: %w", derr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkDatabase(opts.DatabasePath()); err != nil {
+		return fmt.Errorf("checking db: %w", err)
+	}
+	return nil
+}
+
+// buildIndex runs the index passes and finalizes the index
+func (opts *Options) buildIndex(db *sql.DB) error {
+	if opts.pageScans() > 1 {
+		opts.pages = newPageCache(opts.memoryLimit())
+		defer func() { opts.pages = nil }()
+	}
+	w := newDBWriter(db, opts.CommitEvery)
+	err := opts.indexDocs(w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("indexing: %w", err)
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	if err := opts.indexDocs(tx); err != nil {
-		return fmt.Errorf("indexing: %w", err)
+	if err := opts.finalizeIndex(tx); err != nil {
+		return fmt.Errorf("finalizing index: %w", err)
 	}
 
 	return tx.Commit()
 }
 
-// indexDocs coordinates the indexing process with priority: HHK -> HHC -> Walk
-func (opts *Options) indexDocs(tx *sql.Tx) error {
+// indexDocs coordinates the indexing process. The first available of HHK,
+// HHC and title scrape in -source-priority order provides the main entries;
+// the HHK keywords are completed by the titles of pages without any.
+func (opts *Options) indexDocs(db *dbWriter) error {
 	basePath := opts.ContentPath()
+	hhcPath := findFileByExt(basePath, ".hhc")
+	hhkPath := findFileByExt(basePath, ".hhk")
 
-	// Helper to find the first file with a specific extension
-	findFileByExt := func(ext string) string {
-		var found string
-		filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
-			if err == nil && !d.IsDir() && strings.EqualFold(filepath.Ext(path), ext) {
-				found = path
-				return fs.SkipAll // Stop search after first match
-			}
-			return nil
+	var err error
+	switch opts.mainSource(hhkPath != "", hhcPath != "") {
+	case sourceHHK:
+		log.Printf("Indexing using HHK file: %s", filepath.Base(hhkPath))
+		var listed map[string]bool
+		err = opts.timeStage("index/hhk", func() (err error) {
+			listed, err = opts.indexSitemap(db, hhkPath, sourceHHK)
+			return err
+		})
+		if err == nil {
+			// Pages without keywords stay findable by their titles
+			err = opts.timeStage("index/title", func() error { return opts.indexHTMLFiles(db, listed) })
+		}
+	case sourceHHC:
+		log.Printf("Indexing using HHC file: %s", filepath.Base(hhcPath))
+		var listed map[string]bool
+		err = opts.timeStage("index/hhc", func() (err error) {
+			listed, err = opts.indexSitemap(db, hhcPath, sourceHHC)
+			return err
 		})
-		return found
+		if err == nil {
+			// Topics shown in inline frames are not in the table of contents
+			err = opts.timeStage("index/iframes", func() error { return opts.indexIFrames(db, listed) })
+		}
+	default:
+		log.Println("No index files found. Scanning HTML files...")
+		err = opts.timeStage("index/title", func() error { return opts.indexHTMLFiles(db, nil) })
 	}
-	if hhkPath := findFileByExt(".hhk"); hhkPath != "" {
-		log.Printf("Indexing using HHK file: %s", filepath.Base(hhkPath))
-		return opts.indexSitemap(tx, hhkPath)
+	if err != nil {
+		return err
 	}
-	if hhcPath := findFileByExt(".hhc"); hhcPath != "" {
-		log.Printf("Indexing using HHC file: %s", filepath.Base(hhcPath))
-		return opts.indexSitemap(tx, hhcPath)
+
+	passes := []struct {
+		enabled bool
+		source  string
+		run     func() error
+	}{
+		{opts.Glossary, sourceGlossary, func() error { return opts.indexGlossary(db, hhcPath) }},
+		{opts.Constants, sourceConstants, func() error { return opts.indexTables(db) }},
+		{opts.Commands, sourceCommands, func() error { return opts.indexCommands(db) }},
+		{opts.Equations, sourceEquations, func() error { return opts.indexEquations(db) }},
 	}
-	log.Println("No index files found. Scanning HTML files...")
-	return opts.indexHTMLFiles(tx)
+	for _, pass := range passes {
+		if !pass.enabled {
+			continue
+		}
+		if err := opts.timeStage("index/"+pass.source, pass.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findFileByExt returns the first file below basePath with the given extension
+func findFileByExt(basePath, ext string) string {
+	var found string
+	filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.EqualFold(filepath.Ext(path), ext) {
+			found = path
+			return fs.SkipAll // Stop search after first match
+		}
+		return nil
+	})
+	return found
+}
+
+// mainSource returns the highest ranked of the HHK, HHC and title sources
+// that is available
+func (opts *Options) mainSource(hasHHK, hasHHC bool) string {
+	best := sourceTitle
+	if hasHHK && opts.sourceRanks[sourceHHK] < opts.sourceRanks[best] {
+		best = sourceHHK
+	}
+	if hasHHC && opts.sourceRanks[sourceHHC] < opts.sourceRanks[best] {
+		best = sourceHHC
+	}
+	return best
 }
 
-// indexSitemap parses HHK or HHC files and indexes content
-func (opts *Options) indexSitemap(tx *sql.Tx, path string) error {
+// indexSitemap parses HHK or HHC files and indexes content. It returns the
+// content files the entries point at.
+func (opts *Options) indexSitemap(db *dbWriter, path, source string) (map[string]bool, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	content := decodeToUTF8(b, defaultSitemapEncoding)
-	stmt, err := tx.Prepare("INSERT OR IGNORE INTO searchIndex(name, type, path) VALUES (?, ?, ?)")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
+	w := newIndexWriter(db, opts, source)
+	listed := map[string]bool{}
 
 	// HHK/HHC files are often messy HTML. We extract <OBJECT> tags regex-based.
-	objects := sitemapObjectRE.FindAllStringSubmatch(content, -1)
-	count := 0
-
-	for _, objMatch := range objects {
-		if len(objMatch) < 2 {
+	for _, item := range parseSitemap(content) {
+		if item.Local == "" {
 			continue
 		}
-		objContent := objMatch[1]
-
-		nameMatch := paramNameRE.FindStringSubmatch(objContent)
-		localMatch := paramLocalRE.FindStringSubmatch(objContent)
-
-		if len(nameMatch) >= 2 && len(localMatch) >= 2 {
-			name := html.UnescapeString(nameMatch[1])
-			path := filepath.ToSlash(html.UnescapeString(localMatch[1]))
-
-			name = strings.Join(strings.Fields(name), " ")
-
-			if name != "" && path != "" {
-				if _, err := stmt.Exec(name, "Guide", path); err != nil {
-					return err
-				}
-				count++
+		name, entryType := item.Name, opts.defaultType()
+		if source == sourceHHC && opts.TOCNames {
+			name, entryType = opts.tocName(item)
+		}
+		// A keyword pointing at several topics gets an entry for each
+		for _, local := range append([]string{item.Local}, item.More...) {
+			if page, _, ok := opts.resolveLocal(local); ok {
+				listed[page] = true
+			}
+			if err := w.Add(name, entryType, opts.sitemapPath(local)); err != nil {
+				return nil, err
 			}
 		}
 	}
 
-	log.Printf("Indexed %d entries from sitemap", count)
-	return nil
+	log.Printf("Indexed %d entries from sitemap", w.count)
+	return listed, nil
 }
 
-// indexHTMLFiles walks the content directory and populates the database from HTML titles
-func (opts *Options) indexHTMLFiles(tx *sql.Tx) error {
-	stmt, err := tx.Prepare("INSERT OR IGNORE INTO searchIndex(name, type, path) VALUES (?, ?, ?)")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
+// indexHTMLFiles walks the content directory and populates the database
+// from HTML titles, leaving out the pages in skip. Titles listed in the
+// topic table of the CHM are taken from there; only other pages are read.
+func (opts *Options) indexHTMLFiles(db *dbWriter, skip map[string]bool) error {
+	w := newIndexWriter(db, opts, sourceTitle)
+	topicTitles := opts.topicTitles()
+	fromTopics, fromExtraction := 0, 0
 
 	basePath := opts.ContentPath()
-	return filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -370,63 +991,181 @@ func (opts *Options) indexHTMLFiles(tx *sql.Tx) error {
 			return nil
 		}
 
-		ext := filepath.Ext(path)
-		if !strings.EqualFold(ext, ".htm") && !strings.EqualFold(ext, ".html") {
+		if !isHTMLFile(path) {
 			return nil
 		}
 
-		title, err := extractTitle(path)
+		relPath, err := filepath.Rel(basePath, path)
 		if err != nil {
-			log.Printf("Warning: skipping file %s due to error: %v", path, err)
-			return nil
+			return err
 		}
-
-		if title == "" {
+		relPath = filepath.ToSlash(relPath)
+		if skip[relPath] {
 			return nil
 		}
 
-		relPath, err := filepath.Rel(basePath, path)
+		title, from, err := opts.pageTitle(topicTitles, relPath, path)
 		if err != nil {
-			return err
+			opts.pageErrorf("skipping file %s due to error: %v", path, err)
+			opts.skipPage(relPath, readErrorReason(err))
+			return nil
+		}
+		switch from {
+		case titleFromTopics:
+			fromTopics++
+		case titleFromExtraction:
+			fromExtraction++
 		}
-		relPath = filepath.ToSlash(relPath)
 
-		if _, err = stmt.Exec(title, "Guide", relPath); err != nil {
-			return err
+		if title == "" {
+			opts.skipPage(relPath, skipNoTitle)
+			return nil
 		}
 
-		return nil
+		return w.Add(title, opts.defaultType(), indexPath(relPath))
 	})
+	if fromTopics > 0 {
+		log.Printf("Took %d titles from the topic table", fromTopics)
+	}
+	if fromExtraction > 0 {
+		log.Printf("Took %d titles read while extracting", fromExtraction)
+	}
+	return err
+}
+
+// Convert runs every conversion step for a single source
+func (opts *Options) Convert(cache *buildCache) error {
+	order, err := opts.stageOrder()
+	if err != nil {
+		return err
+	}
+	opts.report = opts.newReport()
+	previous := opts.previousReport()
+	steps := []struct {
+		stage, what string
+		run         func() error
+	}{
+		{"read", "checking source", opts.CheckSource},
+		{"read", "reading #SYSTEM", opts.ReadSystem},
+		{"read", "reading topic table", opts.ReadTopics},
+		{"extract", "cleaning output", opts.Clean},
+		{"extract", "creating directories", opts.CreateDirectory},
+		{"extract", "extracting source", func() error { return cache.Extract(opts) }},
+		{"extract", "converting Help 2 tables", opts.ConvertHelp2},
+		{"extract", "reading Help Viewer metadata", opts.ConvertMSHC},
+		{"extract", "merging child CHMs", opts.MergeChildren},
+		{"extract", "pruning other languages", opts.PruneLanguages},
+		{"extract", "checking extracted files", opts.CheckExtracted},
+		{"extract", "writing binary TOC", opts.WriteBinaryTOC},
+		{"extract", "counting pages", opts.countPages},
+		{"transcode", "decoding file names", opts.DecodeFileNames},
+		{"rewrite", "rewriting pages", opts.Rewrite},
+		{"rewrite", "writing missing-page stubs", opts.WriteMissingStubs},
+		{"rewrite", "checking pages", opts.CheckPages},
+		{"index", "counting pages", func() error {
+			// Counted while extracting, unless the content is left from before
+			if slices.Contains(order, "extract") {
+				return nil
+			}
+			return opts.countPages()
+		}},
+		{"index", "loading skip-list", opts.loadSkipList},
+		{"index", "creating database", opts.CreateDatabase},
+		{"index", "counting entries", opts.countEntries},
+		{"index", "scoring index", opts.scoreIndex},
+		{"package", "choosing start page", opts.ChooseIndexFile},
+		{"package", "adding contents to start page", opts.AddStartContents},
+		{"package", "writing about page", opts.WriteAbout},
+		{"package", "writing plist", opts.WritePlist},
+		{"package", "copying icon", opts.CopyIcon},
+		{"package", "writing tags", opts.WriteTags},
+		{"package", "writing deep links", opts.WriteDeepLinks},
+		{"package", "writing source map", opts.WriteSourceMap},
+		{"package", "rebasing paths", opts.RebasePaths},
+		{"package", "writing extra files", opts.WriteExtraFiles},
+		{"export", "exporting " + opts.Format, opts.Export},
+	}
+	for _, stage := range order {
+		for _, step := range steps {
+			if step.stage != stage {
+				continue
+			}
+			err := opts.timeStage(step.stage, step.run)
+			if err == nil {
+				err = opts.strictErr()
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", step.what, err)
+			}
+		}
+	}
+	if err := opts.finishReport(previous); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	// Archived last, so that the archive holds the report kept in the docset
+	if slices.Contains(order, "package") {
+		if err := opts.timeStage("package", opts.WriteTgz); err != nil {
+			return fmt.Errorf("archiving docset: %w", err)
+		}
+	}
+	return nil
 }
 
 func run() error {
-	opts := parseFlags()
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			return cmd(os.Args[2:])
+		}
+	}
+	opts := NewOptions()
 	if opts == nil {
 		usage()
 		return nil
 	}
-
-	if err := opts.Clean(); err != nil {
-		return fmt.Errorf("cleaning output: %w", err)
+	opts.temp = newTempRoot(opts.KeepTemp)
+	defer opts.temp.Remove()
+	defer opts.temp.RemoveOnSignal()()
+	if err := opts.fetchSources(context.Background()); err != nil {
+		return err
+	}
+	builds, err := opts.Builds()
+	if err != nil {
+		return err
 	}
-	if err := opts.CreateDirectory(); err != nil {
-		return fmt.Errorf("creating directories: %w", err)
+	if opts.Estimate {
+		for i, build := range builds {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := build.writeEstimates(os.Stdout); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	if err := opts.ExtractSource(); err != nil {
-		return fmt.Errorf("extracting source: %w", err)
+	err = runBuilds(builds, opts.Jobs)
+
+	var reports []*DocsetReport
+	for _, build := range builds {
+		if build.report != nil {
+			reports = append(reports, build.report)
+		}
 	}
-	if err := opts.CreateDatabase(); err != nil {
-		return fmt.Errorf("creating database: %w", err)
+	logReports(reports)
+	if opts.Timings {
+		writeTimings(os.Stderr, reports)
 	}
-	if err := opts.WritePlist(); err != nil {
-		return fmt.Errorf("writing plist: %w", err)
+	if opts.Report != "" {
+		if werr := writeReports(opts.Report, reports); werr != nil {
+			return errors.Join(err, fmt.Errorf("writing report: %w", werr))
+		}
 	}
-
-	return nil
+	return err
 }
 
 func main() {
 	if err := run(); err != nil {
-		log.Fatalf("Error: %v", err)
+		log.Printf("Error: %v", err)
+		os.Exit(exitCode(err))
 	}
 }
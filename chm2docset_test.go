@@ -2,18 +2,30 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+
+	"chm2docset/chm"
 )
 
 func cleanTmp() {
 	os.RemoveAll("tmp")
 }
 
+// Puts fixture executables in front of PATH.
+func useFixtureBin() {
+	bin, _ := filepath.Abs("_fixtures/bin")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
 type Test struct {
 	actual   interface{}
 	expected interface{}
@@ -258,21 +270,41 @@ func TestExtractSource(t *testing.T) {
 	opts := &Options{
 		SourcePath: "/foo/bar/baz.chm",
 		Outdir:     "tmp/foo.docset",
+		Extractor:  extractorChmlib,
 	}
 	opts.CreateDirectory()
-	os.Setenv("PATH", "_fixtures/bin:"+os.Getenv("PATH"))
+	useFixtureBin()
+	os.Setenv("CHM2DOCSET_SECRET", "1")
+	defer os.Unsetenv("CHM2DOCSET_SECRET")
 	err := opts.ExtractSource()
 	if err != nil {
 		t.Errorf("Expected nil but got %v", err)
 	}
-	b, err := ioutil.ReadFile("tmp/fixtureinput.txt")
+	b, err := ioutil.ReadFile("tmp/foo.docset/Contents/Resources/Documents/fixtureinput.txt")
 	if err != nil {
 		t.Errorf("Expected nil but got %v", err)
 	}
-	Test{string(b), "/foo/bar/baz.chm tmp/foo.docset/Contents/Resources/Documents\n"}.Compare(t)
+	lines := strings.Split(string(b), "\n")
+	content, _ := filepath.Abs(opts.ContentPath())
+	Test{lines[0], "/foo/bar/baz.chm " + content}.Compare(t)
+	// The extractor runs in a scratch directory without the environment
+	Test{strings.Contains(string(b), "HOME="+lines[1]+"\n"), true}.Compare(t)
+	Test{strings.Contains(string(b), "CHM2DOCSET_SECRET"), false}.Compare(t)
 	cleanTmp()
 }
 
+func TestExtractSourceBuiltin(t *testing.T) {
+	opts := &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp/foo.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	if err := opts.ExtractSource(); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	b, err := os.ReadFile("tmp/foo.docset/Contents/Resources/Documents/sub/lost.htm")
+	Test{err, nil}.Compare(t)
+	Test{strings.Contains(string(b), "<title>Lost</title>"), true}.Compare(t)
+}
+
 func TestCreateDatabase(t *testing.T) {
 	opts := &Options{
 		SourcePath: "/foo/bar/baz.chm",
@@ -281,7 +313,8 @@ func TestCreateDatabase(t *testing.T) {
 	opts.Clean()
 	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
 	opts.CreateDatabase()
-	db, _ := sql.Open("sqlite3", opts.DatabasePath())
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
 	rows, _ := db.Query("SELECT * FROM searchIndex")
 	columns, _ := rows.Columns()
 	Test{columns, []string{"id", "name", "type", "path"}}.DeepEqual(t)
@@ -298,9 +331,70 @@ func TestCreateDatabase(t *testing.T) {
 		grid = append(grid, []string{id, name, indexType, path})
 	}
 	Test{grid, [][]string{
-		{"1", "test 4", "Guide", "/sub/test4.htm"},
-		{"2", "test 1", "Guide", "/test1.htm"},
-		{"3", "test 2 yo", "Guide", "/test2.htm"},
+		{"1", "test 4", "Guide", "sub/test4.htm"},
+		{"2", "test 1", "Guide", "test1.htm"},
+		{"3", "test 2 yo", "Guide", "test2.htm"},
 	}}.DeepEqual(t)
 	cleanTmp()
 }
+
+func TestDecodeCharsetConcurrent(t *testing.T) {
+	cp1251 := []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				Test{decodeCharset(cp1251, "windows-1251"), "Привет"}.Compare(t)
+			}
+		}()
+	}
+	wg.Wait()
+	Test{decoderPoolFor("windows-1251") == decoderPoolFor("windows-1251"), true}.Compare(t)
+	Test{decodeCharset([]byte("abc"), "no-such-charset"), "abc"}.Compare(t)
+}
+
+func TestPlistKeywords(t *testing.T) {
+	os.Args = []string{"chm2docset", "-keyword", "vcl:", "-keyword", " delphi", "/foo/bar/baz.chm"}
+	opts := NewOptions()
+	Test{opts.Keyword(), "vcl,delphi"}.Compare(t)
+	Test{strings.Contains(opts.PlistContent(), `
+    <key>DashDocSetKeyword</key>
+    <string>vcl,delphi</string>
+`), true}.Compare(t)
+}
+
+func TestCheckSource(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/book.chm", append([]byte("ITOLITLS"), make([]byte, 0x60)...), 0644)
+	for _, test := range []struct {
+		source    string
+		protected bool
+	}{
+		{"_fixtures/sample.chm", false},
+		{"tmp/book.chm", true},
+		{"/foo/bar/baz.chm", false},
+	} {
+		opts := &Options{SourcePath: test.source}
+		err := opts.CheckSource()
+		Test{errors.Is(err, chm.ErrProtected), test.protected}.Compare(t)
+		if test.protected {
+			Test{exitCode(err), exitProtected}.Compare(t)
+		}
+	}
+}
+
+func TestCheckExtracted(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	os.WriteFile(opts.ContentPath()+"/logo.gif", []byte("GIF89a"), 0644)
+	err := opts.CheckExtracted()
+	Test{exitCode(err), exitNoPages}.Compare(t)
+
+	os.WriteFile(opts.ContentPath()+"/index.htm", []byte("<html></html>"), 0644)
+	Test{opts.CheckExtracted(), nil}.Compare(t)
+	Test{exitCode(errors.New("other")), 1}.Compare(t)
+}
@@ -0,0 +1,237 @@
+// Package chmfs exposes the content files of a CHM as an io/fs.FS, so that
+// they can be read, walked or served without extracting them first. It is
+// meant for other programs; the conversion still indexes extracted files.
+package chmfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chm2docset/chm"
+)
+
+// FS is the tree of content files of a CHM. Directories are derived from
+// the file names. Lookups fall back to case-insensitive matching, like the
+// HTML Help viewer's. It is safe for concurrent use.
+type FS struct {
+	mu     sync.Mutex
+	r      *chm.Reader
+	files  map[string]chm.File
+	dirs   map[string][]string
+	folded map[string]string
+}
+
+// Open opens the named CHM file. The returned FS is an *FS, to be closed
+// when done with.
+func Open(name string) (fs.FS, error) {
+	r, err := chm.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return New(r), nil
+}
+
+// New returns the tree of content files of r. Closing the FS closes r.
+func New(r *chm.Reader) *FS {
+	f := &FS{
+		r:      r,
+		files:  map[string]chm.File{},
+		dirs:   map[string][]string{".": nil},
+		folded: map[string]string{},
+	}
+	for _, file := range r.Files() {
+		if !file.IsContent() {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(file.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if _, ok := f.files[name]; ok {
+			continue
+		}
+		f.files[name] = file
+		f.addFolded(name)
+		// Register the file in its parents, creating them as needed
+		for child := name; child != "."; {
+			parent := path.Dir(child)
+			_, known := f.dirs[parent]
+			f.dirs[parent] = append(f.dirs[parent], path.Base(child))
+			if known {
+				break
+			}
+			f.addFolded(parent)
+			child = parent
+		}
+	}
+	for dir, names := range f.dirs {
+		sort.Strings(names)
+		f.dirs[dir] = names
+	}
+	return f
+}
+
+func (f *FS) addFolded(name string) {
+	key := strings.ToLower(name)
+	if _, ok := f.folded[key]; !ok {
+		f.folded[key] = name
+	}
+}
+
+// Close closes the underlying CHM reader
+func (f *FS) Close() error {
+	return f.r.Close()
+}
+
+// resolve returns the name of the file or directory name refers to
+func (f *FS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := f.files[name]; ok {
+		return name, nil
+	}
+	if _, ok := f.dirs[name]; ok {
+		return name, nil
+	}
+	if found, ok := f.folded[strings.ToLower(name)]; ok {
+		return found, nil
+	}
+	return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *FS) info(name string) fileInfo {
+	if file, ok := f.files[name]; ok {
+		return fileInfo{name: path.Base(name), size: int64(file.Length)}
+	}
+	return fileInfo{name: path.Base(name), dir: true}
+}
+
+// Open opens a file or directory
+func (f *FS) Open(name string) (fs.File, error) {
+	found, err := f.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.files[found]; !ok {
+		entries, err := f.ReadDir(found)
+		if err != nil {
+			return nil, err
+		}
+		return &dir{info: f.info(found), entries: entries}, nil
+	}
+	b, err := f.ReadFile(found)
+	if err != nil {
+		return nil, err
+	}
+	return &file{info: f.info(found), Reader: bytes.NewReader(b)}, nil
+}
+
+// ReadFile returns the content of a file, decompressing it as needed
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	found, err := f.resolve("read", name)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := f.files[found]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, err := f.r.ReadFile(file.Name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return b, nil
+}
+
+// ReadDir returns the entries of a directory sorted by name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	found, err := f.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	names, ok := f.dirs[found]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries := make([]fs.DirEntry, len(names))
+	for i, child := range names {
+		entries[i] = fs.FileInfoToDirEntry(f.info(path.Join(found, child)))
+	}
+	return entries, nil
+}
+
+// Stat describes a file or directory without reading it
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	found, err := f.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.info(found), nil
+}
+
+// fileInfo describes an entry of the tree. CHMs keep no modification
+// times, so they are all zero.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// file is an open content file, read into memory
+type file struct {
+	info fileInfo
+	*bytes.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is an open directory
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,67 @@
+package chmfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	fsys, err := Open("../_fixtures/sample.chm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.(*FS).Close()
+	if err := fstest.TestFS(fsys, "index.htm", "page.htm", "img/logo.gif", "sub/lost.htm"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSWalk(t *testing.T) {
+	fsys, err := Open("../_fixtures/sample.chm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.(*FS).Close()
+	var names []string
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"img/logo.gif", "index.htm", "page.htm", "sub/lost.htm"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Errorf("Expected %v but got %v", expected, names)
+		}
+	}
+}
+
+func TestFSCaseInsensitive(t *testing.T) {
+	fsys, err := Open("../_fixtures/sample.chm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.(*FS).Close()
+	b, err := fs.ReadFile(fsys, "Index.HTM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 226 {
+		t.Errorf("Expected 226 bytes but got %d", len(b))
+	}
+	if _, err := fs.Stat(fsys, "missing.htm"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist but got %v", err)
+	}
+	if _, err := fs.Stat(fsys, "../index.htm"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Expected fs.ErrInvalid but got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// typeSuffixRE matches titles naming the kind of symbol they document,
+	// e.g. "CreateFile Function" or "TForm.Show Method"
+	typeSuffixRE = regexp.MustCompile(`^\S+\s+(?i:(function|class|method|property|constant|enumeration|enum|interface|structure|struct|event|field|namespace|macro|operator|constructor|delegate|module|type|variable))$`)
+	// callRE matches symbol names followed by an argument list, e.g.
+	// "printf()" or "TForm.Show(Sender)"
+	callRE = regexp.MustCompile(`^[A-Za-z_][\w:.]*\s*\([^()]*\)$`)
+	// identifierRE matches a symbol name, possibly qualified
+	identifierRE = regexp.MustCompile(`^[A-Za-z_]\w*(?:(?:\.|::)[A-Za-z_]\w*)*$`)
+	// constantNameRE matches names such as MAX_PATH
+	constantNameRE = regexp.MustCompile(`^[A-Z][A-Z0-9]*(?:_[A-Z0-9]+)+$`)
+)
+
+// typeWords maps the words of typeSuffixRE, and directory names, to Dash
+// entry types
+var typeWords = map[string]string{
+	"function":     "Function",
+	"functions":    "Function",
+	"class":        "Class",
+	"classes":      "Class",
+	"method":       "Method",
+	"methods":      "Method",
+	"property":     "Property",
+	"properties":   "Property",
+	"constant":     "Constant",
+	"constants":    "Constant",
+	"enumeration":  "Enum",
+	"enumerations": "Enum",
+	"enum":         "Enum",
+	"enums":        "Enum",
+	"interface":    "Interface",
+	"interfaces":   "Interface",
+	"structure":    "Struct",
+	"structures":   "Struct",
+	"struct":       "Struct",
+	"structs":      "Struct",
+	"event":        "Event",
+	"events":       "Event",
+	"field":        "Field",
+	"fields":       "Field",
+	"namespace":    "Namespace",
+	"namespaces":   "Namespace",
+	"macro":        "Macro",
+	"macros":       "Macro",
+	"operator":     "Operator",
+	"operators":    "Operator",
+	"constructor":  "Constructor",
+	"delegate":     "Delegate",
+	"module":       "Module",
+	"modules":      "Module",
+	"type":         "Type",
+	"types":        "Type",
+	"variable":     "Variable",
+	"variables":    "Variable",
+}
+
+// apiDirs are directory names of reference pages, whose symbol names are
+// classified by their spelling
+var apiDirs = map[string]bool{"api": true, "apis": true, "reference": true, "ref": true, "sdk": true}
+
+// classify returns the Dash type of an entry that would otherwise get the
+// -default-type, guessed from its name and path, or "" if nothing hints at
+// one.
+// In order, it looks at:
+//   - a trailing kind, e.g. "CreateFile Function"
+//   - an argument list, e.g. "TForm.Show()", a Method when qualified
+//   - a directory named after a kind, e.g. /methods/
+//   - the spelling of symbol names in reference directories such as /api/:
+//     MAX_PATH is a Constant, TForm.Show a Method, TForm a Class
+func classify(name, entryPath string) string {
+	name = strings.TrimSpace(name)
+	if m := typeSuffixRE.FindStringSubmatch(name); m != nil {
+		return typeWords[strings.ToLower(m[1])]
+	}
+	if callRE.MatchString(name) {
+		if strings.ContainsAny(name[:strings.Index(name, "(")], ".:") {
+			return "Method"
+		}
+		return "Function"
+	}
+
+	dirs := strings.Split(strings.ToLower(path.Dir(stripFragment(entryPath))), "/")
+	api := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if t, ok := typeWords[dirs[i]]; ok {
+			return t
+		}
+		api = api || apiDirs[dirs[i]]
+	}
+	if !api || !identifierRE.MatchString(name) {
+		return ""
+	}
+	switch {
+	case constantNameRE.MatchString(name):
+		return "Constant"
+	case strings.ContainsAny(name, ".:"):
+		return "Method"
+	case name[0] >= 'A' && name[0] <= 'Z':
+		return "Class"
+	}
+	return "Function"
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		name, path, expected string
+	}{
+		{"CreateFile Function", "win32/createfile.htm", "Function"},
+		{"TForm Class", "vcl/tform.htm", "Class"},
+		{"TForm.Caption property", "vcl/tform_caption.htm", "Property"},
+		{"TAlign Enumeration", "vcl/talign.htm", "Enum"},
+		{"printf()", "crt/printf.htm", "Function"},
+		{"TForm.Show(Sender)", "vcl/show.htm", "Method"},
+		{"std::vector::push_back()", "stl/push_back.htm", "Method"},
+		{"Show", "vcl/methods/show.htm#x", "Method"},
+		{"MAX_PATH", "api/limits.htm", "Constant"},
+		{"TForm.Show", "Reference/vcl/show.htm", "Method"},
+		{"TForm", "api/tform.htm", "Class"},
+		{"printf", "api/printf.htm", "Function"},
+		{"Getting started", "api/start.htm", ""},
+		{"TForm", "guide/tform.htm", ""},
+		{"Installing the Toolkit", "install.htm", ""},
+		{"Overview", "overview.htm", ""},
+	} {
+		Test{test.name + " " + classify(test.name, test.path), test.name + " " + test.expected}.Compare(t)
+	}
+}
+
+func TestIndexClassify(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Classify: true}
+	opts.sourceRanks, _ = parseSourcePriority(defaultSourcePriority)
+	opts.entries = map[entryKey]entryOrigin{}
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	w := newDBWriter(db, 0)
+
+	hhk := newIndexWriter(w, opts, sourceHHK)
+	hhk.Add("CreateFile Function", "Guide", "createfile.htm")
+	hhk.Add("Overview", "Guide", "overview.htm")
+	hhk.Add("MAX_PATH", "Section", "api/limits.htm")
+	w.Close()
+
+	rows, _ := db.Query("SELECT name, type FROM searchIndex ORDER BY name")
+	var entries []string
+	for rows.Next() {
+		var name, entryType string
+		rows.Scan(&name, &entryType)
+		entries = append(entries, name+"|"+entryType)
+	}
+	Test{entries, []string{"CreateFile Function|Function", "MAX_PATH|Section", "Overview|Guide"}}.DeepEqual(t)
+}
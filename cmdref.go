@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	preRE          = regexp.MustCompile(`(?is)<pre\b[^>]*>(.*?)</pre\s*>`)
+	synopsisHeadRE = regexp.MustCompile(`(?i)\b(syntax|synopsis|usage)\b`)
+	commandNameRE  = regexp.MustCompile(`^[A-Za-z][\w.-]*`)
+	switchStartRE  = regexp.MustCompile(`^(?:--?[A-Za-z0-9?]|/[A-Za-z?])`)
+	switchRE       = regexp.MustCompile(`(?:^|[\s,|])(--?[A-Za-z0-9?][\w-]*|/[A-Za-z?][\w?]*)`)
+)
+
+const (
+	// Bytes before a <pre> block searched for a Syntax/Usage caption
+	synopsisLookBehind = 200
+	// Number of switches a page needs to count as a command reference
+	minSwitches = 2
+)
+
+// cmdEntry is a command or option found on a command reference page
+type cmdEntry struct {
+	Name   string
+	Type   string
+	Anchor string
+}
+
+// indexCommands indexes the commands and switches of command reference pages
+func (opts *Options) indexCommands(db *dbWriter) error {
+	w := newIndexWriter(db, opts, sourceCommands)
+
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		entries, err := commandEntries(opts.pages, path)
+		if err != nil {
+			opts.pageErrorf("skipping commands of %s due to error: %v", path, err)
+			return nil
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, e := range entries {
+			if err := w.Add(e.Name, e.Type, indexPath(relPath)+"#"+e.Anchor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		log.Printf("Indexed %d commands and options", w.count)
+	}
+	return nil
+}
+
+// commandEntries returns the command named by the synopsis block of a page
+// and the switches listed in its option tables or definition lists. Pages
+// with fewer than minSwitches switches are not command references.
+func commandEntries(pages *pageCache, path string) ([]cmdEntry, error) {
+	b, err := pages.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	charset := detectCharset(b, "")
+	used := map[string]bool{}
+
+	var command *cmdEntry
+	var commandInsertion *idInsertion
+	for _, loc := range preRE.FindAllSubmatchIndex(b, -1) {
+		before := b[max(0, loc[0]-synopsisLookBehind):loc[0]]
+		if !synopsisHeadRE.Match(before) {
+			continue
+		}
+		name := commandNameRE.FindString(cellText(b[loc[2]:loc[3]], charset))
+		if name == "" {
+			continue
+		}
+		command = &cmdEntry{Name: name, Type: "Command"}
+		tag := b[loc[0]:loc[2]]
+		if m := idAttrRE.FindSubmatch(tag); m != nil {
+			command.Anchor = string(m[1])
+		} else {
+			command.Anchor = uniqueAnchor("cmd-", name, used)
+			commandInsertion = &idInsertion{End: loc[2] - 1, ID: command.Anchor}
+		}
+		used[command.Anchor] = true
+		break
+	}
+
+	var options []cmdEntry
+	var insertions []idInsertion
+	addSwitches := func(text string, tag, body []byte, tagEnd int) {
+		if !switchStartRE.MatchString(text) {
+			return
+		}
+		var anchor string
+		if m := idAttrRE.FindSubmatch(tag); m != nil {
+			anchor = string(m[1])
+		} else if m := nameAnchorRE.FindSubmatch(body); m != nil {
+			anchor = string(m[1])
+		} else {
+			anchor = uniqueAnchor("opt-", text, used)
+			insertions = append(insertions, idInsertion{End: tagEnd, ID: anchor})
+		}
+		used[anchor] = true
+		for _, m := range switchRE.FindAllStringSubmatch(text, -1) {
+			name := m[1]
+			if command != nil {
+				name = command.Name + " " + name
+			}
+			options = append(options, cmdEntry{Name: name, Type: "Option", Anchor: anchor})
+		}
+	}
+	for _, loc := range tableRE.FindAllSubmatchIndex(b, -1) {
+		for _, row := range tableRows(b, loc[2], loc[3], charset) {
+			if len(row.cells) >= 2 {
+				addSwitches(row.cells[0], row.tag, row.body, row.tagEnd)
+			}
+		}
+	}
+	for _, loc := range dtOpenRE.FindAllIndex(b, -1) {
+		body := b[loc[1]:]
+		if end := dtEndRE.FindIndex(body); end != nil {
+			body = body[:end[0]]
+		}
+		addSwitches(cellText(body, charset), b[loc[0]:loc[1]], body, loc[1]-1)
+	}
+
+	if len(options) < minSwitches {
+		return nil, nil
+	}
+	var entries []cmdEntry
+	if command != nil {
+		entries = append(entries, *command)
+		if commandInsertion != nil {
+			insertions = append(insertions, *commandInsertion)
+		}
+	}
+	entries = append(entries, options...)
+
+	if len(insertions) > 0 {
+		if err := pages.WriteFile(path, insertIDs(b, insertions)); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommandEntries(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/xcopy.htm", []byte(`<html><head><title>xcopy</title></head><body>
+<h3>Syntax</h3>
+<pre>xcopy source [destination] [/a | /m] [/d[:date]]</pre>
+<h3>Parameters</h3>
+<table>
+<tr><th>Parameter</th><th>Description</th></tr>
+<tr><td>source</td><td>Files to copy.</td></tr>
+<tr><td>/a</td><td>Copies only files with the archive attribute.</td></tr>
+<tr id="m"><td>/m</td><td>Turns the archive attribute off.</td></tr>
+</table>
+<dl><dt>-v, --verbose</dt><dd>Lists files.</dd></dl>
+</body></html>`), 0644)
+	entries, err := commandEntries(nil, "tmp/xcopy.htm")
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{entries, []cmdEntry{
+		{"xcopy", "Command", "cmd-xcopy"},
+		{"xcopy /a", "Option", "opt-a"},
+		{"xcopy /m", "Option", "m"},
+		{"xcopy -v", "Option", "opt-v-verbose"},
+		{"xcopy --verbose", "Option", "opt-v-verbose"},
+	}}.DeepEqual(t)
+	b, _ := os.ReadFile("tmp/xcopy.htm")
+	Test{strings.Contains(string(b), `<pre id="cmd-xcopy">xcopy`), true}.Compare(t)
+	Test{strings.Contains(string(b), `<tr id="opt-a"><td>/a</td>`), true}.Compare(t)
+}
+
+func TestCommandEntriesNotReference(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	page := `<title>Intro</title><h3>Usage</h3><pre>run it</pre><table><tr><td>/a</td><td>only one</td></tr></table>`
+	os.WriteFile("tmp/intro.htm", []byte(page), 0644)
+	entries, _ := commandEntries(nil, "tmp/intro.htm")
+	Test{len(entries), 0}.Compare(t)
+	b, _ := os.ReadFile("tmp/intro.htm")
+	Test{string(b), page}.Compare(t)
+}
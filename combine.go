@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"chm2docset/chm"
+)
+
+// combined reports whether the sources are combined into one docset
+func (opts *Options) combined() bool {
+	return opts.Combine && len(opts.Sources) > 1
+}
+
+// checkCombine checks the sources can be combined under -combine
+func (opts *Options) checkCombine() error {
+	if opts.Name == "" {
+		return errors.New("-combine needs -name for the combined docset")
+	}
+	for _, source := range opts.Sources {
+		sub := Options{SourcePath: source, FromDir: opts.FromDir}
+		if sub.isSourceDir() || sub.isProject() || isHelp2File(source) || isMSHCFile(source) || isHLPFile(source) {
+			return fmt.Errorf("-combine takes CHM files only, not %s", source)
+		}
+	}
+	return nil
+}
+
+// combinedPart is a source of a combined docset
+type combinedPart struct {
+	Title string
+	Href  string
+}
+
+// extractCombined extracts every source into a directory of the content
+// path named after it, as if they were children merged into a master CHM,
+// and writes a table of contents and an index holding theirs as well as a
+// landing page linking each of them
+func (opts *Options) extractCombined() error {
+	basePath := opts.ContentPath()
+	opts.mergedCHMs = map[string]*mergedCHM{}
+	taken := map[string]bool{}
+	dirs := make([]string, len(opts.Sources))
+	for i, source := range opts.Sources {
+		file := filepath.Base(source)
+		dirs[i] = uniquePath(strings.TrimSuffix(file, filepath.Ext(file)), taken)
+		taken[dirs[i]] = true
+	}
+	for i, source := range opts.Sources {
+		opts.reportDir(source, dirs[i])
+	}
+	if err := opts.extractParts(dirs); err != nil {
+		return err
+	}
+
+	var parts []combinedPart
+	var toc, index bytes.Buffer
+	for i, source := range opts.Sources {
+		file, dir := filepath.Base(source), dirs[i]
+		opts.mergedCHMs[strings.ToLower(file)] = &mergedCHM{file: file, dir: dir, sitemaps: map[string]bool{}}
+
+		title, start := opts.readPart(source, dir)
+		if title == "" {
+			title = strings.TrimSuffix(file, filepath.Ext(file))
+		}
+		if start == "" {
+			start = opts.firstTopic(dir)
+		}
+		part := combinedPart{Title: title}
+		if start != "" {
+			part.Href = escapeLink(start)
+		}
+		parts = append(parts, part)
+
+		if start != "" {
+			writeSitemapItem(&toc, "", title, start)
+		} else {
+			writeSitemapItem(&toc, "", title)
+		}
+		for _, ext := range []string{".hhc", ".hhk"} {
+			list, err := opts.takeSitemap(dir, ext)
+			if err != nil {
+				return err
+			}
+			if ext == ".hhc" {
+				toc.Write(list)
+			} else if list != nil {
+				// The lists of the parts are kept in order within one list
+				index.Write(sitemapListRE.ReplaceAll(bytes.TrimSpace(list), nil))
+				index.WriteByte('\n')
+			}
+		}
+		log.Printf("Combined %s into %s/", file, dir)
+	}
+
+	if err := writeSitemaps(filepath.Join(basePath, opts.Basename()), toc.Bytes(), index.Bytes()); err != nil {
+		return err
+	}
+	if err := opts.writeCover(parts); err != nil {
+		return err
+	}
+	opts.defaultTopic = coverFile
+	return nil
+}
+
+// extractParts extracts every source of a combined docset into its
+// directory in dirs concurrently. Sources with identical content are
+// extracted once and copied into the directories of the others.
+func (opts *Options) extractParts(dirs []string) error {
+	basePath := opts.ContentPath()
+	var mu sync.Mutex
+	extractions := map[string]*extraction{}
+	extract := func(source, dest string) error {
+		sum, err := fileHash(source)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		e, ok := extractions[sum]
+		if !ok {
+			e = &extraction{done: make(chan struct{}), path: dest}
+			extractions[sum] = e
+		}
+		mu.Unlock()
+		if !ok {
+			e.err = opts.extractFile(source, dest)
+			close(e.done)
+			return e.err
+		}
+		<-e.done
+		if e.err != nil {
+			return e.err
+		}
+		log.Printf("%s is identical to an earlier source, copying it", filepath.Base(source))
+		return copyTree(e.path, dest)
+	}
+
+	errs := make([]error, len(opts.Sources))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.extractWorkers(len(opts.Sources)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				source := opts.Sources[i]
+				if err := extract(source, filepath.Join(basePath, dirs[i])); err != nil {
+					errs[i] = fmt.Errorf("%s: %w", source, err)
+				}
+			}
+		}()
+	}
+	for i := range opts.Sources {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sitemapListRE matches the tags opening and closing the outermost list of
+// a sitemap
+var sitemapListRE = regexp.MustCompile(`(?is)^<ul\b[^>]*>|</ul\s*>$`)
+
+// readPart returns the title and the start page, below dir, of a source
+// of a combined docset, and adds its topic table to the titles of pages
+func (opts *Options) readPart(source, dir string) (title, start string) {
+	r, err := chm.Open(source)
+	if err != nil {
+		return "", ""
+	}
+	defer r.Close()
+	charset := chmCharset(r)
+	if s, err := r.System(); err == nil {
+		title = strings.TrimSpace(decodeCharset([]byte(s.Title), charset))
+		if topic := strings.TrimSpace(decodeCharset([]byte(s.DefaultTopic), charset)); topic != "" {
+			if page := opts.findContentFile(path.Join(dir, strings.TrimPrefix(stripFragment(topic), "/"))); page != "" {
+				start = page + topic[len(stripFragment(topic)):]
+			}
+		}
+	}
+	topics, err := r.Topics()
+	if err != nil {
+		return title, start
+	}
+	for _, topic := range topics {
+		title := strings.TrimSpace(decodeCharset([]byte(topic.Title), charset))
+		if title != "" && topic.Local != "" {
+			local := path.Join(dir, strings.TrimPrefix(stripFragment(topic.Local), "/"))
+			opts.topics = append(opts.topics, chm.Topic{Title: title, Local: local})
+		}
+	}
+	return title, start
+}
+
+// firstTopic returns the first page of the table of contents of a source
+// extracted into dir, or ""
+func (opts *Options) firstTopic(dir string) string {
+	hhc := findFileByExt(filepath.Join(opts.ContentPath(), dir), ".hhc")
+	if hhc == "" {
+		return ""
+	}
+	b, err := os.ReadFile(hhc)
+	if err != nil {
+		return ""
+	}
+	for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+		if item.Local == "" {
+			continue
+		}
+		if page := opts.findContentFile(path.Join(dir, strings.TrimPrefix(strings.ReplaceAll(stripFragment(item.Local), `\`, "/"), "/"))); page != "" {
+			return page
+		}
+	}
+	return ""
+}
+
+// takeSitemap removes the sitemaps with extension ext below dir and
+// returns the list of the first, decoded to UTF-8, with its Local values
+// rebased onto dir
+func (opts *Options) takeSitemap(dir, ext string) ([]byte, error) {
+	var list []byte
+	for {
+		sitemap := findFileByExt(filepath.Join(opts.ContentPath(), dir), ext)
+		if sitemap == "" {
+			return list, nil
+		}
+		b, err := os.ReadFile(sitemap)
+		if err != nil {
+			return nil, err
+		}
+		if list == nil {
+			if found := sitemapULRE.Find([]byte(decodeToUTF8(b, defaultSitemapEncoding))); found != nil {
+				list = append(opts.rebaseLocals(found, dir), '\n')
+			}
+		}
+		if err := os.Remove(sitemap); err != nil {
+			return nil, err
+		}
+	}
+}
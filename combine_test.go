@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	defer cleanTmp()
+	sources := []string{"_fixtures/merged/master.chm", "_fixtures/sample.chm"}
+	opts := &Options{Sources: sources, SourcePath: sources[0], Outdir: "tmp", Combine: true}
+	_, err := opts.Builds()
+	Test{err.Error(), "-combine needs -name for the combined docset"}.Compare(t)
+	opts.Name = "Combined"
+	builds, err := opts.Builds()
+	Test{err, nil}.Compare(t)
+	Test{len(builds), 1}.Compare(t)
+	Test{runBuilds(builds, 1), nil}.Compare(t)
+
+	content := opts.ContentPath()
+	Test{opts.DocsetPath(), "tmp/Combined.docset"}.Compare(t)
+	for _, name := range []string{"master/index.htm", "sample/page.htm", "Child/topics/open.htm", "Combined.hhc"} {
+		if _, err := os.Stat(content + "/" + name); err != nil {
+			t.Errorf("Expected %s but got %v", name, err)
+		}
+	}
+	_, err = os.Stat(content + "/master/master.hhc")
+	Test{os.IsNotExist(err), true}.Compare(t)
+	Test{opts.IndexFilePath(), coverFile}.Compare(t)
+	b, _ := os.ReadFile(content + "/" + coverFile)
+	Test{strings.Contains(string(b), `<li><a href="sample/page.htm">Sample Änderungen</a></li>`), true}.Compare(t)
+	Test{strings.Contains(string(b), `<li><a href="master/index.htm">master</a></li>`), true}.Compare(t)
+	Test{strings.Contains(string(b), "master.chm, sample.chm"), true}.Compare(t)
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	var entries string
+	db.QueryRow("SELECT group_concat(name || ' ' || path, ', ') FROM (SELECT * FROM searchIndex ORDER BY name)").Scan(&entries)
+	Test{entries, "Open Child/topics/open.htm, Sample Änderungen sample/page.htm, Suite master/index.htm, master master/index.htm"}.Compare(t)
+
+	var counts []string
+	for _, src := range builds[0].report.Sources {
+		counts = append(counts, fmt.Sprintf("%s %d %d", filepath.Base(src.Source), src.Pages, src.Entries))
+	}
+	Test{counts, []string{"master.chm 2 2", "sample.chm 3 1", "Child.chm 1 1"}}.DeepEqual(t)
+}
+
+func TestCheckCombine(t *testing.T) {
+	opts := &Options{Sources: []string{"_fixtures/sample.chm", "_fixtures"}, Combine: true, Name: "Both"}
+	Test{opts.checkCombine().Error(), "-combine takes CHM files only, not _fixtures"}.Compare(t)
+	opts.Sources = []string{"_fixtures/sample.chm", "_fixtures/merged/master.chm"}
+	Test{opts.checkCombine(), nil}.Compare(t)
+	Test{opts.combined(), true}.Compare(t)
+	opts.Sources = opts.Sources[:1]
+	Test{opts.combined(), false}.Compare(t)
+}
+
+func TestExtractPartsIdentical(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp/copy", 0755)
+	b, _ := os.ReadFile("_fixtures/sample.chm")
+	os.WriteFile("tmp/copy/sample.chm", b, 0644)
+	opts := &Options{Sources: []string{"_fixtures/sample.chm", "tmp/copy/sample.chm", "_fixtures/merged/master.chm"}, Outdir: "tmp", Name: "Twice", Combine: true}
+	opts.CreateDirectory()
+	Test{opts.extractParts([]string{"sample", "sample-2", "master"}), nil}.Compare(t)
+	for _, name := range []string{"sample/page.htm", "sample-2/page.htm", "sample-2/img/logo.gif", "master/index.htm"} {
+		if _, err := os.Stat(opts.ContentPath() + "/" + name); err != nil {
+			t.Errorf("Expected %s but got %v", name, err)
+		}
+	}
+
+	opts.Sources = append(opts.Sources, "tmp/missing.chm")
+	err := opts.extractParts([]string{"a", "b", "c", "missing"})
+	Test{err != nil && strings.HasPrefix(err.Error(), "tmp/missing.chm: "), true}.Compare(t)
+}
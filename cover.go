@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultIndexFile = "Welcome.htm"
+	coverFile        = "chm2docset-cover.html"
+
+	coverTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 3em; color: #333; }
+h1 { font-weight: 300; font-size: 2.4em; margin-bottom: .2em; }
+.version { color: #888; font-size: 1.2em; }
+dl { margin-top: 2em; }
+dt { font-weight: bold; margin-top: .6em; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Version}}<div class="version">Version {{.Version}}</div>{{end}}
+<p>Use the search field to find topics in this documentation set.</p>
+{{if .Parts}}<ul>
+{{range .Parts}}<li>{{if .Href}}<a href="{{.Href}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</li>
+{{end}}</ul>{{end}}
+<dl>
+<dt>Source</dt><dd>{{.Source}}</dd>
+<dt>Converted</dt><dd>{{.Date}} by chm2docset</dd>
+</dl>
+</body>
+</html>
+`
+)
+
+var (
+	coverTmpl = template.Must(template.New("cover").Parse(coverTemplate))
+
+	// Conventional names of CHM start pages, in order of preference
+	startPageNames = []string{"index.htm", "index.html", "default.htm", "default.html", "start.htm", "main.htm"}
+)
+
+// IndexFilePath returns the page Dash opens first
+func (opts *Options) IndexFilePath() string {
+	if opts.indexFile != "" {
+		return opts.indexFile
+	}
+	return defaultIndexFile
+}
+
+// ChooseIndexFile picks the start page of the docset: the default topic
+// the CHM was compiled with, Welcome.htm, the first topic of the table of
+// contents, or a conventional start page. If none exists a cover page is
+// generated.
+func (opts *Options) ChooseIndexFile() error {
+	basePath := opts.ContentPath()
+	if opts.defaultTopic != "" {
+		if page, fragment, ok := opts.resolveLocal(opts.defaultTopic); ok {
+			opts.indexFile = indexPath(page) + fragment
+			return nil
+		}
+		log.Printf("Default topic %s not found", opts.defaultTopic)
+	}
+	if page := findPage(basePath, defaultIndexFile); page != "" {
+		opts.indexFile = page
+		return nil
+	}
+	if hhcPath := findFileByExt(basePath, ".hhc"); hhcPath != "" {
+		if b, err := os.ReadFile(hhcPath); err == nil {
+			for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+				if item.Local == "" {
+					continue
+				}
+				if page, fragment, ok := opts.resolveLocal(item.Local); ok {
+					opts.indexFile = indexPath(page) + fragment
+					return nil
+				}
+				break
+			}
+		}
+	}
+	for _, name := range startPageNames {
+		if page := findPage(basePath, name); page != "" {
+			opts.indexFile = page
+			return nil
+		}
+	}
+
+	log.Printf("No start page found, generating %s", coverFile)
+	if err := opts.writeCover(nil); err != nil {
+		return err
+	}
+	opts.indexFile = coverFile
+	return nil
+}
+
+// writeCover writes a landing page describing the docset, linking the
+// parts of a combined docset
+func (opts *Options) writeCover(parts []combinedPart) error {
+	source := opts.SourceFilename()
+	if opts.combined() {
+		names := make([]string, len(opts.Sources))
+		for i, s := range opts.Sources {
+			names[i] = filepath.Base(s)
+		}
+		source = strings.Join(names, ", ")
+	}
+	var buf bytes.Buffer
+	err := coverTmpl.Execute(&buf, struct {
+		Name, Version, Source, Date string
+		Parts                       []combinedPart
+	}{
+		Name:    opts.Title(),
+		Version: opts.DocsetVersion,
+		Source:  source,
+		Date:    time.Now().UTC().Format("2006-01-02"),
+		Parts:   parts,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(opts.ContentPath(), coverFile), buf.Bytes(), 0644)
+}
+
+// findPage returns the path of rel below basePath with its actual case, or
+// "" if it does not exist. CHM links are case-insensitive while the
+// extracted tree may not be.
+func findPage(basePath, rel string) string {
+	dir := basePath
+	var parts []string
+	for _, want := range strings.Split(filepath.ToSlash(rel), "/") {
+		if want == "" || want == "." {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return ""
+		}
+		found := ""
+		for _, e := range entries {
+			if e.Name() == want {
+				found = want
+				break
+			}
+			if found == "" && strings.EqualFold(e.Name(), want) {
+				found = e.Name()
+			}
+		}
+		if found == "" {
+			return ""
+		}
+		parts = append(parts, found)
+		dir = filepath.Join(dir, found)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	if info, err := os.Stat(dir); err != nil || info.IsDir() {
+		return ""
+	}
+	return strings.Join(parts, "/")
+}
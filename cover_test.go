@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFindPage(t *testing.T) {
+	os.MkdirAll("tmp/docs/Sub", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/docs/Sub/Page.HTM", nil, 0644)
+	Test{findPage("tmp/docs", "sub/page.htm"), "Sub/Page.HTM"}.Compare(t)
+	Test{findPage("tmp/docs", "Sub/Page.HTM"), "Sub/Page.HTM"}.Compare(t)
+	Test{findPage("tmp/docs", "sub"), ""}.Compare(t)
+	Test{findPage("tmp/docs", "missing.htm"), ""}.Compare(t)
+}
+
+func TestChooseIndexFile(t *testing.T) {
+	opts := &Options{
+		SourcePath:    "/foo/bar/baz.chm",
+		Outdir:        "tmp/baz.docset",
+		DocsetVersion: "1.2",
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+
+	// No start page at all: a cover is generated
+	opts.ChooseIndexFile()
+	Test{opts.IndexFilePath(), coverFile}.Compare(t)
+	b, _ := os.ReadFile(content + "/" + coverFile)
+	Test{strings.Contains(string(b), "<h1>baz</h1>"), true}.Compare(t)
+	Test{strings.Contains(string(b), "Version 1.2"), true}.Compare(t)
+	Test{strings.Contains(string(b), "<dd>baz.chm</dd>"), true}.Compare(t)
+
+	os.WriteFile(content+"/Default.htm", nil, 0644)
+	opts.ChooseIndexFile()
+	Test{opts.IndexFilePath(), "Default.htm"}.Compare(t)
+
+	os.WriteFile(content+"/intro.htm", nil, 0644)
+	os.WriteFile(content+"/toc.hhc", []byte(`<UL><LI><OBJECT type="text/sitemap">
+<param name="Name" value="Intro"><param name="Local" value="Intro.htm#start"></OBJECT></UL>`), 0644)
+	opts.ChooseIndexFile()
+	Test{opts.IndexFilePath(), "intro.htm#start"}.Compare(t)
+
+	os.WriteFile(content+"/welcome.htm", nil, 0644)
+	opts.ChooseIndexFile()
+	Test{opts.IndexFilePath(), "welcome.htm"}.Compare(t)
+	Test{strings.Contains(opts.PlistContent(), "<string>welcome.htm</string>"), true}.Compare(t)
+}
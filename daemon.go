@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conversion states reported by the daemon
+const (
+	statusQueued  = "queued"
+	statusRunning = "running"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// defaultMaxUpload bounds the size of the files the daemon accepts
+const defaultMaxUpload = 512 << 20
+
+// daemonCommand implements the daemon subcommand
+func daemonCommand(args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s daemon [options]\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	listen := flags.String("listen", "127.0.0.1:8080", "Address to serve the conversion API on, only to this host by default")
+	dir := flags.String("dir", "", "Directory keeping uploads and docsets (default: a new temporary directory)")
+	jobs := flags.Int("jobs", 1, "Number of conversions to run at once")
+	maxUpload := flags.Int64("max-upload", defaultMaxUpload, "Largest file accepted, in bytes")
+	keep := flags.Duration("keep", 24*time.Hour, "Remove finished conversions after this long, 0 to keep them")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+	}
+
+	if *dir == "" {
+		d, err := os.MkdirTemp("", "chm2docset-daemon-")
+		if err != nil {
+			return err
+		}
+		*dir = d
+	}
+	q, err := newConversionQueue(*dir, *maxUpload)
+	if err != nil {
+		return err
+	}
+	q.start(max(*jobs, 1))
+	if *keep > 0 {
+		go func() {
+			for range time.Tick(time.Minute) {
+				q.expire(*keep)
+			}
+		}()
+	}
+	log.Printf("Serving conversions on %s, keeping files in %s", *listen, *dir)
+	return http.ListenAndServe(*listen, q.handler())
+}
+
+// conversionJob is a conversion submitted to the daemon
+type conversionJob struct {
+	ID       string     `json:"id"`
+	Source   string     `json:"source"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Pages    int        `json:"pages,omitempty"`
+	Entries  int        `json:"entries,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	opts *Options
+}
+
+// conversionQueue runs the conversions submitted to the daemon in order of
+// submission. Every conversion keeps its upload and docset in a directory
+// named after its id.
+type conversionQueue struct {
+	dir       string
+	maxUpload int64
+	mu        sync.Mutex
+	jobs      map[string]*conversionJob
+	pending   chan *conversionJob
+}
+
+func newConversionQueue(dir string, maxUpload int64) (*conversionQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &conversionQueue{
+		dir:       dir,
+		maxUpload: maxUpload,
+		jobs:      map[string]*conversionJob{},
+		pending:   make(chan *conversionJob, 1024),
+	}, nil
+}
+
+// start runs n workers converting the submitted files
+func (q *conversionQueue) start(n int) {
+	for range n {
+		go func() {
+			for job := range q.pending {
+				q.run(job)
+			}
+		}()
+	}
+}
+
+func (q *conversionQueue) run(job *conversionJob) {
+	q.mu.Lock()
+	if _, ok := q.jobs[job.ID]; !ok {
+		// Deleted while queued
+		q.mu.Unlock()
+		return
+	}
+	job.Status = statusRunning
+	q.mu.Unlock()
+
+	log.Printf("Converting %s (%s)", job.Source, job.ID)
+	// Every conversion has temporary files of its own, removed when it ends
+	job.opts.temp = newTempRoot(false)
+	builds, err := job.opts.Builds()
+	if err == nil {
+		err = runBuilds(builds, 1)
+	}
+	if rerr := job.opts.temp.Remove(); rerr != nil {
+		log.Printf("Warning: removing temporary files of %s: %v", job.ID, rerr)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	job.Finished = &now
+	for _, build := range builds {
+		if src := build.totalReport(); src != nil {
+			job.Pages += src.Pages
+			job.Entries += src.Entries
+		}
+	}
+	if err != nil {
+		job.Status, job.Error = statusFailed, err.Error()
+		log.Printf("Converting %s (%s) failed: %v", job.Source, job.ID, err)
+		return
+	}
+	job.Status = statusDone
+}
+
+// submit stores an uploaded file and queues its conversion
+func (q *conversionQueue) submit(name string, r io.Reader, conf func(opts *Options)) (*conversionJob, error) {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".chm", ".hxs", ".mshc", ".hlp":
+	default:
+		return nil, fmt.Errorf("%q is not a CHM, HxS, MSHC or HLP file", name)
+	}
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(q.dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	source := filepath.Join(dir, name)
+	f, err := os.Create(source)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	// The defaults of the command line, such as -memory-limit, bound the
+	// conversion of untrusted uploads as well
+	opts := defaultOptions()
+	opts.SourcePath, opts.Sources, opts.Outdir = source, []string{source}, filepath.Join(dir, "out")
+	conf(opts)
+	job := &conversionJob{ID: id, Source: name, Status: statusQueued, Created: time.Now(), opts: opts}
+	q.mu.Lock()
+	q.jobs[id] = job
+	q.mu.Unlock()
+	select {
+	case q.pending <- job:
+	default:
+		q.remove(id)
+		return nil, errors.New("too many conversions are queued")
+	}
+	return job, nil
+}
+
+// status returns a copy of a conversion safe to encode
+func (q *conversionQueue) status(id string) (conversionJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return conversionJob{}, false
+	}
+	return *job, true
+}
+
+// remove deletes a conversion that is not running and its files
+func (q *conversionQueue) remove(id string) error {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if ok && job.Status == statusRunning {
+		q.mu.Unlock()
+		return errors.New("the conversion is running")
+	}
+	delete(q.jobs, id)
+	q.mu.Unlock()
+	return os.RemoveAll(filepath.Join(q.dir, id))
+}
+
+// expire removes the conversions finished longer than keep ago
+func (q *conversionQueue) expire(keep time.Duration) {
+	q.mu.Lock()
+	var old []string
+	for id, job := range q.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > keep {
+			old = append(old, id)
+		}
+	}
+	q.mu.Unlock()
+	for _, id := range old {
+		if err := q.remove(id); err != nil {
+			log.Printf("Warning: removing conversion %s: %v", id, err)
+		}
+	}
+}
+
+// handler serves the conversion API:
+//
+//	POST   /conversions                upload a file as the "file" form field
+//	GET    /conversions                list the conversions
+//	GET    /conversions/{id}           status of a conversion
+//	GET    /conversions/{id}/docset.tgz  the converted docset
+//	DELETE /conversions/{id}           remove a conversion and its files
+func (q *conversionQueue) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /conversions", q.handleSubmit)
+	mux.HandleFunc("GET /conversions", q.handleList)
+	mux.HandleFunc("GET /conversions/{id}", q.handleStatus)
+	mux.HandleFunc("GET /conversions/{id}/docset.tgz", q.handleDocset)
+	mux.HandleFunc("DELETE /conversions/{id}", q.handleDelete)
+	return mux
+}
+
+func (q *conversionQueue) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, q.maxUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("reading the uploaded file: %w", err))
+		return
+	}
+	defer file.Close()
+	job, err := q.submit(header.Filename, file, func(opts *Options) {
+		// Settings a portal may choose per upload
+		opts.Name = filepath.Base(r.FormValue("name"))
+		if opts.Name == "." || opts.Name == string(filepath.Separator) {
+			opts.Name = ""
+		}
+		if platform := r.FormValue("platform"); platform != "" {
+			opts.Platform = platform
+		}
+		if keyword := r.FormValue("keyword"); keyword != "" {
+			opts.Keywords = stringList{keyword}
+		}
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	status, _ := q.status(job.ID)
+	w.Header().Set("Location", "/conversions/"+job.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (q *conversionQueue) handleList(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	list := make([]conversionJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		list = append(list, *job)
+	}
+	q.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (q *conversionQueue) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, ok := q.status(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, errors.New("no such conversion"))
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (q *conversionQueue) handleDocset(w http.ResponseWriter, r *http.Request) {
+	status, ok := q.status(r.PathValue("id"))
+	switch {
+	case !ok:
+		writeJSONError(w, http.StatusNotFound, errors.New("no such conversion"))
+		return
+	case status.Status != statusDone:
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("the conversion is %s", status.Status))
+		return
+	}
+	docset := status.opts.DocsetPath()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", status.opts.Basename()+".tgz"))
+	if err := writeTgz(w, docset); err != nil {
+		// The headers are sent already
+		log.Printf("Warning: sending %s: %v", docset, err)
+	}
+}
+
+func (q *conversionQueue) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := q.status(id); !ok {
+		writeJSONError(w, http.StatusNotFound, errors.New("no such conversion"))
+		return
+	}
+	if err := q.remove(id); err != nil {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newJobID returns a random conversion id
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upload posts a file to the conversions endpoint of server
+func upload(t *testing.T, server *httptest.Server, name string, content []byte, fields map[string]string) *http.Response {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	fw, _ := w.CreateFormFile("file", name)
+	fw.Write(content)
+	w.Close()
+	res, err := http.Post(server.URL+"/conversions", w.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestDaemon(t *testing.T) {
+	defer cleanTmp()
+	q, err := newConversionQueue("tmp/daemon", 1<<20)
+	Test{err, nil}.Compare(t)
+	q.start(1)
+	server := httptest.NewServer(q.handler())
+	defer server.Close()
+
+	b, _ := os.ReadFile("_fixtures/sample.chm")
+	res := upload(t, server, "sample.chm", b, map[string]string{"name": "../Sample", "platform": "sample"})
+	Test{res.StatusCode, http.StatusAccepted}.Compare(t)
+	var job conversionJob
+	json.NewDecoder(res.Body).Decode(&job)
+	res.Body.Close()
+	Test{job.Source, "sample.chm"}.Compare(t)
+	Test{res.Header.Get("Location"), "/conversions/" + job.ID}.Compare(t)
+
+	for deadline := time.Now().Add(30 * time.Second); job.Status != statusDone && job.Status != statusFailed && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+		res, _ := http.Get(server.URL + "/conversions/" + job.ID)
+		json.NewDecoder(res.Body).Decode(&job)
+		res.Body.Close()
+	}
+	Test{job.Status, statusDone}.Compare(t)
+	Test{job.Error, ""}.Compare(t)
+	Test{job.Pages, 3}.Compare(t)
+
+	res, _ = http.Get(server.URL + "/conversions/" + job.ID + "/docset.tgz")
+	Test{res.StatusCode, http.StatusOK}.Compare(t)
+	Test{res.Header.Get("Content-Disposition"), `attachment; filename="Sample.tgz"`}.Compare(t)
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	var plist string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name == "Sample.docset/Contents/Info.plist" {
+			b, _ := io.ReadAll(tr)
+			plist = string(b)
+		}
+	}
+	res.Body.Close()
+	sort.Strings(names)
+	Test{names[0], "Sample.docset/"}.Compare(t)
+	Test{strings.Contains(plist, "<string>sample</string>"), true}.Compare(t)
+
+	res, _ = http.Get(server.URL + "/conversions")
+	var list []conversionJob
+	json.NewDecoder(res.Body).Decode(&list)
+	res.Body.Close()
+	Test{len(list), 1}.Compare(t)
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/conversions/"+job.ID, nil)
+	res, _ = http.DefaultClient.Do(req)
+	Test{res.StatusCode, http.StatusNoContent}.Compare(t)
+	_, err = os.Stat("tmp/daemon/" + job.ID)
+	Test{os.IsNotExist(err), true}.Compare(t)
+	res, _ = http.Get(server.URL + "/conversions/" + job.ID)
+	Test{res.StatusCode, http.StatusNotFound}.Compare(t)
+}
+
+func TestDaemonRejects(t *testing.T) {
+	defer cleanTmp()
+	q, _ := newConversionQueue("tmp/daemon", 1024)
+	server := httptest.NewServer(q.handler())
+	defer server.Close()
+
+	res := upload(t, server, "notes.txt", []byte("x"), nil)
+	Test{res.StatusCode, http.StatusBadRequest}.Compare(t)
+	var msg map[string]string
+	json.NewDecoder(res.Body).Decode(&msg)
+	Test{msg["error"], `"notes.txt" is not a CHM, HxS, MSHC or HLP file`}.Compare(t)
+
+	res = upload(t, server, "big.chm", bytes.Repeat([]byte("x"), 4096), nil)
+	Test{res.StatusCode, http.StatusBadRequest}.Compare(t)
+
+	res, _ = http.Get(server.URL + "/conversions/nope/docset.tgz")
+	Test{res.StatusCode, http.StatusNotFound}.Compare(t)
+}
+
+func TestDaemonDefaults(t *testing.T) {
+	defer cleanTmp()
+	useFixtureBin()
+	os.MkdirAll("tmp/tmpdir", 0755)
+	tmpdir, _ := filepath.Abs("tmp/tmpdir")
+	t.Setenv("TMPDIR", tmpdir)
+	q, _ := newConversionQueue("tmp/daemon", 1<<20)
+	f, _ := os.Open("_fixtures/sample.chm")
+	defer f.Close()
+	// An external extractor, which needs a scratch directory
+	job, err := q.submit("sample.chm", f, func(opts *Options) { opts.Extractor = extractorChmlib })
+	Test{err, nil}.Compare(t)
+	Test{job.opts.memoryLimit(), int64(defaultMemoryLimit << 20)}.Compare(t)
+	Test{job.opts.CommitEvery, defaultCommitEvery}.Compare(t)
+	Test{job.opts.SourcePriority, defaultSourcePriority}.Compare(t)
+
+	q.run(<-q.pending)
+	Test{job.Status, statusDone}.Compare(t)
+	Test{job.Error, ""}.Compare(t)
+	left, _ := os.ReadDir(tmpdir)
+	Test{len(left), 0}.Compare(t)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Default number of statements executed per transaction
+const defaultCommitEvery = 1000
+
+// dbWriter serializes the statements of concurrent callers through a single
+// goroutine that commits every batchSize statements, so the work done so
+// far survives a later failure.
+type dbWriter struct {
+	db        *sql.DB
+	batchSize int
+	reqs      chan writeRequest
+	done      chan error
+	closeOnce sync.Once
+	err       error
+}
+
+type writeRequest struct {
+	query  string
+	args   []interface{}
+	result chan writeResult
+}
+
+type writeResult struct {
+	res sql.Result
+	err error
+}
+
+// newDBWriter starts a writer on db. A batchSize of 0 or less commits only
+// when the writer is closed.
+func newDBWriter(db *sql.DB, batchSize int) *dbWriter {
+	w := &dbWriter{
+		db:        db,
+		batchSize: batchSize,
+		reqs:      make(chan writeRequest),
+		done:      make(chan error, 1),
+	}
+	go w.loop()
+	return w
+}
+
+// Exec runs a statement on the writer goroutine and waits for its result
+func (w *dbWriter) Exec(query string, args ...interface{}) (sql.Result, error) {
+	result := make(chan writeResult, 1)
+	w.reqs <- writeRequest{query, args, result}
+	r := <-result
+	return r.res, r.err
+}
+
+// Close commits the pending statements and stops the writer
+func (w *dbWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.reqs)
+		w.err = <-w.done
+	})
+	return w.err
+}
+
+func (w *dbWriter) loop() {
+	var tx *sql.Tx
+	stmts := map[string]*sql.Stmt{}
+	pending := 0
+
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		err := tx.Commit()
+		tx, stmts, pending = nil, map[string]*sql.Stmt{}, 0
+		return err
+	}
+
+	for req := range w.reqs {
+		var r writeResult
+		if tx == nil {
+			tx, r.err = w.db.Begin()
+		}
+		var stmt *sql.Stmt
+		if r.err == nil {
+			if stmt = stmts[req.query]; stmt == nil {
+				if stmt, r.err = tx.Prepare(req.query); r.err == nil {
+					stmts[req.query] = stmt
+				}
+			}
+		}
+		if r.err == nil {
+			r.res, r.err = stmt.Exec(req.args...)
+			pending++
+		}
+		if r.err == nil && w.batchSize > 0 && pending >= w.batchSize {
+			r.err = commit()
+		}
+		req.result <- r
+	}
+	w.done <- commit()
+}
+
+// dumpDatabase copies db to a new database file at path using the SQLite
+// backup API
+func dumpDatabase(db *sql.DB, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		return backupTo(driverConn, path)
+	})
+}
+
+// checkDatabase verifies the integrity of the database file at path and
+// compacts it
+func checkDatabase(path string) error {
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database is corrupt: %s", strings.Join(problems, "; "))
+	}
+
+	_, err = db.Exec("VACUUM")
+	return err
+}
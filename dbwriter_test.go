@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func openTestIndex(t *testing.T) *sql.DB {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+	}
+	opts.CreateDirectory()
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	db.Exec(dbSchema)
+	return db
+}
+
+func countEntries(db *sql.DB) int {
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM searchIndex").Scan(&n)
+	return n
+}
+
+func TestDBWriterConcurrent(t *testing.T) {
+	defer cleanTmp()
+	db := openTestIndex(t)
+	defer db.Close()
+
+	w := newDBWriter(db, 7)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_, err := w.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, 'Guide', ?)",
+					fmt.Sprintf("entry %d-%d", i, j), "x.htm")
+				if err != nil {
+					t.Errorf("Expected nil but got %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{countEntries(db), 100}.Compare(t)
+}
+
+func TestDBWriterKeepsCommittedBatches(t *testing.T) {
+	defer cleanTmp()
+	db := openTestIndex(t)
+	defer db.Close()
+
+	w := newDBWriter(db, 2)
+	for i := 0; i < 5; i++ {
+		w.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, 'Guide', 'x.htm')", fmt.Sprint(i))
+	}
+	// The first four entries were committed before the writer failed
+	Test{countEntries(db), 4}.Compare(t)
+	_, err := w.Exec("INSERT INTO missing(name) VALUES ('x')")
+	Test{err != nil, true}.Compare(t)
+	w.Close()
+	Test{countEntries(db), 5}.Compare(t)
+}
+
+func TestDumpDatabase(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset"}
+	opts.CreateDirectory()
+	os.WriteFile(opts.DatabasePath(), []byte("stale"), 0644)
+
+	mem, _ := sql.Open(sqliteDriver, ":memory:")
+	mem.SetMaxOpenConns(1)
+	mem.Exec(dbSchema)
+	mem.Exec("INSERT INTO searchIndex(name, type, path) VALUES ('a', 'Guide', 'a.htm'), ('b', 'Guide', 'b.htm')")
+	if err := dumpDatabase(mem, opts.DatabasePath()); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	mem.Close()
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	Test{countEntries(db), 2}.Compare(t)
+}
+
+func TestCheckDatabase(t *testing.T) {
+	defer cleanTmp()
+	db := openTestIndex(t)
+	for i := 0; i < 500; i++ {
+		db.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, 'Guide', 'x.htm')", fmt.Sprint(i))
+	}
+	db.Close()
+	path := "tmp/Sample.docset/Contents/Resources/docSet.dsidx"
+	if err := checkDatabase(path); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+
+	// Overwrite the middle of the file to corrupt the index pages
+	b, _ := os.ReadFile(path)
+	for i := len(b) / 2; i < len(b)/2+2048 && i < len(b); i++ {
+		b[i] = 0xff
+	}
+	os.WriteFile(path, b, 0644)
+	Test{checkDatabase(path) != nil, true}.Compare(t)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var deepLinkHeader = []string{"name", "type", "path", "url"}
+
+// dashKeyword returns the keyword Dash searches the docset by: the first
+// -keyword, or the platform family without one
+func (opts *Options) dashKeyword() string {
+	if keyword, _, _ := strings.Cut(opts.Keyword(), ","); keyword != "" {
+		return keyword
+	}
+	return opts.Platform
+}
+
+// dashLink returns the dash:// URL searching the docset for name
+func dashLink(keyword, name string) string {
+	return "dash://" + url.QueryEscape(keyword) + ":" + strings.ReplaceAll(url.QueryEscape(name), "+", "%20")
+}
+
+// WriteDeepLinks writes a dash:// link for every index entry, or for the
+// entries of the -deep-link-types, to the -deep-links CSV file
+func (opts *Options) WriteDeepLinks() error {
+	if opts.DeepLinks == "" {
+		return nil
+	}
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := "SELECT name, type, path FROM searchIndex"
+	var args []interface{}
+	if types := splitList(opts.DeepLinkTypes); len(types) > 0 {
+		query += " WHERE type IN (?" + strings.Repeat(", ?", len(types)-1) + ")"
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+	rows, err := db.Query(query+" ORDER BY name, type, path", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	f, err := os.Create(opts.DeepLinks)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(deepLinkHeader)
+	keyword := opts.dashKeyword()
+	count := 0
+	for rows.Next() {
+		var name, entryType, path string
+		if err := rows.Scan(&name, &entryType, &path); err != nil {
+			return err
+		}
+		w.Write([]string{name, entryType, path, dashLink(keyword, name)})
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d deep links to %s", count, opts.DeepLinks)
+	return f.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestDashLink(t *testing.T) {
+	for _, test := range []Test{
+		{dashLink("vcl", "TForm"), "dash://vcl:TForm"},
+		{dashLink("vcl", "TForm.Show method"), "dash://vcl:TForm.Show%20method"},
+		{dashLink("c#", "a&b"), "dash://c%23:a%26b"},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestWriteDeepLinks(t *testing.T) {
+	opts := &Options{
+		SourcePath:    "/foo/bar/baz.chm",
+		Outdir:        "tmp/baz.docset",
+		Platform:      "unknown",
+		Keywords:      stringList{"vcl", "delphi"},
+		DeepLinks:     "tmp/links.csv",
+		DeepLinkTypes: "Class",
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	db.Exec(dbSchema)
+	for _, e := range [][]string{
+		{"TForm", "Class", "forms.htm"},
+		{"TForm.Show", "Method", "forms.htm#show"},
+	} {
+		db.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, ?, ?)", e[0], e[1], e[2])
+	}
+	db.Close()
+
+	if err := opts.WriteDeepLinks(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile("tmp/links.csv")
+	Test{string(b), "name,type,path,url\nTForm,Class,forms.htm,dash://vcl:TForm\n"}.Compare(t)
+
+	opts.Keywords = nil
+	Test{opts.dashKeyword(), "unknown"}.Compare(t)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dirType gives the entries of the pages below a directory a type
+type dirType struct {
+	prefix    string
+	entryType string
+}
+
+// parseDirTypes reads -dir-types, comma-separated PREFIX=TYPE items such
+// as "reference/functions/=Function,tutorials/=Guide". Prefixes are
+// directories of the content, matched regardless of case; the longest
+// prefix comes first.
+func parseDirTypes(s string) ([]dirType, error) {
+	var types []dirType
+	for _, item := range splitList(s) {
+		prefix, entryType, ok := strings.Cut(item, "=")
+		prefix, entryType = strings.TrimSpace(prefix), strings.TrimSpace(entryType)
+		if !ok || entryType == "" {
+			return nil, fmt.Errorf("-dir-types item %q is not PREFIX=TYPE", item)
+		}
+		prefix = strings.Trim(strings.ToLower(strings.ReplaceAll(prefix, `\`, "/")), "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		types = append(types, dirType{prefix, entryType})
+	}
+	sort.SliceStable(types, func(i, j int) bool { return len(types[i].prefix) > len(types[j].prefix) })
+	return types, nil
+}
+
+// dirType returns the -dir-types type of the page an index path points at,
+// or "" if no prefix matches
+func (opts *Options) dirType(path string) string {
+	page := strings.ToLower(pageOf(path))
+	for _, t := range opts.dirTypes {
+		if strings.HasPrefix(page, t.prefix) {
+			return t.entryType
+		}
+	}
+	return ""
+}
+
+// joinDirTypes returns the dir-types of a sidecar file as a -dir-types value
+func joinDirTypes(types map[string]string) string {
+	items := make([]string, 0, len(types))
+	for prefix, entryType := range types {
+		items = append(items, prefix+"="+entryType)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestParseDirTypes(t *testing.T) {
+	types, err := parseDirTypes(`Reference=Class, reference/functions/=Function,\tutorials\=Guide`)
+	Test{err, nil}.Compare(t)
+	Test{types, []dirType{{"reference/functions/", "Function"}, {"reference/", "Class"}, {"tutorials/", "Guide"}}}.DeepEqual(t)
+
+	types, err = parseDirTypes("")
+	Test{err, nil}.Compare(t)
+	Test{len(types), 0}.Compare(t)
+
+	_, err = parseDirTypes("reference/")
+	Test{err.Error(), `-dir-types item "reference/" is not PREFIX=TYPE`}.Compare(t)
+	_, err = parseDirTypes("reference/=")
+	Test{err != nil, true}.Compare(t)
+}
+
+func TestDirType(t *testing.T) {
+	opts := &Options{}
+	opts.dirTypes, _ = parseDirTypes("reference/=Class,reference/functions/=Function")
+	for _, test := range []Test{
+		{opts.dirType("Reference/Functions/printf.htm#x"), "Function"},
+		{opts.dirType("reference/tform.htm"), "Class"},
+		{opts.dirType("reference%20old/x.htm"), ""},
+		{opts.dirType("referenced.htm"), ""},
+		{opts.dirType("intro.htm"), ""},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestIndexDirTypes(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset"}
+	opts.sourceRanks, _ = parseSourcePriority(defaultSourcePriority)
+	opts.dirTypes, _ = parseDirTypes("functions/=Function")
+	opts.entries = map[entryKey]entryOrigin{}
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	w := newDBWriter(db, 0)
+
+	hhk := newIndexWriter(w, opts, sourceHHK)
+	hhk.Add("printf", "Guide", "functions/printf.htm")
+	hhk.Add("EOF", "Constant", "functions/printf.htm#eof")
+	hhk.Add("Overview", "Guide", "overview.htm")
+	w.Close()
+
+	rows, _ := db.Query("SELECT name, type FROM searchIndex ORDER BY name")
+	var entries []string
+	for rows.Next() {
+		var name, entryType string
+		rows.Scan(&name, &entryType)
+		entries = append(entries, name+"|"+entryType)
+	}
+	Test{entries, []string{"EOF|Constant", "Overview|Guide", "printf|Function"}}.DeepEqual(t)
+}
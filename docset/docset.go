@@ -0,0 +1,82 @@
+// Package docset writes the search index of Dash docsets. The index can be
+// written to a database handle owned by the caller, so that applications
+// embedding the conversion control its transactions and can keep several
+// indexes in one database.
+package docset
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// DefaultTable is the table Dash reads the entries of a docset from
+const DefaultTable = "searchIndex"
+
+var tableNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Execer runs statements. *sql.DB and *sql.Tx implement it.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Schema returns the statements creating an index table. Entries are
+// unique by name, type and path.
+func Schema(table string) string {
+	index := "anchor"
+	if table != DefaultTable {
+		index = table + "_anchor"
+	}
+	return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s(id INTEGER PRIMARY KEY, name TEXT, type TEXT, path TEXT);
+	CREATE UNIQUE INDEX IF NOT EXISTS %[2]s ON %[1]s (name, type, path);
+	`, table, index)
+}
+
+// IndexWriter adds entries to an index table. The caller owns the handle
+// and decides when to commit and close it.
+type IndexWriter struct {
+	db     Execer
+	table  string
+	insert string
+	count  int
+}
+
+// NewIndexWriter returns a writer adding entries to table, or to
+// DefaultTable if table is empty
+func NewIndexWriter(db Execer, table string) (*IndexWriter, error) {
+	if table == "" {
+		table = DefaultTable
+	}
+	if !tableNameRE.MatchString(table) {
+		return nil, fmt.Errorf("docset: invalid table name %q", table)
+	}
+	return &IndexWriter{
+		db:     db,
+		table:  table,
+		insert: fmt.Sprintf("INSERT OR IGNORE INTO %s(name, type, path) VALUES (?, ?, ?)", table),
+	}, nil
+}
+
+// CreateTable creates the index table unless it exists
+func (w *IndexWriter) CreateTable() error {
+	_, err := w.db.Exec(Schema(w.table))
+	return err
+}
+
+// Add adds an entry. Entries already in the table are skipped.
+func (w *IndexWriter) Add(name, entryType, path string) error {
+	res, err := w.db.Exec(w.insert, name, entryType, path)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		w.count += int(n)
+	}
+	return nil
+}
+
+// Count returns the number of entries added
+func (w *IndexWriter) Count() int {
+	return w.count
+}
@@ -0,0 +1,58 @@
+package docset
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestIndexWriterTx(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	tx, _ := db.Begin()
+	for _, table := range []string{"vcl", "rtl"} {
+		w, err := NewIndexWriter(tx, table)
+		if err != nil {
+			t.Fatalf("Expected nil but got %v", err)
+		}
+		if err := w.CreateTable(); err != nil {
+			t.Fatalf("Expected nil but got %v", err)
+		}
+		w.Add("TForm", "Class", "forms.htm")
+		w.Add("TForm", "Class", "forms.htm")
+		w.Add("Show", "Method", "forms.htm#show")
+		if w.Count() != 2 {
+			t.Errorf(`Expected "%v" but got "%v"`, 2, w.Count())
+		}
+	}
+	tx.Rollback()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&n); err != nil || n != 0 {
+		t.Errorf("Expected the rolled back tables to be gone but got %v %v", n, err)
+	}
+}
+
+func TestIndexWriterDefaultTable(t *testing.T) {
+	db, _ := sql.Open("sqlite", ":memory:")
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	w, _ := NewIndexWriter(db, "")
+	w.CreateTable()
+	w.Add("TForm", "Class", "forms.htm")
+
+	var name string
+	db.QueryRow("SELECT name FROM searchIndex").Scan(&name)
+	if name != "TForm" {
+		t.Errorf(`Expected "%v" but got "%v"`, "TForm", name)
+	}
+	if _, err := NewIndexWriter(db, "index; DROP TABLE x"); err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
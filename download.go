@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDownloadAttempts bounds the requests made to download one file, each
+// resuming where the previous one broke off
+const maxDownloadAttempts = 8
+
+// downloadRetryDelay is the pause before the first retry, doubled for each
+// further retry
+var downloadRetryDelay = 2 * time.Second
+
+// isURL reports whether a source is to be downloaded
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// downloadState is the checkpoint of a download, kept next to the partial
+// file so that a later run resumes it
+type downloadState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+	Complete     bool   `json:"complete"`
+}
+
+// validator returns the value to send as If-Range, or "" if the server gave
+// nothing to tell a changed file by
+func (s *downloadState) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+// downloadDir returns the directory keeping downloads, -download-dir or the
+// user cache directory
+func (opts *Options) downloadDir() (string, error) {
+	if opts.DownloadDir != "" {
+		return opts.DownloadDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chm2docset", "downloads"), nil
+}
+
+// fetchSources downloads the sources given as URLs and replaces them by the
+// downloaded files
+func (opts *Options) fetchSources(ctx context.Context) error {
+	dir := ""
+	for i, source := range opts.Sources {
+		if !isURL(source) {
+			continue
+		}
+		if dir == "" {
+			d, err := opts.downloadDir()
+			if err != nil {
+				return err
+			}
+			dir = d
+		}
+		p, err := download(ctx, http.DefaultClient, source, dir)
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", source, err)
+		}
+		opts.Sources[i] = p
+	}
+	if len(opts.Sources) > 0 {
+		opts.SourcePath = opts.Sources[0]
+	}
+	return nil
+}
+
+// download fetches rawURL into a directory of dir named after the URL and
+// returns the path of the file. A download broken off, in this run or an
+// earlier one, is resumed with a range request as long as the server
+// reports the same ETag or modification time; a complete download is
+// reused while the server reports it unchanged.
+func download(ctx context.Context, client *http.Client, rawURL, dir string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	dir = filepath.Join(dir, hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || !filepath.IsLocal(name) {
+		name = "download.chm"
+	}
+	target := filepath.Join(dir, name)
+	partial := target + ".part"
+	statePath := filepath.Join(dir, "download.json")
+
+	state := &downloadState{URL: rawURL}
+	if b, err := os.ReadFile(statePath); err == nil {
+		json.Unmarshal(b, state)
+	}
+	if state.Complete {
+		if _, err := os.Stat(target); err == nil {
+			unchanged, err := checkUnchanged(ctx, client, rawURL, state)
+			if err != nil {
+				log.Printf("Warning: could not check %s, using the earlier download: %v", rawURL, err)
+				return target, nil
+			}
+			if unchanged {
+				log.Printf("Using the earlier download of %s", rawURL)
+				return target, nil
+			}
+		}
+		state = &downloadState{URL: rawURL}
+	}
+
+	delay := downloadRetryDelay
+	for attempt := 1; ; attempt++ {
+		done, err := downloadRange(ctx, client, rawURL, partial, statePath, state)
+		if done {
+			break
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || ctx.Err() != nil || attempt == maxDownloadAttempts {
+			return "", err
+		}
+		log.Printf("Download of %s broken off at %d bytes (%v), resuming in %s", rawURL, fileSize(partial), err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		delay *= 2
+	}
+
+	if err := os.Rename(partial, target); err != nil {
+		return "", err
+	}
+	state.Complete = true
+	if err := saveDownloadState(statePath, state); err != nil {
+		return "", err
+	}
+	log.Printf("Downloaded %s (%d bytes)", rawURL, state.Size)
+	return target, nil
+}
+
+// permanentError is a download failure that retrying does not help
+type permanentError struct{ error }
+
+// downloadRange requests the part of the file missing from partial and
+// appends it, or starts over if the file changed on the server. It reports
+// whether the file is complete.
+func downloadRange(ctx context.Context, client *http.Client, rawURL, partial, statePath string, state *downloadState) (bool, error) {
+	offset := fileSize(partial)
+	if state.validator() == "" {
+		// The file cannot be told to be the same as before
+		offset = 0
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return false, &permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", state.validator())
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if start := contentRangeStart(resp.Header.Get("Content-Range")); start != offset {
+			return false, &permanentError{fmt.Errorf("the server resumed at byte %d instead of %d", start, offset)}
+		}
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && offset == state.Size:
+		// Everything was there already
+		return true, nil
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			log.Printf("%s changed on the server, downloading it again", rawURL)
+		}
+		flags |= os.O_TRUNC
+		offset = 0
+		state.ETag = resp.Header.Get("ETag")
+		state.LastModified = resp.Header.Get("Last-Modified")
+		state.Size = resp.ContentLength
+		if err := saveDownloadState(statePath, state); err != nil {
+			return false, &permanentError{err}
+		}
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return false, fmt.Errorf("server answered %s", resp.Status)
+	default:
+		return false, &permanentError{fmt.Errorf("server answered %s", resp.Status)}
+	}
+
+	f, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return false, &permanentError{err}
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		return false, &permanentError{cerr}
+	}
+	if err != nil {
+		return false, err
+	}
+	if state.Size >= 0 && offset+n < state.Size {
+		return false, io.ErrUnexpectedEOF
+	}
+	if state.Size < 0 {
+		state.Size = offset + n
+	}
+	return true, nil
+}
+
+// checkUnchanged asks the server whether the file of a complete download
+// is still current
+func checkUnchanged(ctx context.Context, client *http.Client, rawURL string, state *downloadState) (bool, error) {
+	if state.validator() == "" {
+		return false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusNotModified, nil
+}
+
+// contentRangeStart returns the first byte of a Content-Range header such
+// as "bytes 100-199/200", or -1
+func contentRangeStart(header string) int64 {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return -1
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+func saveDownloadState(p string, state *downloadState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0644)
+}
+
+// fileSize returns the size of a file, or 0 if it does not exist
+func fileSize(p string) int64 {
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadResume(t *testing.T) {
+	cleanTmp()
+	downloadRetryDelay = time.Millisecond
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var mu sync.Mutex
+	var ranges []string
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Method+" "+r.Header.Get("Range"))
+		fail := r.Method == http.MethodGet && failures > 0
+		if fail {
+			failures--
+		}
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if fail {
+			// Send 3000 bytes, then drop the connection
+			http.ServeContent(&cappedWriter{ResponseWriter: w, left: 3000}, r, "help.chm", modified, bytes.NewReader(content))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "help.chm", modified, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	p, err := download(context.Background(), srv.Client(), srv.URL+"/files/help.chm", "tmp/downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Test{filepath.Base(p), "help.chm"}.Compare(t)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Test{bytes.Equal(b, content), true}.Compare(t)
+	Test{ranges, []string{"GET ", "GET bytes=3000-", "GET bytes=6000-"}}.DeepEqual(t)
+
+	// A complete download is reused while unchanged
+	ranges = nil
+	p2, err := download(context.Background(), srv.Client(), srv.URL+"/files/help.chm", "tmp/downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Test{p2, p}.Compare(t)
+	Test{ranges, []string{"HEAD "}}.DeepEqual(t)
+}
+
+func TestDownloadChanged(t *testing.T) {
+	cleanTmp()
+	downloadRetryDelay = time.Millisecond
+	content := bytes.Repeat([]byte("abcdefghij"), 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	// A partial file of an earlier version is left from a previous run
+	rawURL := srv.URL + "/help.chm"
+	p, err := download(context.Background(), srv.Client(), rawURL, "tmp/downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(p)
+	os.Remove(p)
+	os.WriteFile(p+".part", []byte("stale"), 0644)
+	saveDownloadState(filepath.Join(dir, "download.json"), &downloadState{URL: rawURL, ETag: `"v1"`, Size: 1000})
+
+	p, err = download(context.Background(), srv.Client(), rawURL, "tmp/downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Test{bytes.Equal(b, content), true}.Compare(t)
+}
+
+func TestDownloadNotFound(t *testing.T) {
+	cleanTmp()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, err := download(context.Background(), srv.Client(), srv.URL+"/missing.chm", "tmp/downloads")
+	Test{err != nil, true}.Compare(t)
+}
+
+// cappedWriter stops writing a response after a number of bytes
+type cappedWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *cappedWriter) Write(b []byte) (int, error) {
+	if len(b) > w.left {
+		n, _ := w.ResponseWriter.Write(b[:w.left])
+		w.left = 0
+		return n, io.ErrShortWrite
+	}
+	w.left -= len(b)
+	return w.ResponseWriter.Write(b)
+}
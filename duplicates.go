@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policies for an entry whose name, type and path are indexed already
+const (
+	duplicateIgnore  = "ignore"
+	duplicateReplace = "replace"
+	duplicateSuffix  = "suffix"
+	duplicateError   = "error"
+)
+
+var duplicatePolicies = []string{duplicateIgnore, duplicateReplace, duplicateSuffix, duplicateError}
+
+// parseDuplicatePolicies returns the -duplicates policy of every entry
+// source. The value is a comma-separated list of a POLICY for every source
+// and SOURCE=POLICY items for particular ones, e.g. "ignore,hhk=suffix".
+func parseDuplicatePolicies(s string) (map[string]string, error) {
+	policies := map[string]string{}
+	fallback := duplicateIgnore
+	for _, item := range splitList(strings.ToLower(s)) {
+		source, policy, ok := strings.Cut(item, "=")
+		if !ok {
+			source, policy = "", item
+		}
+		source, policy = strings.TrimSpace(source), strings.TrimSpace(policy)
+		known := false
+		for _, name := range duplicatePolicies {
+			known = known || name == policy
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown duplicate policy %q, expected one of %s", policy, strings.Join(duplicatePolicies, ", "))
+		}
+		if source == "" {
+			fallback = policy
+			continue
+		}
+		known = false
+		for _, name := range entrySources {
+			known = known || name == source
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown entry source %q, expected one of %s", source, strings.Join(entrySources, ", "))
+		}
+		policies[source] = policy
+	}
+	for _, source := range entrySources {
+		if _, ok := policies[source]; !ok {
+			policies[source] = fallback
+		}
+	}
+	return policies, nil
+}
+
+// duplicate applies the policy of the source of w to an entry that is in
+// the index already
+func (w *indexWriter) duplicate(name, entryType, path string) error {
+	policy := w.opts.duplicatePolicies[w.source]
+	switch policy {
+	case duplicateReplace:
+		// The entry now belongs to this source and sorts as if added last
+		_, err := w.db.Exec("INSERT OR REPLACE INTO searchIndex(name, type, path) VALUES (?, ?, ?)", name, entryType, path)
+		if err != nil {
+			return err
+		}
+		w.opts.entries[entryKey{name, path}] = entryOrigin{entryType, w.opts.sourceRanks[w.source]}
+	case duplicateSuffix:
+		// Number the entry like the viewer numbers topics of one keyword
+		for i := 2; ; i++ {
+			suffixed := fmt.Sprintf("%s (%d)", name, i)
+			res, err := w.db.Exec("INSERT OR IGNORE INTO searchIndex(name, type, path) VALUES (?, ?, ?)", suffixed, entryType, path)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				w.count++
+				w.opts.addEntries(int(n))
+				if _, ok := w.opts.entries[entryKey{suffixed, path}]; !ok {
+					w.opts.entries[entryKey{suffixed, path}] = entryOrigin{entryType, w.opts.sourceRanks[w.source]}
+				}
+				break
+			}
+		}
+	case duplicateError:
+		return fmt.Errorf("%s entry %q (%s) for %s is indexed already", w.source, name, entryType, path)
+	default:
+		policy = duplicateIgnore
+	}
+	w.opts.countDuplicate(w.source, policy)
+	return nil
+}
+
+// countDuplicate records a duplicate entry of source handled by policy
+func (opts *Options) countDuplicate(source, policy string) {
+	src := opts.sourceReport()
+	if src == nil {
+		return
+	}
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	if src.Duplicates == nil {
+		src.Duplicates = map[string]map[string]int{}
+	}
+	if src.Duplicates[source] == nil {
+		src.Duplicates[source] = map[string]int{}
+	}
+	src.Duplicates[source][policy]++
+}
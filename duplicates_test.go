@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestParseDuplicatePolicies(t *testing.T) {
+	policies, err := parseDuplicatePolicies("suffix, HHK=error")
+	Test{err, nil}.Compare(t)
+	Test{policies[sourceHHK], duplicateError}.Compare(t)
+	Test{policies[sourceTitle], duplicateSuffix}.Compare(t)
+	Test{len(policies), len(entrySources)}.Compare(t)
+
+	policies, err = parseDuplicatePolicies("")
+	Test{err, nil}.Compare(t)
+	Test{policies[sourceHHC], duplicateIgnore}.Compare(t)
+
+	_, err = parseDuplicatePolicies("keep")
+	Test{err.Error(), `unknown duplicate policy "keep", expected one of ignore, replace, suffix, error`}.Compare(t)
+	_, err = parseDuplicatePolicies("toc=error")
+	Test{err != nil, true}.Compare(t)
+}
+
+func TestDuplicatePolicies(t *testing.T) {
+	for _, test := range []struct {
+		policy   string
+		expected []string
+		err      bool
+	}{
+		{duplicateIgnore, []string{"Open open.htm", "Save save.htm"}, false},
+		{duplicateReplace, []string{"Save save.htm", "Open open.htm"}, false},
+		{duplicateSuffix, []string{"Open open.htm", "Save save.htm", "Open (2) open.htm", "Open (3) open.htm"}, false},
+		{duplicateError, []string{"Open open.htm", "Save save.htm"}, true},
+	} {
+		opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Duplicates: "hhk=" + test.policy}
+		opts.report = opts.newReport()
+		opts.sourceRanks, _ = parseSourcePriority("")
+		opts.duplicatePolicies, _ = parseDuplicatePolicies(opts.Duplicates)
+		opts.entries = map[entryKey]entryOrigin{}
+		opts.CreateDirectory()
+		db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+		db.Exec(dbSchema)
+		w := newDBWriter(db, 0)
+
+		hhk := newIndexWriter(w, opts, sourceHHK)
+		hhk.Add("Open", "Guide", "open.htm")
+		hhk.Add("Save", "Guide", "save.htm")
+		err := hhk.Add("Open", "Guide", "open.htm")
+		Test{err != nil, test.err}.Compare(t)
+		if err == nil {
+			hhk.Add("Open", "Guide", "open.htm")
+		}
+		w.Close()
+
+		rows, _ := db.Query("SELECT name, path FROM searchIndex ORDER BY id")
+		var entries []string
+		for rows.Next() {
+			var name, path string
+			rows.Scan(&name, &path)
+			entries = append(entries, name+" "+path)
+		}
+		db.Close()
+		Test{entries, test.expected}.DeepEqual(t)
+		count := 2
+		if test.err {
+			count = 0
+		}
+		Test{opts.sourceReport().Duplicates[sourceHHK][test.policy], count}.Compare(t)
+		cleanTmp()
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"html"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRE       = regexp.MustCompile(`(?is)<h[1-6]\b[^>]*>(.*?)</h[1-6]\s*>`)
+	formulaRE       = regexp.MustCompile(`(?is)<img\b[^>]*>|<math\b[^>]*>.*?</math\s*>`)
+	altAttrRE       = regexp.MustCompile(`(?i)\salt(?:text)?\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	texAnnotationRE = regexp.MustCompile(`(?is)<annotation\b[^>]*x-tex[^>]*>(.*?)</annotation\s*>`)
+	// File names and classes of formula images, e.g. eq12.gif or class="math"
+	formulaHintRE = regexp.MustCompile(`(?i)\b(?:eqn?[\d_-]|equation|formula|math|latex)`)
+	// Operators and TeX commands that mark alt text as a formula
+	formulaTextRE = regexp.MustCompile(`[=^<>≤≥≠±∑∏∫√∞∂∆]|\\[a-zA-Z]+`)
+)
+
+const (
+	equationEntryType = "Section"
+	// Longer alt texts are descriptions rather than formulas
+	maxFormulaText = 200
+)
+
+// eqEntry is a section whose heading holds a formula, or a formula below a
+// heading
+type eqEntry struct {
+	Name   string
+	Anchor string
+}
+
+// indexEquations indexes the formulas of every page
+func (opts *Options) indexEquations(db *dbWriter) error {
+	w := newIndexWriter(db, opts, sourceEquations)
+
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		entries, err := equationEntries(opts.pages, path)
+		if err != nil {
+			opts.pageErrorf("skipping equations of %s due to error: %v", path, err)
+			return nil
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, e := range entries {
+			if err := w.Add(e.Name, equationEntryType, indexPath(relPath)+"#"+e.Anchor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		log.Printf("Indexed %d equations", w.count)
+	}
+	return nil
+}
+
+// equationEntries returns the formula entries of a page. Headings holding
+// formula images or MathML are named with the formulas' alt text; other
+// formulas are named after their heading followed by the formula. Elements
+// without an id get one and the page is rewritten.
+func equationEntries(pages *pageCache, path string) ([]eqEntry, error) {
+	b, err := pages.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	charset := detectCharset(b, "")
+	headings := headingRE.FindAllSubmatchIndex(b, -1)
+
+	var entries []eqEntry
+	var insertions []idInsertion
+	used := map[string]bool{}
+	anchorFor := func(tag []byte, tagEnd int, prefix, name string) string {
+		if m := idAttrRE.FindSubmatch(tag); m != nil {
+			used[string(m[1])] = true
+			return string(m[1])
+		}
+		anchor := uniqueAnchor(prefix, name, used)
+		used[anchor] = true
+		if b[tagEnd-1] == '/' {
+			tagEnd--
+		}
+		insertions = append(insertions, idInsertion{End: tagEnd, ID: anchor})
+		return anchor
+	}
+
+	inHeading := map[int]bool{}
+	heading := -1
+	for _, f := range formulaRE.FindAllIndex(b, -1) {
+		text := formulaText(b[f[0]:f[1]], charset)
+		if text == "" {
+			continue
+		}
+		for heading+1 < len(headings) && headings[heading+1][0] <= f[0] {
+			heading++
+		}
+		if heading >= 0 && f[1] <= headings[heading][1] {
+			inHeading[heading] = true
+			continue
+		}
+		if heading < 0 {
+			continue
+		}
+		name := headingText(b, headings[heading], charset) + ": " + text
+		tagEnd := f[0] + strings.IndexByte(string(b[f[0]:f[1]]), '>')
+		entries = append(entries, eqEntry{Name: name, Anchor: anchorFor(b[f[0]:tagEnd], tagEnd, "eq-", text)})
+	}
+
+	for i, h := range headings {
+		if !inHeading[i] {
+			continue
+		}
+		name := headingText(b, h, charset)
+		tagEnd := h[2] - 1
+		entries = append(entries, eqEntry{Name: name, Anchor: anchorFor(b[h[0]:tagEnd], tagEnd, "sec-", name)})
+	}
+
+	if len(insertions) > 0 {
+		if err := pages.WriteFile(path, insertIDs(b, insertions)); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// formulaText returns the text of a formula image or MathML element, or ""
+// if the element is not a formula
+func formulaText(element []byte, charset string) string {
+	isMath := len(element) > 5 && strings.EqualFold(string(element[1:5]), "math")
+	tagEnd := strings.IndexByte(string(element), '>') + 1
+	tag := element[:tagEnd]
+
+	var text string
+	if m := altAttrRE.FindSubmatch(tag); m != nil {
+		text = string(m[1]) + string(m[2]) + string(m[3])
+		text = html.UnescapeString(decodeCharset([]byte(text), charset))
+	}
+	if isMath && text == "" {
+		if m := texAnnotationRE.FindSubmatch(element); m != nil {
+			text = cellText(m[1], charset)
+		} else {
+			text = cellText(element, charset)
+		}
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" || len(text) > maxFormulaText {
+		return ""
+	}
+	if !isMath && !formulaHintRE.Match(altAttrRE.ReplaceAll(tag, nil)) && !formulaTextRE.MatchString(text) {
+		return ""
+	}
+	return text
+}
+
+// headingText returns the text of a heading with its formulas replaced by
+// their text
+func headingText(b []byte, h []int, charset string) string {
+	content := b[h[2]:h[3]]
+	var parts []string
+	last := 0
+	for _, f := range formulaRE.FindAllIndex(content, -1) {
+		if text := formulaText(content[f[0]:f[1]], charset); text != "" {
+			parts = append(parts, cellText(content[last:f[0]], charset), text)
+			last = f[1]
+		}
+	}
+	parts = append(parts, cellText(content[last:], charset))
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormulaText(t *testing.T) {
+	for _, test := range []struct{ element, expected string }{
+		{`<img src="images/eq12.gif" alt="E = mc^2">`, "E = mc^2"},
+		{`<img src="eq3.gif" alt="Beam deflection">`, "Beam deflection"},
+		{`<img src="photo.jpg" alt="σ = F/A">`, "σ = F/A"},
+		{`<img src="logo.gif" alt="Company logo">`, ""},
+		{`<img src="eq1.gif">`, ""},
+		{`<math alttext="a^2+b^2=c^2"><mi>a</mi></math>`, "a^2+b^2=c^2"},
+		{`<math><semantics><mi>x</mi><annotation encoding="application/x-tex">\sqrt{x}</annotation></semantics></math>`, `\sqrt{x}`},
+		{`<math><mi>x</mi><mo>+</mo><mn>1</mn></math>`, "x+1"},
+	} {
+		Test{formulaText([]byte(test.element), ""), test.expected}.Compare(t)
+	}
+}
+
+func TestEquationEntries(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/stress.htm", []byte(`<html><body>
+<p>Intro <img src="eq0.gif" alt="x = 1"></p>
+<h2>Von Mises stress <img src="eq1.gif" alt="&sigma;_v"/></h2>
+<p>The stress is <img src="eq2.gif" alt="σ = F/A" id="main"> where
+<img src="arrow.gif" alt="see also"></p>
+<h3 id="strain">Strain</h3>
+<math alttext="\varepsilon = \Delta L / L"><mi>ε</mi></math>
+</body></html>`), 0644)
+
+	entries, err := equationEntries(nil, "tmp/stress.htm")
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	Test{entries, []eqEntry{
+		{"Von Mises stress σ_v: σ = F/A", "main"},
+		{`Strain: \varepsilon = \Delta L / L`, "eq-varepsilon-delta-l-l"},
+		{"Von Mises stress σ_v", "sec-von-mises-stress-v"},
+	}}.DeepEqual(t)
+
+	b, _ := os.ReadFile("tmp/stress.htm")
+	for _, s := range []string{
+		`<h2 id="sec-von-mises-stress-v">`,
+		`<math alttext="\varepsilon = \Delta L / L" id="eq-varepsilon-delta-l-l">`,
+		`<img src="eq1.gif" alt="&sigma;_v"/>`,
+	} {
+		Test{strings.Contains(string(b), s), true}.Compare(t)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+// sourceEstimate predicts the outcome of converting a CHM from its
+// directory listing and sitemaps, without extracting its pages
+type sourceEstimate struct {
+	Pages      int
+	OtherFiles int
+	// Size is the uncompressed size of the files to extract
+	Size       uint64
+	HHCEntries int
+	HHKEntries int
+	// Main is the source of the main index entries, as in -source-priority
+	Main    string
+	Entries int
+}
+
+// estimate reads the directory listing of a CHM and its .hhc and .hhk
+// files, leaving out the files -extract-only and -extract-skip reject
+func (opts *Options) estimate(source string) (*sourceEstimate, error) {
+	ranks, err := parseSourcePriority(opts.SourcePriority)
+	if err != nil {
+		return nil, err
+	}
+	keep, err := opts.extractFilter()
+	if err != nil {
+		return nil, err
+	}
+	r, err := chm.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	e := &sourceEstimate{}
+	var hhc, hhk string
+	for _, f := range r.Files() {
+		if !f.IsContent() || keep != nil && !keep(f.Name[1:]) {
+			continue
+		}
+		e.Size += f.Length
+		switch ext := strings.ToLower(filepath.Ext(f.Name)); {
+		case isHTMLFile(f.Name):
+			e.Pages++
+		case ext == ".hhc" && hhc == "":
+			hhc = f.Name
+		case ext == ".hhk" && hhk == "":
+			hhk = f.Name
+		default:
+			e.OtherFiles++
+		}
+	}
+
+	// Pages the keyword index lists, by lower-cased path
+	listed := map[string]bool{}
+	for _, sitemap := range []struct {
+		name    string
+		entries *int
+	}{{hhc, &e.HHCEntries}, {hhk, &e.HHKEntries}} {
+		if sitemap.name == "" {
+			continue
+		}
+		b, err := r.ReadFile(sitemap.name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", sitemap.name, err)
+		}
+		for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+			for _, local := range append([]string{item.Local}, item.More...) {
+				if local == "" {
+					continue
+				}
+				*sitemap.entries++
+				if sitemap.name == hhk {
+					listed[strings.ToLower(strings.TrimPrefix(stripFragment(local), "/"))] = true
+				}
+			}
+		}
+	}
+
+	opts.sourceRanks = ranks
+	e.Main = opts.mainSource(hhk != "", hhc != "")
+	switch e.Main {
+	case sourceHHK:
+		// Pages without keywords are indexed by their titles
+		e.Entries = e.HHKEntries + max(e.Pages-len(listed), 0)
+	case sourceHHC:
+		e.Entries = e.HHCEntries
+	default:
+		e.Entries = e.Pages
+	}
+	return e, nil
+}
+
+// estimateSources describes the sources of main index entries
+var estimateSources = map[string]string{
+	sourceHHK:   "the keyword index",
+	sourceHHC:   "the table of contents",
+	sourceTitle: "page titles",
+}
+
+// writeEstimates prints the estimate of every CHM the conversion reads,
+// so that options can be chosen before running a long conversion
+func (opts *Options) writeEstimates(w io.Writer) error {
+	sources := []string{opts.SourcePath}
+	if opts.combined() {
+		sources = opts.Sources
+	}
+	for i, source := range sources {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		part := Options{SourcePath: source, FromDir: opts.FromDir}
+		if part.isSourceDir() || part.isProject() || isHelp2File(source) || isMSHCFile(source) || isHLPFile(source) {
+			return fmt.Errorf("-estimate reads CHM files only, not %s", source)
+		}
+		e, err := opts.estimate(source)
+		if err != nil {
+			return err
+		}
+		fields := []struct {
+			name  string
+			value interface{}
+		}{
+			{"Source", source},
+			{"Pages", e.Pages},
+			{"Other files", e.OtherFiles},
+			{"Uncompressed size", fmt.Sprintf("%d bytes", e.Size)},
+			{"Table of contents entries", e.HHCEntries},
+			{"Keyword index entries", e.HHKEntries},
+			{"Index entries", fmt.Sprintf("about %d, mainly from %s", e.Entries, estimateSources[e.Main])},
+		}
+		for _, field := range fields {
+			fmt.Fprintf(w, "%s: %v\n", field.name, field.value)
+		}
+	}
+	return nil
+}
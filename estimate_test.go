@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	opts := &Options{}
+	e, err := opts.estimate("_fixtures/merged/master.chm")
+	Test{err, nil}.Compare(t)
+	Test{*e, sourceEstimate{Pages: 1, Size: 503, HHCEntries: 1, Main: sourceHHC, Entries: 1}}.DeepEqual(t)
+
+	e, err = opts.estimate("_fixtures/sample.chm")
+	Test{err, nil}.Compare(t)
+	Test{[]int{e.Pages, e.OtherFiles, e.Entries}, []int{3, 1, 3}}.DeepEqual(t)
+	Test{e.Main, sourceTitle}.Compare(t)
+
+	opts.ExtractSkip = stringList{"sub", "*.gif"}
+	e, _ = opts.estimate("_fixtures/sample.chm")
+	Test{[]int{e.Pages, e.OtherFiles, e.Entries}, []int{2, 0, 2}}.DeepEqual(t)
+}
+
+func TestWriteEstimates(t *testing.T) {
+	opts := &Options{SourcePath: "_fixtures/merged/master.chm"}
+	var buf bytes.Buffer
+	Test{opts.writeEstimates(&buf), nil}.Compare(t)
+	Test{buf.String(), `Source: _fixtures/merged/master.chm
+Pages: 1
+Other files: 0
+Uncompressed size: 503 bytes
+Table of contents entries: 1
+Keyword index entries: 0
+Index entries: about 1, mainly from the table of contents
+`}.Compare(t)
+
+	opts = &Options{SourcePath: "_fixtures/merged"}
+	Test{opts.writeEstimates(&buf).Error(), "-estimate reads CHM files only, not _fixtures/merged"}.Compare(t)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Output formats. Other formats than docset are exported from the
+// converted docset, which is removed afterwards.
+const (
+	formatDocset = "docset"
+	formatSite   = "site"
+)
+
+var exporters = map[string]func(opts *Options) error{
+	formatSite:       (*Options).exportSite,
+	formatMarkdown:   (*Options).exportMarkdown,
+	formatHTMLSingle: (*Options).exportHTMLSingle,
+}
+
+// formatNames returns the supported -format values
+func formatNames() []string {
+	names := []string{formatDocset}
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// checkFormat validates -format
+func (opts *Options) checkFormat() error {
+	if opts.Format == "" || opts.Format == formatDocset {
+		return nil
+	}
+	if _, ok := exporters[opts.Format]; !ok {
+		return fmt.Errorf("unknown format %q, expected one of %s", opts.Format, strings.Join(formatNames(), ", "))
+	}
+	if opts.Tgz {
+		return fmt.Errorf("-tgz archives a docset, not the %s format", opts.Format)
+	}
+	return nil
+}
+
+// ExportPath returns the output path of an exported format: the docset
+// path without its .docset extension
+func (opts *Options) ExportPath() string {
+	return strings.TrimSuffix(opts.DocsetPath(), ".docset")
+}
+
+// Export writes the converted docset in -format and removes the docset
+func (opts *Options) Export() error {
+	export, ok := exporters[opts.Format]
+	if !ok {
+		return nil
+	}
+	if err := os.RemoveAll(opts.ExportPath()); err != nil {
+		return err
+	}
+	if err := export(opts); err != nil {
+		return err
+	}
+	return os.RemoveAll(opts.DocsetPath())
+}
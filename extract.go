@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+// Extractor writes the content files of a CHM into a directory
+type Extractor interface {
+	Extract(ctx context.Context, source, destination string) error
+}
+
+// Extractor names for -extractor
+const (
+	extractorBuiltin = "builtin"
+	extractorHH      = "hh"
+	extractorChmlib  = "chmlib"
+	extractor7z      = "7z"
+)
+
+var extractors = map[string]Extractor{
+	extractorBuiltin: builtinExtractor{},
+	extractorHH: commandExtractor{bin: "hh.exe", args: func(source, destination string) []string {
+		return []string{"-decompile", destination, source}
+	}},
+	extractorChmlib: commandExtractor{bin: "extract_chmLib", args: func(source, destination string) []string {
+		return []string{source, destination}
+	}},
+	extractor7z: sevenZipExtractor{},
+}
+
+// extractorOrder is the order extractors are tried in on a CHM after the
+// -extractor one
+var extractorOrder = []string{extractorBuiltin, extractorChmlib, extractor7z, extractorHH}
+
+// availableExtractor is implemented by extractors running a program, which
+// may not be installed
+type availableExtractor interface {
+	available() error
+}
+
+// extractorNames returns the supported -extractor values
+func extractorNames() []string {
+	names := []string{extractorBuiltin}
+	for name := range extractors {
+		if name != extractorBuiltin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// extractor returns the -extractor backend
+func (opts *Options) extractor() (Extractor, error) {
+	name := opts.Extractor
+	if name == "" {
+		name = extractorBuiltin
+	}
+	e, ok := extractors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown extractor %q, expected one of %s", name, strings.Join(extractorNames(), ", "))
+	}
+	return e, nil
+}
+
+// builtinExtractor reads the CHM with the chm package
+type builtinExtractor struct {
+	// memoryLimit is the MemoryLimit of the reader, in bytes
+	memoryLimit int64
+}
+
+func (e builtinExtractor) Extract(ctx context.Context, source, destination string) error {
+	return e.ExtractFiltered(ctx, source, destination, nil)
+}
+
+func (e builtinExtractor) ExtractFiltered(ctx context.Context, source, destination string, keep func(name string) bool) error {
+	return e.ExtractStreaming(ctx, source, destination, keep, nil)
+}
+
+func (e builtinExtractor) ExtractStreaming(ctx context.Context, source, destination string, keep func(name string) bool, visit func(name string, b []byte)) error {
+	r, err := chm.Open(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	r.MemoryLimit = e.memoryLimit
+	n, err := r.ExtractEach(destination, keep, visit)
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w; another -extractor may be able to read it", source, err)
+	}
+	log.Printf("Extracted %d files from %s", n, source)
+	return nil
+}
+
+// commandExtractor runs an external program with runSandboxed
+type commandExtractor struct {
+	bin  string
+	args func(source, destination string) []string
+	// temp holds the scratch directories of the program
+	temp *tempRoot
+}
+
+func (e commandExtractor) available() error {
+	_, err := e.lookPath()
+	return err
+}
+
+// lookPath finds the program in PATH
+func (e commandExtractor) lookPath() (string, error) {
+	bin, err := exec.LookPath(e.bin)
+	if err != nil {
+		return "", fmt.Errorf("dependency missing: %s is required but not found in PATH: %w", e.bin, err)
+	}
+	return bin, nil
+}
+
+func (e commandExtractor) Extract(ctx context.Context, source, destination string) error {
+	bin, err := e.lookPath()
+	if err != nil {
+		return err
+	}
+	source, destination, err = absPaths(source, destination)
+	if err != nil {
+		return err
+	}
+	if out, err := runSandboxed(ctx, e.temp, bin, e.args(source, destination)...); err != nil {
+		return fmt.Errorf("command execution failed (%s): %w\n%s", e.bin, err, lastLines(out, 10))
+	}
+	return scrubOutput(destination)
+}
+
+// sevenZipExtractor runs 7-Zip, installed as 7z or, for the standalone
+// build, as 7za
+type sevenZipExtractor struct {
+	// temp holds the scratch directories of the program
+	temp *tempRoot
+}
+
+func (sevenZipExtractor) bin() (string, error) {
+	for _, bin := range []string{"7z", "7za"} {
+		if path, err := exec.LookPath(bin); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("dependency missing: 7z or 7za is required but not found in PATH")
+}
+
+func (e sevenZipExtractor) available() error {
+	_, err := e.bin()
+	return err
+}
+
+func (e sevenZipExtractor) Extract(ctx context.Context, source, destination string) error {
+	bin, err := e.bin()
+	if err != nil {
+		return err
+	}
+	source, destination, err = absPaths(source, destination)
+	if err != nil {
+		return err
+	}
+	// 7z prints a line per file; its output is kept for messages only
+	out, err := runSandboxed(ctx, e.temp, bin, "x", "-y", "-o"+destination, "--", source)
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		// Exit code 1 is a warning, e.g. for a file that could not be read
+		log.Printf("7z reported warnings extracting %s:\n%s", source, lastLines(out, 10))
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("command execution failed (%s): %w\n%s", filepath.Base(bin), err, lastLines(out, 10))
+	}
+	if err := removeInternalFiles(destination); err != nil {
+		return err
+	}
+	return scrubOutput(destination)
+}
+
+// absPaths makes source and destination absolute, as external extractors
+// run in a directory of their own
+func absPaths(source, destination string) (string, string, error) {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return "", "", err
+	}
+	destination, err = filepath.Abs(destination)
+	return source, destination, err
+}
+
+// removeInternalFiles removes the #SYSTEM, $FIftiMain and like files of the
+// CHM itself, which 7z extracts along with the content
+func removeInternalFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if (name[0] == '#' || name[0] == '$') && !strings.Contains(name, ".") {
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lastLines returns the last n lines of s
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
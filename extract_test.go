@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"chm2docset/chm"
+)
+
+func TestExtractor(t *testing.T) {
+	e, err := (&Options{}).extractor()
+	Test{e, builtinExtractor{}}.Compare(t)
+	Test{err, nil}.Compare(t)
+	e, err = (&Options{Extractor: extractorHH}).extractor()
+	Test{e.(commandExtractor).bin, "hh.exe"}.Compare(t)
+	Test{err, nil}.Compare(t)
+	_, err = (&Options{Extractor: "unrar"}).extractor()
+	Test{err.Error(), `unknown extractor "unrar", expected one of builtin, 7z, chmlib, hh`}.Compare(t)
+	Test{extractorNames(), []string{"builtin", "7z", "chmlib", "hh"}}.DeepEqual(t)
+}
+
+func TestCommandExtractorMissing(t *testing.T) {
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", "")
+	err := extractors[extractorChmlib].Extract(context.Background(), "baz.chm", "tmp")
+	Test{err != nil, true}.Compare(t)
+}
+
+func TestExtract7z(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/foo.docset", Extractor: extractor7z}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	useFixtureBin()
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	content, _ := filepath.Abs(opts.ContentPath())
+	b, _ := os.ReadFile(opts.ContentPath() + "/args.txt")
+	Test{string(b), "x -y -o" + content + " -- /foo/bar/baz.chm\n"}.Compare(t)
+	names := []string{}
+	filepath.WalkDir(opts.ContentPath(), func(path string, d os.DirEntry, err error) error {
+		rel, _ := filepath.Rel(opts.ContentPath(), path)
+		names = append(names, filepath.ToSlash(rel))
+		return err
+	})
+	Test{names, []string{".", "#keep.htm", "args.txt", "sub", "sub/test.htm"}}.DeepEqual(t)
+}
+
+func TestExtractFallback(t *testing.T) {
+	opts := &Options{SourcePath: "_fixtures/Sample.docset/Contents/Info.plist", Outdir: "tmp/foo.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	useFixtureBin()
+	// The built-in reader fails, so extract_chmLib is tried next
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	_, err := os.Stat(opts.ContentPath() + "/index.htm")
+	Test{err, nil}.Compare(t)
+
+	// Missing programs are skipped
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.MkdirAll("tmp/bin", 0755)
+	sevenZip, _ := filepath.Abs("_fixtures/bin/7z")
+	os.Symlink(sevenZip, "tmp/bin/7z")
+	dirs := []string{}
+	fixtureBin, _ := filepath.Abs("_fixtures/bin")
+	for _, dir := range filepath.SplitList(path) {
+		if dir != fixtureBin {
+			dirs = append(dirs, dir)
+		}
+	}
+	bin, _ := filepath.Abs("tmp/bin")
+	os.Setenv("PATH", strings.Join(append([]string{bin}, dirs...), string(os.PathListSeparator)))
+	opts.Clean()
+	opts.CreateDirectory()
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	_, err = os.Stat(opts.ContentPath() + "/sub/test.htm")
+	Test{err, nil}.Compare(t)
+	// Files of the extractors that failed are removed
+	_, err = os.Stat(opts.ContentPath() + "/index.htm")
+	Test{os.IsNotExist(err), true}.Compare(t)
+
+	// Without any extractor left, the errors of all are reported
+	os.Remove("tmp/bin/7z")
+	opts.Clean()
+	opts.CreateDirectory()
+	if _, err := (sevenZipExtractor{}).bin(); err == nil {
+		t.Log("7-Zip is installed, not checking the errors of missing extractors")
+	} else if _, err := exec.LookPath("extract_chmLib"); err == nil {
+		t.Log("chmlib is installed, not checking the errors of missing extractors")
+	} else {
+		err = opts.ExtractSource()
+		Test{err != nil && strings.Contains(err.Error(), "extract_chmLib is required") && strings.Contains(err.Error(), "7z or 7za is required"), true}.Compare(t)
+	}
+
+	// Protected files stop the chain
+	opts = &Options{SourcePath: "tmp/protected.chm", Outdir: "tmp/foo.docset"}
+	os.WriteFile("tmp/protected.chm", []byte("ITOLITLS"+strings.Repeat("\x00", 0x60)), 0644)
+	os.Setenv("PATH", path)
+	useFixtureBin()
+	err = opts.ExtractSource()
+	Test{errors.Is(err, chm.ErrProtected), true}.Compare(t)
+}
+
+func TestLastLines(t *testing.T) {
+	Test{lastLines("a\nb\nc\n", 2), "b\nc"}.Compare(t)
+	Test{lastLines("a", 2), "a"}.Compare(t)
+}
+
+func TestRunSandboxedTimeout(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = runSandboxed(ctx, nil, sleep, "10")
+	Test{err != nil && strings.Contains(err.Error(), "sleep timed out"), true}.Compare(t)
+}
+
+func TestRunSandboxedTempRoot(t *testing.T) {
+	pwd, err := exec.LookPath("pwd")
+	if err != nil {
+		t.Skip("pwd not found")
+	}
+	temp := newTempRoot(false)
+	defer temp.Remove()
+	out, err := runSandboxed(context.Background(), temp, pwd)
+	Test{err, nil}.Compare(t)
+	scratch := strings.TrimSpace(out)
+	Test{filepath.Dir(scratch), temp.dir}.Compare(t)
+	_, err = os.Stat(scratch)
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
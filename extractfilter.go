@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filteredExtractor is implemented by extractors that can leave files out
+// while extracting rather than writing them first
+type filteredExtractor interface {
+	ExtractFiltered(ctx context.Context, source, destination string, keep func(name string) bool) error
+}
+
+// extractFilter returns whether a content file, given by its slash
+// separated path inside the CHM, is extracted under -extract-only and
+// -extract-skip, or nil when neither is given
+func (opts *Options) extractFilter() (func(name string) bool, error) {
+	if len(opts.ExtractOnly) == 0 && len(opts.ExtractSkip) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range append(append([]string(nil), opts.ExtractOnly...), opts.ExtractSkip...) {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return nil, fmt.Errorf("invalid extract pattern %q: %w", pattern, err)
+		}
+	}
+	only, skip := opts.ExtractOnly, opts.ExtractSkip
+	return func(name string) bool {
+		name = strings.ToLower(strings.TrimPrefix(name, "/"))
+		// The table of contents and index are needed to build the docset
+		if ext := path.Ext(name); ext == ".hhc" || ext == ".hhk" {
+			return true
+		}
+		if len(only) > 0 && !matchExtractPattern(only, name) {
+			return false
+		}
+		return !matchExtractPattern(skip, name)
+	}, nil
+}
+
+// matchExtractPattern reports whether one of patterns matches name, one of
+// its parent directories or, for patterns without a slash, its base name.
+// Matching ignores case.
+func matchExtractPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.Trim(pattern, "/"))
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+		}
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneExtracted removes the files below dir that keep rejects, for
+// extractors that wrote every file, and returns their number. Directories
+// left empty are removed as well.
+func pruneExtracted(dir string, keep func(name string) bool) (int, error) {
+	var removed int
+	var dirs []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		if keep(filepath.ToSlash(rel)) {
+			return nil
+		}
+		removed++
+		return os.Remove(p)
+	})
+	if err != nil {
+		return removed, err
+	}
+	// Deepest directories come last in walk order
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	if removed > 0 {
+		log.Printf("Removed %d files left out by -extract-only and -extract-skip", removed)
+	}
+	return removed, nil
+}
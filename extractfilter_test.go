@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestExtractFilter(t *testing.T) {
+	keep, err := (&Options{}).extractFilter()
+	Test{keep == nil, true}.Compare(t)
+	Test{err, nil}.Compare(t)
+
+	opts := &Options{ExtractOnly: stringList{"API/*", "/guide"}, ExtractSkip: stringList{"*.PDF", "api/old"}}
+	keep, err = opts.extractFilter()
+	Test{err, nil}.Compare(t)
+	for name, expected := range map[string]bool{
+		"api/a.htm":          true,
+		"/api/b.htm":         true,
+		"api/sub/c.htm":      true,
+		"api/manual.pdf":     false,
+		"api/old/d.htm":      false,
+		"Guide/intro.htm":    true,
+		"guide/x/y/deep.htm": true,
+		"other/a.htm":        false,
+		"index.htm":          false,
+		"toc.hhc":            true,
+		"sub/Index.HHK":      true,
+	} {
+		if keep(name) != expected {
+			t.Errorf("Expected keep(%q) to be %v", name, expected)
+		}
+	}
+
+	_, err = (&Options{ExtractSkip: stringList{"[a-"}}).extractFilter()
+	Test{err.Error(), `invalid extract pattern "[a-": syntax error in pattern`}.Compare(t)
+}
+
+func TestExtractFiltered(t *testing.T) {
+	defer cleanTmp()
+	for _, opts := range []*Options{
+		{SourcePath: "_fixtures/multilang.chm", Outdir: "tmp/builtin.docset", ExtractOnly: stringList{"en"}, ExtractSkip: stringList{"setup.htm"}},
+		{SourcePath: "_fixtures/Sample.docset/Contents/Info.plist", Outdir: "tmp/7z.docset", Extractor: extractor7z, ExtractSkip: stringList{"args.txt", "#*"}},
+	} {
+		opts.CreateDirectory()
+		useFixtureBin()
+		Test{opts.ExtractSource(), nil}.Compare(t)
+		names := []string{}
+		filepath.WalkDir(opts.ContentPath(), func(path string, d os.DirEntry, err error) error {
+			rel, _ := filepath.Rel(opts.ContentPath(), path)
+			names = append(names, filepath.ToSlash(rel))
+			return err
+		})
+		sort.Strings(names)
+		if opts.ExtractOnly != nil {
+			Test{names, []string{".", "en", "en/index.htm"}}.DeepEqual(t)
+		} else {
+			Test{names, []string{".", "sub", "sub/test.htm"}}.DeepEqual(t)
+		}
+	}
+}
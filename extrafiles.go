@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// extraFileFuncs are the functions available to -extra-file templates
+var extraFileFuncs = template.FuncMap{
+	// json quotes a value for manifest files, e.g. "title": {{json .Title}}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// extraFileData is what -extra-file templates are rendered with: the
+// options, with methods such as Title, BundleIdentifier and IndexFilePath,
+// and the outcome of the conversion
+type extraFileData struct {
+	*Options
+	// Source is the name of the input file
+	Source    string
+	Pages     int
+	Entries   int
+	Generated time.Time
+}
+
+// extraFile is a template and the path below the docset bundle it is
+// rendered to
+type extraFile struct {
+	Template, Target string
+}
+
+// extraFiles parses the -extra-file flags, given as TEMPLATE=PATH
+func (opts *Options) extraFiles() ([]extraFile, error) {
+	var files []extraFile
+	for _, spec := range opts.ExtraFiles {
+		tmpl, target, ok := strings.Cut(spec, "=")
+		tmpl, target = strings.TrimSpace(tmpl), filepath.Clean(filepath.FromSlash(strings.TrimSpace(target)))
+		if !ok || tmpl == "" || target == "." {
+			return nil, fmt.Errorf("-extra-file %q is not TEMPLATE=PATH", spec)
+		}
+		if !filepath.IsLocal(target) {
+			return nil, fmt.Errorf("-extra-file %q: %s is outside the docset", spec, target)
+		}
+		if filepath.Clean(filepath.Join(opts.DocsetPath(), target)) == filepath.Clean(opts.PlistPath()) {
+			return nil, fmt.Errorf("-extra-file %q would replace Info.plist", spec)
+		}
+		files = append(files, extraFile{tmpl, target})
+	}
+	return files, nil
+}
+
+// WriteExtraFiles renders the -extra-file templates into the docset bundle,
+// for portals expecting files such as manifest.json or version.txt next to
+// the documents
+func (opts *Options) WriteExtraFiles() error {
+	files, err := opts.extraFiles()
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	data := extraFileData{Options: opts, Source: filepath.Base(opts.SourcePath), Generated: time.Now().UTC()}
+	if src := opts.totalReport(); src != nil {
+		data.Pages, data.Entries = src.Pages, src.Entries
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file.Template)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(filepath.Base(file.Template)).Funcs(extraFileFuncs).Parse(string(b))
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", file.Template, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("rendering %s: %w", file.Template, err)
+		}
+		p := filepath.Join(opts.DocsetPath(), file.Target)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	log.Printf("Wrote %d extra files into %s", len(files), opts.DocsetPath())
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExtraFiles(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp"}
+	for _, test := range []struct {
+		spec, err string
+	}{
+		{"manifest.tmpl=manifest.json", ""},
+		{"version.tmpl=Contents/Resources/version.txt", ""},
+		{"manifest.tmpl", `-extra-file "manifest.tmpl" is not TEMPLATE=PATH`},
+		{"=manifest.json", `-extra-file "=manifest.json" is not TEMPLATE=PATH`},
+		{"manifest.tmpl=../manifest.json", `-extra-file "manifest.tmpl=../manifest.json": ../manifest.json is outside the docset`},
+		{"plist.tmpl=Contents/Info.plist", `-extra-file "plist.tmpl=Contents/Info.plist" would replace Info.plist`},
+	} {
+		opts.ExtraFiles = stringList{test.spec}
+		_, err := opts.extraFiles()
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+		Test{msg, test.err}.Compare(t)
+	}
+}
+
+func TestWriteExtraFiles(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp", Platform: "delphi", DocsetVersion: "2.1"}
+	opts.report = opts.newReport()
+	opts.sourceReport().Pages = 12
+	opts.sourceReport().Entries = 34
+	opts.CreateDirectory()
+	os.WriteFile("tmp/manifest.tmpl", []byte(`{"name": {{json .Title}}, "id": {{json .BundleIdentifier}}, "source": {{json .Source}}, "pages": {{.Pages}}, "entries": {{.Entries}}}`), 0644)
+	os.WriteFile("tmp/version.tmpl", []byte(`{{.DocsetVersion}} {{.Platform}} {{.Generated.Year}}`), 0644)
+	opts.ExtraFiles = stringList{"tmp/manifest.tmpl=manifest.json", "tmp/version.tmpl=Contents/Resources/version.txt"}
+	Test{opts.WriteExtraFiles(), nil}.Compare(t)
+
+	b, _ := os.ReadFile("tmp/baz.docset/manifest.json")
+	Test{string(b), `{"name": "baz", "id": "io.ngs.documentation.baz", "source": "baz.chm", "pages": 12, "entries": 34}`}.Compare(t)
+	b, _ = os.ReadFile("tmp/baz.docset/Contents/Resources/version.txt")
+	Test{strings.HasPrefix(string(b), "2.1 delphi 20"), true}.Compare(t)
+
+	os.WriteFile("tmp/broken.tmpl", []byte(`{{.Nope}}`), 0644)
+	opts.ExtraFiles = stringList{"tmp/broken.tmpl=broken.txt"}
+	err := opts.WriteExtraFiles()
+	Test{err != nil && strings.HasPrefix(err.Error(), "rendering tmp/broken.tmpl: "), true}.Compare(t)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"chm2docset/chm"
+)
+
+// DecodeFileNames renames the extracted files whose names are not UTF-8,
+// as written by help compilers on Japanese, Chinese or Russian systems, by
+// decoding them from the charset of the CHM locale. Sitemap entries naming
+// them are rewritten here, links of pages by the rewrite stage.
+func (opts *Options) DecodeFileNames() error {
+	r, err := chm.Open(opts.SourcePath)
+	if err != nil {
+		return nil
+	}
+	charset := chmCharset(r)
+	r.Close()
+	return opts.decodeFileNames(charset)
+}
+
+// decodeFileNames renames the files of the content directory whose names
+// are not UTF-8 by decoding them from charset
+func (opts *Options) decodeFileNames(charset string) error {
+	root := opts.ContentPath()
+	var files []string
+	undecoded := 0
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files = append(files, rel)
+		if !utf8.ValidString(rel) {
+			undecoded++
+		}
+		return nil
+	})
+	if err != nil || undecoded == 0 {
+		return err
+	}
+	sort.Strings(files)
+
+	moves := map[string]string{}
+	taken := map[string]bool{}
+	for _, old := range files {
+		if utf8.ValidString(old) {
+			taken[old] = true
+			moves[old] = old
+		}
+	}
+	for _, old := range files {
+		if _, ok := moves[old]; ok {
+			continue
+		}
+		new := decodeCharset([]byte(old), charset)
+		if !utf8.ValidString(new) {
+			// Unknown charset: keep the name as extracted
+			new = strings.ToValidUTF8(new, "_")
+		}
+		new = uniquePath(new, taken)
+		taken[new] = true
+		moves[old] = new
+	}
+	if err := opts.moveFiles(moves); err != nil {
+		return err
+	}
+	log.Printf("Decoded %d file names from %s", undecoded, charset)
+
+	for _, rel := range files {
+		if ext := strings.ToLower(filepath.Ext(rel)); ext != ".hhc" && ext != ".hhk" {
+			continue
+		}
+		p := filepath.Join(root, filepath.FromSlash(moves[rel]))
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if b, changed := opts.rewriteSitemapLocals(b); changed {
+			if err := os.WriteFile(p, b, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteSitemapLocals replaces the Local values of a sitemap naming
+// renamed files by their new paths. These are percent-encoded, so that
+// they read the same in any charset the sitemap is decoded from.
+func (opts *Options) rewriteSitemapLocals(b []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	last := 0
+	for _, m := range paramLocalRE.FindAllSubmatchIndex(b, -1) {
+		local := html.UnescapeString(string(b[m[2]:m[3]]))
+		base := stripFragment(local)
+		// A backslash may be the second byte of a double-byte character
+		new, ok := opts.renames.Lookup(strings.TrimPrefix(base, "/"))
+		if !ok {
+			new, ok = opts.renames.Lookup(strings.TrimPrefix(strings.ReplaceAll(base, "\\", "/"), "/"))
+		}
+		if !ok {
+			continue
+		}
+		out.Write(b[last:m[2]])
+		out.WriteString(html.EscapeString(escapeLink(new) + local[len(base):]))
+		last = m[3]
+	}
+	if last == 0 {
+		return b, false
+	}
+	out.Write(b[last:])
+	return out.Bytes(), true
+}
+
+// DecodedLinks returns the rewrite of the links to files renamed by
+// DecodeFileNames, unless -lowercase rewrites them along with its own
+func (opts *Options) DecodedLinks() (pageRewrite, error) {
+	if opts.LowercasePaths {
+		return nil, nil
+	}
+	return opts.linkRewrite(), nil
+}
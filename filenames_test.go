@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDecodeFileNames(t *testing.T) {
+	// 資料/テスト.htm in Shift JIS
+	const dir, page = "\x8e\x91\x97\xbf", "\x83e\x83X\x83g.htm"
+	for _, lowercase := range []bool{false, true} {
+		opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", LowercasePaths: lowercase, RedirectStubs: true}
+		opts.CreateDirectory()
+		content := opts.ContentPath()
+		os.MkdirAll(content+"/"+dir, 0755)
+		os.WriteFile(content+"/Index.htm", []byte(`<a href="`+dir+`/`+page+`#a">p</a>`), 0644)
+		os.WriteFile(content+"/"+dir+"/"+page, []byte(`<a href="../Index.htm">up</a> <a href="`+page+`#b">b</a>`), 0644)
+		os.WriteFile(content+"/toc.hhc", []byte(`<param name="Local" value="`+dir+`\`+page+`#a">`), 0644)
+
+		if err := opts.decodeFileNames("shift_jis"); err != nil {
+			t.Fatalf("Expected nil but got %v", err)
+		}
+		if err := opts.Rewrite(); err != nil {
+			t.Fatalf("Expected nil but got %v", err)
+		}
+		index := "Index.htm"
+		if lowercase {
+			index = "index.htm"
+		}
+		b, _ := os.ReadFile(content + "/" + index)
+		Test{string(b), `<a href="%E8%B3%87%E6%96%99/%E3%83%86%E3%82%B9%E3%83%88.htm#a">p</a>`}.Compare(t)
+		b, _ = os.ReadFile(content + "/資料/テスト.htm")
+		Test{string(b), `<a href="../` + index + `">up</a> <a href="%E3%83%86%E3%82%B9%E3%83%88.htm#b">b</a>`}.Compare(t)
+		b, _ = os.ReadFile(content + "/toc.hhc")
+		Test{string(b), `<param name="Local" value="%E8%B3%87%E6%96%99/%E3%83%86%E3%82%B9%E3%83%88.htm#a">`}.Compare(t)
+		Test{opts.mapPath(dir + "/" + page), "資料/テスト.htm"}.Compare(t)
+		_, err := os.Stat(content + "/" + dir)
+		Test{os.IsNotExist(err), true}.Compare(t)
+		cleanTmp()
+	}
+}
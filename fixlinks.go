@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FuzzyLinks returns the rewrite repairing links to missing files, or nil
+// without -fix-links. A link is pointed at the file it most likely meant
+// when exactly one file matches it after fixing the case of its path,
+// swapping .htm and .html, or dropping a directory level.
+func (opts *Options) FuzzyLinks() (pageRewrite, error) {
+	if !opts.RepairLinks {
+		return nil, nil
+	}
+	// Listed after renames, so that the rewrite sees the final names
+	files := newPathMap()
+	root := opts.ContentPath()
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files.Add(rel, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rel string, b []byte) ([]byte, bool) {
+		var out bytes.Buffer
+		last := 0
+		for _, m := range linkRE.FindAllSubmatchIndex(b, -1) {
+			var start, end int
+			for g := 2; g < len(m); g += 2 {
+				if m[g] >= 0 {
+					start, end = m[g], m[g+1]
+					break
+				}
+			}
+			raw := html.UnescapeString(string(b[start:end]))
+			target, ok := resolveLink(rel, raw)
+			if !ok || target == "" {
+				continue
+			}
+			if _, ok := files.exact[target]; ok {
+				continue
+			}
+			found := fuzzyTarget(files, target)
+			if found == "" {
+				continue
+			}
+			suffix := ""
+			if i := strings.IndexAny(raw, "#?"); i >= 0 {
+				suffix = raw[i:]
+			}
+			out.Write(b[last:start])
+			out.WriteString(html.EscapeString(escapeLink(relativeLink(rel, found)) + suffix))
+			last = end
+		}
+		if last == 0 {
+			return b, false
+		}
+		out.Write(b[last:])
+		return out.Bytes(), true
+	}, nil
+}
+
+// fuzzyTarget returns the only file of files that target may have meant,
+// or "" if there is none or the match is ambiguous
+func fuzzyTarget(files *pathMap, target string) string {
+	if found, ok := files.Lookup(target); ok {
+		return found
+	}
+	if found, ok := files.Lookup(swapHTMLExt(target)); ok {
+		return found
+	}
+	// A directory level too many, e.g. html/html/topic.htm
+	dirs := strings.Split(path.Dir(target), "/")
+	if dirs[0] == "." {
+		return ""
+	}
+	found := ""
+	for i := range dirs {
+		candidate := path.Join(append(append([]string{}, dirs[:i]...), dirs[i+1:]...)...)
+		candidate = path.Join(candidate, path.Base(target))
+		for _, name := range []string{candidate, swapHTMLExt(candidate)} {
+			match, ok := files.Lookup(name)
+			if !ok {
+				continue
+			}
+			if found != "" && found != match {
+				return ""
+			}
+			found = match
+		}
+	}
+	return found
+}
+
+// swapHTMLExt turns a .htm path into .html and the reverse; other paths
+// are returned unchanged
+func swapHTMLExt(p string) string {
+	ext := path.Ext(p)
+	switch strings.ToLower(ext) {
+	case ".htm":
+		return p + "l"
+	case ".html":
+		return p[:len(p)-1]
+	}
+	return p
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFuzzyTarget(t *testing.T) {
+	files := newPathMap()
+	for _, f := range []string{"index.htm", "html/Topic.html", "html/guide.htm", "a/x.htm", "b/x.htm", "a/b/y.htm"} {
+		files.Add(f, f)
+	}
+	for _, test := range []Test{
+		{fuzzyTarget(files, "INDEX.HTM"), "index.htm"},
+		{fuzzyTarget(files, "html/topic.htm"), "html/Topic.html"},
+		{fuzzyTarget(files, "html/guide.html"), "html/guide.htm"},
+		{fuzzyTarget(files, "html/html/guide.htm"), "html/guide.htm"},
+		{fuzzyTarget(files, "docs/html/topic.htm"), "html/Topic.html"},
+		{fuzzyTarget(files, "a/b/x.htm"), ""}, // a/x.htm or b/x.htm
+		{fuzzyTarget(files, "a/c/b/y.htm"), "a/b/y.htm"},
+		{fuzzyTarget(files, "c/d/y.htm"), ""},
+		{fuzzyTarget(files, "missing.htm"), ""},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestFuzzyLinks(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", RepairLinks: true}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/html", 0755)
+	os.WriteFile(content+"/html/Setup.html", nil, 0644)
+	os.WriteFile(content+"/index.htm", []byte(`<a href="HTML/setup.htm#step2">Setup</a> <a href="html/html/Setup.html">Again</a> <a href="html/Setup.html">Ok</a> <a href="gone.htm">Gone</a>`), 0644)
+
+	Test{opts.Rewrite(), nil}.Compare(t)
+	b, _ := os.ReadFile(content + "/index.htm")
+	Test{string(b), `<a href="html/Setup.html#step2">Setup</a> <a href="html/Setup.html">Again</a> <a href="html/Setup.html">Ok</a> <a href="gone.htm">Gone</a>`}.Compare(t)
+}
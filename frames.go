@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	framesetRE   = regexp.MustCompile(`(?i)<frameset\b`)
+	frameRE      = regexp.MustCompile(`(?i)<frame\b[^>]*>`)
+	frameSrcRE   = regexp.MustCompile(`(?i)\ssrc\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	frameNameRE  = regexp.MustCompile(`(?i)\sname\s*=\s*["']?([^"'\s>]+)`)
+	targetTagRE  = regexp.MustCompile(`(?i)<(?:a|area|base|form)\b[^>]*>`)
+	targetAttrRE = regexp.MustCompile(`(?i)\s+target\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// Names of the frame holding the topic in common frame layouts
+var contentFrameNames = map[string]bool{
+	"main": true, "content": true, "contents": true, "body": true,
+	"topic": true, "right": true, "basefrm": true,
+}
+
+// FlattenFrames returns the rewrite replacing frameset pages by a redirect
+// to their content frame and dropping link targets naming frames, or nil
+// without -flatten-frames. Navigation frames are left to Dash's own table
+// of contents.
+func (opts *Options) FlattenFrames() (pageRewrite, error) {
+	if !opts.FlattenFrameset {
+		return nil, nil
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		if framesetRE.Match(b) {
+			src := contentFrame(b)
+			if src == "" {
+				return b, false
+			}
+			target := html.EscapeString(src)
+			return []byte(fmt.Sprintf(redirectStubTemplate, target)), true
+		}
+		return dropFrameTargets(b)
+	}, nil
+}
+
+// contentFrame returns the source of the frame holding the topic: the frame
+// with a conventional content name, or else the last frame
+func contentFrame(b []byte) string {
+	var src string
+	for _, tag := range frameRE.FindAll(b, -1) {
+		m := frameSrcRE.FindSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		src = html.UnescapeString(string(m[1]) + string(m[2]) + string(m[3]))
+		if name := frameNameRE.FindSubmatch(tag); name != nil && contentFrameNames[strings.ToLower(string(name[1]))] {
+			break
+		}
+	}
+	return src
+}
+
+// dropFrameTargets removes the target attributes of links other than
+// target="_blank", as the frames they name no longer exist. Targets naming
+// an inline frame of the same page still work and are kept.
+func dropFrameTargets(b []byte) ([]byte, bool) {
+	iframes := iframeNames(b)
+	changed := false
+	out := targetTagRE.ReplaceAllFunc(b, func(tag []byte) []byte {
+		return targetAttrRE.ReplaceAllFunc(tag, func(attr []byte) []byte {
+			m := targetAttrRE.FindSubmatch(attr)
+			target := string(m[1]) + string(m[2]) + string(m[3])
+			if strings.EqualFold(target, "_blank") || iframes[strings.ToLower(target)] {
+				return attr
+			}
+			changed = true
+			return nil
+		})
+	})
+	if !changed {
+		return b, false
+	}
+	return out, true
+}
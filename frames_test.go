@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestContentFrame(t *testing.T) {
+	for _, test := range []Test{
+		{contentFrame([]byte(`<frameset cols="25%,*"><frame src="nav.htm" name="toc"><frame src="topics/intro.htm" name="Main"><frame src="footer.htm"></frameset>`)), "topics/intro.htm"},
+		{contentFrame([]byte(`<FRAMESET rows="50,*"><FRAME SRC=banner.htm><FRAME SRC='welcome.htm?a=1&amp;b=2'></FRAMESET>`)), "welcome.htm?a=1&b=2"},
+		{contentFrame([]byte(`<frameset></frameset>`)), ""},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestFlattenFrames(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", FlattenFrameset: true}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.WriteFile(content+"/index.htm", []byte(`<html><frameset cols="200,*"><frame src="nav.htm" name="nav"><frame src="intro.htm" name="main"></frameset></html>`), 0644)
+	os.WriteFile(content+"/nav.htm", []byte(`<a href="intro.htm" target="main">Intro</a> <a href="http://example.com" target="_blank">Web</a>`), 0644)
+
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile(content + "/index.htm")
+	Test{strings.Contains(string(b), `url=intro.htm`), true}.Compare(t)
+	b, _ = os.ReadFile(content + "/nav.htm")
+	Test{string(b), `<a href="intro.htm">Intro</a> <a href="http://example.com" target="_blank">Web</a>`}.Compare(t)
+}
+
+func TestDropFrameTargetsKeepsIFrames(t *testing.T) {
+	b, changed := dropFrameTargets([]byte(`<a href="a.htm" target="Viewer">A</a><a href="b.htm" target="main">B</a><iframe name="viewer" src="a.htm"></iframe>`))
+	Test{changed, true}.Compare(t)
+	Test{string(b), `<a href="a.htm" target="Viewer">A</a><a href="b.htm">B</a><iframe name="viewer" src="a.htm"></iframe>`}.Compare(t)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// copySourceDir copies the already extracted directory given as source
+// into the content directory, in place of extracting a CHM
+func (opts *Options) copySourceDir() error {
+	info, err := os.Stat(opts.SourcePath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("-from-dir: %s is not a directory", opts.SourcePath)
+	}
+	return opts.copyTreeInto(opts.SourcePath)
+}
+
+// copyTreeInto copies the files below dir into the content directory,
+// leaving out the files rejected by -extract-only and -extract-skip
+func (opts *Options) copyTreeInto(dir string) error {
+	source, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	docset, err := filepath.Abs(opts.DocsetPath())
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(source, docset); err == nil && filepath.IsLocal(rel) {
+		return fmt.Errorf("the docset %s is inside the source directory %s; choose another -out", opts.DocsetPath(), dir)
+	}
+
+	if err := copyTree(dir, opts.ContentPath()); err != nil {
+		return fmt.Errorf("copying %s: %w", dir, err)
+	}
+	log.Printf("Copied %s", dir)
+	keep, err := opts.extractFilter()
+	if err != nil || keep == nil {
+		return err
+	}
+	_, err = pruneExtracted(opts.ContentPath(), keep)
+	return err
+}
+
+// dirHash returns the hex encoded SHA-256 of the absolute path of a
+// directory
+func dirHash(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(abs)))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExtractSourceFromDir(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "_fixtures/Sample.docset/Contents/Resources/Documents", Outdir: "tmp", FromDir: true, ExtractSkip: stringList{"sub"}}
+	Test{opts.Basename(), "Documents"}.Compare(t)
+	opts.CreateDirectory()
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	_, err := os.Stat(opts.ContentPath() + "/test1.htm")
+	Test{err, nil}.Compare(t)
+	_, err = os.Stat(opts.ContentPath() + "/sub")
+	Test{os.IsNotExist(err), true}.Compare(t)
+
+	opts = &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp", FromDir: true}
+	Test{opts.ExtractSource().Error(), "-from-dir: _fixtures/sample.chm is not a directory"}.Compare(t)
+
+	opts = &Options{SourcePath: "tmp", Outdir: "tmp/out", FromDir: true}
+	Test{opts.ExtractSource().Error(), "the docset tmp/out/tmp.docset is inside the source directory tmp; choose another -out"}.Compare(t)
+}
+
+func TestDirHash(t *testing.T) {
+	a, err := dirHash("tmp")
+	Test{err, nil}.Compare(t)
+	b, _ := dirHash("./tmp/")
+	Test{a, b}.Compare(t)
+	c, _ := dirHash("_fixtures")
+	Test{a == c, false}.Compare(t)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	glossaryRE = regexp.MustCompile(`(?i)\b(glossary|glossaries|terminology|definitions of terms)\b`)
+	dtOpenRE   = regexp.MustCompile(`(?i)<dt\b[^>]*>`)
+	dtEndRE    = regexp.MustCompile(`(?i)</dt\s*>|<dd\b|<dt\b|</dl\s*>`)
+)
+
+const glossaryEntryType = "Define"
+
+// glossaryTerm is a <dt> term with the anchor that points at it
+type glossaryTerm struct {
+	Name   string
+	Anchor string
+}
+
+// indexGlossary indexes the terms of every glossary page. Glossary pages are
+// pages whose title mentions a glossary and pages below a "Glossary" branch
+// of the table of contents.
+func (opts *Options) indexGlossary(db *dbWriter, hhcPath string) error {
+	basePath := opts.ContentPath()
+	topicTitles := opts.topicTitles()
+	pages := map[string]bool{}
+
+	if hhcPath != "" {
+		b, err := os.ReadFile(hhcPath)
+		if err != nil {
+			return err
+		}
+		for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+			if item.Local != "" && isGlossaryItem(item) {
+				page, _, ok := opts.resolveLocal(item.Local)
+				if !ok {
+					page = stripFragment(opts.mapPath(item.Local))
+				}
+				pages[page] = true
+			}
+		}
+	}
+
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		title, _, err := opts.pageTitle(topicTitles, relPath, path)
+		if err != nil || !glossaryRE.MatchString(title) {
+			return nil
+		}
+		pages[relPath] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := newIndexWriter(db, opts, sourceGlossary)
+
+	sorted := make([]string, 0, len(pages))
+	for page := range pages {
+		sorted = append(sorted, page)
+	}
+	sort.Strings(sorted)
+	for _, page := range sorted {
+		terms, err := glossaryTerms(opts.pages, filepath.Join(basePath, filepath.FromSlash(page)))
+		if err != nil {
+			opts.pageErrorf("skipping glossary %s due to error: %v", page, err)
+			continue
+		}
+		for _, term := range terms {
+			if err := w.Add(term.Name, glossaryEntryType, indexPath(page)+"#"+term.Anchor); err != nil {
+				return err
+			}
+		}
+	}
+	if w.count > 0 {
+		log.Printf("Indexed %d glossary terms", w.count)
+	}
+	return nil
+}
+
+func isGlossaryItem(item sitemapItem) bool {
+	if glossaryRE.MatchString(item.Name) {
+		return true
+	}
+	for _, parent := range item.Parents {
+		if glossaryRE.MatchString(parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// glossaryTerms returns the <dt> terms of a page. Terms without an id or
+// named anchor get an id attribute, and the page is rewritten in place.
+func glossaryTerms(pages *pageCache, path string) ([]glossaryTerm, error) {
+	b, err := pages.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	charset := detectCharset(b, "")
+
+	var terms []glossaryTerm
+	var insertions []idInsertion
+	used := map[string]bool{}
+	for _, loc := range dtOpenRE.FindAllIndex(b, -1) {
+		tag := b[loc[0]:loc[1]]
+		body := b[loc[1]:]
+		if end := dtEndRE.FindIndex(body); end != nil {
+			body = body[:end[0]]
+		}
+		name := cellText(body, charset)
+		if name == "" {
+			continue
+		}
+
+		var anchor string
+		if m := idAttrRE.FindSubmatch(tag); m != nil {
+			anchor = string(m[1])
+		} else if m := nameAnchorRE.FindSubmatch(body); m != nil {
+			anchor = string(m[1])
+		} else {
+			anchor = uniqueAnchor("term-", name, used)
+			insertions = append(insertions, idInsertion{End: loc[1] - 1, ID: anchor})
+		}
+		used[anchor] = true
+		terms = append(terms, glossaryTerm{Name: name, Anchor: anchor})
+	}
+
+	if len(insertions) > 0 {
+		if err := pages.WriteFile(path, insertIDs(b, insertions)); err != nil {
+			return nil, err
+		}
+	}
+	return terms, nil
+}
+
+// stripFragment removes the #fragment of a sitemap path
+func stripFragment(path string) string {
+	if i := strings.IndexByte(path, '#'); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
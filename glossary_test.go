@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestGlossaryTerms(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/glossary.htm", []byte(`<html><head><title>Glossary</title></head><body><dl>
+<dt id="api">API</dt><dd>Application programming interface</dd>
+<dt><a name="dll"></a>DLL<dd>Dynamic link library
+<dt><b>Thread &amp; Fiber</b></dt><dd>...</dd>
+<dt>Thread &amp; fiber</dt><dd>duplicate</dd>
+<dt data-id="x"><a data-name="y"></a>Cache</dt><dd>...</dd>
+</dl></body></html>`), 0644)
+	terms, err := glossaryTerms(nil, "tmp/glossary.htm")
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{terms, []glossaryTerm{
+		{"API", "api"},
+		{"DLL", "dll"},
+		{"Thread & Fiber", "term-thread-fiber"},
+		{"Thread & fiber", "term-thread-fiber-2"},
+		{"Cache", "term-cache"},
+	}}.DeepEqual(t)
+	b, _ := os.ReadFile("tmp/glossary.htm")
+	Test{string(b), `<html><head><title>Glossary</title></head><body><dl>
+<dt id="api">API</dt><dd>Application programming interface</dd>
+<dt><a name="dll"></a>DLL<dd>Dynamic link library
+<dt id="term-thread-fiber"><b>Thread &amp; Fiber</b></dt><dd>...</dd>
+<dt id="term-thread-fiber-2">Thread &amp; fiber</dt><dd>duplicate</dd>
+<dt data-id="x" id="term-cache"><a data-name="y"></a>Cache</dt><dd>...</dd>
+</dl></body></html>`}.Compare(t)
+}
+
+func TestIndexGlossary(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+		Glossary:   true,
+	}
+	opts.Clean()
+	defer cleanTmp()
+	opts.CreateDirectory()
+	os.MkdirAll(opts.ContentPath()+"/terms", 0755)
+	os.WriteFile(opts.ContentPath()+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Terms"><param name="Local" value="terms/index.htm"></OBJECT>
+<UL><LI><OBJECT type="text/sitemap"><param name="Name" value="Glossary"></OBJECT>
+<UL><LI><OBJECT type="text/sitemap"><param name="Name" value="A-M"><param name="Local" value="terms/a.htm"></OBJECT></UL>
+</UL></UL>`), 0644)
+	os.WriteFile(opts.ContentPath()+"/terms/index.htm", []byte(`<title>Terms</title><dl><dt>Ignored</dt></dl>`), 0644)
+	os.WriteFile(opts.ContentPath()+"/terms/a.htm", []byte(`<title>A-M</title><dl><dt>Atom</dt></dl>`), 0644)
+	os.WriteFile(opts.ContentPath()+"/words.htm", []byte(`<title>Glossary of words</title><dl><dt>Word</dt></dl>`), 0644)
+	if err := opts.CreateDatabase(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT name, path FROM searchIndex WHERE type = 'Define' ORDER BY name")
+	grid := [][]string{}
+	for rows.Next() {
+		var name, path string
+		rows.Scan(&name, &path)
+		grid = append(grid, []string{name, path})
+	}
+	Test{grid, [][]string{
+		{"Atom", "terms/a.htm#term-atom"},
+		{"Word", "words.htm#term-word"},
+	}}.DeepEqual(t)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isHelp2File reports whether a source is a Microsoft Help 2 (.HxS) file,
+// as Visual Studio 2002-2008 documentation ships. Its ITOLITLS container is
+// that of Microsoft Reader e-books, which the built-in reader rejects as
+// protected, so it is told apart by its extension.
+func isHelp2File(source string) bool {
+	return strings.EqualFold(filepath.Ext(source), ".hxs")
+}
+
+// help2TOCNode is a HelpTOCNode of an .HxT table of contents
+type help2TOCNode struct {
+	Title    string         `xml:"Title,attr"`
+	URL      string         `xml:"Url,attr"`
+	NodeType string         `xml:"NodeType,attr"`
+	Children []help2TOCNode `xml:"HelpTOCNode"`
+}
+
+// help2Keyword is a Keyword of an .HxK index
+type help2Keyword struct {
+	Term     string         `xml:"Term,attr"`
+	Jumps    []help2Jump    `xml:"Jump"`
+	Keywords []help2Keyword `xml:"Keyword"`
+}
+
+type help2Jump struct {
+	URL string `xml:"Url,attr"`
+}
+
+// ConvertHelp2 writes the table of contents and keyword index of an HxS
+// source, kept as .HxT and .HxK XML files, as HHC and HHK sitemaps to be
+// indexed like those of a CHM, and takes the title from its .HxC collection
+func (opts *Options) ConvertHelp2() error {
+	if !isHelp2File(opts.SourcePath) || opts.combined() {
+		return nil
+	}
+	root := opts.ContentPath()
+	var tocs, indexes, collections []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".hxt":
+			tocs = append(tocs, p)
+		case ".hxk":
+			indexes = append(indexes, p)
+		case ".hxc":
+			collections = append(collections, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(collections) > 0 && opts.systemTitle == "" {
+		var collection struct {
+			Title string `xml:"Title,attr"`
+		}
+		if err := decodeHelp2(collections[0], &collection); err != nil {
+			opts.warnf("reading %s: %v", filepath.Base(collections[0]), err)
+		}
+		opts.systemTitle = strings.TrimSpace(collection.Title)
+	}
+
+	var toc bytes.Buffer
+	for _, p := range tocs {
+		var t struct {
+			Nodes []help2TOCNode `xml:"HelpTOCNode"`
+		}
+		if err := decodeHelp2(p, &t); err != nil {
+			opts.warnf("reading %s: %v", filepath.Base(p), err)
+			continue
+		}
+		writeHelp2TOC(&toc, t.Nodes, "")
+	}
+	var index bytes.Buffer
+	for _, p := range indexes {
+		var k struct {
+			Name     string         `xml:"Name,attr"`
+			Keywords []help2Keyword `xml:"Keyword"`
+		}
+		if err := decodeHelp2(p, &k); err != nil {
+			opts.warnf("reading %s: %v", filepath.Base(p), err)
+			continue
+		}
+		// The keyword index is named K; F holds F1 help keywords and A
+		// associative links, neither meant to be read
+		if !strings.EqualFold(k.Name, "K") {
+			continue
+		}
+		writeHelp2Index(&index, k.Keywords, "")
+	}
+
+	if err := writeSitemaps(filepath.Join(root, opts.Basename()), toc.Bytes(), index.Bytes()); err != nil {
+		return err
+	}
+	log.Printf("Converted %d Help 2 tables of contents and %d indexes", len(tocs), len(indexes))
+	return nil
+}
+
+// decodeHelp2 decodes a Help 2 XML file into v. The files are UTF-8 or
+// UTF-16 with a byte order mark, or declare another encoding.
+func decodeHelp2(p string, v interface{}) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	utf16 := false
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		b, utf16 = []byte(decodeCharset(b[2:], "utf-16le")), true
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		b, utf16 = []byte(decodeCharset(b[2:], "utf-16be")), true
+	}
+	d := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))))
+	d.Strict = false
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		label = strings.ToLower(label)
+		if utf16 && strings.HasPrefix(label, "utf-16") {
+			// Already decoded from the byte order mark
+			return input, nil
+		}
+		b, err := io.ReadAll(input)
+		return strings.NewReader(decodeCharset(b, label)), err
+	}
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("parsing XML: %w", err)
+	}
+	return nil
+}
+
+// help2Local returns the sitemap Local value of a Help 2 URL, or "" for
+// ms-help URLs into other collections
+func help2Local(url string) string {
+	url = strings.TrimSpace(url)
+	if url == "" || strings.Contains(url, ":") {
+		return ""
+	}
+	return strings.ReplaceAll(url, `\`, "/")
+}
+
+// writeHelp2TOC writes the nodes of an .HxT file as sitemap list items
+func writeHelp2TOC(w *bytes.Buffer, nodes []help2TOCNode, indent string) {
+	for _, node := range nodes {
+		if strings.EqualFold(node.NodeType, "TOC") {
+			// An included table of contents, converted on its own
+			continue
+		}
+		var locals []string
+		if local := help2Local(node.URL); local != "" {
+			locals = append(locals, local)
+		}
+		title := strings.TrimSpace(node.Title)
+		if title == "" && len(locals) == 0 {
+			continue
+		}
+		writeSitemapItem(w, indent, title, locals...)
+		if len(node.Children) > 0 {
+			w.WriteString(indent + "<UL>\n")
+			writeHelp2TOC(w, node.Children, indent+"\t")
+			w.WriteString(indent + "</UL>\n")
+		}
+	}
+}
+
+// writeHelp2Index writes the keywords of an .HxK file as sitemap list
+// items, with a Local value for each of their jumps
+func writeHelp2Index(w *bytes.Buffer, keywords []help2Keyword, indent string) {
+	for _, keyword := range keywords {
+		term := strings.TrimSpace(keyword.Term)
+		if term == "" {
+			continue
+		}
+		var locals []string
+		for _, jump := range keyword.Jumps {
+			if local := help2Local(jump.URL); local != "" {
+				locals = append(locals, local)
+			}
+		}
+		writeSitemapItem(w, indent, term, locals...)
+		if len(keyword.Keywords) > 0 {
+			w.WriteString(indent + "<UL>\n")
+			writeHelp2Index(w, keyword.Keywords, indent+"\t")
+			w.WriteString(indent + "</UL>\n")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestConvertHelp2(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/help/vsdocs.HxS", Outdir: "tmp"}
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/html", 0755)
+	os.WriteFile(content+"/html/intro.htm", []byte("<html><body>Intro</body></html>"), 0644)
+	os.WriteFile(content+"/vsdocs.HxC", []byte(`<?xml version="1.0"?>
+<!DOCTYPE HelpCollection>
+<HelpCollection DTDVersion="1.0" LangId="1033" Title="VS &amp; Tools">
+  <TOCDef File="vsdocs.HxT"/>
+</HelpCollection>`), 0644)
+	os.WriteFile(content+"/vsdocs.HxT", []byte(`<?xml version="1.0" encoding="utf-8"?>
+<HelpTOC DTDVersion="1.0">
+  <HelpTOCNode Title="Introduction" Url="html\intro.htm">
+    <HelpTOCNode Title="Classes" Url="html/classes.htm"/>
+    <HelpTOCNode NodeType="TOC" Url="other.HxT"/>
+  </HelpTOCNode>
+  <HelpTOCNode Title="Elsewhere" Url="ms-help://MS.VSCC/dv/html/x.htm"/>
+</HelpTOC>`), 0644)
+	// UTF-16 with a byte order mark, as Help Workshop writes them
+	index := `<?xml version="1.0" encoding="utf-16"?>
+<HelpIndex Name="K" DTDVersion="1.0">
+  <Keyword Term="Größe">
+    <Jump Url="html/intro.htm"/>
+    <Keyword Term="Klasse"><Jump Url="html/classes.htm"/><Jump Url="html/intro.htm#k"/></Keyword>
+  </Keyword>
+</HelpIndex>`
+	b := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(index)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	os.WriteFile(content+"/vsdocs_K.HxK", b, 0644)
+	os.WriteFile(content+"/vsdocs_F.HxK", []byte(`<HelpIndex Name="F"><Keyword Term="F1Key"><Jump Url="html/intro.htm"/></Keyword></HelpIndex>`), 0644)
+
+	Test{opts.ConvertHelp2(), nil}.Compare(t)
+	Test{opts.Title(), "VS & Tools"}.Compare(t)
+
+	b, _ = os.ReadFile(content + "/vsdocs.hhc")
+	var toc [][]string
+	for _, item := range parseSitemap(string(b)) {
+		toc = append(toc, append([]string{item.Name, item.Local}, item.Parents...))
+	}
+	Test{toc, [][]string{
+		{"Introduction", "html/intro.htm"},
+		{"Classes", "html/classes.htm", "Introduction"},
+		{"Elsewhere", ""},
+	}}.DeepEqual(t)
+
+	b, _ = os.ReadFile(content + "/vsdocs.hhk")
+	var keywords [][]string
+	for _, item := range parseSitemap(string(b)) {
+		keywords = append(keywords, append([]string{item.Name, item.Local}, item.More...))
+	}
+	Test{keywords, [][]string{
+		{"Größe", "html/intro.htm"},
+		{"Klasse", "html/classes.htm", "html/intro.htm#k"},
+	}}.DeepEqual(t)
+}
+
+func TestConvertHelp2SkipsCHM(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/help/vsdocs.chm", Outdir: "tmp"}
+	opts.CreateDirectory()
+	os.WriteFile(opts.ContentPath()+"/vsdocs.HxT", []byte(`<HelpTOC><HelpTOCNode Title="A" Url="a.htm"/></HelpTOC>`), 0644)
+	Test{opts.ConvertHelp2(), nil}.Compare(t)
+	_, err := os.Stat(opts.ContentPath() + "/vsdocs.hhc")
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
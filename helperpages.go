@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Printable variants of topics, e.g. topic_print.htm or print-topic.htm
+	printPageRE = regexp.MustCompile(`(?i)(?:^|/)(?:[^/]*[_-]print(?:able)?|print[_-][^/]*)\.html?$`)
+	// Pages that print themselves when opened
+	printOnLoadRE = regexp.MustCompile(`(?i)<body\b[^>]*\bonload\s*=\s*["'][^"']*\bprint\s*\(`)
+	// Calls opening a page in a popup, e.g. hhctrl.TextPopup('note.htm') or
+	// window.open("note.htm", ...)
+	popupCallRE = regexp.MustCompile(`(?i)(?:\w*popup\w*|window\.open)\s*\(\s*['"]([^'"]+\.html?)`)
+)
+
+// Popup targets with at most this much text are helper pages
+const maxPopupText = 500
+
+// findHelperPages returns the print variants and popup pages below the
+// content directory, lower-cased. Such pages duplicate or merely support
+// real topics and only clutter search results.
+func (opts *Options) findHelperPages() (map[string]bool, error) {
+	basePath := opts.ContentPath()
+	helpers := map[string]bool{}
+	popups := map[string]bool{}
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if printPageRE.MatchString(relPath) {
+			helpers[strings.ToLower(relPath)] = true
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			opts.pageErrorf("skipping helper page check of %s due to error: %v", path, err)
+			return nil
+		}
+		if printOnLoadRE.Match(b) {
+			helpers[strings.ToLower(relPath)] = true
+		}
+		for _, m := range popupCallRE.FindAllSubmatch(b, -1) {
+			if target, ok := resolveLink(relPath, html.UnescapeString(string(m[1]))); ok && target != "" {
+				popups[target] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for target := range popups {
+		page := findPage(basePath, target)
+		if page == "" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(basePath, filepath.FromSlash(page)))
+		if err == nil && isTinyPage(b) {
+			helpers[strings.ToLower(page)] = true
+		}
+	}
+	if len(helpers) > 0 {
+		log.Printf("Found %d print and popup pages", len(helpers))
+	}
+	return helpers, nil
+}
+
+// isTinyPage reports whether the body of a page holds little text
+func isTinyPage(b []byte) bool {
+	body := b
+	if m := bodyRE.FindSubmatch(b); m != nil {
+		body = m[1]
+	}
+	return len(cellText(body, detectCharset(b, ""))) <= maxPopupText
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFindHelperPages(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/notes", 0755)
+	for name, body := range map[string]string{
+		"topic.htm":        `<body><a href="javascript:hhctrl.TextPopup('notes/Term.htm')">term</a> <a href="#" onclick="window.open('big.htm')">big</a></body>`,
+		"topic_print.htm":  `<body>Printable topic</body>`,
+		"print-all.html":   `<body>Everything</body>`,
+		"fingerprint.htm":  `<body>Not a print page</body>`,
+		"report.htm":       `<body onload="window.print()">Report</body>`,
+		"notes/term.htm":   `<body><p>A short definition.</p></body>`,
+		"big.htm":          `<body>` + strings.Repeat("Lots of text. ", 100) + `</body>`,
+		"notes/unused.htm": `<body>Short but never opened as a popup</body>`,
+	} {
+		os.WriteFile(content+"/"+name, []byte(body), 0644)
+	}
+
+	helpers, err := opts.findHelperPages()
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	Test{helpers, map[string]bool{
+		"topic_print.htm": true,
+		"print-all.html":  true,
+		"report.htm":      true,
+		"notes/term.htm":  true,
+	}}.DeepEqual(t)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"html"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var iframeRE = regexp.MustCompile(`(?i)<iframe\b[^>]*>`)
+
+// iframeTargets returns the content pages the inline frames of the page at
+// rel load, in order. Frames showing other sites or the page itself are
+// left out.
+func (opts *Options) iframeTargets(rel string, b []byte) []string {
+	var targets []string
+	seen := map[string]bool{rel: true}
+	for _, tag := range iframeRE.FindAll(b, -1) {
+		m := frameSrcRE.FindSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		src := html.UnescapeString(string(m[1]) + string(m[2]) + string(m[3]))
+		target, ok := resolveLink(rel, strings.TrimSpace(src))
+		if !ok || target == "" {
+			continue
+		}
+		page := opts.findContentFile(target)
+		if page == "" || !isHTMLFile(page) || seen[page] {
+			continue
+		}
+		seen[page] = true
+		targets = append(targets, page)
+	}
+	return targets
+}
+
+// iframeNames returns the lower-cased names of the inline frames of a page
+func iframeNames(b []byte) map[string]bool {
+	names := map[string]bool{}
+	for _, tag := range iframeRE.FindAll(b, -1) {
+		if m := frameNameRE.FindSubmatch(tag); m != nil {
+			names[strings.ToLower(string(m[1]))] = true
+		}
+	}
+	return names
+}
+
+// indexIFrames indexes the pages loaded into inline frames of the pages in
+// listed under their titles, as the table of contents only names the page
+// hosting them. Pages already listed, and pages without a title, are left
+// out. Indexed pages are added to listed.
+func (opts *Options) indexIFrames(db *dbWriter, listed map[string]bool) error {
+	w := newIndexWriter(db, opts, sourceTitle)
+	topicTitles := opts.topicTitles()
+	basePath := opts.ContentPath()
+
+	hosts := make([]string, 0, len(listed))
+	for page := range listed {
+		hosts = append(hosts, page)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if !isHTMLFile(host) {
+			continue
+		}
+		b, err := opts.pages.ReadFile(filepath.Join(basePath, filepath.FromSlash(host)))
+		if err != nil {
+			opts.pageErrorf("reading %s for inline frames: %v", host, err)
+			continue
+		}
+		for _, page := range opts.iframeTargets(host, b) {
+			if listed[page] {
+				continue
+			}
+			listed[page] = true
+			title, _, err := opts.pageTitle(topicTitles, page, filepath.Join(basePath, filepath.FromSlash(page)))
+			if err != nil {
+				opts.pageErrorf("skipping inline frame %s of %s: %v", page, host, err)
+				opts.skipPage(page, readErrorReason(err))
+				continue
+			}
+			if title == "" {
+				opts.skipPage(page, skipNoTitle)
+				continue
+			}
+			if err := w.Add(title, opts.defaultType(), indexPath(page)); err != nil {
+				return err
+			}
+		}
+	}
+	if w.count > 0 {
+		log.Printf("Indexed %d pages shown in inline frames", w.count)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestIFrameTargets(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/topics", 0755)
+	for _, name := range []string{"host.htm", "topics/Intro.htm", "topics/data.txt"} {
+		os.WriteFile(content+"/"+name, nil, 0644)
+	}
+	b := []byte(`<iframe src="topics/intro.htm#top"></iframe>
+<IFRAME SRC='topics/data.txt'></IFRAME><iframe src="http://example.com/"></iframe>
+<iframe src="host.htm"></iframe><iframe src=missing.htm></iframe><iframe src="topics/Intro.htm"></iframe>`)
+	Test{opts.iframeTargets("host.htm", b), []string{"topics/Intro.htm"}}.DeepEqual(t)
+}
+
+func TestIndexIFrames(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.WriteFile(content+"/toc.hhc", []byte(`<ul><li><object type="text/sitemap"><param name="Name" value="Overview"><param name="Local" value="host.htm"></object>
+<li><object type="text/sitemap"><param name="Name" value="Listed"><param name="Local" value="listed.htm"></object></ul>`), 0644)
+	os.WriteFile(content+"/host.htm", []byte(`<title></title><iframe name="body" src="shown.htm"></iframe><iframe src="listed.htm"></iframe><iframe src="untitled.htm"></iframe>`), 0644)
+	os.WriteFile(content+"/shown.htm", []byte(`<title>Shown Topic</title>`), 0644)
+	os.WriteFile(content+"/listed.htm", []byte(`<title>Listed Topic</title>`), 0644)
+	os.WriteFile(content+"/untitled.htm", []byte(`<p>No title</p>`), 0644)
+	os.WriteFile(content+"/other.htm", []byte(`<title>Other Topic</title>`), 0644)
+
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT name, path FROM searchIndex ORDER BY name")
+	defer rows.Close()
+	var entries []string
+	for rows.Next() {
+		var name, path string
+		rows.Scan(&name, &path)
+		entries = append(entries, name+" "+path)
+	}
+	Test{entries, []string{"Listed listed.htm", "Overview host.htm", "Shown Topic shown.htm"}}.DeepEqual(t)
+}
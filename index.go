@@ -0,0 +1,404 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// Trailing argument list of a function title, e.g. "Connect(int port)"
+	callSuffixRE = regexp.MustCompile(`^([A-Za-z_~][\w.:~]*)\([^()]*\)$`)
+	// Qualified identifier, e.g. "TSocket.Connect" or "std::vector"
+	qualifiedRE = regexp.MustCompile(`^[A-Za-z_][\w]*(?:(?:\.|::)[A-Za-z_][\w]*)+$`)
+	qualifierRE = regexp.MustCompile(`^.*(?:\.|::)`)
+	// Section number of a chapter title, e.g. "3.2.1 " or "4. " or "2 - "
+	numberingRE = regexp.MustCompile(`^\d+(?:\.\d+)*\.?\s*(?:[-–—:]\s*|\s)`)
+)
+
+// Entry sources
+const (
+	sourceHHK       = "hhk"
+	sourceHHC       = "hhc"
+	sourceTitle     = "title"
+	sourceGlossary  = "glossary"
+	sourceConstants = "constants"
+	sourceCommands  = "commands"
+	sourceEquations = "equations"
+
+	// Typed entries win over the generic Guide entries of the sitemaps
+	defaultSourcePriority = "commands,constants,glossary,equations,hhk,hhc,title"
+)
+
+var entrySources = []string{sourceHHK, sourceHHC, sourceTitle, sourceGlossary, sourceConstants, sourceCommands, sourceEquations}
+
+// entryKey identifies the entries that conflict when their types differ
+type entryKey struct {
+	name, path string
+}
+
+// entryOrigin is the type of an indexed entry and the rank of its source
+type entryOrigin struct {
+	entryType string
+	rank      int
+}
+
+// parseSourcePriority returns the rank of every entry source, 0 being the
+// highest. Sources missing from the list rank below the listed ones.
+func parseSourcePriority(s string) (map[string]int, error) {
+	ranks := map[string]int{}
+	for _, source := range splitList(strings.ToLower(s)) {
+		known := false
+		for _, name := range entrySources {
+			known = known || name == source
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown entry source %q, expected one of %s", source, strings.Join(entrySources, ", "))
+		}
+		if _, ok := ranks[source]; !ok {
+			ranks[source] = len(ranks)
+		}
+	}
+	for _, source := range entrySources {
+		if _, ok := ranks[source]; !ok {
+			ranks[source] = len(ranks)
+		}
+	}
+	return ranks, nil
+}
+
+// indexWriter inserts entries of one source into searchIndex
+type indexWriter struct {
+	db     *dbWriter
+	opts   *Options
+	source string
+	count  int
+}
+
+func newIndexWriter(db *dbWriter, opts *Options, source string) *indexWriter {
+	return &indexWriter{db: db, opts: opts, source: source}
+}
+
+// Add inserts an entry, followed by its aliases when enabled
+func (w *indexWriter) Add(name, entryType, path string) error {
+	if w.opts.StripNums {
+		name = stripNumbering(name)
+	}
+	if typed := w.opts.ruleType(name, entryType, path); typed != entryType {
+		entryType = typed
+	} else if entryType == w.opts.defaultType() {
+		if t := w.opts.dirType(path); t != "" {
+			entryType = t
+		} else if w.opts.Classify {
+			if guessed := classify(name, path); guessed != "" {
+				entryType = guessed
+			}
+		}
+	}
+	if err := w.insert(name, entryType, path); err != nil {
+		return err
+	}
+	names := []string{name}
+	if w.opts.Aliases {
+		names = append(names, aliasesFor(name)...)
+	}
+	for i, alias := range names {
+		if i > 0 {
+			if err := w.insert(alias, entryType, path); err != nil {
+				return err
+			}
+		}
+		if !w.opts.FoldAlias {
+			continue
+		}
+		if folded := foldASCII(alias); folded != alias {
+			if err := w.insert(folded, entryType, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insert adds a row, counting it, or applies the -duplicates policy of the
+// source if the row is there already. If another source already indexed the
+// same name and path with a different type, the type of the source with the
+// higher priority is kept.
+func (w *indexWriter) insert(name, entryType, path string) error {
+	key := entryKey{name, path}
+	rank := w.opts.sourceRanks[w.source]
+	if prev, ok := w.opts.entries[key]; ok && prev.entryType != entryType {
+		if rank >= prev.rank {
+			return nil
+		}
+		_, err := w.db.Exec("UPDATE OR REPLACE searchIndex SET type = ? WHERE name = ? AND type = ? AND path = ?",
+			entryType, name, prev.entryType, path)
+		if err != nil {
+			return err
+		}
+		w.opts.entries[key] = entryOrigin{entryType, rank}
+		return nil
+	}
+
+	res, err := w.db.Exec("INSERT OR IGNORE INTO searchIndex(name, type, path) VALUES (?, ?, ?)", name, entryType, path)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return w.duplicate(name, entryType, path)
+	}
+	w.count++
+	w.opts.addEntries(int(n))
+	if _, ok := w.opts.entries[key]; !ok {
+		w.opts.entries[key] = entryOrigin{entryType, rank}
+	}
+	return nil
+}
+
+// aliasesFor returns alternative spellings of a symbol name: without a
+// trailing argument list and without its namespace or class qualifier
+func aliasesFor(name string) []string {
+	var aliases []string
+	add := func(alias string) {
+		if alias == "" || alias == name {
+			return
+		}
+		for _, a := range aliases {
+			if a == alias {
+				return
+			}
+		}
+		aliases = append(aliases, alias)
+	}
+
+	bare := name
+	if m := callSuffixRE.FindStringSubmatch(name); m != nil {
+		bare = m[1]
+		add(bare)
+	}
+	if qualifiedRE.MatchString(bare) {
+		add(qualifierRE.ReplaceAllString(bare, ""))
+	}
+	return aliases
+}
+
+// stripNumbering removes the section number from the start of a title,
+// unless nothing but the number would remain
+func stripNumbering(name string) string {
+	if m := numberingRE.FindString(name); m != "" && strings.TrimSpace(name[len(m):]) != "" {
+		return strings.TrimSpace(name[len(m):])
+	}
+	return name
+}
+
+// Latin letters that do not decompose into a base letter and accents
+var foldedLetters = strings.NewReplacer(
+	"ß", "ss", "Æ", "AE", "æ", "ae", "Œ", "OE", "œ", "oe", "Ø", "O", "ø", "o",
+	"Đ", "D", "đ", "d", "Ł", "L", "ł", "l", "Þ", "Th", "þ", "th", "ı", "i",
+)
+
+// foldASCII returns name with the accents and umlauts of Latin letters
+// removed, e.g. "Übersicht" becomes "Ubersicht". Other scripts are kept, as
+// their marks distinguish letters.
+func foldASCII(name string) string {
+	var b strings.Builder
+	latin := false
+	for _, r := range norm.NFD.String(foldedLetters.Replace(name)) {
+		if unicode.Is(unicode.Mn, r) {
+			if !latin {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		latin = unicode.Is(unicode.Latin, r)
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
+
+// finalizeIndex applies the exclusions, the type filters, the annotations
+// and the priority rules
+func (opts *Options) finalizeIndex(tx *sql.Tx) error {
+	if err := opts.excludePaths(tx); err != nil {
+		return err
+	}
+	if err := opts.filterTypes(tx); err != nil {
+		return err
+	}
+	if err := opts.annotateIndex(tx); err != nil {
+		return err
+	}
+	var deprecated map[string]bool
+	if opts.DetectDeprecated {
+		var err error
+		if deprecated, err = opts.deprecatedPages(); err != nil {
+			return err
+		}
+	}
+	if err := opts.applyPriorities(tx, deprecated); err != nil {
+		return err
+	}
+	return opts.recordUnlisted(tx)
+}
+
+// filterTypes applies the -only-types and -drop-types filters
+func (opts *Options) filterTypes(tx *sql.Tx) error {
+	var removed int64
+	if only := splitList(opts.OnlyTypes); len(only) > 0 {
+		n, err := deleteTypes(tx, "NOT IN", only)
+		if err != nil {
+			return err
+		}
+		removed += n
+	}
+	if drop := splitList(opts.DropTypes); len(drop) > 0 {
+		n, err := deleteTypes(tx, "IN", drop)
+		if err != nil {
+			return err
+		}
+		removed += n
+	}
+	if removed > 0 {
+		log.Printf("Removed %d entries by type filter", removed)
+		opts.addEntries(-int(removed))
+	}
+	return nil
+}
+
+// excludePaths removes the entries whose path matches an -exclude regexp,
+// whose page is on the skip-list or in a language other than -language or
+// -split-languages keeps, or which point at print and popup pages unless
+// -keep-helper-pages is set
+func (opts *Options) excludePaths(tx *sql.Tx) error {
+	var helpers map[string]bool
+	if !opts.KeepHelperPages {
+		var err error
+		if helpers, err = opts.findHelperPages(); err != nil {
+			return err
+		}
+	}
+	otherLanguage, err := opts.otherLanguagePages()
+	if err != nil {
+		return err
+	}
+	if len(opts.Excludes) == 0 && len(opts.skipped) == 0 && len(helpers) == 0 && len(otherLanguage) == 0 && len(opts.otherLanguageDirs) == 0 {
+		return nil
+	}
+	var res []*regexp.Regexp
+	for _, expr := range opts.Excludes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid -exclude: %w", err)
+		}
+		res = append(res, re)
+	}
+
+	rows, err := tx.Query("SELECT id, path FROM searchIndex")
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		page := strings.ToLower(pageOf(path))
+		reason := ""
+		switch {
+		case opts.skips(path):
+			reason = skipSkipList
+		case helpers[page]:
+			reason = skipHelperPage
+		case otherLanguage[page] || opts.inOtherLanguage(page):
+			reason = skipOtherLanguage
+		}
+		for _, re := range res {
+			if reason == "" && re.MatchString(path) {
+				reason = skipExcluded
+			}
+		}
+		if reason != "" {
+			ids = append(ids, id)
+			opts.skipPage(pageOf(path), reason)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := tx.Exec("DELETE FROM searchIndex WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("Excluded %d entries", len(ids))
+		opts.addEntries(-len(ids))
+	}
+	return nil
+}
+
+// deleteTypes deletes the entries whose type is (NOT) IN types
+func deleteTypes(tx *sql.Tx, op string, types []string) (int64, error) {
+	args := make([]interface{}, len(types))
+	for i, t := range types {
+		args[i] = t
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(types)), ", ")
+	res, err := tx.Exec("DELETE FROM searchIndex WHERE type "+op+" ("+placeholders+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// defaultType returns the type of the entries of sitemaps and page titles,
+// -default-type or Guide
+func (opts *Options) defaultType() string {
+	if opts.DefaultType != "" {
+		return opts.DefaultType
+	}
+	return "Guide"
+}
+
+// tocSeparator joins the names of a chapter and its topics under
+// -toc-hierarchy
+const tocSeparator = " > "
+
+// tocName returns the name and type of a table of contents entry under
+// -toc-hierarchy: top-level entries keep the -default-type, nested ones become
+// Sections named after their enclosing entry, e.g. "Chapter > Topic"
+func (opts *Options) tocName(item sitemapItem) (name, entryType string) {
+	if len(item.Parents) == 0 {
+		return item.Name, opts.defaultType()
+	}
+	parent, name := item.Parents[len(item.Parents)-1], item.Name
+	if opts.StripNums {
+		parent, name = stripNumbering(parent), stripNumbering(name)
+	}
+	return parent + tocSeparator + name, "Section"
+}
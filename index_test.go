@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestAliasesFor(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		aliases []string
+	}{
+		{"Connect()", []string{"Connect"}},
+		{"TSocket.Connect", []string{"Connect"}},
+		{"TSocket.Connect(int port)", []string{"TSocket.Connect", "Connect"}},
+		{"std::vector::push_back", []string{"push_back"}},
+		{"Overview (Windows)", nil},
+		{"Version 1.2", nil},
+		{"Connect", nil},
+	} {
+		Test{aliasesFor(test.name), test.aliases}.DeepEqual(t)
+	}
+}
+
+func TestFoldASCII(t *testing.T) {
+	for _, test := range []Test{
+		{foldASCII("Übersicht"), "Ubersicht"},
+		{foldASCII("Straße façade"), "Strasse facade"},
+		{foldASCII("Łódź"), "Lodz"},
+		{foldASCII("Connect"), "Connect"},
+		{foldASCII("Йод"), "Йод"},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestStripNumbering(t *testing.T) {
+	for _, test := range []Test{
+		{stripNumbering("3.2.1 Configuring X"), "Configuring X"},
+		{stripNumbering("4. Installation"), "Installation"},
+		{stripNumbering("12 - Appendix"), "Appendix"},
+		{stripNumbering("1.2: Overview"), "Overview"},
+		{stripNumbering("2.0"), "2.0"},
+		{stripNumbering("3D Graphics"), "3D Graphics"},
+		{stripNumbering("Version 1.2"), "Version 1.2"},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	Test{splitList(" Class, Method,,"), []string{"Class", "Method"}}.DeepEqual(t)
+	Test{len(splitList("")), 0}.Compare(t)
+}
+
+func TestTypeFilters(t *testing.T) {
+	for _, test := range []struct {
+		only, drop string
+		expected   []string
+	}{
+		{"", "", []string{"Class", "Guide", "Method"}},
+		{"Class,Method", "", []string{"Class", "Method"}},
+		{"", "Guide", []string{"Class", "Method"}},
+		{"Class,Guide", "Guide", []string{"Class"}},
+	} {
+		opts := &Options{
+			SourcePath: "/foo/bar/baz.chm",
+			Outdir:     "tmp/Sample.docset",
+			OnlyTypes:  test.only,
+			DropTypes:  test.drop,
+		}
+		opts.CreateDirectory()
+		db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+		db.Exec(dbSchema)
+		tx, _ := db.Begin()
+		for _, entryType := range []string{"Guide", "Class", "Method"} {
+			tx.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, ?, ?)", "x", entryType, "x.htm")
+		}
+		if err := opts.finalizeIndex(tx); err != nil {
+			t.Errorf("Expected nil but got %v", err)
+		}
+		tx.Commit()
+		rows, _ := db.Query("SELECT type FROM searchIndex ORDER BY type")
+		var types []string
+		for rows.Next() {
+			var entryType string
+			rows.Scan(&entryType)
+			types = append(types, entryType)
+		}
+		db.Close()
+		Test{types, test.expected}.DeepEqual(t)
+		cleanTmp()
+	}
+}
+
+func TestParseSourcePriority(t *testing.T) {
+	ranks, err := parseSourcePriority("title, HHK")
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	Test{ranks["title"], 0}.Compare(t)
+	Test{ranks["hhk"], 1}.Compare(t)
+	Test{ranks["hhc"], 2}.Compare(t)
+	Test{len(ranks), len(entrySources)}.Compare(t)
+
+	_, err = parseSourcePriority("hhk,toc")
+	Test{err != nil, true}.Compare(t)
+}
+
+func TestSourceConflicts(t *testing.T) {
+	for _, test := range []struct {
+		priority string
+		expected []string
+	}{
+		{defaultSourcePriority, []string{"Constant", "Guide"}},
+		{"hhk,constants", []string{"Guide", "Guide"}},
+	} {
+		opts := &Options{
+			SourcePath:     "/foo/bar/baz.chm",
+			Outdir:         "tmp/Sample.docset",
+			SourcePriority: test.priority,
+		}
+		opts.sourceRanks, _ = parseSourcePriority(test.priority)
+		opts.entries = map[entryKey]entryOrigin{}
+		opts.CreateDirectory()
+		db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+		db.Exec(dbSchema)
+		w := newDBWriter(db, 0)
+
+		hhk := newIndexWriter(w, opts, sourceHHK)
+		hhk.Add("MAX_PATH", "Guide", "consts.htm#max_path")
+		hhk.Add("Overview", "Guide", "consts.htm")
+		consts := newIndexWriter(w, opts, sourceConstants)
+		consts.Add("MAX_PATH", "Constant", "consts.htm#max_path")
+		w.Close()
+
+		rows, _ := db.Query("SELECT type FROM searchIndex ORDER BY type")
+		var types []string
+		for rows.Next() {
+			var entryType string
+			rows.Scan(&entryType)
+			types = append(types, entryType)
+		}
+		db.Close()
+		Test{types, test.expected}.DeepEqual(t)
+		cleanTmp()
+	}
+}
+
+func TestTOCName(t *testing.T) {
+	opts := &Options{}
+	for _, test := range []struct {
+		item           sitemapItem
+		name, itemType string
+	}{
+		{sitemapItem{Name: "Chapter"}, "Chapter", "Guide"},
+		{sitemapItem{Name: "Topic", Parents: []string{"Book", "Chapter"}}, "Chapter > Topic", "Section"},
+	} {
+		name, entryType := opts.tocName(test.item)
+		Test{name, test.name}.Compare(t)
+		Test{entryType, test.itemType}.Compare(t)
+	}
+	opts.StripNums = true
+	name, _ := opts.tocName(sitemapItem{Name: "3.1 Topic", Parents: []string{"3 Chapter"}})
+	Test{name, "Chapter > Topic"}.Compare(t)
+	opts.DefaultType = "Sample"
+	_, entryType := opts.tocName(sitemapItem{Name: "Chapter"})
+	Test{entryType, "Sample"}.Compare(t)
+}
+
+func TestIndexDefaultType(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", DefaultType: "Sample", Classify: true}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Basics"><param name="Local" value="test1.htm"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="printf()"><param name="Local" value="test2.htm"></OBJECT>
+</UL>`), 0644)
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT DISTINCT type FROM searchIndex ORDER BY type")
+	var types []string
+	for rows.Next() {
+		var entryType string
+		rows.Scan(&entryType)
+		types = append(types, entryType)
+	}
+	Test{types, []string{"Function", "Sample"}}.DeepEqual(t)
+}
+
+func TestIndexTOCHierarchy(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", TOCNames: true}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Basics"><param name="Local" value="test1.htm"></OBJECT>
+<UL><LI><OBJECT type="text/sitemap"><param name="Name" value="Details"><param name="Local" value="test2.htm"></OBJECT></UL>
+</UL>`), 0644)
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT name, type, path FROM searchIndex ORDER BY path")
+	var entries []string
+	for rows.Next() {
+		var name, entryType, path string
+		rows.Scan(&name, &entryType, &path)
+		entries = append(entries, name+"|"+entryType+"|"+path)
+	}
+	Test{entries, []string{"Basics|Guide|test1.htm", "Basics > Details|Section|test2.htm"}}.DeepEqual(t)
+}
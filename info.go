@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+// infoCommand implements the info subcommand
+func infoCommand(args []string) error {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s info inputfile\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+
+	r, err := chm.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return writeInfo(os.Stdout, r)
+}
+
+// writeInfo prints the metadata of a CHM: the settings of its #SYSTEM file,
+// falling back to the file header for the language, and the number of its
+// pages and other content files
+func writeInfo(w io.Writer, r *chm.Reader) error {
+	s, err := r.System()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lcid := s.LanguageID
+	if lcid == 0 {
+		lcid = r.LanguageID
+	}
+	charset := lcidCharset(lcid)
+	text := func(s string) string {
+		return strings.TrimSpace(decodeCharset([]byte(s), charset))
+	}
+
+	var pages, assets int
+	for _, f := range r.Files() {
+		switch {
+		case !f.IsContent():
+		case isHTMLFile(f.Name):
+			pages++
+		default:
+			assets++
+		}
+	}
+
+	language := fmt.Sprintf("0x%04x", lcid)
+	if tag := lcidTag(lcid); tag != "" {
+		language += " (" + tag + ")"
+	}
+	fields := []struct{ name, value string }{
+		{"Title", text(s.Title)},
+		{"Default topic", text(s.DefaultTopic)},
+		{"Language", language},
+		{"Codepage", charset},
+		{"Compiler", text(s.Compiler)},
+		{"Format version", fmt.Sprint(r.Version)},
+		{"Contents file", text(s.ContentsFile)},
+		{"Index file", text(s.IndexFile)},
+		{"Pages", fmt.Sprint(pages)},
+		{"Other files", fmt.Sprint(assets)},
+		{"Protection", r.Protection()},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Fprintf(w, "%s: %s\n", field.name, field.value)
+		}
+	}
+	return nil
+}
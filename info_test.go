@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"chm2docset/chm"
+)
+
+func TestWriteInfo(t *testing.T) {
+	r, err := chm.Open("_fixtures/sample.chm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var b bytes.Buffer
+	Test{writeInfo(&b, r), nil}.Compare(t)
+	Test{b.String(), `Title: Sample Änderungen
+Default topic: page.htm
+Language: 0x0409 (en-US)
+Codepage: windows-1252
+Format version: 3
+Pages: 3
+Other files: 1
+`}.Compare(t)
+}
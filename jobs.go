@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+)
+
+// Thresholds of the worker counts chosen when -jobs is 0
+const (
+	// Below these, pages are rewritten in a single goroutine
+	serialPages     = 64
+	serialPageBytes = 1 << 20
+	// Pages and bytes of pages given to each page worker at least
+	pagesPerWorker = 16
+	bytesPerWorker = 256 << 10
+	// Average source sizes above which fewer conversions run at once, as
+	// each spreads its pages over the CPUs and extraction is bound by disk
+	largeSource = 16 << 20
+	hugeSource  = 64 << 20
+)
+
+// autoJobs returns the number of conversions of builds to run at once
+func autoJobs(builds []*Options) int {
+	cpus := runtime.NumCPU()
+	jobs := min(cpus, len(builds))
+	var total int64
+	for _, build := range builds {
+		if info, err := os.Stat(build.SourcePath); err == nil {
+			total += info.Size()
+		}
+	}
+	if len(builds) > 0 {
+		switch average := total / int64(len(builds)); {
+		case average > hugeSource:
+			jobs = min(jobs, cpus/4)
+		case average > largeSource:
+			jobs = min(jobs, cpus/2)
+		}
+	}
+	jobs = max(jobs, 1)
+	if len(builds) > 1 {
+		log.Printf("Running %d conversions at once", jobs)
+	}
+	return jobs
+}
+
+// pageWorkers returns the number of goroutines processing count pages of
+// size bytes in total: -jobs if given, otherwise one for small CHMs, where
+// the overhead outweighs the gain, up to one per CPU for large ones
+func (opts *Options) pageWorkers(count int, size int64) int {
+	if opts.Jobs > 0 {
+		return max(min(opts.Jobs, count), 1)
+	}
+	if count < serialPages || size < serialPageBytes {
+		return 1
+	}
+	return max(min(runtime.NumCPU(), count/pagesPerWorker, int(size/bytesPerWorker)), 1)
+}
+
+// extractWorkers returns the number of goroutines extracting count sources
+// of one docset: -jobs if given, otherwise one per CPU
+func (opts *Options) extractWorkers(count int) int {
+	if opts.Jobs > 0 {
+		return max(min(opts.Jobs, count), 1)
+	}
+	return max(min(runtime.NumCPU(), count), 1)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestPageWorkers(t *testing.T) {
+	cpus := runtime.NumCPU()
+	opts := &Options{}
+	for _, test := range []Test{
+		{opts.pageWorkers(10, 1<<30), 1},
+		{opts.pageWorkers(10000, 100<<10), 1},
+		{opts.pageWorkers(64, 4<<20), min(cpus, 4)},
+		{opts.pageWorkers(10000, 1<<30), cpus},
+		{(&Options{Jobs: 3}).pageWorkers(10, 1), 3},
+		{(&Options{Jobs: 3}).pageWorkers(2, 1), 2},
+		{(&Options{Jobs: 3}).pageWorkers(0, 0), 1},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestAutoJobs(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/a.chm", []byte("small"), 0644)
+	cpus := runtime.NumCPU()
+	small := []*Options{{SourcePath: "tmp/a.chm"}, {SourcePath: "tmp/a.chm"}, {SourcePath: "tmp/a.chm"}}
+	Test{autoJobs(small), min(cpus, 3)}.Compare(t)
+	Test{autoJobs(small[:1]), 1}.Compare(t)
+
+	f, _ := os.Create("tmp/huge.chm")
+	f.Truncate(hugeSource + 1)
+	f.Close()
+	huge := []*Options{{SourcePath: "tmp/huge.chm"}, {SourcePath: "tmp/huge.chm"}}
+	Test{autoJobs(huge), max(min(cpus/4, 2), 1)}.Compare(t)
+}
+
+func TestExtractWorkers(t *testing.T) {
+	cpus := runtime.NumCPU()
+	Test{(&Options{}).extractWorkers(3), min(cpus, 3)}.Compare(t)
+	Test{(&Options{}).extractWorkers(0), 1}.Compare(t)
+	Test{(&Options{Jobs: 2}).extractWorkers(5), 2}.Compare(t)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"chm2docset/chm"
+)
+
+var (
+	htmlTagRE  = regexp.MustCompile(`(?i)<html\b[^>]*>`)
+	langAttrRE = regexp.MustCompile(`(?i)\s(?:xml:)?lang\s*=`)
+)
+
+// lcidTags maps Windows locale ids to BCP 47 language tags
+var lcidTags = map[uint32]string{
+	0x0401: "ar-SA", 0x0402: "bg-BG", 0x0403: "ca-ES", 0x0404: "zh-TW",
+	0x0405: "cs-CZ", 0x0406: "da-DK", 0x0407: "de-DE", 0x0408: "el-GR",
+	0x0409: "en-US", 0x040a: "es-ES", 0x040b: "fi-FI", 0x040c: "fr-FR",
+	0x040d: "he-IL", 0x040e: "hu-HU", 0x040f: "is-IS", 0x0410: "it-IT",
+	0x0411: "ja-JP", 0x0412: "ko-KR", 0x0413: "nl-NL", 0x0414: "nb-NO",
+	0x0415: "pl-PL", 0x0416: "pt-BR", 0x0418: "ro-RO", 0x0419: "ru-RU",
+	0x041a: "hr-HR", 0x041b: "sk-SK", 0x041c: "sq-AL", 0x041d: "sv-SE",
+	0x041e: "th-TH", 0x041f: "tr-TR", 0x0421: "id-ID", 0x0422: "uk-UA",
+	0x0423: "be-BY", 0x0424: "sl-SI", 0x0425: "et-EE", 0x0426: "lv-LV",
+	0x0427: "lt-LT", 0x042a: "vi-VN", 0x042d: "eu-ES", 0x0436: "af-ZA",
+	0x0439: "hi-IN", 0x043e: "ms-MY", 0x0804: "zh-CN", 0x0807: "de-CH",
+	0x0809: "en-GB", 0x080a: "es-MX", 0x080c: "fr-BE", 0x0813: "nl-BE",
+	0x0814: "nn-NO", 0x0816: "pt-PT", 0x081a: "sr-Latn-RS", 0x0c04: "zh-HK",
+	0x0c07: "de-AT", 0x0c09: "en-AU", 0x0c0a: "es-ES", 0x0c0c: "fr-CA",
+	0x0c1a: "sr-Cyrl-RS", 0x1004: "zh-SG", 0x1009: "en-CA", 0x100c: "fr-CH",
+	0x1409: "en-NZ", 0x1809: "en-IE",
+}
+
+// charsetLangs maps legacy charsets that imply a language to its tag
+var charsetLangs = map[string]string{
+	"windows-1251": "ru", "koi8-r": "ru", "koi8-u": "uk",
+	"shift_jis": "ja", "euc-jp": "ja", "iso-2022-jp": "ja",
+	"gb2312": "zh-CN", "gbk": "zh-CN", "gb18030": "zh-CN", "big5": "zh-TW",
+	"euc-kr": "ko", "ks_c_5601-1987": "ko",
+	"windows-1253": "el", "windows-1255": "he", "windows-1256": "ar",
+	"windows-1254": "tr", "windows-874": "th", "windows-1258": "vi",
+}
+
+// primaryCharsets maps the primary languages of Windows locale ids whose
+// ANSI code page is not windows-1252 to that code page
+var primaryCharsets = map[uint32]string{
+	0x01: "windows-1256", 0x02: "windows-1251", 0x04: "gbk",
+	0x05: "windows-1250", 0x08: "windows-1253", 0x0d: "windows-1255",
+	0x0e: "windows-1250", 0x11: "shift_jis", 0x12: "euc-kr",
+	0x15: "windows-1250", 0x18: "windows-1250", 0x19: "windows-1251",
+	0x1a: "windows-1250", 0x1b: "windows-1250", 0x1c: "windows-1250",
+	0x1e: "windows-874", 0x1f: "windows-1254", 0x22: "windows-1251",
+	0x23: "windows-1251", 0x24: "windows-1250", 0x25: "windows-1257",
+	0x26: "windows-1257", 0x27: "windows-1257", 0x2a: "windows-1258",
+}
+
+// lcidCharset returns the ANSI code page of a Windows locale id, in which
+// the strings of the CHM system files are stored
+func lcidCharset(lcid uint32) string {
+	switch lcid {
+	case 0x0404, 0x0c04, 0x1404: // Chinese as written in Taiwan, Hong Kong and Macao
+		return "big5"
+	case 0x0c1a, 0x201a: // Serbian and Bosnian in Cyrillic script
+		return "windows-1251"
+	}
+	if charset, ok := primaryCharsets[lcid&0x3ff]; ok {
+		return charset
+	}
+	return "windows-1252"
+}
+
+// lcidTag returns the language tag of a Windows locale id
+func lcidTag(lcid uint32) string {
+	if tag, ok := lcidTags[lcid]; ok {
+		return tag
+	}
+	// Fall back to the primary language of the locale
+	for id, tag := range lcidTags {
+		if id&0x3ff == lcid&0x3ff && id&0xfc00 == 0x0400 {
+			return tag[:2]
+		}
+	}
+	return ""
+}
+
+// sourceLang returns the language declared by the CHM header, if any
+func (opts *Options) sourceLang() string {
+	r, err := chm.Open(opts.SourcePath)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+	return lcidTag(r.LanguageID)
+}
+
+// InjectLang returns the rewrite adding a lang attribute to the <html> tag
+// of pages that lack one, or nil without -lang. With -lang auto the language
+// comes from the CHM locale, or per page from a charset that implies a
+// language.
+func (opts *Options) InjectLang() (pageRewrite, error) {
+	if opts.Lang == "" {
+		return nil, nil
+	}
+	lang := opts.Lang
+	if lang == "auto" {
+		lang = opts.sourceLang()
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		pageLang := lang
+		if pageLang == "" {
+			pageLang = charsetLangs[detectCharset(b, "")]
+		}
+		return setLang(b, pageLang)
+	}, nil
+}
+
+// setLang adds lang to the <html> tag of b unless it already declares one
+func setLang(b []byte, lang string) ([]byte, bool) {
+	if lang == "" {
+		return b, false
+	}
+	loc := htmlTagRE.FindIndex(b)
+	if loc == nil || langAttrRE.Match(b[loc[0]:loc[1]]) {
+		return b, false
+	}
+	end := loc[1] - 1
+	if end > loc[0] && b[end-1] == '/' {
+		end--
+	}
+	var out bytes.Buffer
+	out.Write(b[:end])
+	fmt.Fprintf(&out, ` lang="%s"`, lang)
+	out.Write(b[end:])
+	return out.Bytes(), true
+}
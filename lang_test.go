@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLcidTag(t *testing.T) {
+	Test{lcidTag(0x0409), "en-US"}.Compare(t)
+	Test{lcidTag(0x0419), "ru-RU"}.Compare(t)
+	Test{lcidTag(0x2c0a), "es"}.Compare(t)
+	Test{lcidTag(0x7fff), ""}.Compare(t)
+}
+
+func TestSetLang(t *testing.T) {
+	for _, test := range []struct {
+		page, lang, expected string
+		ok                   bool
+	}{
+		{`<HTML><body></body></HTML>`, "ru", `<HTML lang="ru"><body></body></HTML>`, true},
+		{`<html xmlns="x"/>`, "ja", `<html xmlns="x" lang="ja"/>`, true},
+		{`<html lang="en"><body></body></html>`, "ru", `<html lang="en"><body></body></html>`, false},
+		{`<html xml:lang="en">`, "ru", `<html xml:lang="en">`, false},
+		{`<body>no html tag</body>`, "ru", `<body>no html tag</body>`, false},
+		{`<html>`, "", `<html>`, false},
+	} {
+		out, ok := setLang([]byte(test.page), test.lang)
+		Test{string(out), test.expected}.Compare(t)
+		Test{ok, test.ok}.Compare(t)
+	}
+}
+
+func TestInjectLangAuto(t *testing.T) {
+	opts := &Options{
+		SourcePath: "_fixtures/sample.chm",
+		Outdir:     "tmp/Sample.docset",
+		Lang:       "auto",
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	os.WriteFile(opts.ContentPath()+"/a.htm", []byte(`<html><body>a</body></html>`), 0644)
+	if err := opts.Rewrite(); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile(opts.ContentPath() + "/a.htm")
+	Test{string(b), `<html lang="en-US"><body>a</body></html>`}.Compare(t)
+}
+
+func TestInjectLangCharset(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+		Lang:       "auto",
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	page := `<html><head><meta http-equiv="Content-Type" content="text/html; charset=windows-1251"></head></html>`
+	os.WriteFile(opts.ContentPath()+"/a.htm", []byte(page), 0644)
+	opts.Rewrite()
+	b, _ := os.ReadFile(opts.ContentPath() + "/a.htm")
+	Test{string(b), `<html lang="ru"><head><meta http-equiv="Content-Type" content="text/html; charset=windows-1251"></head></html>`}.Compare(t)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"html"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	htmlLangRE        = regexp.MustCompile(`(?i)<html\b[^>]*?\s(?:xml:)?lang\s*=\s*["']?([a-z]{2,3}(?:-[a-z0-9]+)*)`)
+	contentLanguageRE = regexp.MustCompile(`(?i)<meta\s[^>]*http-equiv\s*=\s*["']?content-language["']?[^>]*\scontent\s*=\s*["']?([a-z]{2,3}(?:-[a-z0-9]+)*)`)
+)
+
+// Runes of page text looked at to guess its language
+const langTextLimit = 4000
+
+// languageWords maps frequent words of the Latin script languages told
+// apart by detectLang to the language; words common to several of them are
+// left out
+var languageWords = map[string]string{
+	"the": "en", "and": "en", "is": "en", "are": "en", "of": "en", "to": "en", "with": "en", "this": "en", "that": "en", "for": "en",
+	"der": "de", "die": "de", "und": "de", "ist": "de", "nicht": "de", "mit": "de", "das": "de", "den": "de", "wird": "de", "sie": "de",
+	"les": "fr", "et": "fr", "est": "fr", "des": "fr", "une": "fr", "pour": "fr", "dans": "fr", "sur": "fr", "qui": "fr", "vous": "fr",
+	"el": "es", "los": "es", "las": "es", "y": "es", "del": "es", "se": "es", "por": "es", "como": "es", "su": "es", "puede": "es",
+	"il": "it", "di": "it", "che": "it", "della": "it", "per": "it", "sono": "it", "gli": "it", "questo": "it", "non": "it", "nel": "it",
+	"het": "nl", "een": "nl", "van": "nl", "niet": "nl", "voor": "nl", "zijn": "nl", "wordt": "nl", "ook": "nl", "naar": "nl", "bij": "nl",
+	"não": "pt", "uma": "pt", "com": "pt", "os": "pt", "ao": "pt", "são": "pt", "você": "pt", "pelo": "pt", "também": "pt", "mais": "pt",
+}
+
+// scriptLangs maps scripts used by a single language, in the sense of a
+// documentation set, to its tag. Han is handled by detectLang.
+var scriptLangs = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Arabic, "ar"},
+	{unicode.Thai, "th"},
+}
+
+// detectLang returns the language of a page: as declared by its <html lang>
+// or Content-Language, as guessed from the script and frequent words of its
+// text, or as implied by its charset; "" if unknown
+func detectLang(b []byte) string {
+	head := b[:min(len(b), 4096)]
+	for _, re := range []*regexp.Regexp{htmlLangRE, contentLanguageRE} {
+		if m := re.FindSubmatch(head); m != nil {
+			return string(m[1])
+		}
+	}
+	charset := detectCharset(b, "")
+	content := decodeCharset(b, charset)
+	if m := bodyRE.FindStringSubmatch(content); m != nil {
+		content = m[1]
+	}
+	if lang := guessLang(html.UnescapeString(tagRE.ReplaceAllString(content, " "))); lang != "" {
+		return lang
+	}
+	return charsetLangs[charset]
+}
+
+// guessLang guesses the language of text from its script or, for Latin
+// script, from frequent words
+func guessLang(text string) string {
+	var latin, han, kana int
+	scripts := make([]int, len(scriptLangs))
+	runes := 0
+	for _, r := range text {
+		if runes++; runes > langTextLimit {
+			break
+		}
+		switch {
+		case !unicode.IsLetter(r):
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for i, s := range scriptLangs {
+				if unicode.Is(s.script, r) {
+					scripts[i]++
+					break
+				}
+			}
+		}
+	}
+	best, bestCount := "", latin
+	if kana > 0 && kana+han > bestCount {
+		best, bestCount = "ja", kana+han
+	} else if han > bestCount {
+		best, bestCount = "zh", han
+	}
+	for i, s := range scriptLangs {
+		if scripts[i] > bestCount {
+			best, bestCount = s.lang, scripts[i]
+		}
+	}
+	if best != "" || latin == 0 {
+		return best
+	}
+
+	counts := map[string]int{}
+	for i, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if i >= langTextLimit/4 {
+			break
+		}
+		if lang, ok := languageWords[word]; ok {
+			counts[lang]++
+		}
+	}
+	best, bestCount = "", 1
+	for lang, n := range counts {
+		if n > bestCount || n == bestCount && best != "" && lang < best {
+			best, bestCount = lang, n
+		}
+	}
+	return best
+}
+
+// langMatches reports whether the language tag matches one of the
+// languages given, comparing primary subtags
+func langMatches(tag string, languages []string) bool {
+	primary := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+	for _, lang := range languages {
+		if strings.EqualFold(strings.SplitN(lang, "-", 2)[0], primary) {
+			return true
+		}
+	}
+	return false
+}
+
+// otherLanguagePages returns the pages, lower-cased, detected to be in a
+// language not listed by -language. Pages of unknown language are kept.
+func (opts *Options) otherLanguagePages() (map[string]bool, error) {
+	languages := splitList(opts.Language)
+	if len(languages) == 0 {
+		return nil, nil
+	}
+	pages := map[string]bool{}
+	found := map[string]int{}
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		b, err := opts.pages.ReadFile(path)
+		if err != nil {
+			opts.pageErrorf("skipping language detection of %s due to error: %v", path, err)
+			return nil
+		}
+		lang := detectLang(b)
+		if lang == "" || langMatches(lang, languages) {
+			return nil
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		pages[strings.ToLower(filepath.ToSlash(relPath))] = true
+		found[strings.ToLower(strings.SplitN(lang, "-", 2)[0])]++
+		return nil
+	})
+	if len(pages) > 0 {
+		log.Printf("Found %d pages in other languages: %v", len(pages), found)
+	}
+	return pages, err
+}
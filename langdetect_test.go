@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestDetectLang(t *testing.T) {
+	for _, test := range []Test{
+		{detectLang([]byte(`<html lang="de-AT"><body>The quick fox</body></html>`)), "de-AT"},
+		{detectLang([]byte(`<html><head><meta http-equiv="Content-Language" content="fr"></head><body>The</body></html>`)), "fr"},
+		{detectLang([]byte(`<html><body><p>This is the description of the function and its arguments.</p></body></html>`)), "en"},
+		{detectLang([]byte(`<html><body><p>Die Funktion ist nicht mit der Version kompatibel und wird entfernt.</p></body></html>`)), "de"},
+		{detectLang([]byte(`<html><body><p>La fonction est utilisée pour les fichiers et des dossiers.</p></body></html>`)), "fr"},
+		{detectLang([]byte(`<html><body><p>Функция возвращает значение</p></body></html>`)), "ru"},
+		{detectLang([]byte(`<html><body><p>この関数は値を返します</p></body></html>`)), "ja"},
+		{detectLang([]byte(`<html><body><p>此函数返回值</p></body></html>`)), "zh"},
+		{detectLang([]byte(`<html><head><meta charset="euc-jp"></head><body>OK</body></html>`)), "ja"},
+		{detectLang([]byte(`<html><body>TForm</body></html>`)), ""},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestLangMatches(t *testing.T) {
+	for _, test := range []Test{
+		{langMatches("en-US", []string{"en"}), true},
+		{langMatches("en", []string{"de", "EN-GB"}), true},
+		{langMatches("de", []string{"en"}), false},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestLanguageFilter(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Language: "en"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/test2.htm", []byte(`<html lang="de"><head><title>test 2</title></head></html>`), 0644)
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM searchIndex WHERE path = 'test2.htm'").Scan(&n)
+	Test{n, 0}.Compare(t)
+	db.QueryRow("SELECT COUNT(*) FROM searchIndex WHERE path = 'test1.htm'").Scan(&n)
+	Test{n, 1}.Compare(t)
+}
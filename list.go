@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"chm2docset/chm"
+)
+
+// listCommand implements the list subcommand
+func listCommand(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s list inputfile\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	all := flags.Bool("all", false, "List directories and the internal #/$ and :: files too")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+
+	r, err := chm.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	writeListing(os.Stdout, r, *all)
+	return nil
+}
+
+// writeListing prints the size, storage section and name of the files of a
+// CHM, in directory order, followed by a summary. Without all, only the
+// content files a conversion extracts are listed.
+func writeListing(w io.Writer, r *chm.Reader, all bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "size\tstorage\tname\n")
+	var files, pages int
+	var size, compressed uint64
+	for _, f := range r.Files() {
+		if !all && !f.IsContent() {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", f.Length, sectionName(f.Section), f.Name)
+		if f.IsDir() {
+			continue
+		}
+		files++
+		size += f.Length
+		if f.Section == 1 {
+			compressed += f.Length
+		}
+		if f.IsContent() && isHTMLFile(f.Name) {
+			pages++
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d files, %d pages, %d bytes, %d of them LZX-compressed\n", files, pages, size, compressed)
+	if protection := r.Protection(); protection != "" {
+		fmt.Fprintf(w, "protected: %s\n", protection)
+	}
+}
+
+// sectionName describes how a content section stores its files
+func sectionName(section int) string {
+	switch section {
+	case 0:
+		return "stored"
+	case 1:
+		return "lzx"
+	}
+	return fmt.Sprintf("section %d", section)
+}
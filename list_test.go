@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"chm2docset/chm"
+)
+
+func TestWriteListing(t *testing.T) {
+	r, err := chm.Open("_fixtures/sample.chm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var b bytes.Buffer
+	writeListing(&b, r, false)
+	Test{b.String(), strings.Join([]string{
+		"size  storage  name",
+		"6     stored   /img/logo.gif",
+		"226   stored   /index.htm",
+		"86    stored   /page.htm",
+		"86    stored   /sub/lost.htm",
+		"4 files, 3 pages, 404 bytes, 0 of them LZX-compressed",
+		"",
+	}, "\n")}.Compare(t)
+
+	b.Reset()
+	writeListing(&b, r, true)
+	Test{strings.Contains(b.String(), "stored   /#SYSTEM\n"), true}.Compare(t)
+	Test{strings.Contains(b.String(), "/sub/\n"), true}.Compare(t)
+}
+
+func TestSectionName(t *testing.T) {
+	Test{sectionName(0), "stored"}.Compare(t)
+	Test{sectionName(1), "lzx"}.Compare(t)
+	Test{sectionName(3), "section 3"}.Compare(t)
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const formatMarkdown = "markdown"
+
+var (
+	// Characters not allowed in file names on common file systems
+	fileNameRE = regexp.MustCompile(`[\\/:*?"<>|\s]+`)
+	spacesRE   = regexp.MustCompile(`[ \t\r\n]+`)
+	mdEscaper  = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`")
+)
+
+// Marks a hard line break until whitespace has been collapsed
+const mdLineBreak = "\x00"
+
+// exportMarkdown converts the pages to Markdown files laid out like the
+// table of contents: an entry becomes name.md, and its children go into a
+// name directory beside it. Pages missing from the table of contents keep
+// their paths. Other files are copied, and links are rewritten to match.
+func (opts *Options) exportMarkdown() error {
+	out := opts.ExportPath()
+	pages, err := opts.markdownPaths()
+	if err != nil {
+		return err
+	}
+
+	basePath := opts.ContentPath()
+	count := 0
+	err = filepath.WalkDir(basePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ext := strings.ToLower(path.Ext(rel)); ext == ".hhc" || ext == ".hhk" {
+			return nil
+		}
+		target, isPage := pages[rel]
+		if !isPage {
+			target = rel
+		}
+		dest := filepath.Join(out, filepath.FromSlash(target))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if isPage {
+			md, err := opts.pageMarkdown(b, rel, target, pages)
+			if err != nil {
+				opts.pageErrorf("skipping Markdown conversion of %s due to error: %v", rel, err)
+				return nil
+			}
+			b = []byte(md)
+			count++
+		}
+		return os.WriteFile(dest, b, 0644)
+	})
+	if err == nil {
+		log.Printf("Exported %d pages as Markdown to %s", count, out)
+	}
+	return err
+}
+
+// markdownPaths returns the Markdown path of every page
+func (opts *Options) markdownPaths() (map[string]string, error) {
+	pages := map[string]string{}
+	taken := map[string]bool{}
+	add := func(page, md string) {
+		md = uniquePath(md, taken)
+		taken[md] = true
+		pages[page] = md
+	}
+
+	if hhcPath := findFileByExt(opts.ContentPath(), ".hhc"); hhcPath != "" {
+		b, err := os.ReadFile(hhcPath)
+		if err != nil {
+			return nil, err
+		}
+		var dirs []string
+		for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+			level := min(len(item.Parents), len(dirs))
+			dirs = append(dirs[:level], fileSlug(item.Name))
+			if item.Local == "" {
+				continue
+			}
+			page, _, ok := opts.resolveLocal(item.Local)
+			if _, seen := pages[page]; ok && !seen {
+				add(page, strings.Join(dirs, "/")+".md")
+			}
+		}
+	}
+
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(p) {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := pages[rel]; !ok {
+			add(rel, strings.TrimSuffix(rel, path.Ext(rel))+".md")
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// fileSlug returns name as a file name, keeping letters of any script
+func fileSlug(name string) string {
+	slug := strings.Trim(fileNameRE.ReplaceAllString(name, "-"), "-.")
+	if slug == "" {
+		return "item"
+	}
+	return slug
+}
+
+// pageMarkdown converts an HTML page at rel, exported to target, to
+// Markdown
+func (opts *Options) pageMarkdown(b []byte, rel, target string, pages map[string]string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(decodeToUTF8(b, "")))
+	if err != nil {
+		return "", err
+	}
+	c := &mdConverter{resolve: func(link string) string {
+		linked, ok := resolveLink(rel, link)
+		if !ok || linked == "" {
+			return link
+		}
+		fragment := ""
+		if i := strings.IndexByte(link, '#'); i >= 0 {
+			fragment = link[i:]
+		}
+		if found := opts.findContentFile(linked); found != "" {
+			linked = found
+		}
+		if md, ok := pages[linked]; ok {
+			linked = md
+		}
+		return escapeLink(relativeLink(target, linked)) + fragment
+	}}
+	md := c.blocks(doc)
+	if title := findElement(doc, atom.Title); title != nil && findElement(doc, atom.H1) == nil {
+		if text := strings.TrimSpace(spacesRE.ReplaceAllString(textContent(title), " ")); text != "" {
+			md = "# " + mdEscaper.Replace(text) + "\n\n" + md
+		}
+	}
+	return md + "\n", nil
+}
+
+// mdConverter converts parsed HTML to Markdown
+type mdConverter struct {
+	resolve func(link string) string
+}
+
+// Elements rendered as blocks of their own
+var mdBlocks = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.P: true, atom.Div: true, atom.Ul: true, atom.Ol: true, atom.Pre: true,
+	atom.Blockquote: true, atom.Table: true, atom.Hr: true, atom.Dl: true,
+	atom.Body: true, atom.Html: true, atom.Section: true, atom.Article: true,
+	atom.Center: true, atom.Main: true, atom.Header: true, atom.Footer: true,
+}
+
+// Elements without content to convert
+var mdSkipped = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Object: true, atom.Form: true, atom.Iframe: true,
+}
+
+// blocks converts the children of n, separating blocks by blank lines
+func (c *mdConverter) blocks(n *html.Node) string {
+	var out, inline strings.Builder
+	add := func(part, sep string) {
+		if out.Len() > 0 {
+			out.WriteString(sep)
+		}
+		out.WriteString(part)
+	}
+	flush := func() {
+		if text := cleanInline(inline.String()); text != "" {
+			add(text, "\n\n")
+		}
+		inline.Reset()
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && mdSkipped[child.DataAtom] {
+			continue
+		}
+		if child.Type == html.ElementNode && (mdBlocks[child.DataAtom] || child.DataAtom == atom.Dt || child.DataAtom == atom.Dd) {
+			flush()
+			sep := "\n\n"
+			if n.DataAtom == atom.Li && (child.DataAtom == atom.Ul || child.DataAtom == atom.Ol) {
+				// Keep nested lists tight
+				sep = "\n"
+			}
+			if block := c.block(child); block != "" {
+				add(block, sep)
+			}
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return out.String()
+}
+
+// block converts a block element
+func (c *mdConverter) block(n *html.Node) string {
+	anchor := ""
+	if id := attr(n, "id"); id != "" {
+		anchor = fmt.Sprintf(`<a id="%s"></a>`, html.EscapeString(id))
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := cleanInline(c.inlineChildren(n))
+		if text == "" {
+			return anchor
+		}
+		level := int(n.Data[1] - '0')
+		return strings.Repeat("#", level) + " " + anchor + strings.ReplaceAll(text, "\n", " ")
+	case atom.Ul, atom.Ol:
+		return anchor + c.list(n)
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + "\n" + code + "\n" + fence
+	case atom.Blockquote:
+		lines := strings.Split(c.blocks(n), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return strings.Join(lines, "\n")
+	case atom.Table:
+		return anchor + c.table(n)
+	case atom.Hr:
+		return "---"
+	case atom.Dt:
+		if text := cleanInline(c.inlineChildren(n)); text != "" {
+			return anchor + "**" + text + "**"
+		}
+		return anchor
+	}
+	return anchor + c.blocks(n)
+}
+
+// list converts a ul or ol element, indenting nested content under its item
+func (c *mdConverter) list(n *html.Node) string {
+	var items []string
+	number := 1
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		content := c.blocks(li)
+		lines := strings.Split(content, "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] != "" {
+				lines[i] = strings.Repeat(" ", len(marker)) + lines[i]
+			}
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table converts a table to a pipe table, its first row being the header
+func (c *mdConverter) table(n *html.Node) string {
+	var rows [][]string
+	columns := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.DataAtom == atom.Table {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				walk(child)
+				continue
+			}
+			var row []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					text := strings.ReplaceAll(cleanInline(c.inlineChildren(cell)), "\n", " ")
+					row = append(row, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			columns = max(columns, len(row))
+			rows = append(rows, row)
+		}
+	}
+	walk(n)
+	if columns == 0 {
+		return ""
+	}
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inline converts an inline node
+func (c *mdConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return mdEscaper.Replace(spacesRE.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if mdSkipped[n.DataAtom] {
+		return ""
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		return mdLineBreak
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" {
+			return ""
+		}
+		return fmt.Sprintf("![%s](%s)", strings.ReplaceAll(attr(n, "alt"), "]", `\]`), c.resolve(src))
+	case atom.A:
+		text := c.inlineChildren(n)
+		anchor := ""
+		if name := attr(n, "name") + attr(n, "id"); name != "" {
+			anchor = fmt.Sprintf(`<a id="%s"></a>`, html.EscapeString(name))
+		}
+		href := attr(n, "href")
+		if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") || strings.TrimSpace(text) == "" {
+			return anchor + text
+		}
+		return anchor + "[" + strings.TrimSpace(text) + "](" + c.resolve(href) + ")"
+	case atom.Strong, atom.B:
+		return wrapInline("**", c.inlineChildren(n))
+	case atom.Em, atom.I:
+		return wrapInline("*", c.inlineChildren(n))
+	case atom.Code, atom.Tt, atom.Kbd, atom.Samp:
+		return wrapInline("`", strings.ReplaceAll(textContent(n), "`", ""))
+	}
+	return c.inlineChildren(n)
+}
+
+func (c *mdConverter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.inline(child))
+	}
+	return b.String()
+}
+
+// wrapInline wraps text in marker, keeping surrounding spaces outside
+func wrapInline(marker, text string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// cleanInline collapses whitespace and turns line break marks into hard
+// line breaks
+func cleanInline(s string) string {
+	s = spacesRE.ReplaceAllString(s, " ")
+	lines := strings.Split(s, mdLineBreak)
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.TrimSpace(strings.Join(lines, "  \n"))
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
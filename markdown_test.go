@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExportMarkdown(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Format: formatMarkdown}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Getting started"><param name="Local" value="test1.htm"></OBJECT>
+<UL><LI><OBJECT type="text/sitemap"><param name="Name" value="&Uuml;ber: Nested"><param name="Local" value="sub/test4.htm#x"></OBJECT></UL>
+</UL>`), 0644)
+	os.WriteFile(opts.ContentPath()+"/test1.htm", []byte(`<html><head><title>Start</title><script>x()</script></head><body>
+<p>See <a href="SUB/test4.htm#x">the <b>nested</b> page</a>.<br>Next   line</p>
+<ul><li>One<ul><li>Two</li></ul></li></ul>
+<table><tr><th>A</th><th>B</th></tr><tr><td>1 | 2</td></tr></table>
+<pre>a *b*</pre>
+</body></html>`), 0644)
+
+	if err := opts.Export(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile("tmp/Sample/Getting-started.md")
+	Test{string(b), "# Start\n\n" +
+		"See [the **nested** page](Getting-started/%C3%9Cber-Nested.md#x).  \nNext line\n\n" +
+		"- One\n  - Two\n\n" +
+		"| A | B |\n| --- | --- |\n| 1 \\| 2 |  |\n\n" +
+		"```\na *b*\n```\n"}.Compare(t)
+	_, err := os.Stat("tmp/Sample/Getting-started/Über-Nested.md")
+	Test{err, nil}.Compare(t)
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	for _, test := range []struct{ in, out string }{
+		{`<h2 id="top">Title <i>here</i></h2>`, `## <a id="top"></a>Title *here*`},
+		{`<p><a name="x"></a>Use <code>f(*p)</code></p>`, "<a id=\"x\"></a>Use `f(*p)`"},
+		{`<ol><li><p>First</p><p>more</p></li><li>Second</li></ol>`, "1. First\n\n   more\n2. Second"},
+		{`<blockquote>Quote<p>Two</p></blockquote>`, "> Quote\n>\n> Two"},
+		{`<p>2 * 3 = <img src="six.gif" alt="six"></p>`, `2 \* 3 = ![six](six.gif)`},
+	} {
+		md, _ := (&Options{}).pageMarkdown([]byte(test.in), "page.htm", "page.md", nil)
+		Test{md, test.out + "\n"}.Compare(t)
+	}
+}
@@ -0,0 +1,9 @@
+package main
+
+// defaultMemoryLimit is the default -memory-limit, in MiB
+const defaultMemoryLimit = 256
+
+// memoryLimit returns -memory-limit in bytes, 0 meaning no limit
+func (opts *Options) memoryLimit() int64 {
+	return max(opts.MemoryLimit, 0) << 20
+}
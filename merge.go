@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// mergeObjectRE matches the sitemap objects pulling in the table of
+	// contents or index of another CHM, e.g. child.chm::/child.hhc
+	mergeObjectRE = regexp.MustCompile(`(?is)<object[^>]*>\s*<param\s+name=["']?Merge["']?\s+value=["']?([^"'>]+)["']?\s*/?>\s*</object\s*>`)
+	// chmLinkRE matches links into a CHM file, in any of the forms the HTML
+	// Help viewer understands
+	chmLinkRE   = regexp.MustCompile(`(?i)^(?:(?:ms-its|its|mk:@msitstore):)?(.*?\.chm)::(/?[^#?]*)(.*)$`)
+	sitemapULRE = regexp.MustCompile(`(?is)<ul\b.*</ul\s*>`)
+)
+
+// maxMergeDepth bounds how deep child CHMs may merge further CHMs
+const maxMergeDepth = 8
+
+// mergedCHM is a child CHM extracted into a directory of the content path
+type mergedCHM struct {
+	file     string // file name of the CHM
+	dir      string // relative to the content path
+	sitemaps map[string]bool
+}
+
+// MergeChildren follows the Merge references of the .hhc and .hhk files,
+// which make a master CHM show the contents and index of child CHMs. Every
+// child found beside the source is extracted into a directory named after
+// it and its sitemap is inlined where it was referenced, so that the docset
+// holds the complete set. Children that are not found are reported.
+func (opts *Options) MergeChildren() error {
+	basePath := opts.ContentPath()
+	if opts.mergedCHMs == nil {
+		// The sources of a combined docset are there already
+		opts.mergedCHMs = map[string]*mergedCHM{
+			strings.ToLower(filepath.Base(opts.SourcePath)): {file: filepath.Base(opts.SourcePath)},
+		}
+	}
+	// Found before any child is extracted, which may sort first
+	masters := map[string]string{}
+	for _, ext := range []string{".hhc", ".hhk"} {
+		if master := findFileByExt(basePath, ext); master != "" {
+			masters[ext] = master
+		}
+	}
+	for _, ext := range []string{".hhc", ".hhk"} {
+		master := masters[ext]
+		if master == "" {
+			continue
+		}
+		b, err := os.ReadFile(master)
+		if err != nil {
+			return err
+		}
+		merged, changed, err := opts.inlineMerges(b, 0)
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := os.WriteFile(master, merged, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The sitemaps of children become part of the master's: those not
+	// referenced are appended to it, so that they are not taken for the
+	// master's own
+	for name, child := range opts.mergedCHMs {
+		if child == nil || child.dir == "" {
+			continue
+		}
+		for _, ext := range []string{".hhc", ".hhk"} {
+			for {
+				sitemap := findFileByExt(filepath.Join(basePath, child.dir), ext)
+				if sitemap == "" {
+					break
+				}
+				rel, err := filepath.Rel(basePath, sitemap)
+				if err != nil {
+					return err
+				}
+				if !child.sitemaps[filepath.ToSlash(rel)] && masters[ext] != "" {
+					if err := opts.appendSitemap(masters[ext], sitemap, child.dir); err != nil {
+						return err
+					}
+				}
+				if err := os.Remove(sitemap); err != nil {
+					return err
+				}
+			}
+		}
+		log.Printf("Merged %s into %s/", name, child.dir)
+	}
+	return nil
+}
+
+// appendSitemap appends the entries of the sitemap of a merged CHM in dir
+// to the sitemap at master
+func (opts *Options) appendSitemap(master, sitemap, dir string) error {
+	b, err := os.ReadFile(sitemap)
+	if err != nil {
+		return err
+	}
+	list := sitemapULRE.Find(b)
+	if list == nil {
+		return nil
+	}
+	f, err := os.OpenFile(master, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append([]byte("\n"), opts.rebaseLocals(list, dir)...))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// merged reports whether a child CHM was merged into the source
+func (opts *Options) merged() bool {
+	for _, child := range opts.mergedCHMs {
+		if child != nil && child.dir != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineMerges replaces the Merge objects of a sitemap by the sitemaps they
+// name, extracting child CHMs as needed
+func (opts *Options) inlineMerges(b []byte, depth int) ([]byte, bool, error) {
+	var out bytes.Buffer
+	last := 0
+	for _, m := range mergeObjectRE.FindAllSubmatchIndex(b, -1) {
+		ref := html.UnescapeString(string(b[m[2]:m[3]]))
+		sitemap, err := opts.mergedSitemap(ref, depth)
+		if err != nil {
+			return nil, false, err
+		}
+		out.Write(b[last:m[0]])
+		out.Write(sitemap)
+		last = m[1]
+	}
+	if last == 0 {
+		return b, false, nil
+	}
+	out.Write(b[last:])
+	return out.Bytes(), true, nil
+}
+
+// mergedSitemap returns the entries of the sitemap a Merge reference names,
+// with their Local values rebased onto the directory of its CHM, or nothing
+// if the CHM is not found
+func (opts *Options) mergedSitemap(ref string, depth int) ([]byte, error) {
+	m := chmLinkRE.FindStringSubmatch(strings.TrimSpace(ref))
+	if m == nil {
+		opts.warnf("ignoring Merge reference %q", ref)
+		return nil, nil
+	}
+	child, err := opts.mergeCHM(m[1])
+	if child == nil || child.dir == "" || err != nil {
+		// A master merging its own sitemap adds nothing
+		return nil, err
+	}
+	rel := path.Join(child.dir, strings.TrimPrefix(strings.ReplaceAll(m[2], `\`, "/"), "/"))
+	found := opts.findContentFile(rel)
+	if found == "" {
+		opts.warnf("%s: the merged sitemap %s is missing", m[1], m[2])
+		return nil, nil
+	}
+	b, err := os.ReadFile(filepath.Join(opts.ContentPath(), filepath.FromSlash(found)))
+	if err != nil {
+		return nil, err
+	}
+	child.sitemaps[found] = true
+
+	list := sitemapULRE.Find(b)
+	if depth < maxMergeDepth {
+		if list, _, err = opts.inlineMerges(list, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return opts.rebaseLocals(list, child.dir), nil
+}
+
+// mergeCHM extracts the child CHM named by a Merge reference, once, and
+// returns where it went, or nil if it is not found beside the source
+func (opts *Options) mergeCHM(name string) (*mergedCHM, error) {
+	base := path.Base(strings.ReplaceAll(name, `\`, "/"))
+	key := strings.ToLower(base)
+	if child, ok := opts.mergedCHMs[key]; ok {
+		return child, nil
+	}
+	source := findPage(filepath.Dir(opts.SourcePath), base)
+	if source == "" {
+		opts.warnf("the merged CHM %s is not beside %s", base, filepath.Base(opts.SourcePath))
+		opts.mergedCHMs[key] = nil
+		return nil, nil
+	}
+	child := &mergedCHM{file: source, dir: strings.TrimSuffix(source, filepath.Ext(source)), sitemaps: map[string]bool{}}
+	source = filepath.Join(filepath.Dir(opts.SourcePath), source)
+	if err := opts.extractFile(source, filepath.Join(opts.ContentPath(), child.dir)); err != nil {
+		return nil, err
+	}
+	opts.mergedCHMs[key] = child
+	opts.reportDir(source, child.dir)
+	// Files extracted since the content files were listed
+	if opts.contentFiles != nil {
+		if err := opts.indexContentFiles(); err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+// rebaseLocals prefixes the Local values of a sitemap with dir, following
+// links into other merged CHMs
+func (opts *Options) rebaseLocals(b []byte, dir string) []byte {
+	var out bytes.Buffer
+	last := 0
+	for _, m := range paramLocalRE.FindAllSubmatchIndex(b, -1) {
+		local := html.UnescapeString(string(b[m[2]:m[3]]))
+		if target, ok := opts.mergedLink(local); ok {
+			local = target
+		} else if !schemeRE.MatchString(local) {
+			local = path.Join(dir, strings.TrimPrefix(strings.ReplaceAll(local, `\`, "/"), "/"))
+		}
+		out.Write(b[last:m[2]])
+		out.WriteString(html.EscapeString(local))
+		last = m[3]
+	}
+	out.Write(b[last:])
+	return out.Bytes()
+}
+
+// mergedLink returns the content path, with its fragment, of a link into
+// the source or a merged CHM, such as ms-its:child.chm::/topic.htm
+func (opts *Options) mergedLink(link string) (string, bool) {
+	m := chmLinkRE.FindStringSubmatch(link)
+	if m == nil {
+		return "", false
+	}
+	child := opts.mergedCHMs[strings.ToLower(path.Base(strings.ReplaceAll(m[1], `\`, "/")))]
+	if child == nil {
+		return "", false
+	}
+	return path.Join(child.dir, strings.TrimPrefix(m[2], "/")) + m[3], true
+}
+
+// MergeLinks returns the rewrite turning links into the source or merged
+// CHMs into relative links, or nil if no CHM was merged
+func (opts *Options) MergeLinks() (pageRewrite, error) {
+	if !opts.merged() {
+		return nil, nil
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		var out bytes.Buffer
+		last := 0
+		for _, m := range linkRE.FindAllSubmatchIndex(b, -1) {
+			for g := 2; g < len(m); g += 2 {
+				if m[g] < 0 {
+					continue
+				}
+				target, ok := opts.mergedLink(html.UnescapeString(string(b[m[g]:m[g+1]])))
+				if ok {
+					page, fragment := stripFragment(target), target[len(stripFragment(target)):]
+					if found := opts.findContentFile(page); found != "" {
+						page = found
+					}
+					out.Write(b[last:m[g]])
+					out.WriteString(html.EscapeString(escapeLink(relativeLink(rel, page)) + fragment))
+					last = m[g+1]
+				}
+				break
+			}
+		}
+		if last == 0 {
+			return b, false
+		}
+		out.Write(b[last:])
+		return out.Bytes(), true
+	}, nil
+}
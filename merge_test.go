@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMergedLink(t *testing.T) {
+	opts := &Options{mergedCHMs: map[string]*mergedCHM{
+		"master.chm": {dir: ""},
+		"child.chm":  {dir: "Child"},
+		"gone.chm":   nil,
+	}}
+	for _, test := range []struct {
+		link, target string
+		ok           bool
+	}{
+		{"ms-its:child.chm::/topics/a.htm#x", "Child/topics/a.htm#x", true},
+		{"mk:@MSITStore:C:\\Help\\CHILD.CHM::/a.htm", "Child/a.htm", true},
+		{"its:master.chm::b.htm", "b.htm", true},
+		{"child.chm::/a.htm", "Child/a.htm", true},
+		{"ms-its:gone.chm::/a.htm", "", false},
+		{"a.htm", "", false},
+	} {
+		target, ok := opts.mergedLink(test.link)
+		Test{target, test.target}.Compare(t)
+		Test{ok, test.ok}.Compare(t)
+	}
+}
+
+func TestMergeChildren(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "_fixtures/merged/master.chm", Outdir: "tmp/master.docset"}
+	Test{runBuilds([]*Options{opts}, 1), nil}.Compare(t)
+
+	content := opts.ContentPath()
+	_, err := os.Stat(content + "/Child/topics/open.htm")
+	Test{err, nil}.Compare(t)
+	for _, sitemap := range []string{"/Child/child.hhc", "/Child/child.hhk"} {
+		_, err = os.Stat(content + sitemap)
+		Test{os.IsNotExist(err), true}.Compare(t)
+	}
+	b, _ := os.ReadFile(content + "/index.htm")
+	Test{strings.Contains(string(b), `href="Child/topics/open.htm#usage"`), true}.Compare(t)
+	Test{strings.Contains(string(b), `href="mk:@MSITStore:missing.chm::/a.htm"`), true}.Compare(t)
+	b, _ = os.ReadFile(content + "/Child/topics/open.htm")
+	Test{strings.Contains(string(b), `href="../../index.htm"`), true}.Compare(t)
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	var entries string
+	db.QueryRow("SELECT group_concat(name || ' ' || path, ', ') FROM (SELECT * FROM searchIndex ORDER BY name)").Scan(&entries)
+	Test{entries, "Open Child/topics/open.htm, Suite index.htm"}.Compare(t)
+	Test{len(opts.sourceReport().Warnings), 1}.Compare(t)
+}
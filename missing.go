@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const missingStubTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s</title>
+</head>
+<body>
+<h1>%[1]s</h1>
+<p>This page is missing from the original CHM: its table of contents or
+index points at <code>%[2]s</code>, which the help file does not contain.</p>
+</body>
+</html>
+`
+
+// WriteMissingStubs writes a page saying so at every HTML page the table
+// of contents or index points at but the CHM lacks, which Dash would show
+// as a blank error, and lists them in the report
+func (opts *Options) WriteMissingStubs() error {
+	if err := opts.indexContentFiles(); err != nil {
+		return err
+	}
+	root := opts.ContentPath()
+	var sitemaps []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(p)); ext == ".hhc" || ext == ".hhk" {
+			sitemaps = append(sitemaps, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Tables of contents come first to name the stubs
+	sort.Slice(sitemaps, func(i, j int) bool {
+		hhcI, hhcJ := strings.EqualFold(filepath.Ext(sitemaps[i]), ".hhc"), strings.EqualFold(filepath.Ext(sitemaps[j]), ".hhc")
+		if hhcI != hhcJ {
+			return hhcI
+		}
+		return sitemaps[i] < sitemaps[j]
+	})
+
+	// Missing pages by lower-cased path, named after their first entry
+	titles := map[string]string{}
+	var missing []string
+	for _, p := range sitemaps {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+			for _, local := range append([]string{item.Local}, item.More...) {
+				page := opts.missingPage(local)
+				if page == "" {
+					continue
+				}
+				if _, ok := titles[strings.ToLower(page)]; !ok {
+					titles[strings.ToLower(page)] = item.Name
+					missing = append(missing, page)
+				}
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+
+	for _, page := range missing {
+		p := filepath.Join(root, filepath.FromSlash(page))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		stub := fmt.Sprintf(missingStubTemplate, html.EscapeString(titles[strings.ToLower(page)]), html.EscapeString(page))
+		if err := os.WriteFile(p, []byte(stub), 0644); err != nil {
+			return err
+		}
+		opts.contentFiles.Add(page, page)
+		opts.warnf("%s is listed in the table of contents or index but missing from the CHM", page)
+	}
+	if src := opts.sourceReport(); src != nil {
+		opts.report.mu.Lock()
+		src.Missing = append(src.Missing, missing...)
+		opts.report.mu.Unlock()
+	}
+	log.Printf("Wrote %d stubs for pages missing from the CHM", len(missing))
+	return nil
+}
+
+// missingPage returns the content path of the HTML page a sitemap Local
+// value names if it does not exist, or "" if it exists or is not a page of
+// this CHM
+func (opts *Options) missingPage(local string) string {
+	if local == "" || chmLinkRE.MatchString(local) {
+		return ""
+	}
+	base, _, ok := opts.resolveLocal(local)
+	if ok {
+		return ""
+	}
+	page, ok := resolveLink("", base)
+	if !ok || page == "" || !isHTMLFile(page) {
+		return ""
+	}
+	return page
+}
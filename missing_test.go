@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteMissingStubs(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	opts.report = opts.newReport()
+	content := opts.ContentPath()
+	os.WriteFile(content+"/A.htm", []byte("<title>A</title>"), 0644)
+	os.WriteFile(content+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="A"><param name="Local" value="a.htm"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Gone &amp; lost"><param name="Local" value="Sub/Gone.htm#x"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Web"><param name="Local" value="http://example.com/y.htm"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Child"><param name="Local" value="child.chm::/z.htm"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Manual"><param name="Local" value="manual.pdf"></OBJECT>
+</UL>`), 0644)
+	os.WriteFile(content+"/index.hhk", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Gone"><param name="Local" value="sub/gone.htm"><param name="Local" value="other.htm"></OBJECT>
+</UL>`), 0644)
+
+	Test{opts.WriteMissingStubs(), nil}.Compare(t)
+	Test{opts.sourceReport().Missing, []string{"Sub/Gone.htm", "other.htm"}}.DeepEqual(t)
+	b, _ := os.ReadFile(content + "/Sub/Gone.htm")
+	Test{strings.Contains(string(b), "<title>Gone &amp; lost</title>"), true}.Compare(t)
+	Test{strings.Contains(string(b), "<code>Sub/Gone.htm</code>"), true}.Compare(t)
+	b, _ = os.ReadFile(content + "/other.htm")
+	Test{strings.Contains(string(b), "<title>Gone</title>"), true}.Compare(t)
+	Test{opts.sitemapPath("sub/gone.htm#x"), "Sub/Gone.htm#x"}.Compare(t)
+	_, err := os.Stat(content + "/manual.pdf")
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
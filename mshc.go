@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	metaTagRE  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrRE = regexp.MustCompile(`(?is)\b(name|content)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	// xhelpLinkRE matches the links between topics of Help Viewer packages,
+	// e.g. ms-xhelp:///?Id=T:System.String
+	xhelpLinkRE = regexp.MustCompile(`(?i)^ms-xhelp:`)
+)
+
+// isMSHCFile reports whether a source is a Microsoft Help Viewer package,
+// a zip archive of topics whose table of contents and keywords are kept in
+// meta tags of the topics
+func isMSHCFile(source string) bool {
+	return strings.EqualFold(filepath.Ext(source), ".mshc")
+}
+
+// zipExtractor unpacks the zip archives of Help Viewer packages
+type zipExtractor struct{}
+
+func (e zipExtractor) Extract(ctx context.Context, source, destination string) error {
+	return e.ExtractFiltered(ctx, source, destination, nil)
+}
+
+func (zipExtractor) ExtractFiltered(ctx context.Context, source, destination string, keep func(name string) bool) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	n := 0
+	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(strings.ReplaceAll(f.Name, `\`, "/"), "/")
+		if f.FileInfo().IsDir() || keep != nil && !keep(name) {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("extracting %s: %s is outside the package", source, f.Name)
+		}
+		if err := extractZipFile(f, filepath.Join(destination, filepath.FromSlash(name))); err != nil {
+			return fmt.Errorf("extracting %s: %w", source, err)
+		}
+		n++
+	}
+	log.Printf("Extracted %d files from %s", n, source)
+	return nil
+}
+
+func extractZipFile(f *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// helpTopic is the Help Viewer metadata of a page
+type helpTopic struct {
+	page     string
+	id       string
+	title    string
+	parent   string
+	order    int
+	keywords []string
+}
+
+// readHelpTopic reads the Microsoft.Help meta tags of a page
+func readHelpTopic(page string, b []byte) helpTopic {
+	topic := helpTopic{page: page}
+	for _, tag := range metaTagRE.FindAll(b, -1) {
+		var name, content string
+		for _, m := range metaAttrRE.FindAllSubmatch(tag, -1) {
+			value := html.UnescapeString(string(m[2]) + string(m[3]) + string(m[4]))
+			if strings.EqualFold(string(m[1]), "name") {
+				name = value
+			} else {
+				content = strings.TrimSpace(value)
+			}
+		}
+		switch strings.ToLower(name) {
+		case "microsoft.help.id":
+			topic.id = content
+		case "title":
+			topic.title = content
+		case "microsoft.help.tocparent":
+			topic.parent = content
+		case "microsoft.help.tocorder":
+			topic.order, _ = strconv.Atoi(content)
+		case "microsoft.help.keywords":
+			if content != "" {
+				topic.keywords = append(topic.keywords, content)
+			}
+		}
+	}
+	if topic.title == "" {
+		if m := titleRE.FindSubmatch(b); m != nil {
+			topic.title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+		}
+	}
+	return topic
+}
+
+// ConvertMSHC writes the table of contents and keyword index of a Help
+// Viewer package, kept in the meta tags of its topics, as HHC and HHK
+// sitemaps to be indexed like those of a CHM, and records the topic ids
+// that MSHCLinks turns links into pages by
+func (opts *Options) ConvertMSHC() error {
+	if !isMSHCFile(opts.SourcePath) || opts.combined() {
+		return nil
+	}
+	root := opts.ContentPath()
+	var topics []helpTopic
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(p) {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if topic := readHelpTopic(filepath.ToSlash(rel), b); topic.id != "" {
+			topics = append(topics, topic)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	opts.helpIDs = map[string]string{}
+	children := map[string][]helpTopic{}
+	for _, topic := range topics {
+		key := strings.ToLower(topic.id)
+		if _, ok := opts.helpIDs[key]; !ok {
+			opts.helpIDs[key] = topic.page
+		}
+		if topic.parent != "" {
+			children[strings.ToLower(topic.parent)] = append(children[strings.ToLower(topic.parent)], topic)
+		}
+	}
+	for _, list := range children {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].order != list[j].order {
+				return list[i].order < list[j].order
+			}
+			return list[i].page < list[j].page
+		})
+	}
+
+	var toc bytes.Buffer
+	// Root topics name -1 as their parent
+	roots := children["-1"]
+	var writeTOC func(list []helpTopic, indent string, seen map[string]bool)
+	writeTOC = func(list []helpTopic, indent string, seen map[string]bool) {
+		for _, topic := range list {
+			key := strings.ToLower(topic.id)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			writeSitemapItem(&toc, indent, topic.title, topic.page)
+			if sub := children[key]; len(sub) > 0 {
+				toc.WriteString(indent + "<UL>\n")
+				writeTOC(sub, indent+"\t", seen)
+				toc.WriteString(indent + "</UL>\n")
+			}
+		}
+	}
+	writeTOC(roots, "", map[string]bool{})
+	if len(roots) > 0 && opts.defaultTopic == "" {
+		opts.defaultTopic = roots[0].page
+	}
+
+	// Keywords with every page they lead to, in order of appearance
+	pages := map[string][]string{}
+	var keywords []string
+	for _, topic := range topics {
+		for _, keyword := range topic.keywords {
+			if _, ok := pages[keyword]; !ok {
+				keywords = append(keywords, keyword)
+			}
+			pages[keyword] = append(pages[keyword], topic.page)
+		}
+	}
+	sort.Strings(keywords)
+	var index bytes.Buffer
+	for _, keyword := range keywords {
+		writeSitemapItem(&index, "", keyword, pages[keyword]...)
+	}
+
+	if err := writeSitemaps(filepath.Join(root, opts.Basename()), toc.Bytes(), index.Bytes()); err != nil {
+		return err
+	}
+	log.Printf("Read the Help Viewer metadata of %d topics, %d keywords", len(topics), len(keywords))
+	return nil
+}
+
+// xhelpTarget returns the page and fragment an ms-xhelp link points at
+func (opts *Options) xhelpTarget(link string) (string, string, bool) {
+	if !xhelpLinkRE.MatchString(link) {
+		return "", "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", false
+	}
+	for key, values := range u.Query() {
+		if !strings.EqualFold(key, "id") || len(values) == 0 {
+			continue
+		}
+		page, ok := opts.helpIDs[strings.ToLower(values[0])]
+		if !ok {
+			return "", "", false
+		}
+		fragment := ""
+		if u.Fragment != "" {
+			fragment = "#" + u.Fragment
+		}
+		return page, fragment, true
+	}
+	return "", "", false
+}
+
+// MSHCLinks returns the rewrite turning the ms-xhelp links between topics
+// of a Help Viewer package into relative links, or nil for other sources
+func (opts *Options) MSHCLinks() (pageRewrite, error) {
+	if len(opts.helpIDs) == 0 {
+		return nil, nil
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		var out bytes.Buffer
+		last := 0
+		for _, m := range linkRE.FindAllSubmatchIndex(b, -1) {
+			for g := 2; g < len(m); g += 2 {
+				if m[g] < 0 {
+					continue
+				}
+				page, fragment, ok := opts.xhelpTarget(html.UnescapeString(string(b[m[g]:m[g+1]])))
+				if ok {
+					if found := opts.findContentFile(page); found != "" {
+						page = found
+					}
+					out.Write(b[last:m[g]])
+					out.WriteString(html.EscapeString(escapeLink(relativeLink(rel, page)) + fragment))
+					last = m[g+1]
+				}
+				break
+			}
+		}
+		if last == 0 {
+			return b, false
+		}
+		out.Write(b[last:])
+		return out.Bytes(), true
+	}, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+// writeMSHC writes a Help Viewer package holding files
+func writeMSHC(path string, files map[string]string) {
+	f, _ := os.Create(path)
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, _ := w.Create(name)
+		fw.Write([]byte(content))
+	}
+	w.Close()
+	f.Close()
+}
+
+func helpPage(id, title, parent, order string, keywords ...string) string {
+	meta := `<meta name="Microsoft.Help.Id" content="` + id + `" />
+<meta name="Title" content="` + title + `" />
+<meta name="Microsoft.Help.TocParent" content="` + parent + `" />
+<meta name="Microsoft.Help.TocOrder" content="` + order + `" />
+`
+	for _, k := range keywords {
+		meta += `<meta name="Microsoft.Help.Keywords" content="` + k + `" />` + "\n"
+	}
+	return "<html><head>" + meta + "</head><body><h1>" + title + "</h1></body></html>"
+}
+
+func TestReadHelpTopic(t *testing.T) {
+	topic := readHelpTopic("html/a.htm", []byte(helpPage("T:Foo", "Foo &amp; Bar", "-1", "2", "Foo class", "Bar")))
+	Test{topic, helpTopic{page: "html/a.htm", id: "T:Foo", title: "Foo & Bar", parent: "-1", order: 2, keywords: []string{"Foo class", "Bar"}}}.DeepEqual(t)
+
+	topic = readHelpTopic("b.htm", []byte(`<html><head><title>From title</title><meta content='X' name='Microsoft.Help.Id'></head></html>`))
+	Test{topic, helpTopic{page: "b.htm", id: "X", title: "From title"}}.DeepEqual(t)
+}
+
+func TestConvertMSHC(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	writeMSHC("tmp/lib.mshc", map[string]string{
+		"html/root.htm":   helpPage("root", "Library", "-1", "0"),
+		"html/second.htm": helpPage("second", "Second", "root", "1", "Widget"),
+		"html/first.htm": strings.Replace(helpPage("first", "First", "root", "0", "Widget", "Gadget"),
+			"<body>", `<body><a href="ms-xhelp:///?Id=second#usage">Second</a><a href="ms-xhelp:///?method=page&amp;id=nowhere">Gone</a>`, 1),
+		"styles/help.css": "body {}",
+		"lib.msha":        "<html></html>",
+	})
+	opts := &Options{SourcePath: "tmp/lib.mshc", Outdir: "tmp/out"}
+	Test{opts.Convert(nil), nil}.Compare(t)
+
+	content := opts.ContentPath()
+	_, err := os.Stat(content + "/styles/help.css")
+	Test{err, nil}.Compare(t)
+	b, _ := os.ReadFile(content + "/lib.hhc")
+	var toc [][]string
+	for _, item := range parseSitemap(string(b)) {
+		toc = append(toc, append([]string{item.Name, item.Local}, item.Parents...))
+	}
+	Test{toc, [][]string{
+		{"Library", "html/root.htm"},
+		{"First", "html/first.htm", "Library"},
+		{"Second", "html/second.htm", "Library"},
+	}}.DeepEqual(t)
+	Test{opts.IndexFilePath(), "html/root.htm"}.Compare(t)
+
+	b, _ = os.ReadFile(content + "/html/first.htm")
+	Test{strings.Contains(string(b), `<a href="second.htm#usage">Second</a>`), true}.Compare(t)
+	Test{strings.Contains(string(b), `href="ms-xhelp:///?method=page&amp;id=nowhere"`), true}.Compare(t)
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	var entries string
+	db.QueryRow("SELECT group_concat(name || ' ' || path, ', ') FROM (SELECT * FROM searchIndex ORDER BY name, path)").Scan(&entries)
+	Test{entries, "Gadget html/first.htm, Widget html/first.htm, Widget html/second.htm"}.Compare(t)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	bodyOpenRE  = regexp.MustCompile(`(?i)<body\b[^>]*>`)
+	bodyCloseRE = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+// tocEntry is an entry of the table of contents. Entries without a page
+// are folders.
+type tocEntry struct {
+	Name     string
+	Page     string
+	Fragment string
+	Parent   *tocEntry
+	// Prev and Next are the neighbouring entries with a page
+	Prev, Next *tocEntry
+}
+
+// Up returns the closest enclosing entry with a page
+func (e *tocEntry) Up() *tocEntry {
+	for p := e.Parent; p != nil; p = p.Parent {
+		if p.Page != "" {
+			return p
+		}
+	}
+	return nil
+}
+
+// tableOfContents reads the HHC file and returns the first entry of every
+// page by content path, or nil if there is no HHC file
+func (opts *Options) tableOfContents() (map[string]*tocEntry, error) {
+	hhcPath := findFileByExt(opts.ContentPath(), ".hhc")
+	if hhcPath == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(hhcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := map[string]*tocEntry{}
+	var stack []*tocEntry
+	var prev *tocEntry
+	for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+		e := &tocEntry{Name: item.Name}
+		level := min(len(item.Parents), len(stack))
+		if level > 0 {
+			e.Parent = stack[level-1]
+		}
+		stack = append(stack[:level], e)
+		if item.Local == "" {
+			continue
+		}
+		page, fragment, ok := opts.resolveLocal(item.Local)
+		if !ok {
+			continue
+		}
+		e.Page, e.Fragment = page, fragment
+		if _, ok := pages[page]; ok {
+			continue
+		}
+		pages[page] = e
+		if prev != nil {
+			prev.Next, e.Prev = e, prev
+		}
+		prev = e
+	}
+	return pages, nil
+}
+
+// Navigation returns the rewrite adding previous, up and next links in
+// table of contents order to the top and bottom of every page, or nil
+// without -nav or a table of contents
+func (opts *Options) Navigation() (pageRewrite, error) {
+	if !opts.Nav {
+		return nil, nil
+	}
+	toc, err := opts.tableOfContents()
+	if err != nil || len(toc) == 0 {
+		return nil, err
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		e, ok := toc[rel]
+		if !ok {
+			return b, false
+		}
+		var links []string
+		for _, link := range []struct {
+			rel, label string
+			target     *tocEntry
+		}{
+			{"prev", "Previous", e.Prev},
+			{"up", "Up", e.Up()},
+			{"next", "Next", e.Next},
+		} {
+			if link.target != nil {
+				links = append(links, fmt.Sprintf(`<a rel="%s" href="%s" title="%s">%s</a>`,
+					link.rel, tocLink(rel, link.target), asciiHTML(link.target.Name), link.label))
+			}
+		}
+		if len(links) == 0 {
+			return b, false
+		}
+		bar := `<div class="chm2docset-nav">` + strings.Join(links, " | ") + `</div>`
+		return insertInBody(b, bar, bar), true
+	}, nil
+}
+
+// tocLink returns the link from page to a table of contents entry
+func tocLink(page string, e *tocEntry) string {
+	return html.EscapeString(escapeLink(relativeLink(page, e.Page)) + e.Fragment)
+}
+
+// insertInBody inserts top after the <body> tag of a page and bottom before
+// its </body> tag, or at the start and end of a page without them
+func insertInBody(b []byte, top, bottom string) []byte {
+	start, end := 0, len(b)
+	if loc := bodyOpenRE.FindIndex(b); loc != nil {
+		start = loc[1]
+	}
+	if bottom != "" {
+		if locs := bodyCloseRE.FindAllIndex(b[start:], -1); len(locs) > 0 {
+			end = start + locs[len(locs)-1][0]
+		}
+	}
+	var out bytes.Buffer
+	out.Write(b[:start])
+	out.WriteString(top)
+	out.Write(b[start:end])
+	out.WriteString(bottom)
+	out.Write(b[end:])
+	return out.Bytes()
+}
+
+// asciiHTML escapes s for HTML using character references for non-ASCII
+// characters, so that it can be inserted into a page of any charset
+func asciiHTML(s string) string {
+	var out strings.Builder
+	for _, r := range html.EscapeString(s) {
+		if r < 0x80 {
+			out.WriteRune(r)
+		} else {
+			fmt.Fprintf(&out, "&#%d;", r)
+		}
+	}
+	return out.String()
+}
+
+// Breadcrumbs returns the rewrite adding a trail of the enclosing table of
+// contents entries to the top of every page, or nil without -breadcrumbs or
+// a table of contents. Entries with a page are linked; folders are not.
+func (opts *Options) Breadcrumbs() (pageRewrite, error) {
+	if !opts.BreadcrumbBar {
+		return nil, nil
+	}
+	toc, err := opts.tableOfContents()
+	if err != nil || len(toc) == 0 {
+		return nil, err
+	}
+	var home *tocEntry
+	for _, e := range toc {
+		if e.Prev == nil {
+			home = e
+		}
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		e, ok := toc[rel]
+		if !ok {
+			return b, false
+		}
+		var trail []*tocEntry
+		for p := e.Parent; p != nil; p = p.Parent {
+			trail = append([]*tocEntry{p}, trail...)
+		}
+		var crumbs []string
+		if home != e && (len(trail) == 0 || trail[0] != home) {
+			crumbs = append(crumbs, fmt.Sprintf(`<a href="%s">Home</a>`, tocLink(rel, home)))
+		}
+		for _, p := range trail {
+			if p.Page == "" {
+				crumbs = append(crumbs, asciiHTML(p.Name))
+			} else {
+				crumbs = append(crumbs, fmt.Sprintf(`<a href="%s">%s</a>`, tocLink(rel, p), asciiHTML(p.Name)))
+			}
+		}
+		if len(crumbs) == 0 {
+			return b, false
+		}
+		crumbs = append(crumbs, asciiHTML(e.Name))
+		bar := `<div class="chm2docset-breadcrumbs">` + strings.Join(crumbs, " &#9656; ") + `</div>`
+		return insertInBody(b, bar, ""), true
+	}, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+const navTestTOC = `<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Intro"><param name="Local" value="intro.htm"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Reference"></OBJECT>
+<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Classes"><param name="Local" value="ref/classes.htm"></OBJECT>
+<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="TForm"><param name="Local" value="ref/TForm.htm#top"></OBJECT>
+</UL>
+</UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="&Uuml;ber"><param name="Local" value="about.htm"></OBJECT>
+</UL>`
+
+func writeNavTestPages(opts *Options) string {
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/ref", 0755)
+	os.WriteFile(content+"/toc.hhc", []byte(navTestTOC), 0644)
+	for _, page := range []string{"intro.htm", "ref/classes.htm", "ref/TForm.htm", "about.htm"} {
+		os.WriteFile(content+"/"+page, []byte(`<html><BODY class="x"><p>text</p></BODY></html>`), 0644)
+	}
+	return content
+}
+
+func TestTableOfContents(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	defer cleanTmp()
+	writeNavTestPages(opts)
+
+	toc, err := opts.tableOfContents()
+	Test{err, nil}.Compare(t)
+	Test{len(toc), 4}.Compare(t)
+	form := toc["ref/TForm.htm"]
+	Test{form.Fragment, "#top"}.Compare(t)
+	Test{form.Up().Name, "Classes"}.Compare(t)
+	Test{form.Parent.Parent.Name, "Reference"}.Compare(t)
+	Test{form.Prev.Name, "Classes"}.Compare(t)
+	Test{form.Next.Name, "Über"}.Compare(t)
+	Test{toc["ref/classes.htm"].Prev.Name, "Intro"}.Compare(t)
+	Test{toc["ref/classes.htm"].Up() == nil, true}.Compare(t)
+}
+
+func TestNavigation(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", Nav: true}
+	defer cleanTmp()
+	content := writeNavTestPages(opts)
+
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	bar := `<div class="chm2docset-nav"><a rel="prev" href="classes.htm" title="Classes">Previous</a> | ` +
+		`<a rel="up" href="classes.htm" title="Classes">Up</a> | ` +
+		`<a rel="next" href="../about.htm" title="&#220;ber">Next</a></div>`
+	b, _ := os.ReadFile(content + "/ref/TForm.htm")
+	Test{string(b), `<html><BODY class="x">` + bar + `<p>text</p>` + bar + `</BODY></html>`}.Compare(t)
+
+	bar = `<div class="chm2docset-nav"><a rel="next" href="ref/classes.htm" title="Classes">Next</a></div>`
+	b, _ = os.ReadFile(content + "/intro.htm")
+	Test{string(b), `<html><BODY class="x">` + bar + `<p>text</p>` + bar + `</BODY></html>`}.Compare(t)
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", BreadcrumbBar: true}
+	defer cleanTmp()
+	content := writeNavTestPages(opts)
+
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	for _, test := range []struct {
+		page, trail string
+	}{
+		{"ref/TForm.htm", `<a href="../intro.htm">Home</a> &#9656; Reference &#9656; <a href="classes.htm">Classes</a> &#9656; TForm`},
+		{"about.htm", `<a href="intro.htm">Home</a> &#9656; &#220;ber`},
+		{"intro.htm", ``},
+	} {
+		b, _ := os.ReadFile(content + "/" + test.page)
+		expected := `<html><BODY class="x"><p>text</p></BODY></html>`
+		if test.trail != "" {
+			expected = `<html><BODY class="x"><div class="chm2docset-breadcrumbs">` + test.trail + `</div><p>text</p></BODY></html>`
+		}
+		Test{string(b), expected}.Compare(t)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// pageCache holds the pages read while indexing, so that a page scanned by
+// the title scrape and the optional passes is read from disk once. Passes
+// inserting ids write through it. Pages past the limit of the cache are
+// read from disk every time.
+type pageCache struct {
+	mu    sync.Mutex
+	pages map[string][]byte
+	limit int64
+	size  int64
+}
+
+// newPageCache returns a cache holding up to limit bytes, or any number
+// for a limit of 0
+func newPageCache(limit int64) *pageCache {
+	return &pageCache{pages: map[string][]byte{}, limit: limit}
+}
+
+// ReadFile returns the content of a page. A nil cache reads from disk.
+func (c *pageCache) ReadFile(path string) ([]byte, error) {
+	if c == nil {
+		return os.ReadFile(path)
+	}
+	c.mu.Lock()
+	b, ok := c.pages[path]
+	c.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.store(path, b)
+	return b, nil
+}
+
+// WriteFile writes a page and replaces its cached content
+func (c *pageCache) WriteFile(path string, b []byte) error {
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	if c != nil {
+		c.store(path, b)
+	}
+	return nil
+}
+
+// store caches the content of a page if it fits
+func (c *pageCache) store(path string, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := c.size - int64(len(c.pages[path])) + int64(len(b))
+	if c.limit > 0 && size > c.limit {
+		c.size -= int64(len(c.pages[path]))
+		delete(c.pages, path)
+		return
+	}
+	c.pages[path], c.size = b, size
+}
+
+// pageScans returns the number of index passes reading every page
+func (opts *Options) pageScans() int {
+	basePath := opts.ContentPath()
+	mainSource := opts.mainSource(findFileByExt(basePath, ".hhk") != "", findFileByExt(basePath, ".hhc") != "")
+	n := 0
+	for _, scans := range []bool{mainSource != sourceHHC, opts.Constants, opts.Commands, opts.Equations, opts.DetectDeprecated, opts.Language != ""} {
+		if scans {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPageCache(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/page.htm", []byte("one"), 0644)
+
+	var none *pageCache
+	b, err := none.ReadFile("tmp/page.htm")
+	Test{string(b), "one"}.Compare(t)
+	Test{err, nil}.Compare(t)
+
+	c := newPageCache(0)
+	c.ReadFile("tmp/page.htm")
+	os.WriteFile("tmp/page.htm", []byte("changed on disk"), 0644)
+	b, _ = c.ReadFile("tmp/page.htm")
+	Test{string(b), "one"}.Compare(t)
+
+	c.WriteFile("tmp/page.htm", []byte("two"))
+	b, _ = c.ReadFile("tmp/page.htm")
+	Test{string(b), "two"}.Compare(t)
+	b, _ = os.ReadFile("tmp/page.htm")
+	Test{string(b), "two"}.Compare(t)
+
+	_, err = c.ReadFile("tmp/missing.htm")
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
+
+func TestPageCacheLimit(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/small.htm", []byte("small"), 0644)
+	os.WriteFile("tmp/large.htm", []byte("too large"), 0644)
+
+	c := newPageCache(8)
+	c.ReadFile("tmp/small.htm")
+	c.ReadFile("tmp/large.htm")
+	Test{len(c.pages), 1}.Compare(t)
+	Test{c.size, int64(5)}.Compare(t)
+
+	// Pages left out are read from disk again
+	os.WriteFile("tmp/large.htm", []byte("changed"), 0644)
+	b, _ := c.ReadFile("tmp/large.htm")
+	Test{string(b), "changed"}.Compare(t)
+
+	// A page growing past the limit leaves the cache
+	c.WriteFile("tmp/small.htm", []byte("now larger"))
+	Test{len(c.pages), 0}.Compare(t)
+	Test{c.size, int64(0)}.Compare(t)
+}
+
+func TestPageScans(t *testing.T) {
+	opts := &Options{Outdir: "tmp/Sample.docset"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	Test{opts.pageScans(), 1}.Compare(t)
+	opts.Constants, opts.Equations = true, true
+	Test{opts.pageScans(), 3}.Compare(t)
+}
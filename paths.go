@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"html"
+	"io/fs"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// CHM file names may legitimately contain '#' or '?'. Paths written to the
+// index and the plist escape them, and '%' itself, so that they are not
+// taken for the start of a fragment or query.
+var pathEscaper = strings.NewReplacer("%", "%25", "#", "%23", "?", "%3F")
+
+// indexPath returns the path of a content file as written to the index
+func indexPath(rel string) string {
+	return pathEscaper.Replace(rel)
+}
+
+// pageOf returns the content file an index path points at
+func pageOf(path string) string {
+	page := stripFragment(path)
+	if unescaped, err := url.PathUnescape(page); err == nil {
+		return unescaped
+	}
+	return page
+}
+
+// indexContentFiles records the files below the content directory for
+// resolveLocal
+func (opts *Options) indexContentFiles() error {
+	basePath := opts.ContentPath()
+	files := newPathMap()
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files.Add(rel, rel)
+		return nil
+	})
+	opts.contentFiles = files
+	return err
+}
+
+// resolveLocal splits a sitemap Local value into the content file it names
+// and its #fragment. A '#' belongs to the file name when a file of that name
+// exists; otherwise the first '#' starts the fragment. Renamed files are
+// followed. ok is false if no such file exists.
+func (opts *Options) resolveLocal(local string) (page, fragment string, ok bool) {
+	cuts := []int{len(local)}
+	for i := len(local) - 1; i >= 0; i-- {
+		if local[i] == '#' {
+			cuts = append(cuts, i)
+		}
+	}
+	for _, cut := range cuts {
+		candidates := []string{local[:cut]}
+		if unescaped, err := url.PathUnescape(local[:cut]); err == nil && unescaped != local[:cut] {
+			candidates = append(candidates, unescaped)
+		}
+		for _, candidate := range candidates {
+			if found := opts.findContentFile(candidate); found != "" {
+				return found, local[cut:], true
+			}
+		}
+	}
+	base := stripFragment(local)
+	return base, local[len(base):], false
+}
+
+// findContentFile returns the actual path of a content file, matched
+// case-insensitively, or "" if there is none
+func (opts *Options) findContentFile(rel string) string {
+	rel = strings.TrimPrefix(rel, "/")
+	if renamed, ok := opts.renames.Lookup(rel); ok {
+		rel = renamed
+	}
+	if opts.contentFiles == nil {
+		return findPage(opts.ContentPath(), rel)
+	}
+	found, _ := opts.contentFiles.Lookup(rel)
+	return found
+}
+
+// sitemapPath returns the index path of a sitemap Local value
+func (opts *Options) sitemapPath(local string) string {
+	page, fragment, ok := opts.resolveLocal(local)
+	if !ok {
+		return opts.mapPath(local)
+	}
+	return indexPath(page) + fragment
+}
+
+// pathPrefix returns -path-prefix as a relative directory path ending in
+// '/', or "" if it is not set
+func (opts *Options) pathPrefix() string {
+	prefix := strings.Trim(filepath.ToSlash(opts.PathPrefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// RebasePaths prepends -path-prefix to every index path, for Documents
+// served from a subdirectory of a web server. It runs last, as the other
+// steps resolve index paths against the content directory.
+func (opts *Options) RebasePaths() error {
+	prefix := opts.pathPrefix()
+	if prefix == "" {
+		return nil
+	}
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.Exec("UPDATE OR IGNORE searchIndex SET path = ? || path", indexPath(prefix))
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	log.Printf("Rebased %d index paths under %s", n, prefix)
+	return nil
+}
+
+// RootLinks returns the rewrite rebasing root-relative links of pages,
+// such as href="/topic.htm", under -path-prefix, or nil without it
+func (opts *Options) RootLinks() (pageRewrite, error) {
+	prefix := opts.pathPrefix()
+	if prefix == "" {
+		return nil, nil
+	}
+	escaped := html.EscapeString(escapeLink(prefix))
+	return func(rel string, b []byte) ([]byte, bool) {
+		var out bytes.Buffer
+		last := 0
+		for _, m := range linkRE.FindAllSubmatchIndex(b, -1) {
+			for g := 2; g < len(m); g += 2 {
+				if m[g] < 0 {
+					continue
+				}
+				link := b[m[g]:m[g+1]]
+				if bytes.HasPrefix(link, []byte("/")) && !bytes.HasPrefix(link, []byte("//")) {
+					out.Write(b[last : m[g]+1])
+					out.WriteString(escaped)
+					last = m[g] + 1
+				}
+				break
+			}
+		}
+		if last == 0 {
+			return b, false
+		}
+		out.Write(b[last:])
+		return out.Bytes(), true
+	}, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestIndexPath(t *testing.T) {
+	Test{indexPath("lang/C#.htm"), "lang/C%23.htm"}.Compare(t)
+	Test{indexPath("what?.htm"), "what%3F.htm"}.Compare(t)
+	Test{indexPath("100%.htm"), "100%25.htm"}.Compare(t)
+	Test{pageOf("lang/C%23.htm#syntax"), "lang/C#.htm"}.Compare(t)
+	Test{pageOf("100%.htm"), "100%.htm"}.Compare(t)
+}
+
+func TestResolveLocal(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/lang", 0755)
+	for _, name := range []string{"lang/C#.htm", "lang/F#.htm", "Page.htm", "my page.htm"} {
+		os.WriteFile(content+"/"+name, []byte("<html></html>"), 0644)
+	}
+	opts.indexContentFiles()
+
+	for _, test := range []struct{ local, expected string }{
+		{"lang/C#.htm", "lang/C%23.htm"},
+		{"lang/F#.htm#syntax", "lang/F%23.htm#syntax"},
+		{"lang/c%23.htm", "lang/C%23.htm"},
+		{"page.htm#top", "Page.htm#top"},
+		{"my%20page.htm", "my page.htm"},
+		{"missing.htm#x", "missing.htm#x"},
+	} {
+		Test{opts.sitemapPath(test.local), test.expected}.Compare(t)
+	}
+}
+
+func TestLowercaseHashNames(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp", LowercasePaths: true}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.WriteFile(content+"/index.htm", []byte(`<a href="C%23.htm#top">C#</a>`), 0644)
+	os.WriteFile(content+"/C#.htm", []byte(`<html></html>`), 0644)
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile(content + "/index.htm")
+	Test{string(b), `<a href="c%23.htm#top">C#</a>`}.Compare(t)
+	_, err := os.Stat(content + "/c#.htm")
+	Test{err, nil}.Compare(t)
+}
+
+func TestPathPrefix(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", PathPrefix: "/docs/v1"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	Test{opts.pathPrefix(), "docs/v1/"}.Compare(t)
+
+	content := opts.ContentPath()
+	os.WriteFile(content+"/links.htm", []byte(`<a href="/test1.htm">a</a> <img src='/img/a b.gif'> <a href="//cdn.example.com/x.js">c</a> <a href="test2.htm">d</a>`), 0644)
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile(content + "/links.htm")
+	Test{string(b), `<a href="/docs/v1/test1.htm">a</a> <img src='/docs/v1/img/a b.gif'> <a href="//cdn.example.com/x.js">c</a> <a href="test2.htm">d</a>`}.Compare(t)
+
+	opts.CreateDatabase()
+	if err := opts.RebasePaths(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	var path string
+	db.QueryRow("SELECT path FROM searchIndex WHERE path NOT LIKE 'docs/v1/%'").Scan(&path)
+	Test{path, ""}.Compare(t)
+	Test{countEntries(db) > 0, true}.Compare(t)
+}
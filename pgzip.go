@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// gzipBlockSize is the amount of input compressed by each goroutine of a
+// parallel gzip writer
+var gzipBlockSize = 1 << 20
+
+// gzipDictSize is the window of deflate, the input of the previous block a
+// block may refer back to
+const gzipDictSize = 32 << 10
+
+// parallelGzip writes a single gzip member whose blocks are compressed
+// concurrently, as pigz does: every block is a deflate stream primed with
+// the end of the previous block and ended by a sync flush, so that the
+// blocks join into one stream any gzip reader decodes. The checksum is
+// computed in order as the input is written.
+type parallelGzip struct {
+	w     io.Writer
+	level int
+	block []byte
+	dict  []byte
+	crc   uint32
+	size  uint32
+	// queue holds the results of the blocks being compressed in order; its
+	// capacity bounds the blocks held in memory
+	queue  chan chan []byte
+	done   chan struct{}
+	closed bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// newParallelGzip returns a writer compressing with up to procs goroutines
+// at the given flate level
+func newParallelGzip(w io.Writer, level, procs int) (*parallelGzip, error) {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	z := &parallelGzip{
+		w:     w,
+		level: level,
+		queue: make(chan chan []byte, max(procs, 1)),
+		done:  make(chan struct{}),
+	}
+	go z.writeBlocks()
+	return z, nil
+}
+
+// writeBlocks writes the header, then the compressed blocks in order
+func (z *parallelGzip) writeBlocks() {
+	defer close(z.done)
+	// No name or modification time, unknown OS
+	_, err := z.w.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255})
+	for result := range z.queue {
+		b := <-result
+		if err == nil {
+			_, err = z.w.Write(b)
+		}
+	}
+	z.setErr(err)
+}
+
+func (z *parallelGzip) setErr(err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.err == nil {
+		z.err = err
+	}
+}
+
+func (z *parallelGzip) getErr() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.err
+}
+
+func (z *parallelGzip) Write(p []byte) (int, error) {
+	if err := z.getErr(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		room := gzipBlockSize - len(z.block)
+		if room > len(p) {
+			room = len(p)
+		}
+		z.block = append(z.block, p[:room]...)
+		p = p[room:]
+		if len(z.block) == gzipBlockSize {
+			z.compress(false)
+		}
+	}
+	return n, nil
+}
+
+// compress queues the current block, the final one if last
+func (z *parallelGzip) compress(last bool) {
+	block, dict := z.block, z.dict
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, block)
+	z.size += uint32(len(block))
+	window := block
+	if len(block) < gzipDictSize {
+		window = append(append([]byte(nil), dict...), block...)
+	}
+	z.dict = append([]byte(nil), window[max(len(window)-gzipDictSize, 0):]...)
+	z.block = make([]byte, 0, gzipBlockSize)
+
+	result := make(chan []byte, 1)
+	z.queue <- result
+	go func() {
+		var buf bytes.Buffer
+		// The level was checked by newParallelGzip
+		fw, _ := flate.NewWriterDict(&buf, z.level, dict)
+		fw.Write(block)
+		if last {
+			fw.Close()
+		} else {
+			fw.Flush()
+		}
+		result <- buf.Bytes()
+	}()
+}
+
+// Close writes the last block and the trailer. It does not close the
+// underlying writer.
+func (z *parallelGzip) Close() error {
+	if z.closed {
+		return z.getErr()
+	}
+	z.closed = true
+	z.compress(true)
+	close(z.queue)
+	<-z.done
+	if err := z.getErr(); err != nil {
+		return err
+	}
+	trailer := binary.LittleEndian.AppendUint32(nil, z.crc)
+	_, err := z.w.Write(binary.LittleEndian.AppendUint32(trailer, z.size))
+	return err
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const defaultPreset = "dash"
+
+// preset bundles the output settings a docset reader expects
+type preset struct {
+	// Write the Dash specific Info.plist keys
+	dashKeys bool
+	// Write the publisher keys Xcode requires
+	appleKeys bool
+	// Readers on case-sensitive file systems need links to match file
+	// names exactly, which CHM authors rarely cared about
+	lowercase bool
+	// Use the first -keyword as DocSetPlatformFamily, the keyword of
+	// readers that ignore DashDocSetKeyword
+	keywordPlatform bool
+}
+
+var presets = map[string]preset{
+	"dash":  {dashKeys: true},
+	"zeal":  {dashKeys: true, lowercase: true, keywordPlatform: true},
+	"xcode": {appleKeys: true},
+}
+
+// presetNames returns the names of all presets
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// settings returns the preset of the conversion
+func (opts *Options) settings() preset {
+	if p, ok := presets[opts.Preset]; ok {
+		return p
+	}
+	return presets[defaultPreset]
+}
+
+// IsDashDocset reports whether Info.plist gets the Dash specific keys
+func (opts *Options) IsDashDocset() bool {
+	return opts.settings().dashKeys
+}
+
+// IsAppleDocset reports whether Info.plist gets the Xcode publisher keys
+func (opts *Options) IsAppleDocset() bool {
+	return opts.settings().appleKeys
+}
+
+// applyPreset sets the options implied by -preset, leaving the flags given
+// on the command line alone
+func (opts *Options) applyPreset() error {
+	if opts.Preset == "" {
+		return nil
+	}
+	p, ok := presets[strings.ToLower(opts.Preset)]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, expected one of %s", opts.Preset, strings.Join(presetNames(), ", "))
+	}
+	opts.Preset = strings.ToLower(opts.Preset)
+
+	if p.lowercase && !opts.setFlags["lowercase"] {
+		opts.LowercasePaths = true
+		if !opts.setFlags["redirect-stubs"] {
+			opts.RedirectStubs = true
+		}
+	}
+	if p.keywordPlatform && !opts.setFlags["platform"] && len(opts.Keywords) > 0 {
+		if keyword := strings.Split(opts.Keyword(), ",")[0]; keyword != "" {
+			opts.Platform = keyword
+		}
+	}
+	return nil
+}
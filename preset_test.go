@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPresetZeal(t *testing.T) {
+	os.Args = []string{"chm2docset", "-preset", "Zeal", "-keyword", "vcl", "/foo/bar/baz.chm"}
+	opts := NewOptions()
+	Test{opts.Preset, "zeal"}.Compare(t)
+	Test{opts.LowercasePaths, true}.Compare(t)
+	Test{opts.RedirectStubs, true}.Compare(t)
+	Test{opts.Platform, "vcl"}.Compare(t)
+	Test{strings.Contains(opts.PlistContent(), "<key>isDashDocset</key>"), true}.Compare(t)
+}
+
+func TestPresetKeepsExplicitFlags(t *testing.T) {
+	os.Args = []string{"chm2docset", "-preset", "zeal", "-lowercase=false", "-platform", "delphi", "-keyword", "vcl", "/foo/bar/baz.chm"}
+	opts := NewOptions()
+	Test{opts.LowercasePaths, false}.Compare(t)
+	Test{opts.RedirectStubs, false}.Compare(t)
+	Test{opts.Platform, "delphi"}.Compare(t)
+}
+
+func TestPresetXcode(t *testing.T) {
+	opts := &Options{
+		SourcePath:    "/foo/bar/baz.chm",
+		Platform:      "vcl",
+		Preset:        "xcode",
+		DocsetVersion: "2.1",
+		Keywords:      stringList{"vcl"},
+	}
+	Test{opts.PlistContent(), `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+  <dict>
+    <key>dashIndexFilePath</key>
+    <string>Welcome.htm</string>
+    <key>CFBundleIdentifier</key>
+    <string>io.ngs.documentation.baz</string>
+    <key>CFBundleName</key>
+    <string>baz</string>
+    <key>DocSetPlatformFamily</key>
+    <string>vcl</string>
+    <key>DocSetPublisherIdentifier</key>
+    <string>io.ngs.documentation</string>
+    <key>DocSetPublisherName</key>
+    <string>chm2docset</string>
+    <key>CFBundleVersion</key>
+    <string>2.1</string>
+  </dict>
+</plist>`}.Compare(t)
+}
+
+func TestPresetUnknown(t *testing.T) {
+	opts := &Options{Preset: "kindle"}
+	Test{opts.applyPreset() != nil, true}.Compare(t)
+}
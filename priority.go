@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Dash has no weight column in searchIndex. Results with equal match quality
+// are ranked shorter names first, so entries are de-prioritized by
+// decorating their names, which also tells users why they rank low.
+const (
+	defaultDeprecatedMarker = "(deprecated)"
+	lowPrioritySuffix       = " (low priority)"
+)
+
+var (
+	// Elements styled as deprecation notices
+	deprecatedClassRE = regexp.MustCompile(`(?i)\b(?:class|id)\s*=\s*["']?[^"'>]*(?:deprecat|obsolete)`)
+	// Deprecation wording in the leading text of a page
+	deprecatedTextRE = regexp.MustCompile(`(?i)(?:^|[\[(:!\s])(?:deprecated|obsolete)(?:$|[\])!.:\s])`)
+	bodyRE           = regexp.MustCompile(`(?is)<body\b[^>]*>(.*)`)
+)
+
+// Characters of leading page text searched for a deprecation banner
+const bannerTextLimit = 300
+
+// Entry priorities, from most to least relevant
+const (
+	priorityNormal = iota
+	priorityLow
+	priorityDeprecated
+)
+
+// priorityRule assigns a priority to entries whose name or path matches
+type priorityRule struct {
+	re       *regexp.Regexp
+	priority int
+}
+
+// priorityRules compiles the -deprecated and -low-priority patterns
+func (opts *Options) priorityRules() ([]priorityRule, error) {
+	var rules []priorityRule
+	for _, r := range []struct {
+		flag, pattern string
+		priority      int
+	}{
+		{"deprecated", opts.Deprecated, priorityDeprecated},
+		{"low-priority", opts.LowPriority, priorityLow},
+	} {
+		if r.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(r.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %w", r.flag, err)
+		}
+		rules = append(rules, priorityRule{re, r.priority})
+	}
+	return rules, nil
+}
+
+// decorateName returns the name shown for an entry of the given priority
+func (opts *Options) decorateName(name string, priority int) string {
+	switch priority {
+	case priorityDeprecated:
+		marker := opts.DeprecatedMarker
+		if marker == "" {
+			marker = defaultDeprecatedMarker
+		}
+		if suffix := " " + marker; !strings.HasSuffix(name, suffix) {
+			return name + suffix
+		}
+	case priorityLow:
+		if !strings.HasSuffix(name, lowPrioritySuffix) {
+			return name + lowPrioritySuffix
+		}
+	}
+	return name
+}
+
+// applyPriorities renames the entries matched by the priority rules and
+// the entries pointing into deprecated pages
+func (opts *Options) applyPriorities(tx *sql.Tx, deprecatedPages map[string]bool) error {
+	rules, err := opts.priorityRules()
+	if err != nil || len(rules) == 0 && len(deprecatedPages) == 0 {
+		return err
+	}
+
+	type rename struct {
+		id   int64
+		name string
+	}
+	var renames []rename
+	rows, err := tx.Query("SELECT id, name, path FROM searchIndex")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		var name, path string
+		if err := rows.Scan(&id, &name, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		priority := priorityNormal
+		if deprecatedPages[pageOf(path)] {
+			priority = priorityDeprecated
+		}
+		for _, rule := range rules {
+			if rule.priority > priority && (rule.re.MatchString(name) || rule.re.MatchString(path)) {
+				priority = rule.priority
+			}
+		}
+		if decorated := opts.decorateName(name, priority); decorated != name {
+			renames = append(renames, rename{id, decorated})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("UPDATE OR IGNORE searchIndex SET name = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	merged := 0
+	for _, r := range renames {
+		res, err := stmt.Exec(r.name, r.id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		// The decorated entry is indexed already, e.g. from another
+		// source; it stands for this one
+		if _, err := tx.Exec("DELETE FROM searchIndex WHERE id = ?", r.id); err != nil {
+			return err
+		}
+		merged++
+	}
+	if len(renames) > 0 {
+		log.Printf("De-prioritized %d entries", len(renames))
+	}
+	if merged > 0 {
+		log.Printf("Removed %d entries indexed already under their de-prioritized name", merged)
+		opts.addEntries(-merged)
+	}
+	return nil
+}
+
+// deprecatedPages returns the pages carrying a Deprecated/Obsolete banner
+func (opts *Options) deprecatedPages() (map[string]bool, error) {
+	pages := map[string]bool{}
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		b, err := opts.pages.ReadFile(path)
+		if err != nil {
+			opts.pageErrorf("skipping deprecation check of %s due to error: %v", path, err)
+			return nil
+		}
+		if !hasDeprecationBanner(decodeToUTF8(b, "")) {
+			return nil
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		pages[filepath.ToSlash(relPath)] = true
+		return nil
+	})
+	if len(pages) > 0 {
+		log.Printf("Found %d deprecated pages", len(pages))
+	}
+	return pages, err
+}
+
+// hasDeprecationBanner reports whether a page is marked deprecated by its
+// title, by an element styled as a deprecation notice, or by wording at
+// the very start of its text
+func hasDeprecationBanner(content string) bool {
+	if m := titleRE.FindStringSubmatch(content); m != nil && deprecatedTextRE.MatchString(m[1]) {
+		return true
+	}
+	body := content
+	if m := bodyRE.FindStringSubmatch(content); m != nil {
+		body = m[1]
+	}
+	if deprecatedClassRE.MatchString(body) {
+		return true
+	}
+	text := strings.Join(strings.Fields(html.UnescapeString(tagRE.ReplaceAllString(body, " "))), " ")
+	if len(text) > bannerTextLimit {
+		text = text[:bannerTextLimit]
+	}
+	return deprecatedTextRE.MatchString(text)
+}
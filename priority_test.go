@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestDecorateName(t *testing.T) {
+	opts := &Options{}
+	Test{opts.decorateName("Open", priorityNormal), "Open"}.Compare(t)
+	Test{opts.decorateName("Open", priorityLow), "Open (low priority)"}.Compare(t)
+	Test{opts.decorateName("Open", priorityDeprecated), "Open (deprecated)"}.Compare(t)
+	Test{opts.decorateName("Open (deprecated)", priorityDeprecated), "Open (deprecated)"}.Compare(t)
+	opts.DeprecatedMarker = "⚠"
+	Test{opts.decorateName("Open", priorityDeprecated), "Open ⚠"}.Compare(t)
+}
+
+func TestHasDeprecationBanner(t *testing.T) {
+	for _, test := range []struct {
+		page     string
+		expected bool
+	}{
+		{`<title>OpenFile (obsolete)</title><body>Opens a file.</body>`, true},
+		{`<title>Open</title><body><div class="deprecatedNote">Use OpenEx.</div></body>`, true},
+		{`<title>Open</title><body><p><b>Deprecated.</b> Use OpenEx instead.</p></body>`, true},
+		{`<title>Open</title><body><p>[Obsolete] Kept for compatibility.</p></body>`, true},
+		{`<title>Open</title><body><p>Opens a file.</p>` + strings.Repeat("Lorem ipsum. ", 40) + `The flag is deprecated.</body>`, false},
+		{`<title>Open</title><body><p>Undeprecated behavior.</p></body>`, false},
+	} {
+		Test{hasDeprecationBanner(test.page), test.expected}.Compare(t)
+	}
+}
+
+func TestApplyPriorities(t *testing.T) {
+	opts := &Options{
+		SourcePath:  "/foo/bar/baz.chm",
+		Outdir:      "tmp/Sample.docset",
+		Deprecated:  `^Old|^legacy/`,
+		LowPriority: `^Old|^Internal`,
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	tx, _ := db.Begin()
+	for _, e := range [][]string{
+		{"OldOpen", "a.htm"},
+		{"Open", "legacy/open.htm"},
+		{"InternalOpen", "b.htm"},
+		{"Close", "c.htm"},
+		{"Close (deprecated)", "c.htm"},
+	} {
+		tx.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, 'Function', ?)", e[0], e[1])
+	}
+	if err := opts.applyPriorities(tx, map[string]bool{"c.htm": true}); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	tx.Commit()
+	rows, _ := db.Query("SELECT name FROM searchIndex ORDER BY id")
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	Test{names, []string{"OldOpen (deprecated)", "Open (deprecated)", "InternalOpen (low priority)", "Close (deprecated)"}}.DeepEqual(t)
+}
+
+func TestPriorityRulesInvalid(t *testing.T) {
+	opts := &Options{Deprecated: "("}
+	if _, err := opts.priorityRules(); err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
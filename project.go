@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// helpProject holds the settings of an HTML Help Workshop .hhp project
+// that a CHM would be compiled from
+type helpProject struct {
+	Title        string
+	DefaultTopic string
+	ContentsFile string
+	IndexFile    string
+	Language     uint32
+	// Files lists the [FILES] section, relative to the project directory
+	Files []string
+}
+
+// isProject reports whether the source is an .hhp project
+func (opts *Options) isProject() bool {
+	return strings.EqualFold(filepath.Ext(opts.SourcePath), ".hhp")
+}
+
+// isSourceDir reports whether the source is a directory of HTML files,
+// given with or without -from-dir
+func (opts *Options) isSourceDir() bool {
+	if opts.FromDir {
+		return true
+	}
+	info, err := os.Stat(opts.SourcePath)
+	return err == nil && info.IsDir()
+}
+
+// readProject parses an .hhp project. Its text is stored in the code page
+// of its Language setting.
+func readProject(p string) (*helpProject, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	project := &helpProject{}
+	var options [][2]string
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToUpper(line[1 : len(line)-1])
+			continue
+		}
+		switch section {
+		case "OPTIONS":
+			if key, value, ok := strings.Cut(line, "="); ok {
+				options = append(options, [2]string{strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)})
+			}
+		case "FILES":
+			project.Files = append(project.Files, projectPath(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, option := range options {
+		if option[0] == "language" {
+			// e.g. 0x409 English (United States)
+			if id, err := strconv.ParseUint(strings.Fields(option[1] + " ")[0], 0, 32); err == nil {
+				project.Language = uint32(id)
+			}
+		}
+	}
+	charset := lcidCharset(project.Language)
+	for _, option := range options {
+		value := decodeCharset([]byte(option[1]), charset)
+		switch option[0] {
+		case "title":
+			project.Title = value
+		case "default topic":
+			project.DefaultTopic = projectPath(value)
+		case "contents file":
+			project.ContentsFile = projectPath(value)
+		case "index file":
+			project.IndexFile = projectPath(value)
+		}
+	}
+	return project, nil
+}
+
+// projectPath returns a path of a project file with slashes
+func projectPath(p string) string {
+	if p = strings.TrimSpace(p); p == "" {
+		return ""
+	}
+	return path.Clean(strings.ReplaceAll(p, "\\", "/"))
+}
+
+// readProjectSystem takes the title and the default topic from the .hhp
+// project given as source, in place of the #SYSTEM file of a CHM
+func (opts *Options) readProjectSystem() error {
+	project, err := readProject(opts.SourcePath)
+	if err != nil {
+		return fmt.Errorf("reading project: %w", err)
+	}
+	opts.systemTitle = project.Title
+	opts.defaultTopic = project.DefaultTopic
+	return nil
+}
+
+// copyProject copies the directory of the .hhp project given as source into
+// the content directory, in place of extracting a CHM compiled from it. The
+// table of contents, index and [FILES] kept outside that directory are
+// copied to the top of the content directory.
+func (opts *Options) copyProject() error {
+	project, err := readProject(opts.SourcePath)
+	if err != nil {
+		return fmt.Errorf("reading project: %w", err)
+	}
+	dir := filepath.Dir(opts.SourcePath)
+	if err := opts.copyTreeInto(dir); err != nil {
+		return err
+	}
+
+	root := opts.ContentPath()
+	copied := 0
+	for _, file := range append([]string{project.ContentsFile, project.IndexFile}, project.Files...) {
+		if file == "" || strings.ContainsAny(file, "*?") || filepath.IsLocal(filepath.FromSlash(file)) {
+			continue
+		}
+		// The file lives outside the project directory
+		target := path.Base(file)
+		if isHTMLFile(file) {
+			opts.warnf("%s of the project is outside its directory; links to it may break", file)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			opts.warnf("reading %s of the project: %v", file, err)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(root, target), b, 0644); err != nil {
+			return err
+		}
+		copied++
+	}
+	if copied > 0 {
+		log.Printf("Copied %d project files from outside %s", copied, dir)
+	}
+	for _, file := range project.Files {
+		if strings.ContainsAny(file, "*?") || !filepath.IsLocal(filepath.FromSlash(file)) {
+			continue
+		}
+		if findPage(root, file) == "" {
+			opts.warnf("%s is listed in the project but missing", file)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+const testProject = `[OPTIONS]
+Compatibility=1.1 or later
+Compiled file=Help.chm
+Contents file=..\shared\Help.hhc
+Default topic=html\Intro.htm
+Language=0x407 Deutsch (Deutschland)
+Title=Caf` + "\xe9" + ` Hilfe
+
+; Pages of the help
+[FILES]
+html\Intro.htm
+html\gone.htm
+html\*.gif
+
+[MAP]
+#include map.h
+`
+
+func TestReadProject(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp/project", 0755)
+	os.WriteFile("tmp/project/Help.hhp", []byte(testProject), 0644)
+	project, err := readProject("tmp/project/Help.hhp")
+	Test{err, nil}.Compare(t)
+	Test{*project, helpProject{
+		Title:        "Café Hilfe",
+		DefaultTopic: "html/Intro.htm",
+		ContentsFile: "../shared/Help.hhc",
+		Language:     0x407,
+		Files:        []string{"html/Intro.htm", "html/gone.htm", "html/*.gif"},
+	}}.DeepEqual(t)
+}
+
+func TestCopyProject(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp/project/html", 0755)
+	os.MkdirAll("tmp/shared", 0755)
+	os.WriteFile("tmp/project/Help.hhp", []byte(testProject), 0644)
+	os.WriteFile("tmp/project/html/Intro.htm", []byte("<title>Intro</title>"), 0644)
+	os.WriteFile("tmp/shared/Help.hhc", []byte(`<param name="Local" value="html\Intro.htm">`), 0644)
+
+	opts := &Options{SourcePath: "tmp/project/Help.hhp", Outdir: "tmp/out"}
+	opts.report = opts.newReport()
+	Test{opts.isProject(), true}.Compare(t)
+	Test{opts.isSourceDir(), false}.Compare(t)
+	Test{opts.Basename(), "Help"}.Compare(t)
+	opts.CreateDirectory()
+	Test{opts.ReadSystem(), nil}.Compare(t)
+	Test{opts.Title(), "Café Hilfe"}.Compare(t)
+	Test{opts.defaultTopic, "html/Intro.htm"}.Compare(t)
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	for _, name := range []string{"Help.hhp", "html/Intro.htm", "Help.hhc"} {
+		if _, err := os.Stat(opts.ContentPath() + "/" + name); err != nil {
+			t.Errorf("Expected %s to be copied but got %v", name, err)
+		}
+	}
+	Test{opts.sourceReport().Warnings, []string{"html/gone.htm is listed in the project but missing"}}.DeepEqual(t)
+
+	dir := &Options{SourcePath: "tmp/project/html", Outdir: "tmp/out"}
+	Test{dir.isSourceDir(), true}.Compare(t)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Conversions scoring below this likely need custom rules
+const lowQualityScore = 60
+
+// IndexQuality holds heuristic measures of how useful an index is
+type IndexQuality struct {
+	Score       int     `json:"score"`
+	EntryRatio  float64 `json:"entry_page_ratio"`
+	Uniqueness  float64 `json:"title_uniqueness"`
+	Types       int     `json:"types"`
+	BrokenPaths int     `json:"broken_paths"`
+}
+
+// scoreIndex rates the finished index and records the result in the report,
+// warning when the score is low
+func (opts *Options) scoreIndex() error {
+	src := opts.sourceReport()
+	if src == nil {
+		return nil
+	}
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var entries, names, types int
+	err = db.QueryRow("SELECT COUNT(*), COUNT(DISTINCT name), COUNT(DISTINCT type) FROM searchIndex").
+		Scan(&entries, &names, &types)
+	if err != nil {
+		return err
+	}
+	broken, err := opts.brokenPaths(db)
+	if err != nil {
+		return err
+	}
+
+	q := &IndexQuality{Types: types, BrokenPaths: broken}
+	if pages := opts.totalReport().Pages; pages > 0 {
+		q.EntryRatio = round2(float64(entries) / float64(pages))
+	}
+	if entries > 0 {
+		q.Uniqueness = round2(float64(names) / float64(entries))
+	}
+	q.Score = qualityScore(q, entries)
+	src.Quality = q
+
+	if q.Score < lowQualityScore {
+		opts.warnf("index quality score is %d (%.2f entries per page, %.0f%% unique names, %d types, %d broken paths); the conversion likely needs custom rules",
+			q.Score, q.EntryRatio, q.Uniqueness*100, q.Types, q.BrokenPaths)
+	}
+	return nil
+}
+
+// qualityScore combines the measures into a score from 0 to 100. An index
+// with at least one entry per page, unique names, several types and no
+// broken paths scores 100.
+func qualityScore(q *IndexQuality, entries int) int {
+	if entries == 0 {
+		return 0
+	}
+	score := 30*math.Min(q.EntryRatio, 1) +
+		30*q.Uniqueness +
+		15*math.Min(float64(q.Types), 3)/3 +
+		25*(1-float64(q.BrokenPaths)/float64(entries))
+	return int(math.Round(math.Max(score, 0)))
+}
+
+// brokenPaths returns the number of entries pointing at missing files
+func (opts *Options) brokenPaths(db *sql.DB) (int, error) {
+	rows, err := db.Query("SELECT path, COUNT(*) FROM searchIndex GROUP BY path")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	basePath := opts.ContentPath()
+	exists := map[string]bool{}
+	broken := 0
+	for rows.Next() {
+		var path string
+		var n int
+		if err := rows.Scan(&path, &n); err != nil {
+			return 0, err
+		}
+		page := pageOf(path)
+		ok, seen := exists[page]
+		if !seen {
+			ok = fileExists(filepath.Join(basePath, filepath.FromSlash(page)))
+			exists[page] = ok
+		}
+		if !ok {
+			broken += n
+		}
+	}
+	return broken, rows.Err()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
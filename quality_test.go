@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestQualityScore(t *testing.T) {
+	for _, test := range []struct {
+		q        IndexQuality
+		entries  int
+		expected int
+	}{
+		{IndexQuality{EntryRatio: 2, Uniqueness: 1, Types: 5}, 100, 100},
+		{IndexQuality{EntryRatio: 0.5, Uniqueness: 1, Types: 1}, 10, 75},
+		{IndexQuality{EntryRatio: 1, Uniqueness: 0.5, Types: 1, BrokenPaths: 10}, 10, 50},
+		{IndexQuality{}, 0, 0},
+	} {
+		Test{qualityScore(&test.q, test.entries), test.expected}.Compare(t)
+	}
+}
+
+func TestScoreIndex(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+	}
+	opts.Clean()
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.report = opts.newReport()
+	opts.countPages()
+	opts.CreateDatabase()
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	db.Exec("INSERT INTO searchIndex(name, type, path) VALUES ('Gone', 'Class', 'gone.htm#x')")
+	db.Close()
+	if err := opts.scoreIndex(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	q := opts.sourceReport().Quality
+	for _, test := range []Test{
+		{q.EntryRatio, 1.0},
+		{q.Uniqueness, 1.0},
+		{q.Types, 2},
+		{q.BrokenPaths, 1},
+		{q.Score, 89},
+		{len(opts.sourceReport().Warnings), 0},
+	} {
+		test.Compare(t)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const redirectStubTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url=%[1]s">
+<title>Moved</title>
+</head>
+<body><a href="%[1]s">%[1]s</a></body>
+</html>
+`
+
+// pathMap records the files moved within the content directory. Lookups
+// fall back to case-insensitive matching because CHM links are.
+type pathMap struct {
+	exact  map[string]string
+	folded map[string]string
+}
+
+func newPathMap() *pathMap {
+	return &pathMap{exact: map[string]string{}, folded: map[string]string{}}
+}
+
+// Add records that old is now stored at new
+func (m *pathMap) Add(old, new string) {
+	m.exact[old] = new
+	if _, ok := m.folded[strings.ToLower(old)]; !ok {
+		m.folded[strings.ToLower(old)] = new
+	}
+}
+
+// Lookup returns the new location of old
+func (m *pathMap) Lookup(old string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	if new, ok := m.exact[old]; ok {
+		return new, true
+	}
+	new, ok := m.folded[strings.ToLower(old)]
+	return new, ok
+}
+
+// mapPath returns the current location of a content path that may have
+// been renamed, keeping its #fragment
+func (opts *Options) mapPath(p string) string {
+	base := stripFragment(p)
+	if new, ok := opts.renames.Lookup(base); ok {
+		return new + p[len(base):]
+	}
+	return p
+}
+
+// Lowercase renames every file below the content directory to lower case
+// and returns the rewrite of the links of all pages, or nil if no file was
+// renamed. Names that collide once lowercased get a numeric suffix.
+func (opts *Options) Lowercase() (pageRewrite, error) {
+	if !opts.LowercasePaths {
+		return nil, nil
+	}
+	root := opts.ContentPath()
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	// Files that are already lower case keep their names
+	moves := map[string]string{}
+	taken := map[string]bool{}
+	for _, old := range files {
+		if old == strings.ToLower(old) {
+			taken[old] = true
+			moves[old] = old
+		}
+	}
+	for _, old := range files {
+		if _, ok := moves[old]; ok {
+			continue
+		}
+		new := uniquePath(strings.ToLower(old), taken)
+		taken[new] = true
+		moves[old] = new
+	}
+	if err := opts.moveFiles(moves); err != nil {
+		return nil, err
+	}
+	return opts.linkRewrite(), nil
+}
+
+// uniquePath returns p, or p with a numeric suffix before its extension if
+// p is already taken
+func uniquePath(p string, taken map[string]bool) string {
+	if !taken[p] {
+		return p
+	}
+	ext := path.Ext(p)
+	stem := strings.TrimSuffix(p, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// moveFiles moves content files according to moves (old -> new relative
+// paths). Files are staged in a sibling directory so that case-only renames
+// work on case-insensitive file systems.
+func (opts *Options) moveFiles(moves map[string]string) error {
+	root := opts.ContentPath()
+	staging := root + ".renaming"
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+
+	if opts.renames == nil {
+		opts.renames = newPathMap()
+	}
+	renamed := 0
+	for old, new := range moves {
+		if old != new {
+			renamed++
+		}
+	}
+	if renamed == 0 {
+		return nil
+	}
+	// Files renamed before stay recorded under their original path only
+	movedBefore := map[string]bool{}
+	for orig, cur := range opts.renames.exact {
+		if new, ok := moves[cur]; ok && new != cur {
+			opts.renames.exact[orig] = new
+			if opts.renames.folded[strings.ToLower(orig)] == cur {
+				opts.renames.folded[strings.ToLower(orig)] = new
+			}
+			movedBefore[cur] = true
+		}
+	}
+	for old, new := range moves {
+		if old != new && !movedBefore[old] {
+			opts.renames.Add(old, new)
+		}
+	}
+
+	for old, new := range moves {
+		target := filepath.Join(staging, filepath.FromSlash(new))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(root, filepath.FromSlash(old)), target); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(root); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, root); err != nil {
+		return err
+	}
+	opts.streamed.move(moves)
+	log.Printf("Renamed %d files", renamed)
+	return nil
+}
+
+// linkRewrite returns the rewrite of the links of pages to the new
+// locations of renamed files
+func (opts *Options) linkRewrite() pageRewrite {
+	if opts.renames == nil || len(opts.renames.exact) == 0 {
+		return nil
+	}
+	movedFrom := map[string]string{}
+	for old, new := range opts.renames.exact {
+		movedFrom[new] = old
+	}
+	return func(rel string, b []byte) ([]byte, bool) {
+		old, ok := movedFrom[rel]
+		if !ok {
+			old = rel
+		}
+		return opts.rewriteLinks(b, old, rel)
+	}
+}
+
+// writeRedirectStubs writes a page redirecting to the new location at the
+// old location of every renamed page
+func (opts *Options) writeRedirectStubs() error {
+	if opts.renames == nil {
+		return nil
+	}
+	root := opts.ContentPath()
+	count := 0
+	for old, new := range opts.renames.exact {
+		// Names decoded by DecodeFileNames get no stub under their
+		// undecoded name
+		if !isHTMLFile(old) || !utf8.ValidString(old) {
+			continue
+		}
+		p := filepath.Join(root, filepath.FromSlash(old))
+		if _, err := os.Stat(p); err == nil {
+			// Case-insensitive file system, or a new file took the name
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		target := html.EscapeString(escapeLink(relativeLink(old, new)))
+		if err := os.WriteFile(p, []byte(fmt.Sprintf(redirectStubTemplate, target)), 0644); err != nil {
+			return err
+		}
+		count++
+	}
+	if count > 0 {
+		log.Printf("Wrote %d redirect stubs", count)
+	}
+	return nil
+}
+
+// rewriteLinks rewrites the href/src links of a page that moved from
+// oldPage to newPage so that they point at the new locations of their
+// targets
+func (opts *Options) rewriteLinks(b []byte, oldPage, newPage string) ([]byte, bool) {
+	var out bytes.Buffer
+	last := 0
+	changed := false
+	for _, m := range linkRE.FindAllSubmatchIndex(b, -1) {
+		var start, end int
+		for g := 2; g < len(m); g += 2 {
+			if m[g] >= 0 {
+				start, end = m[g], m[g+1]
+				break
+			}
+		}
+		raw := html.UnescapeString(string(b[start:end]))
+		target, ok := resolveLink(oldPage, raw)
+		if !ok || target == "" {
+			continue
+		}
+		suffix := ""
+		if i := strings.IndexAny(raw, "#?"); i >= 0 {
+			suffix = raw[i:]
+		}
+		if new, ok := opts.renames.Lookup(target); ok {
+			target = new
+		}
+		link := escapeLink(relativeLink(newPage, target)) + suffix
+		if link == raw {
+			continue
+		}
+		out.Write(b[last:start])
+		out.WriteString(html.EscapeString(link))
+		last = end
+		changed = true
+	}
+	if !changed {
+		return b, false
+	}
+	out.Write(b[last:])
+	return out.Bytes(), true
+}
+
+// relativeLink returns the path of target relative to the directory of page
+func relativeLink(page, target string) string {
+	from := strings.Split(path.Dir(page), "/")
+	if from[0] == "." {
+		from = nil
+	}
+	to := strings.Split(target, "/")
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+	parts := make([]string, 0, len(from)-i+len(to)-i)
+	for range from[i:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, to[i:]...)
+	return strings.Join(parts, "/")
+}
+
+// escapeLink percent-encodes a path for use in a link
+func escapeLink(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
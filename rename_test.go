@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRelativeLink(t *testing.T) {
+	for _, test := range []struct{ page, target, expected string }{
+		{"index.htm", "a.htm", "a.htm"},
+		{"index.htm", "sub/a.htm", "sub/a.htm"},
+		{"sub/index.htm", "a.htm", "../a.htm"},
+		{"sub/x/index.htm", "sub/y/a.htm", "../y/a.htm"},
+		{"sub/index.htm", "sub/a.htm", "a.htm"},
+	} {
+		Test{relativeLink(test.page, test.target), test.expected}.Compare(t)
+	}
+}
+
+func TestUniquePath(t *testing.T) {
+	taken := map[string]bool{"a.htm": true, "a-2.htm": true}
+	Test{uniquePath("b.htm", taken), "b.htm"}.Compare(t)
+	Test{uniquePath("a.htm", taken), "a-3.htm"}.Compare(t)
+}
+
+func TestPathMap(t *testing.T) {
+	m := newPathMap()
+	m.Add("Sub/Page.htm", "sub/page.htm")
+	m.Add("sub/PAGE.htm", "sub/page-2.htm")
+	for _, test := range []struct{ old, expected string }{
+		{"Sub/Page.htm", "sub/page.htm"},
+		{"sub/PAGE.htm", "sub/page-2.htm"},
+		{"SUB/page.HTM", "sub/page.htm"},
+	} {
+		new, _ := m.Lookup(test.old)
+		Test{new, test.expected}.Compare(t)
+	}
+	_, ok := m.Lookup("other.htm")
+	Test{ok, false}.Compare(t)
+}
+
+func TestLowercase(t *testing.T) {
+	opts := &Options{
+		SourcePath:     "/foo/bar/baz.chm",
+		Outdir:         "tmp/baz.docset",
+		LowercasePaths: true,
+		RedirectStubs:  true,
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.MkdirAll(content+"/Sub", 0755)
+	os.WriteFile(content+"/Index.htm", []byte(`<a href="Sub/Page.htm#x">p</a> <a href="http://example.com/A.htm">x</a> <img src="Logo.GIF">`), 0644)
+	os.WriteFile(content+"/Sub/Page.htm", []byte(`<a href="../index.htm">up</a> <a href="#top">top</a>`), 0644)
+	os.WriteFile(content+"/Logo.GIF", []byte("GIF89a"), 0644)
+	os.WriteFile(content+"/logo.gif", []byte("other"), 0644)
+
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile(content + "/index.htm")
+	Test{string(b), `<a href="sub/page.htm#x">p</a> <a href="http://example.com/A.htm">x</a> <img src="logo-2.gif">`}.Compare(t)
+	b, _ = os.ReadFile(content + "/sub/page.htm")
+	Test{string(b), `<a href="../index.htm">up</a> <a href="#top">top</a>`}.Compare(t)
+	b, _ = os.ReadFile(content + "/logo.gif")
+	Test{string(b), "other"}.Compare(t)
+	Test{opts.mapPath("SUB/page.htm#x"), "sub/page.htm#x"}.Compare(t)
+
+	// Redirect stubs exist only where the file system is case-sensitive
+	if _, err := os.Stat(content + "/INDEX.HTM"); err != nil {
+		b, err = os.ReadFile(content + "/Index.htm")
+		if err != nil {
+			t.Errorf("Expected redirect stub but got %v", err)
+		}
+		Test{strings.Contains(string(b), `url=index.htm`), true}.Compare(t)
+		b, _ = os.ReadFile(content + "/Sub/Page.htm")
+		Test{strings.Contains(string(b), `url=../sub/page.htm`), true}.Compare(t)
+	}
+}
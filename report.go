@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DocsetReport summarizes the conversion of one docset
+type DocsetReport struct {
+	Docset  string          `json:"docset"`
+	Sources []*SourceReport `json:"sources"`
+
+	// dirs maps the lower-cased directories of the content path holding
+	// merged or combined sources, with a trailing slash, to their reports
+	dirs map[string]*SourceReport
+	mu   sync.Mutex
+}
+
+// SourceReport holds the metrics of a single input file
+type SourceReport struct {
+	Source      string         `json:"source"`
+	Pages       int            `json:"pages"`
+	Entries     int            `json:"entries"`
+	Quality     *IndexQuality  `json:"quality,omitempty"`
+	Timings     []*StageTiming `json:"timings,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+	Errors      []string       `json:"errors,omitempty"`
+	Regressions []string       `json:"regressions,omitempty"`
+	Skipped     []SkippedPage  `json:"skipped,omitempty"`
+	Missing     []string       `json:"missing,omitempty"`
+	// Duplicates counts the entries indexed already, by source and the
+	// -duplicates policy applied to them
+	Duplicates map[string]map[string]int `json:"duplicates,omitempty"`
+
+	// skipped holds the lower-cased paths of Skipped
+	skipped map[string]bool
+}
+
+// newReport starts the report of a conversion, with one source per input
+// combined under -combine
+func (opts *Options) newReport() *DocsetReport {
+	r := &DocsetReport{Docset: opts.DocsetPath(), dirs: map[string]*SourceReport{}}
+	if opts.combined() {
+		for _, source := range opts.Sources {
+			r.Sources = append(r.Sources, &SourceReport{Source: source})
+		}
+	} else {
+		r.Sources = []*SourceReport{{Source: opts.SourcePath}}
+	}
+	return r
+}
+
+// sourceReport returns the metrics of the source being converted, the
+// first one of a combined docset, which also holds its warnings
+func (opts *Options) sourceReport() *SourceReport {
+	if opts.report == nil {
+		return nil
+	}
+	return opts.report.Sources[0]
+}
+
+// reportDir credits the pages and entries below dir, relative to the
+// content path, to the report of source, adding one for a merged CHM
+func (opts *Options) reportDir(source, dir string) {
+	if opts.report == nil {
+		return
+	}
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	var src *SourceReport
+	for _, s := range opts.report.Sources {
+		if s.Source == source {
+			src = s
+			break
+		}
+	}
+	if src == nil {
+		src = &SourceReport{Source: source}
+		opts.report.Sources = append(opts.report.Sources, src)
+	}
+	opts.report.dirs[strings.ToLower(strings.Trim(filepath.ToSlash(dir), "/"))+"/"] = src
+}
+
+// reportFor returns the report of the source a page of the content path
+// came from: that of the merged or combined source whose directory holds
+// it, or the first
+func (opts *Options) reportFor(page string) *SourceReport {
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	page = strings.ToLower(strings.TrimPrefix(page, "/"))
+	src, longest := opts.report.Sources[0], 0
+	for dir, s := range opts.report.dirs {
+		if len(dir) > longest && strings.HasPrefix(page, dir) {
+			src, longest = s, len(dir)
+		}
+	}
+	return src
+}
+
+// totalReport returns the report of the source being converted with the
+// pages and entries of all sources, for the pages describing the docset
+func (opts *Options) totalReport() *SourceReport {
+	src := opts.sourceReport()
+	if src == nil {
+		return nil
+	}
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	total := *src
+	total.Pages, total.Entries = 0, 0
+	for _, s := range opts.report.Sources {
+		total.Pages += s.Pages
+		total.Entries += s.Entries
+	}
+	return &total
+}
+
+// warnf logs a warning and records it in the report of the current source
+func (opts *Options) warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Warning: %s", msg)
+	if src := opts.sourceReport(); src != nil {
+		opts.report.mu.Lock()
+		src.Warnings = append(src.Warnings, msg)
+		opts.report.mu.Unlock()
+	}
+}
+
+// addEntries records n inserted index entries
+func (opts *Options) addEntries(n int) {
+	if src := opts.sourceReport(); src != nil {
+		opts.report.mu.Lock()
+		src.Entries += n
+		opts.report.mu.Unlock()
+	}
+}
+
+// countPages records the number of HTML pages in the content directory,
+// each in the report of the source it came from
+func (opts *Options) countPages() error {
+	if opts.report == nil {
+		return nil
+	}
+	basePath := opts.ContentPath()
+	return filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isHTMLFile(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		opts.reportFor(filepath.ToSlash(rel)).Pages++
+		return nil
+	})
+}
+
+// countEntries credits the entries of the finished index to the sources of
+// their pages. The running count of addEntries is exact for a single
+// source.
+func (opts *Options) countEntries() error {
+	if opts.report == nil || len(opts.report.dirs) == 0 {
+		return nil
+	}
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT path FROM searchIndex")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	counts := map[*SourceReport]int{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return err
+		}
+		counts[opts.reportFor(pageOf(path))]++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	for _, src := range opts.report.Sources {
+		src.Entries = counts[src]
+	}
+	return nil
+}
+
+// logReports prints a one line summary per source
+func logReports(reports []*DocsetReport) {
+	for _, r := range reports {
+		for _, src := range r.Sources {
+			quality := ""
+			if src.Quality != nil {
+				quality = fmt.Sprintf(", quality %d", src.Quality.Score)
+			}
+			log.Printf("%s: %d pages, %d entries%s, %d warnings",
+				filepath.Base(src.Source), src.Pages, src.Entries, quality, len(src.Warnings))
+		}
+	}
+}
+
+// writeReports writes the reports as a JSON array
+func writeReports(path string, reports []*DocsetReport) error {
+	b, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
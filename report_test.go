@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReportMetrics(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+	}
+	opts.Clean()
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.report = opts.newReport()
+	opts.countPages()
+	opts.CreateDatabase()
+	opts.warnf("something odd in %s", "test3.htm")
+
+	src := opts.sourceReport()
+	for _, test := range []Test{
+		{src.Source, "/foo/bar/baz.chm"},
+		{src.Pages, 4},
+		{src.Entries, 3},
+		{len(src.Warnings), 1},
+	} {
+		test.Compare(t)
+	}
+
+	if err := writeReports("tmp/report.json", []*DocsetReport{opts.report}); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile("tmp/report.json")
+	var decoded []map[string]interface{}
+	json.Unmarshal(b, &decoded)
+	Test{decoded[0]["docset"], "tmp/Sample.docset"}.Compare(t)
+}
+
+func TestTimings(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+		Glossary:   true,
+		Timings:    true,
+	}
+	opts.Clean()
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.report = opts.newReport()
+	opts.timeStage("index", opts.CreateDatabase)
+	opts.timeStage("index", opts.scoreIndex)
+
+	var stages []string
+	for _, s := range opts.sourceReport().Timings {
+		stages = append(stages, s.Stage)
+	}
+	Test{stages, []string{"index/title", "index/glossary", "index"}}.DeepEqual(t)
+
+	var out strings.Builder
+	writeTimings(&out, []*DocsetReport{opts.report})
+	for _, row := range []string{"baz.chm", "  index", "    glossary", "  total"} {
+		Test{strings.Contains(out.String(), row), true}.Compare(t)
+	}
+}
+
+func TestTimingsDisabled(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset"}
+	opts.report = opts.newReport()
+	opts.timeStage("index", func() error { return nil })
+	Test{len(opts.sourceReport().Timings), 0}.Compare(t)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// storedReportFile is the report kept inside the docset, below Resources
+const storedReportFile = "chm2docset-report.json"
+
+// StoredReportPath returns the path of the report kept in the docset
+func (opts *Options) StoredReportPath() string {
+	return filepath.Join(opts.DocsetPath(), "Contents", "Resources", storedReportFile)
+}
+
+// previousReport returns the report kept in the docset by the previous
+// conversion, or nil if there is none. It must be read before the docset
+// is cleaned.
+func (opts *Options) previousReport() *DocsetReport {
+	b, err := os.ReadFile(opts.StoredReportPath())
+	if err != nil {
+		return nil
+	}
+	var previous DocsetReport
+	if err := json.Unmarshal(b, &previous); err != nil || len(previous.Sources) == 0 {
+		log.Printf("Ignoring unreadable previous report %s", opts.StoredReportPath())
+		return nil
+	}
+	return &previous
+}
+
+// finishReport compares the report with the previous one under
+// -diff-report and keeps it in the docset. Exported formats, whose docset
+// is removed, keep none.
+func (opts *Options) finishReport(previous *DocsetReport) error {
+	if opts.DiffReport && previous != nil {
+		found := false
+		for i, src := range opts.report.Sources {
+			prev := previousSource(previous, src.Source, i)
+			if prev == nil {
+				continue
+			}
+			src.Regressions = diffReports(prev, src)
+			for _, regression := range src.Regressions {
+				found = true
+				log.Printf("Regression: %s: %s", filepath.Base(src.Source), regression)
+			}
+		}
+		if !found {
+			log.Printf("No regressions since the previous conversion")
+		}
+	}
+	if _, ok := exporters[opts.Format]; ok {
+		return nil
+	}
+	b, err := json.MarshalIndent(opts.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(opts.StoredReportPath(), append(b, '\n'), 0644)
+}
+
+// previousSource returns the source of the previous report matching that
+// at index i of the current one: the one with the same file name, or the
+// first for the first, since the path of a single source may change
+func previousSource(previous *DocsetReport, source string, i int) *SourceReport {
+	for _, prev := range previous.Sources {
+		if filepath.Base(prev.Source) == filepath.Base(source) {
+			return prev
+		}
+	}
+	if i == 0 {
+		return previous.Sources[0]
+	}
+	return nil
+}
+
+// diffReports lists what got worse from previous to current: fewer pages
+// or entries, a lower quality score and warnings not given before
+func diffReports(previous, current *SourceReport) []string {
+	var regressions []string
+	if current.Pages < previous.Pages {
+		regressions = append(regressions, fmt.Sprintf("pages dropped from %d to %d", previous.Pages, current.Pages))
+	}
+	if current.Entries < previous.Entries {
+		regressions = append(regressions, fmt.Sprintf("entries dropped from %d to %d", previous.Entries, current.Entries))
+	}
+	if previous.Quality != nil && current.Quality != nil && current.Quality.Score < previous.Quality.Score {
+		regressions = append(regressions, fmt.Sprintf("quality score dropped from %d to %d", previous.Quality.Score, current.Quality.Score))
+	}
+	known := map[string]bool{}
+	for _, warning := range previous.Warnings {
+		known[warning] = true
+	}
+	for _, warning := range current.Warnings {
+		if !known[warning] {
+			regressions = append(regressions, "new warning: "+warning)
+			known[warning] = true
+		}
+	}
+	return regressions
+}
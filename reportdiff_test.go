@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDiffReports(t *testing.T) {
+	previous := &SourceReport{Pages: 10, Entries: 100, Quality: &IndexQuality{Score: 80}, Warnings: []string{"old"}}
+	current := &SourceReport{Pages: 10, Entries: 90, Quality: &IndexQuality{Score: 70}, Warnings: []string{"old", "new", "new"}}
+	Test{diffReports(previous, current), []string{
+		"entries dropped from 100 to 90",
+		"quality score dropped from 80 to 70",
+		"new warning: new",
+	}}.DeepEqual(t)
+	Test{len(diffReports(current, previous)), 0}.Compare(t)
+}
+
+func TestStoredReport(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/foo.docset", DiffReport: true}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	Test{opts.previousReport() == nil, true}.Compare(t)
+
+	opts.report = opts.newReport()
+	opts.sourceReport().Entries = 5
+	Test{opts.finishReport(nil), nil}.Compare(t)
+	previous := opts.previousReport()
+	Test{previous.Sources[0].Entries, 5}.Compare(t)
+
+	opts.report = opts.newReport()
+	opts.warnf("something")
+	Test{opts.finishReport(previous), nil}.Compare(t)
+	Test{opts.sourceReport().Regressions, []string{"entries dropped from 5 to 0", "new warning: something"}}.DeepEqual(t)
+	Test{opts.previousReport().Sources[0].Regressions, opts.sourceReport().Regressions}.DeepEqual(t)
+
+	os.WriteFile(opts.StoredReportPath(), []byte("{"), 0644)
+	Test{opts.previousReport() == nil, true}.Compare(t)
+}
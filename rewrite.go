@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// pageRewrite changes the content of the page at rel, relative to the
+// content directory, and reports whether it changed anything
+type pageRewrite func(rel string, b []byte) ([]byte, bool)
+
+// Rewrite renames files and rewrites pages as enabled by the options. The
+// page rewrites of all passes are applied in a single read and write of
+// each page.
+func (opts *Options) Rewrite() error {
+	var rewrites []pageRewrite
+	for _, pass := range []func() (pageRewrite, error){opts.DecodedLinks, opts.Lowercase, opts.MergeLinks, opts.MSHCLinks, opts.FuzzyLinks, opts.FlattenFrames, opts.InjectLang, opts.Accessibility, opts.Shortcuts, opts.Navigation, opts.Breadcrumbs, opts.RootLinks} {
+		rewrite, err := pass()
+		if err != nil {
+			return err
+		}
+		if rewrite != nil {
+			rewrites = append(rewrites, rewrite)
+		}
+	}
+	if err := opts.rewritePages(rewrites); err != nil {
+		return err
+	}
+	if opts.RedirectStubs {
+		return opts.writeRedirectStubs()
+	}
+	return nil
+}
+
+// rewritePages applies rewrites in order to every page concurrently and
+// writes the pages they changed
+func (opts *Options) rewritePages(rewrites []pageRewrite) error {
+	if len(rewrites) == 0 {
+		return nil
+	}
+	basePath := opts.ContentPath()
+	var pages []string
+	var size int64
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		pages = append(pages, path)
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		count   int
+		errOnce sync.Once
+		werr    error
+	)
+	queue := make(chan string)
+	for range opts.pageWorkers(len(pages), size) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				changed, err := opts.rewritePage(basePath, path, rewrites)
+				if err != nil {
+					errOnce.Do(func() { werr = err })
+					continue
+				}
+				if changed {
+					mu.Lock()
+					count++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, path := range pages {
+		queue <- path
+	}
+	close(queue)
+	wg.Wait()
+
+	if count > 0 {
+		log.Printf("Rewrote %d pages", count)
+	}
+	return werr
+}
+
+// rewritePage applies rewrites to the page at path
+func (opts *Options) rewritePage(basePath, path string, rewrites []pageRewrite) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		opts.pageErrorf("skipping rewrite of %s due to error: %v", path, err)
+		return false, nil
+	}
+	rel, err := filepath.Rel(basePath, path)
+	if err != nil {
+		return false, err
+	}
+	rel = filepath.ToSlash(rel)
+	changed := false
+	for _, rewrite := range rewrites {
+		if out, ok := rewrite(rel, b); ok {
+			b, changed = out, true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, os.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	opts := &Options{
+		SourcePath:     "/foo/bar/baz.chm",
+		Outdir:         "tmp/baz.docset",
+		LowercasePaths: true,
+		Lang:           "de",
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	for i := 0; i < 20; i++ {
+		page := fmt.Sprintf(`<html><body><a href="Page%d.htm">next</a></body></html>`, (i+1)%20)
+		os.WriteFile(fmt.Sprintf("%s/Page%d.htm", content, i), []byte(page), 0644)
+	}
+
+	if err := opts.Rewrite(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		b, _ := os.ReadFile(fmt.Sprintf("%s/page%d.htm", content, i))
+		Test{string(b), fmt.Sprintf(`<html lang="de"><body><a href="page%d.htm">next</a></body></html>`, (i+1)%20)}.Compare(t)
+	}
+}
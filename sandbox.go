@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// defaultExtractTimeout bounds the run of an external extractor
+const defaultExtractTimeout = 10 * time.Minute
+
+// sandboxEnv lists the variables passed on to external extractors. Windows
+// programs fail to start without SYSTEMROOT.
+var sandboxEnv = []string{"PATH", "SYSTEMROOT", "WINDIR"}
+
+// runSandboxed runs an external extractor on a CHM that may come from
+// anywhere. It gets a minimal environment and a scratch working directory
+// of its own below temp, so that stray files it writes do not end up among
+// the content and are removed with the other temporary files, or kept
+// under -keep-temp; arguments must be absolute paths. Its output is
+// returned rather than passed through, and it is killed when ctx ends.
+func runSandboxed(ctx context.Context, temp *tempRoot, bin string, args ...string) (string, error) {
+	scratch, err := temp.Dir("sandbox")
+	if err != nil {
+		return "", err
+	}
+	if !temp.Keep() {
+		defer os.RemoveAll(scratch)
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = scratch
+	cmd.Env = []string{"LC_ALL=C", "HOME=" + scratch, "TMPDIR=" + scratch, "TMP=" + scratch, "TEMP=" + scratch}
+	for _, name := range sandboxEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	// Stdin is the null device. Only the output pipes are inherited, as Go
+	// opens every other descriptor close-on-exec; WaitDelay stops waiting
+	// for them when a child process left behind keeps them open.
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = 5 * time.Second
+
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s timed out: %w", filepath.Base(bin), ctx.Err())
+	}
+	return out.String(), err
+}
+
+// scrubOutput removes what an external extractor wrote below dir other than
+// directories and regular files, such as symbolic links pointing out of the
+// docset, and drops execute and set-id bits
+func scrubOutput(dir string) error {
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Chmod(path, 0755)
+		case d.Type().IsRegular():
+			return os.Chmod(path, 0644)
+		}
+		removed++
+		return os.Remove(path)
+	})
+	if removed > 0 {
+		log.Printf("Removed %d links or special files written by the extractor", removed)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	objectRE   = regexp.MustCompile(`(?is)<object\b[^>]*>(.*?)</object\s*>`)
+	objParamRE = regexp.MustCompile(`(?i)<param\s+name\s*=\s*["']?([^"'\s>]+)["']?\s+value\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]*))`)
+	urlRE      = regexp.MustCompile(`(?i)^(?:https?|ftp|mailto):`)
+)
+
+// Programs that open a URL given as their parameter
+var browsers = map[string]bool{
+	"iexplore.exe": true, "explorer.exe": true, "msedge.exe": true,
+	"chrome.exe": true, "firefox.exe": true,
+}
+
+// Shortcuts returns the rewrite of HTML Help ShortCut objects, which launch
+// a program from a help page. Shortcuts opening a URL become links to it;
+// those launching other programs are removed with a warning.
+func (opts *Options) Shortcuts() (pageRewrite, error) {
+	return func(rel string, b []byte) ([]byte, bool) {
+		var out bytes.Buffer
+		last := 0
+		for _, m := range objectRE.FindAllSubmatchIndex(b, -1) {
+			params := objectParams(b[m[2]:m[3]])
+			if !strings.EqualFold(params["command"], "shortcut") {
+				continue
+			}
+			out.Write(b[last:m[0]])
+			last = m[1]
+
+			program, target := shortcutTarget(params["item1"])
+			if target == "" {
+				opts.warnf("removed shortcut launching %q from %s", program, rel)
+				continue
+			}
+			text := target
+			if button := params["button"]; strings.HasPrefix(strings.ToLower(button), "text:") {
+				text = button[len("text:"):]
+			}
+			fmt.Fprintf(&out, `<a href="%s">%s</a>`, html.EscapeString(target), html.EscapeString(text))
+		}
+		if last == 0 {
+			return b, false
+		}
+		out.Write(b[last:])
+		return out.Bytes(), true
+	}, nil
+}
+
+// objectParams returns the <param> values of an object by lower-case name
+func objectParams(content []byte) map[string]string {
+	params := map[string]string{}
+	for _, m := range objParamRE.FindAllSubmatch(content, -1) {
+		value := string(m[2]) + string(m[3]) + string(m[4])
+		params[strings.ToLower(string(m[1]))] = html.UnescapeString(value)
+	}
+	return params
+}
+
+// shortcutTarget parses the Item1 parameter of a shortcut, "window,program,
+// parameters", and returns the program and the URL it opens, if any
+func shortcutTarget(item string) (program, target string) {
+	parts := strings.SplitN(item, ",", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	program = strings.TrimSpace(parts[1])
+	args := strings.TrimSpace(parts[2])
+	switch {
+	case urlRE.MatchString(program):
+		return program, program
+	case urlRE.MatchString(args) && !strings.ContainsAny(args, " \t") &&
+		browsers[strings.ToLower(path.Base(strings.ReplaceAll(program, `\`, "/")))]:
+		return program, args
+	}
+	return program, ""
+}
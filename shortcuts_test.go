@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShortcuts(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	opts.report = opts.newReport()
+	rewrite, _ := opts.Shortcuts()
+
+	page := `<p>Visit <OBJECT id=hhctrl type="application/x-oleobject" classid="clsid:adb880a6-d8ff-11cf-9377-00aa003b7a11">
+<PARAM name="Command" value="ShortCut">
+<PARAM name="Button" value="Text:our site">
+<PARAM name="Item1" value=",iexplore.exe,http://example.com/?a=1&amp;b=2">
+</OBJECT> or <object type="application/x-oleobject"><param name="Command" value="ShortCut"><param name="Item1" value=",https://example.org,"></object>.
+<OBJECT classid="clsid:adb880a6-d8ff-11cf-9377-00aa003b7a11"><PARAM name="Command" value="ShortCut"><PARAM name="Item1" value=",notepad.exe,readme.txt"></OBJECT>
+<object data="movie.swf"><param name="quality" value="high"></object></p>`
+	out, ok := rewrite("a.htm", []byte(page))
+	Test{ok, true}.Compare(t)
+	Test{string(out), `<p>Visit <a href="http://example.com/?a=1&amp;b=2">our site</a> or <a href="https://example.org">https://example.org</a>.
+
+<object data="movie.swf"><param name="quality" value="high"></object></p>`}.Compare(t)
+	Test{opts.sourceReport().Warnings, []string{`removed shortcut launching "notepad.exe" from a.htm`}}.DeepEqual(t)
+
+	_, ok = rewrite("b.htm", []byte(`<object data="movie.swf"></object>`))
+	Test{ok, false}.Compare(t)
+}
+
+func TestShortcutTarget(t *testing.T) {
+	for _, test := range []struct {
+		item, program, target string
+	}{
+		{",http://example.com,", "http://example.com", "http://example.com"},
+		{`,C:\Program Files\Internet Explorer\iexplore.exe,http://example.com`, `C:\Program Files\Internet Explorer\iexplore.exe`, "http://example.com"},
+		{",notepad.exe,http://example.com", "notepad.exe", ""},
+		{",cmd.exe,/c del", "cmd.exe", ""},
+		{"", "", ""},
+	} {
+		program, target := shortcutTarget(test.item)
+		Test{program, test.program}.Compare(t)
+		Test{target, test.target}.Compare(t)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const sidecarSuffix = ".chm2docset.yaml"
+
+// sidecar holds the settings stored next to a CHM file. Flags given on the
+// command line take precedence over them.
+type sidecar struct {
+	Name     string   `yaml:"name"`
+	Icon     string   `yaml:"icon"`
+	Platform string   `yaml:"platform"`
+	Keywords []string `yaml:"keywords"`
+	Exclude  []string `yaml:"exclude"`
+	Rules    struct {
+		OnlyTypes      string `yaml:"only-types"`
+		DropTypes      string `yaml:"drop-types"`
+		Deprecated     string `yaml:"deprecated"`
+		LowPriority    string `yaml:"low-priority"`
+		SourcePriority string `yaml:"source-priority"`
+		Duplicates     string `yaml:"duplicates"`
+		TypeRules      string `yaml:"type-rules"`
+		DefaultType    string `yaml:"default-type"`
+		// DirTypes maps directory prefixes to entry types
+		DirTypes map[string]string `yaml:"dir-types"`
+	} `yaml:"rules"`
+}
+
+// sidecarPath returns the path of the settings file of a source, e.g.
+// vcl.chm2docset.yaml for vcl.chm
+func sidecarPath(source string) string {
+	return strings.TrimSuffix(source, filepath.Ext(source)) + sidecarSuffix
+}
+
+// readSidecar reads a settings file, returning nil if there is none
+func readSidecar(path string) (*sidecar, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s sidecar
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Icon != "" && !filepath.IsAbs(s.Icon) {
+		s.Icon = filepath.Join(filepath.Dir(path), s.Icon)
+	}
+	if s.Rules.TypeRules != "" && !filepath.IsAbs(s.Rules.TypeRules) {
+		s.Rules.TypeRules = filepath.Join(filepath.Dir(path), s.Rules.TypeRules)
+	}
+	return &s, nil
+}
+
+// applySidecar applies the settings file of the source, if any
+func (opts *Options) applySidecar() error {
+	path := sidecarPath(opts.SourcePath)
+	s, err := readSidecar(path)
+	if s == nil || err != nil {
+		return err
+	}
+	log.Printf("Using settings from %s", path)
+
+	set := func(flagName string, dst *string, value string) {
+		if value != "" && !opts.setFlags[flagName] {
+			*dst = value
+		}
+	}
+	set("name", &opts.Name, s.Name)
+	set("icon", &opts.Icon, s.Icon)
+	set("platform", &opts.Platform, s.Platform)
+	set("only-types", &opts.OnlyTypes, s.Rules.OnlyTypes)
+	set("drop-types", &opts.DropTypes, s.Rules.DropTypes)
+	set("deprecated", &opts.Deprecated, s.Rules.Deprecated)
+	set("low-priority", &opts.LowPriority, s.Rules.LowPriority)
+	set("source-priority", &opts.SourcePriority, s.Rules.SourcePriority)
+	set("duplicates", &opts.Duplicates, s.Rules.Duplicates)
+	set("dir-types", &opts.DirTypes, joinDirTypes(s.Rules.DirTypes))
+	set("type-rules", &opts.TypeRules, s.Rules.TypeRules)
+	set("default-type", &opts.DefaultType, s.Rules.DefaultType)
+	if len(s.Keywords) > 0 && !opts.setFlags["keyword"] {
+		opts.Keywords = append(stringList(nil), s.Keywords...)
+	}
+	// Exclusions add up
+	opts.Excludes = append(append(stringList(nil), opts.Excludes...), s.Exclude...)
+	return nil
+}
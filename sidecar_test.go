@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestSidecarPath(t *testing.T) {
+	Test{sidecarPath("/foo/vcl.chm"), "/foo/vcl.chm2docset.yaml"}.Compare(t)
+	Test{sidecarPath("vcl"), "vcl.chm2docset.yaml"}.Compare(t)
+}
+
+func TestApplySidecar(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp/in", 0755)
+	os.WriteFile("tmp/in/vcl.chm2docset.yaml", []byte(`name: Delphi VCL
+icon: vcl.png
+platform: vcl
+keywords: [vcl, delphi]
+exclude:
+  - ^legacy/
+rules:
+  drop-types: Guide
+  dir-types:
+    tutorials/: Guide
+    reference/functions/: Function
+  type-rules: types.yaml
+`), 0644)
+
+	os.Args = []string{"chm2docset", "-platform", "delphi", "-exclude", "^old/", "tmp/in/vcl.chm"}
+	opts := NewOptions()
+	builds, err := opts.Builds()
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	opts = builds[0]
+	for _, test := range []Test{
+		{opts.Name, "Delphi VCL"},
+		{opts.DocsetPath(), "Delphi VCL.docset"},
+		{opts.Icon, "tmp/in/vcl.png"},
+		{opts.Platform, "delphi"},
+		{opts.Keyword(), "vcl,delphi"},
+		{opts.DropTypes, "Guide"},
+		{opts.DirTypes, "reference/functions/=Function,tutorials/=Guide"},
+		{opts.TypeRules, "tmp/in/types.yaml"},
+	} {
+		test.Compare(t)
+	}
+	Test{[]string(opts.Excludes), []string{"^old/", "^legacy/"}}.DeepEqual(t)
+}
+
+func TestApplySidecarInvalid(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp/in", 0755)
+	os.WriteFile("tmp/in/vcl.chm2docset.yaml", []byte("nmae: typo\n"), 0644)
+	opts := &Options{SourcePath: "tmp/in/vcl.chm"}
+	Test{opts.applySidecar() != nil, true}.Compare(t)
+
+	opts = &Options{SourcePath: "tmp/in/other.chm"}
+	Test{opts.applySidecar(), nil}.Compare(t)
+}
+
+func TestExcludePaths(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+		Excludes:   stringList{"^legacy/", `\.txt$`},
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	tx, _ := db.Begin()
+	for _, path := range []string{"a.htm", "legacy/b.htm", "c.txt", "sub/legacy/d.htm"} {
+		tx.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, 'Guide', ?)", path, path)
+	}
+	if err := opts.finalizeIndex(tx); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	tx.Commit()
+	Test{countEntries(db), 2}.Compare(t)
+}
+
+func TestCopyIcon(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp", Icon: "tmp/icon.gif"}
+	opts.CreateDirectory()
+	Test{opts.CopyIcon() != nil, true}.Compare(t)
+
+	os.WriteFile("tmp/logo.png", []byte("\x89PNG"), 0644)
+	opts.Icon = "tmp/logo.png"
+	if err := opts.CopyIcon(); err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile("tmp/baz.docset/icon.png")
+	Test{string(b), "\x89PNG"}.Compare(t)
+}
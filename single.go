@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const formatHTMLSingle = "html-single"
+
+// Characters replaced in the section ids of pages
+var sectionIDRE = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+var singleTmpl = template.Must(template.New("single").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+{{range .Styles}}<link rel="stylesheet" href="{{.}}">
+{{end}}<style>
+section.chm2docset-page { break-before: page; }
+nav.chm2docset-toc { break-after: page; }
+</style>
+</head>
+<body>
+<nav class="chm2docset-toc">
+<h1>{{.Name}}</h1>
+{{.TOC}}
+</nav>
+{{.Pages}}
+</body>
+</html>
+`))
+
+// exportHTMLSingle concatenates the pages in table of contents order, then
+// the pages missing from it, into one HTML file for printing or PDF
+// rendering. Each page becomes a section whose ids are prefixed with the
+// section id, and links between pages point at the sections. Images and
+// other files are kept beside the file.
+func (opts *Options) exportHTMLSingle() error {
+	out := opts.ExportPath()
+	pages, err := opts.singlePages()
+	if err != nil {
+		return err
+	}
+	ids := map[string]string{}
+	taken := map[string]bool{}
+	for _, page := range pages {
+		base := "page-" + strings.Trim(sectionIDRE.ReplaceAllString(page, "-"), "-")
+		id := base
+		for i := 2; taken[id]; i++ {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		taken[id] = true
+		ids[page] = id
+	}
+	toc, err := opts.singleTOC(ids)
+	if err != nil {
+		return err
+	}
+
+	files := newPathMap()
+	for _, page := range pages {
+		files.Add(page, page)
+	}
+	if err := os.Rename(opts.ContentPath(), out); err != nil {
+		return err
+	}
+	var body strings.Builder
+	var styles []string
+	seenStyle := map[string]bool{}
+	for _, page := range pages {
+		p := filepath.Join(out, filepath.FromSlash(page))
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		doc, err := html.Parse(strings.NewReader(decodeToUTF8(b, "")))
+		if err != nil {
+			opts.pageErrorf("skipping %s due to error: %v", page, err)
+			continue
+		}
+		s := &singlePage{page: page, ids: ids, files: files}
+		for _, style := range s.styles(doc) {
+			if !seenStyle[style] {
+				seenStyle[style] = true
+				styles = append(styles, style)
+			}
+		}
+		fmt.Fprintf(&body, "<section class=\"chm2docset-page\" id=\"%s\">\n", ids[page])
+		if pageBody := findElement(doc, atom.Body); pageBody != nil {
+			s.rewrite(pageBody)
+			for child := pageBody.FirstChild; child != nil; child = child.NextSibling {
+				if err := html.Render(&body, child); err != nil {
+					return err
+				}
+			}
+		}
+		body.WriteString("\n</section>\n")
+	}
+	for _, page := range pages {
+		if err := os.Remove(filepath.Join(out, filepath.FromSlash(page))); err != nil {
+			return err
+		}
+	}
+	for _, ext := range []string{".hhc", ".hhk"} {
+		if sitemap := findFileByExt(out, ext); sitemap != "" {
+			os.Remove(sitemap)
+		}
+	}
+
+	file := filepath.Join(out, opts.Basename()+".html")
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = singleTmpl.Execute(f, struct {
+		Name   string
+		Styles []string
+		TOC    template.HTML
+		Pages  template.HTML
+	}{opts.Title(), styles, toc, template.HTML(body.String())})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		log.Printf("Exported %d pages to %s", len(pages), file)
+	}
+	return err
+}
+
+// singlePages returns the pages in table of contents order, followed by the
+// pages missing from it
+func (opts *Options) singlePages() ([]string, error) {
+	var pages []string
+	seen := map[string]bool{}
+	if hhcPath := findFileByExt(opts.ContentPath(), ".hhc"); hhcPath != "" {
+		b, err := os.ReadFile(hhcPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+			if item.Local == "" {
+				continue
+			}
+			if page, _, ok := opts.resolveLocal(item.Local); ok && !seen[page] && isHTMLFile(page) {
+				seen[page] = true
+				pages = append(pages, page)
+			}
+		}
+	}
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(p) {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); !seen[rel] {
+			seen[rel] = true
+			pages = append(pages, rel)
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// singleTOC renders the HHC tree as nested lists of links to the sections
+func (opts *Options) singleTOC(ids map[string]string) (template.HTML, error) {
+	hhcPath := findFileByExt(opts.ContentPath(), ".hhc")
+	if hhcPath == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(hhcPath)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	depth := 0
+	for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+		level := len(item.Parents) + 1
+		for ; depth < level; depth++ {
+			out.WriteString("<ul>")
+		}
+		for ; depth > level; depth-- {
+			out.WriteString("</ul>")
+		}
+		name := template.HTMLEscapeString(item.Name)
+		page, fragment, ok := opts.resolveLocal(item.Local)
+		id, isPage := ids[page]
+		if item.Local == "" || !ok || !isPage {
+			out.WriteString("<li>" + name + "</li>")
+			continue
+		}
+		if fragment = strings.TrimPrefix(fragment, "#"); fragment != "" {
+			id += "-" + fragment
+		}
+		out.WriteString(`<li><a href="#` + template.HTMLEscapeString(id) + `">` + name + "</a></li>")
+	}
+	for ; depth > 0; depth-- {
+		out.WriteString("</ul>")
+	}
+	return template.HTML(out.String()), nil
+}
+
+// singlePage rewrites a page for the single file
+type singlePage struct {
+	page  string
+	ids   map[string]string
+	files *pathMap
+}
+
+// styles returns the style sheets linked from the head of the page
+func (s *singlePage) styles(doc *html.Node) []string {
+	head := findElement(doc, atom.Head)
+	if head == nil {
+		return nil
+	}
+	var styles []string
+	for n := head.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link && strings.EqualFold(attr(n, "rel"), "stylesheet") {
+			if href := s.link(attr(n, "href")); href != "" {
+				styles = append(styles, href)
+			}
+		}
+	}
+	return styles
+}
+
+// rewrite prefixes the ids of the page, points links at sections and
+// rebases other links on the directory of the file. Scripts and frame
+// targets are dropped.
+func (s *singlePage) rewrite(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && child.DataAtom == atom.Script {
+			n.RemoveChild(child)
+		} else {
+			s.rewrite(child)
+		}
+		child = next
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "target":
+			continue
+		case "id", "name":
+			if n.DataAtom == atom.A || a.Key == "id" {
+				a.Val = s.ids[s.page] + "-" + a.Val
+			}
+		case "href", "src":
+			a.Val = s.link(a.Val)
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+// link returns a link of the page as seen from the single file
+func (s *singlePage) link(link string) string {
+	if strings.HasPrefix(link, "#") {
+		return "#" + s.ids[s.page] + "-" + link[1:]
+	}
+	target, ok := resolveLink(s.page, link)
+	if !ok {
+		return link
+	}
+	fragment := ""
+	if i := strings.IndexByte(link, '#'); i >= 0 {
+		fragment = link[i+1:]
+	}
+	if found, ok := s.files.Lookup(target); ok {
+		target = found
+	}
+	if id, ok := s.ids[target]; ok {
+		if fragment != "" {
+			id += "-" + fragment
+		}
+		return "#" + id
+	}
+	if fragment != "" {
+		fragment = "#" + fragment
+	}
+	return escapeLink(path.Clean(target)) + fragment
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportHTMLSingle(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Format: formatHTMLSingle}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Nested"><param name="Local" value="sub/test4.htm#x"></OBJECT>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="First"><param name="Local" value="test1.htm"></OBJECT>
+</UL>`), 0644)
+	os.WriteFile(opts.ContentPath()+"/sub/test4.htm", []byte(`<html><head><link rel="stylesheet" href="../style.css"></head><body>
+<a name="x"></a><a href="../TEST1.htm#y" target="main">first</a><a href="#x">here</a><img src="pic.gif"><script>x()</script>
+</body></html>`), 0644)
+
+	if err := opts.Export(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile("tmp/Sample/baz.html")
+	content := string(b)
+	for _, s := range []string{
+		`<link rel="stylesheet" href="style.css">`,
+		`<ul><li><a href="#page-sub-test4.htm-x">Nested</a></li><li><a href="#page-test1.htm">First</a></li></ul>`,
+		`<section class="chm2docset-page" id="page-sub-test4.htm">`,
+		`<a name="page-sub-test4.htm-x"></a><a href="#page-test1.htm-y">first</a><a href="#page-sub-test4.htm-x">here</a><img src="sub/pic.gif"/>`,
+		`<section class="chm2docset-page" id="page-test2.htm">`,
+	} {
+		Test{strings.Contains(content, s), true}.Compare(t)
+	}
+	Test{strings.Index(content, `id="page-sub-test4.htm"`) < strings.Index(content, `id="page-test1.htm"`), true}.Compare(t)
+	Test{strings.Contains(content, "<script>"), false}.Compare(t)
+	_, err := os.Stat("tmp/Sample/test1.htm")
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory of the pages within an exported site
+const sitePagesDir = "pages"
+
+var siteTmpl = template.Must(template.New("site").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { margin: 0; display: flex; height: 100vh; font-family: sans-serif; font-size: 14px; }
+nav { width: 300px; overflow: auto; padding: 8px; border-right: 1px solid #ccc; box-sizing: border-box; }
+nav input { width: 100%; box-sizing: border-box; }
+nav ul { padding-left: 16px; margin: 4px 0; }
+nav a { text-decoration: none; }
+#results:empty { display: none; }
+#results small { color: #888; }
+iframe { flex: 1; border: 0; height: 100%; }
+</style>
+</head>
+<body>
+<nav>
+<input id="search" type="search" placeholder="Search" autofocus>
+<ul id="results"></ul>
+<div id="toc">{{.TOC}}</div>
+</nav>
+<iframe name="content" src="{{.Start}}"></iframe>
+<script src="search-index.js"></script>
+<script src="search.js"></script>
+</body>
+</html>
+`))
+
+// siteSearchScript searches the entries of search-index.js, listing names
+// starting with the query before names containing it
+const siteSearchScript = `(function () {
+  var input = document.getElementById("search");
+  var results = document.getElementById("results");
+  var toc = document.getElementById("toc");
+  input.addEventListener("input", function () {
+    var q = input.value.trim().toLowerCase();
+    results.innerHTML = "";
+    toc.style.display = q ? "none" : "";
+    if (!q) return;
+    var prefix = [], inner = [];
+    searchIndex.forEach(function (e) {
+      var i = e.n.toLowerCase().indexOf(q);
+      if (i === 0) prefix.push(e); else if (i > 0) inner.push(e);
+    });
+    prefix.concat(inner).slice(0, 100).forEach(function (e) {
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = "` + sitePagesDir + `/" + e.p;
+      a.target = "content";
+      a.textContent = e.n + " ";
+      var small = document.createElement("small");
+      small.textContent = e.t;
+      a.appendChild(small);
+      li.appendChild(a);
+      results.appendChild(li);
+    });
+  });
+})();
+`
+
+// siteEntry is an index entry in search-index.js, with short keys to keep
+// the file small
+type siteEntry struct {
+	Name string `json:"n"`
+	Type string `json:"t"`
+	Path string `json:"p"`
+}
+
+// exportSite writes the pages with a sidebar holding the table of contents
+// and a client-side search over the index entries. The site works when
+// opened from disk, as the index is loaded as a script.
+func (opts *Options) exportSite() error {
+	site := opts.ExportPath()
+	if err := os.MkdirAll(site, 0755); err != nil {
+		return err
+	}
+	entries, err := opts.siteEntries()
+	if err != nil {
+		return err
+	}
+	toc, err := opts.siteTOC()
+	if err != nil {
+		return err
+	}
+	start := sitePagesDir + "/" + opts.IndexFilePath()
+
+	if err := os.Rename(opts.ContentPath(), filepath.Join(site, sitePagesDir)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(site, "search-index.js"), append(append([]byte("var searchIndex = "), b...), ";\n"...), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(site, "search.js"), []byte(siteSearchScript), 0644); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(site, "index.html"))
+	if err != nil {
+		return err
+	}
+	err = siteTmpl.Execute(f, struct {
+		Name  string
+		TOC   template.HTML
+		Start string
+	}{opts.Title(), toc, start})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		log.Printf("Exported site with %d search entries to %s", len(entries), site)
+	}
+	return err
+}
+
+// siteEntries reads the index entries, sorted by name
+func (opts *Options) siteEntries() ([]siteEntry, error) {
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT name, type, path FROM searchIndex ORDER BY name COLLATE NOCASE, type, path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []siteEntry{}
+	for rows.Next() {
+		var e siteEntry
+		if err := rows.Scan(&e.Name, &e.Type, &e.Path); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// siteTOC renders the HHC tree as nested lists of links opening in the
+// content frame, or returns "" without an HHC file
+func (opts *Options) siteTOC() (template.HTML, error) {
+	hhcPath := findFileByExt(opts.ContentPath(), ".hhc")
+	if hhcPath == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(hhcPath)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	depth := 0
+	for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+		level := len(item.Parents) + 1
+		for ; depth < level; depth++ {
+			out.WriteString("<ul>")
+		}
+		for ; depth > level; depth-- {
+			out.WriteString("</ul>")
+		}
+		name := template.HTMLEscapeString(item.Name)
+		page, fragment, ok := opts.resolveLocal(item.Local)
+		if item.Local == "" || !ok {
+			out.WriteString("<li>" + name + "</li>")
+			continue
+		}
+		href := template.HTMLEscapeString(sitePagesDir + "/" + escapeLink(page) + fragment)
+		out.WriteString(`<li><a href="` + href + `" target="content">` + name + "</a></li>")
+	}
+	for ; depth > 0; depth-- {
+		out.WriteString("</ul>")
+	}
+	return template.HTML(out.String()), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportSite(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Format: formatSite}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/toc.hhc", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="First &amp; foremost"><param name="Local" value="test1.htm"></OBJECT>
+<UL><LI><OBJECT type="text/sitemap"><param name="Name" value="Nested"><param name="Local" value="sub/test4.htm#x"></OBJECT></UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Folder"></OBJECT>
+</UL>`), 0644)
+	opts.CreateDatabase()
+	opts.ChooseIndexFile()
+
+	if err := opts.Export(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	_, err := os.Stat("tmp/Sample.docset")
+	Test{os.IsNotExist(err), true}.Compare(t)
+	_, err = os.Stat("tmp/Sample/pages/sub/test4.htm")
+	Test{err, nil}.Compare(t)
+
+	b, _ := os.ReadFile("tmp/Sample/index.html")
+	for _, s := range []string{
+		`<title>baz</title>`,
+		`<ul><li><a href="pages/test1.htm" target="content">First &amp; foremost</a></li><ul><li><a href="pages/sub/test4.htm#x" target="content">Nested</a></li></ul><li>Folder</li></ul>`,
+		`<iframe name="content" src="pages/test1.htm"></iframe>`,
+	} {
+		Test{strings.Contains(string(b), s), true}.Compare(t)
+	}
+	b, _ = os.ReadFile("tmp/Sample/search-index.js")
+	Test{strings.HasPrefix(string(b), `var searchIndex = [{"n":"First \u0026 foremost","t":"Guide","p":"test1.htm"}`), true}.Compare(t)
+}
+
+func TestCheckFormat(t *testing.T) {
+	for _, test := range []Test{
+		{(&Options{}).checkFormat(), nil},
+		{(&Options{Format: "site"}).checkFormat(), nil},
+		{(&Options{Format: "pdf"}).checkFormat() != nil, true},
+	} {
+		test.Compare(t)
+	}
+}
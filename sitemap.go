@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Tokens that define the nesting of HHK/HHC sitemap entries
+var sitemapTokenRE = regexp.MustCompile(`(?is)<ul\b[^>]*>|</ul\s*>|<object[^>]*>(.*?)</object>`)
+
+// sitemapItem is a single <OBJECT> entry of an HHK or HHC file
+type sitemapItem struct {
+	Name  string
+	Local string
+	// More holds the further Local values of an HHK keyword pointing at
+	// several topics
+	More []string
+	// Parents holds the names of the enclosing entries, outermost first
+	Parents []string
+}
+
+// parseSitemap returns the named entries of an HHK/HHC document in order,
+// keeping track of how they are nested in <UL> lists
+func parseSitemap(content string) []sitemapItem {
+	var items []sitemapItem
+	var stack []string
+	depth := 0
+
+	for _, m := range sitemapTokenRE.FindAllStringSubmatch(content, -1) {
+		token := strings.ToLower(m[0])
+		switch {
+		case strings.HasPrefix(token, "<ul"):
+			depth++
+			continue
+		case strings.HasPrefix(token, "</ul"):
+			if depth > 0 {
+				depth--
+			}
+			continue
+		}
+
+		nameMatch := paramNameRE.FindStringSubmatch(m[1])
+		if len(nameMatch) < 2 {
+			continue
+		}
+		name := strings.Join(strings.Fields(html.UnescapeString(nameMatch[1])), " ")
+		if name == "" {
+			continue
+		}
+		var local string
+		var more []string
+		for i, localMatch := range paramLocalRE.FindAllStringSubmatch(m[1], -1) {
+			if i == 0 {
+				local = filepath.ToSlash(html.UnescapeString(localMatch[1]))
+			} else {
+				more = append(more, filepath.ToSlash(html.UnescapeString(localMatch[1])))
+			}
+		}
+
+		level := depth - 1
+		if level < 0 {
+			level = 0
+		}
+		if level > len(stack) {
+			level = len(stack)
+		}
+		stack = append(stack[:level], name)
+		items = append(items, sitemapItem{
+			Name:    name,
+			Local:   local,
+			More:    more,
+			Parents: append([]string(nil), stack[:level]...),
+		})
+	}
+	return items
+}
+
+// writeSitemapItem writes a sitemap list item
+func writeSitemapItem(w *bytes.Buffer, indent, name string, locals ...string) {
+	w.WriteString(indent + "<LI><OBJECT type=\"text/sitemap\">\n")
+	w.WriteString(indent + "\t<param name=\"Name\" value=\"" + html.EscapeString(name) + "\">\n")
+	for _, local := range locals {
+		w.WriteString(indent + "\t<param name=\"Local\" value=\"" + html.EscapeString(local) + "\">\n")
+	}
+	w.WriteString(indent + "\t</OBJECT>\n")
+}
+
+// writeSitemaps writes the list items toc and index as UTF-8 HHC and HHK
+// files at base with those extensions, leaving out those without items
+func writeSitemaps(base string, toc, index []byte) error {
+	for _, sitemap := range []struct {
+		ext  string
+		list []byte
+	}{{".hhc", toc}, {".hhk", index}} {
+		if len(sitemap.list) == 0 {
+			continue
+		}
+		b := "<HTML>\n<HEAD>\n<meta charset=\"utf-8\">\n</HEAD>\n<BODY>\n<UL>\n" + string(sitemap.list) + "</UL>\n</BODY>\n</HTML>\n"
+		if err := os.WriteFile(base+sitemap.ext, []byte(b), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+const sampleHHC = `<HTML><BODY>
+<OBJECT type="text/site properties"><param name="Window Styles" value="0x800025"></OBJECT>
+<UL>
+	<LI> <OBJECT type="text/sitemap">
+		<param name="Name" value="Introduction">
+		<param name="Local" value="intro.htm">
+		</OBJECT>
+	<LI> <OBJECT type="text/sitemap">
+		<param name="Name" value="Reference">
+		</OBJECT>
+	<UL>
+		<LI> <OBJECT type="text/sitemap">
+			<param name="Name" value="Functions &amp; Macros">
+			<param name="Local" value="ref/funcs.htm">
+			</OBJECT>
+		<UL>
+			<LI> <OBJECT type="text/sitemap">
+				<param name="Name" value="Open">
+				<param name="Local" value="ref/open.htm#top">
+				</OBJECT>
+		</UL>
+	</UL>
+	<LI> <OBJECT type="text/sitemap">
+		<param name="Name" value="Glossary">
+		<param name="Local" value="glossary.htm">
+		</OBJECT>
+</UL>
+</BODY></HTML>`
+
+func TestParseSitemap(t *testing.T) {
+	items := parseSitemap(sampleHHC)
+	Test{items, []sitemapItem{
+		{Name: "Introduction", Local: "intro.htm"},
+		{Name: "Reference"},
+		{Name: "Functions & Macros", Local: "ref/funcs.htm", Parents: []string{"Reference"}},
+		{Name: "Open", Local: "ref/open.htm#top", Parents: []string{"Reference", "Functions & Macros"}},
+		{Name: "Glossary", Local: "glossary.htm"},
+	}}.DeepEqual(t)
+}
+
+func TestParseSitemapKeywordTopics(t *testing.T) {
+	items := parseSitemap(`<UL><LI><OBJECT type="text/sitemap">
+<param name="Name" value="Open">
+<param name="Name" value="Open (File menu)">
+<param name="Local" value="menu.htm#open">
+<param name="Name" value="Open function">
+<param name="Local" value="ref/open.htm">
+</OBJECT></UL>`)
+	Test{items, []sitemapItem{
+		{Name: "Open", Local: "menu.htm#open", More: []string{"ref/open.htm"}},
+	}}.DeepEqual(t)
+}
+
+func TestIndexHHKWithTitles(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	os.WriteFile(opts.ContentPath()+"/index.hhk", []byte(`<UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="yo"><param name="Name" value="First"><param name="Local" value="test1.htm"><param name="Name" value="Second"><param name="Local" value="test2.htm#yo"></OBJECT>
+</UL>`), 0644)
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT name, path FROM searchIndex ORDER BY path, name")
+	var entries []string
+	for rows.Next() {
+		var name, path string
+		rows.Scan(&name, &path)
+		entries = append(entries, name+" "+path)
+	}
+	Test{entries, []string{"test 4 sub/test4.htm", "yo test1.htm", "yo test2.htm#yo"}}.DeepEqual(t)
+}
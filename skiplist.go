@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// skipListPath returns the skip-list file of the source, named after the
+// hash of its content so that it follows the CHM across renames. The list
+// of a source directory is named after the hash of its path. Without -skip
+// and a skip-list directory it returns "", sparing the hash of the source.
+func (opts *Options) skipListPath() (string, error) {
+	dir := opts.SkipDir
+	if dir == "" {
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(config, "chm2docset", "skip")
+	}
+	if len(opts.Skip) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return "", nil
+		}
+	}
+	sum := opts.sourceHash
+	if sum == "" {
+		hash := fileHash
+		if opts.isSourceDir() {
+			hash = dirHash
+		}
+		var err error
+		if sum, err = hash(opts.SourcePath); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, sum+".txt"), nil
+}
+
+// loadSkipList reads the pages skipped in earlier conversions of the same
+// CHM, adds the pages given with -skip and saves the list if it grew
+func (opts *Options) loadSkipList() error {
+	path, err := opts.skipListPath()
+	if err != nil {
+		if len(opts.Skip) == 0 {
+			return nil
+		}
+		return err
+	}
+	if path == "" {
+		return nil
+	}
+	pages, err := readSkipList(path)
+	if err != nil {
+		return err
+	}
+	if len(pages) > 0 {
+		log.Printf("Skipping %d pages listed in %s", len(pages), path)
+	}
+
+	added := false
+	for _, page := range opts.Skip {
+		page = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(page)), "/")
+		if page != "" && !pages[strings.ToLower(page)] {
+			pages[strings.ToLower(page)] = true
+			added = true
+		}
+	}
+	if added {
+		if err := writeSkipList(path, pages); err != nil {
+			return fmt.Errorf("saving skip-list: %w", err)
+		}
+		log.Printf("Saved skip-list %s", path)
+	}
+	opts.skipped = pages
+	return nil
+}
+
+// skips reports whether the page of an entry path is on the skip-list
+func (opts *Options) skips(path string) bool {
+	return opts.skipped[strings.ToLower(pageOf(path))]
+}
+
+// readSkipList reads one page path per line, ignoring blank lines and lines
+// starting with #. Paths are lower-cased as CHM paths are case-insensitive.
+func readSkipList(path string) (map[string]bool, error) {
+	pages := map[string]bool{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pages, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pages[strings.ToLower(line)] = true
+	}
+	return pages, scanner.Err()
+}
+
+func writeSkipList(path string, pages map[string]bool) error {
+	sorted := make([]string, 0, len(pages))
+	for page := range pages {
+		sorted = append(sorted, page)
+	}
+	sort.Strings(sorted)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	content := "# Pages left out of the index, one per line\n" + strings.Join(sorted, "\n") + "\n"
+	return os.WriteFile(path, []byte(content), 0644)
+}
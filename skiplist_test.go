@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSkipList(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/a.chm", []byte("same content"), 0644)
+	os.WriteFile("tmp/b.chm", []byte("same content"), 0644)
+
+	opts := &Options{SourcePath: "tmp/a.chm", SkipDir: "tmp/skip", Skip: stringList{"/Sub/Print.htm"}}
+	if err := opts.loadSkipList(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	Test{opts.skips("sub/print.htm#x"), true}.Compare(t)
+	path, _ := opts.skipListPath()
+	b, _ := os.ReadFile(path)
+	Test{strings.HasSuffix(string(b), "\nsub/print.htm\n"), true}.Compare(t)
+
+	// A copy of the same CHM gets the same skip-list without -skip
+	opts = &Options{SourcePath: "tmp/b.chm", SkipDir: "tmp/skip", Outdir: "tmp/out"}
+	if err := opts.loadSkipList(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	Test{opts.skips("Sub/Print.htm"), true}.Compare(t)
+	Test{opts.skips("sub/index.htm"), false}.Compare(t)
+
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	tx, _ := db.Begin()
+	tx.Exec("INSERT INTO searchIndex(name, type, path) VALUES ('Print', 'Guide', 'Sub/Print.htm'), ('Index', 'Guide', 'sub/index.htm')")
+	opts.finalizeIndex(tx)
+	tx.Commit()
+	Test{countEntries(db), 1}.Compare(t)
+}
+
+func TestSkipListNoHash(t *testing.T) {
+	defer cleanTmp()
+	// Without -skip nor a skip-list directory the source is not read
+	opts := &Options{SourcePath: "/no/such.chm", SkipDir: "tmp/skip"}
+	path, err := opts.skipListPath()
+	Test{path, ""}.Compare(t)
+	Test{err, nil}.Compare(t)
+
+	// The hash of a batch is reused
+	os.MkdirAll("tmp/skip", 0755)
+	opts.sourceHash = "0123"
+	path, err = opts.skipListPath()
+	Test{path, "tmp/skip/0123.txt"}.Compare(t)
+	Test{err, nil}.Compare(t)
+}
+
+func TestSkipListMissingSource(t *testing.T) {
+	opts := &Options{SourcePath: "/no/such.chm", SkipDir: "tmp/skip"}
+	Test{opts.loadSkipList(), nil}.Compare(t)
+	opts.Skip = stringList{"a.htm"}
+	Test{opts.loadSkipList() != nil, true}.Compare(t)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reasons for leaving a page out of the index, as written to the report
+const (
+	skipNoTitle       = "no-title"
+	skipReadError     = "read-error"
+	skipDecodeError   = "decode-error"
+	skipExcluded      = "excluded"
+	skipSkipList      = "skip-list"
+	skipHelperPage    = "helper-page"
+	skipOtherLanguage = "other-language"
+	skipUnlisted      = "unlisted"
+)
+
+// errDecode is returned for text that is not valid in its charset
+var errDecode = errors.New("text does not decode from its charset")
+
+// SkippedPage is a page without index entries and the reason why
+type SkippedPage struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// skipPage records why a page got no index entries. The first reason given
+// for a page is kept.
+func (opts *Options) skipPage(page, reason string) {
+	src := opts.sourceReport()
+	if src == nil {
+		return
+	}
+	key := strings.ToLower(page)
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	if src.skipped[key] {
+		return
+	}
+	if src.skipped == nil {
+		src.skipped = map[string]bool{}
+	}
+	src.skipped[key] = true
+	src.Skipped = append(src.Skipped, SkippedPage{page, reason})
+}
+
+// readErrorReason returns the skip reason of an error reading a page
+func readErrorReason(err error) string {
+	if errors.Is(err, errDecode) {
+		return skipDecodeError
+	}
+	return skipReadError
+}
+
+// recordUnlisted records the pages that got no entries for a reason not
+// given before, such as being left out of the table of contents, drops the
+// skipped pages that got entries after all and sorts them by path
+func (opts *Options) recordUnlisted(tx *sql.Tx) error {
+	src := opts.sourceReport()
+	if src == nil {
+		return nil
+	}
+	rows, err := tx.Query("SELECT DISTINCT path FROM searchIndex")
+	if err != nil {
+		return err
+	}
+	indexed := map[string]bool{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return err
+		}
+		indexed[strings.ToLower(pageOf(path))] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	basePath := opts.ContentPath()
+	err = filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !indexed[strings.ToLower(rel)] {
+			opts.skipPage(rel, skipUnlisted)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pages skipped by one pass may have been indexed by another
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	kept := src.Skipped[:0]
+	for _, s := range src.Skipped {
+		if !indexed[strings.ToLower(s.Path)] {
+			kept = append(kept, s)
+		}
+	}
+	src.Skipped = kept
+	sort.Slice(src.Skipped, func(i, j int) bool { return src.Skipped[i].Path < src.Skipped[j].Path })
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSkippedPages(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/Sample.docset",
+		Excludes:   stringList{"^test2"},
+	}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	content := opts.ContentPath()
+	os.WriteFile(content+"/print.htm", []byte("<title>Printable</title><body onload=\"window.print()\">"), 0644)
+	os.WriteFile(content+"/bad.htm", []byte("<meta charset=\"utf-8\"><title>Caf\xe9</title>"), 0644)
+	opts.report = opts.newReport()
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+
+	Test{opts.sourceReport().Skipped, []SkippedPage{
+		{"bad.htm", skipDecodeError},
+		{"print.htm", skipHelperPage},
+		{"test2.htm", skipExcluded},
+		{"test3.htm", skipNoTitle},
+	}}.DeepEqual(t)
+}
+
+func TestSkippedUnlisted(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	content := opts.ContentPath()
+	os.WriteFile(content+"/toc.hhc", []byte(`<ul><li><object type="text/sitemap"><param name="Name" value="Listed"><param name="Local" value="listed.htm"></object></ul>`), 0644)
+	os.WriteFile(content+"/listed.htm", []byte(`<title>Listed</title>`), 0644)
+	os.WriteFile(content+"/other.htm", []byte(`<title>Other</title>`), 0644)
+	opts.report = opts.newReport()
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	Test{opts.sourceReport().Skipped, []SkippedPage{{"other.htm", skipUnlisted}}}.DeepEqual(t)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var sourceMapHeader = []string{"name", "type", "path", "chm", "object"}
+
+// sourceObject returns the CHM file a content path was extracted from and
+// its object name inside it, following renames and merged CHMs
+func (opts *Options) sourceObject(page string, originals map[string]string) (file, object string) {
+	if old, ok := originals[strings.ToLower(page)]; ok {
+		page = old
+	}
+	file = filepath.Base(opts.SourcePath)
+	for _, child := range opts.mergedCHMs {
+		if child == nil || child.dir == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(page, child.dir+"/"); ok {
+			return child.file, "/" + rest
+		}
+	}
+	return file, "/" + page
+}
+
+// WriteSourceMap writes every index entry, with the CHM and the internal
+// object name its page was extracted from, to the -source-map CSV file, to
+// trace conversion problems back to the help project
+func (opts *Options) WriteSourceMap() error {
+	if opts.SourceMap == "" {
+		return nil
+	}
+	// Renamed files by their new lower-cased path
+	originals := map[string]string{}
+	if opts.renames != nil {
+		for old, new := range opts.renames.exact {
+			originals[strings.ToLower(new)] = old
+		}
+	}
+
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT name, type, path FROM searchIndex ORDER BY name, type, path")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	f, err := os.Create(opts.SourceMap)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(sourceMapHeader)
+	count := 0
+	for rows.Next() {
+		var name, entryType, path string
+		if err := rows.Scan(&name, &entryType, &path); err != nil {
+			return err
+		}
+		file, object := opts.sourceObject(pageOf(path), originals)
+		w.Write([]string{name, entryType, path, file, object})
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	log.Printf("Wrote the source of %d entries to %s", count, opts.SourceMap)
+	return f.Close()
+}
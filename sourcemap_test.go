@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestSourceObject(t *testing.T) {
+	opts := &Options{SourcePath: "/help/master.chm", mergedCHMs: map[string]*mergedCHM{
+		"master.chm": {file: "master.chm"},
+		"child.chm":  {file: "Child.chm", dir: "Child"},
+		"gone.chm":   nil,
+	}}
+	originals := map[string]string{"html/intro.htm": "HTML/Intro.htm"}
+	for _, test := range []struct {
+		page, file, object string
+	}{
+		{"html/intro.htm", "master.chm", "/HTML/Intro.htm"},
+		{"index.htm", "master.chm", "/index.htm"},
+		{"Child/topics/open.htm", "Child.chm", "/topics/open.htm"},
+		{"Children/a.htm", "master.chm", "/Children/a.htm"},
+	} {
+		file, object := opts.sourceObject(test.page, originals)
+		Test{file, test.file}.Compare(t)
+		Test{object, test.object}.Compare(t)
+	}
+}
+
+func TestWriteSourceMap(t *testing.T) {
+	opts := &Options{
+		SourcePath: "/foo/bar/baz.chm",
+		Outdir:     "tmp/baz.docset",
+		SourceMap:  "tmp/source.csv",
+		renames:    newPathMap(),
+	}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	opts.renames.Add("Forms.htm", "forms.htm")
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	db.Exec(dbSchema)
+	for _, e := range [][]string{
+		{"TForm", "Class", "forms.htm"},
+		{"TForm.Show", "Method", "forms.htm#show"},
+		{"Overview", "Guide", "a%23b.htm"},
+	} {
+		db.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, ?, ?)", e[0], e[1], e[2])
+	}
+	db.Close()
+
+	Test{opts.WriteSourceMap(), nil}.Compare(t)
+	b, _ := os.ReadFile("tmp/source.csv")
+	Test{string(b), "name,type,path,chm,object\n" +
+		"Overview,Guide,a%23b.htm,baz.chm,/a#b.htm\n" +
+		"TForm,Class,forms.htm,baz.chm,/Forms.htm\n" +
+		"TForm.Show,Method,forms.htm#show,baz.chm,/Forms.htm\n"}.Compare(t)
+}
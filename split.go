@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+// Pages of a directory read to detect its language
+const languageSample = 20
+
+// languageDirRE matches directory names that are language tags, such as
+// en, en-us or de_DE
+var languageDirRE = regexp.MustCompile(`^(?i)[a-z]{2}(?:[-_][a-z]{2})?$`)
+
+// splitLanguageBuilds replaces every build with -split-languages whose CHM
+// holds translations in top-level directories by one build per language.
+// The builds of a CHM share its extraction; each drops the directories of
+// the other languages and keeps the rest, such as images, in common.
+func splitLanguageBuilds(builds []*Options) ([]*Options, error) {
+	var out []*Options
+	for _, build := range builds {
+		if !build.SplitLanguages {
+			out = append(out, build)
+			continue
+		}
+		trees, err := languageTrees(build.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("detecting languages of %s: %w", build.SourcePath, err)
+		}
+		if len(trees) < 2 {
+			log.Printf("%s holds a single language, not splitting it", build.SourcePath)
+			out = append(out, build)
+			continue
+		}
+		if strings.HasSuffix(build.Outdir, ".docset") {
+			return nil, fmt.Errorf("-out must be a directory when splitting %s into %d languages", build.SourcePath, len(trees))
+		}
+		langs := make([]string, 0, len(trees))
+		for lang := range trees {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+		log.Printf("Splitting %s into %s", build.SourcePath, strings.Join(langs, ", "))
+		for _, lang := range langs {
+			split := *build
+			split.Name = build.Basename() + "-" + lang
+			split.languageDirs = trees[lang]
+			split.otherLanguageDirs = nil
+			// Files written beside the docset get one per language too
+			split.SourceMap = languageFile(build.SourceMap, lang)
+			split.Ctags = languageFile(build.Ctags, lang)
+			split.DeepLinks = languageFile(build.DeepLinks, lang)
+			for _, other := range langs {
+				if other != lang {
+					split.otherLanguageDirs = append(split.otherLanguageDirs, trees[other]...)
+				}
+			}
+			out = append(out, &split)
+		}
+	}
+	return out, nil
+}
+
+// languageFile returns the path of a file written for the docset of lang,
+// with the language before its extension, or "" if path is
+func languageFile(path, lang string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + lang + ext
+}
+
+// languageTrees returns the top-level directories of a CHM by language.
+// The language of a directory comes from its name if it is a language tag
+// or a Windows locale id such as 1033, else from its first pages.
+// Directories of unknown language are left out.
+func languageTrees(source string) (map[string][]string, error) {
+	r, err := chm.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	pages := map[string][]chm.File{}
+	var dirs []string
+	for _, f := range r.Files() {
+		if !f.IsContent() || !isHTMLFile(f.Name) {
+			continue
+		}
+		name := strings.TrimPrefix(f.Name, "/")
+		dir, _, ok := strings.Cut(name, "/")
+		if !ok {
+			continue
+		}
+		if _, ok := pages[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		pages[dir] = append(pages[dir], f)
+	}
+
+	trees := map[string][]string{}
+	for _, dir := range dirs {
+		lang := dirLanguage(dir)
+		if lang == "" {
+			lang = sampleLanguage(r, pages[dir])
+		}
+		if lang != "" {
+			trees[lang] = append(trees[lang], dir)
+		}
+	}
+	return trees, nil
+}
+
+// dirLanguage returns the primary language named by a directory, or ""
+func dirLanguage(dir string) string {
+	if languageDirRE.MatchString(dir) {
+		return strings.ToLower(dir[:2])
+	}
+	if lcid, err := strconv.ParseUint(dir, 10, 16); err == nil {
+		if tag := lcidTag(uint32(lcid)); tag != "" {
+			return strings.ToLower(tag[:2])
+		}
+	}
+	return ""
+}
+
+// sampleLanguage returns the primary language detected for most of the
+// first pages given, or ""
+func sampleLanguage(r *chm.Reader, pages []chm.File) string {
+	counts := map[string]int{}
+	for _, f := range pages[:min(len(pages), languageSample)] {
+		b, err := r.ReadFile(f.Name)
+		if err != nil {
+			continue
+		}
+		if lang := detectLang(b); lang != "" {
+			counts[strings.ToLower(strings.SplitN(lang, "-", 2)[0])]++
+		}
+	}
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount || n == bestCount && lang < best {
+			best, bestCount = lang, n
+		}
+	}
+	if bestCount*2 <= min(len(pages), languageSample) {
+		return ""
+	}
+	return best
+}
+
+// PruneLanguages removes the directories of the other languages of a CHM
+// split by -split-languages. A default topic in one of them is moved to
+// the same page of the kept language, if it exists.
+func (opts *Options) PruneLanguages() error {
+	basePath := opts.ContentPath()
+	for _, dir := range opts.otherLanguageDirs {
+		if err := os.RemoveAll(filepath.Join(basePath, dir)); err != nil {
+			return err
+		}
+	}
+	if len(opts.otherLanguageDirs) > 0 {
+		log.Printf("Removed the pages of other languages in %s", strings.Join(opts.otherLanguageDirs, ", "))
+	}
+	if topDir, rest, ok := strings.Cut(strings.TrimPrefix(opts.defaultTopic, "/"), "/"); ok && opts.inOtherLanguage(topDir) {
+		for _, dir := range opts.languageDirs {
+			if findPage(basePath, path.Join(dir, stripFragment(rest))) != "" {
+				opts.defaultTopic = dir + "/" + rest
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// inOtherLanguage reports whether a content path lies in a directory
+// removed by PruneLanguages
+func (opts *Options) inOtherLanguage(page string) bool {
+	for _, dir := range opts.otherLanguageDirs {
+		if strings.EqualFold(page, dir) || len(page) > len(dir) && strings.EqualFold(page[:len(dir)+1], dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestDirLanguage(t *testing.T) {
+	for _, test := range []Test{
+		{dirLanguage("en"), "en"},
+		{dirLanguage("de_DE"), "de"},
+		{dirLanguage("EN-us"), "en"},
+		{dirLanguage("1036"), "fr"},
+		{dirLanguage("images"), ""},
+		{dirLanguage("9999"), ""},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestLanguageTrees(t *testing.T) {
+	trees, err := languageTrees("_fixtures/multilang.chm")
+	Test{err, nil}.Compare(t)
+	Test{trees, map[string][]string{"en": {"en"}, "de": {"de"}, "fr": {"1036"}}}.DeepEqual(t)
+	trees, _ = languageTrees("_fixtures/sample.chm")
+	Test{len(trees), 0}.Compare(t)
+}
+
+func TestSplitLanguageBuilds(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "_fixtures/multilang.chm", Outdir: "tmp/out", SplitLanguages: true, SourceMap: "tmp/map.csv"}
+	builds, err := opts.Builds()
+	Test{err, nil}.Compare(t)
+	Test{len(builds), 3}.Compare(t)
+	names := []string{}
+	for _, build := range builds {
+		names = append(names, build.Basename())
+	}
+	Test{names, []string{"multilang-de", "multilang-en", "multilang-fr"}}.DeepEqual(t)
+	Test{builds[0].otherLanguageDirs, []string{"en", "1036"}}.DeepEqual(t)
+	Test{builds[1].SourceMap, "tmp/map-en.csv"}.Compare(t)
+	Test{builds[1].Ctags, ""}.Compare(t)
+
+	Test{runBuilds(builds, 1), nil}.Compare(t)
+	de := builds[0]
+	_, err = os.Stat(de.ContentPath() + "/en")
+	Test{os.IsNotExist(err), true}.Compare(t)
+	_, err = os.Stat(de.ContentPath() + "/img/logo.gif")
+	Test{err, nil}.Compare(t)
+	Test{de.IndexFilePath(), "de/index.htm"}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, de.DatabasePath())
+	defer db.Close()
+	var name string
+	db.QueryRow("SELECT group_concat(name) FROM searchIndex").Scan(&name)
+	Test{name, "Willkommen"}.Compare(t)
+
+	opts = &Options{SourcePath: "_fixtures/multilang.chm", Outdir: "tmp/out.docset", SplitLanguages: true}
+	_, err = opts.Builds()
+	Test{err != nil, true}.Compare(t)
+}
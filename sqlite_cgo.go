@@ -0,0 +1,38 @@
+//go:build cgo_sqlite
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the database/sql driver name of the cgo SQLite
+const sqliteDriver = "sqlite3"
+
+// backupTo copies the database of a driver connection to a new file at
+// path using the SQLite backup API
+func backupTo(driverConn interface{}, path string) error {
+	src, ok := driverConn.(*sqlite3.SQLiteConn)
+	if !ok {
+		return fmt.Errorf("driver does not support backups")
+	}
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	dest := conn.(*sqlite3.SQLiteConn)
+	backup, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+	for done := false; !done; {
+		if done, err = backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+	}
+	return backup.Finish()
+}
@@ -0,0 +1,34 @@
+//go:build !cgo_sqlite
+
+package main
+
+import (
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver name of the pure Go SQLite
+const sqliteDriver = "sqlite"
+
+// backupTo copies the database of a driver connection to a new file at
+// path using the SQLite backup API
+func backupTo(driverConn interface{}, path string) error {
+	src, ok := driverConn.(interface {
+		NewBackup(string) (*sqlite.Backup, error)
+	})
+	if !ok {
+		return fmt.Errorf("driver does not support backups")
+	}
+	backup, err := src.NewBackup(path)
+	if err != nil {
+		return err
+	}
+	for more := true; more; {
+		if more, err = backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+	}
+	return backup.Finish()
+}
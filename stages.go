@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// pipelineStages are the stages of a conversion in their default order
+var pipelineStages = []string{"read", "extract", "transcode", "rewrite", "index", "package", "export"}
+
+// stageAliases names passes that run within a stage rather than on their
+// own: the frames and shortcuts scrub is part of rewrite, and the anchors of
+// indexed table rows and terms are inserted while indexing
+var stageAliases = map[string]string{"sanitize": "rewrite", "anchor": "index"}
+
+// stageOrder returns the stages -stages selects, in the order given, or
+// every stage in its default order. Leaving out extract needs the content
+// of an earlier conversion, which keeps the .hhc and .hhk to index.
+func (opts *Options) stageOrder() ([]string, error) {
+	if strings.TrimSpace(opts.Stages) == "" {
+		return pipelineStages, nil
+	}
+	var order []string
+	given, seen := map[string]bool{}, map[string]bool{}
+	for _, name := range strings.Split(opts.Stages, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		stage := name
+		if alias, ok := stageAliases[name]; ok {
+			stage = alias
+		} else if !slices.Contains(pipelineStages, name) {
+			return nil, fmt.Errorf("unknown stage %q in -stages, expected some of %s, or sanitize or anchor", name, strings.Join(pipelineStages, ", "))
+		}
+		if given[name] {
+			return nil, fmt.Errorf("stage %q is given twice in -stages", name)
+		}
+		given[name] = true
+		// A stage runs once, where it or an alias of it is first given
+		if !seen[stage] {
+			seen[stage] = true
+			order = append(order, stage)
+		}
+	}
+	if !seen["extract"] {
+		if fi, err := os.Stat(opts.ContentPath()); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("-stages leaves out extract, but %s holds no extracted content to run %s on", opts.DocsetPath(), strings.Join(order, ", "))
+		}
+	}
+	return order, nil
+}
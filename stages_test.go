@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestStageOrder(t *testing.T) {
+	order, err := (&Options{}).stageOrder()
+	Test{order, pipelineStages}.DeepEqual(t)
+	Test{err, nil}.Compare(t)
+	order, err = (&Options{Stages: " Rewrite, index,,package ", Outdir: "_fixtures/Sample.docset"}).stageOrder()
+	Test{order, []string{"rewrite", "index", "package"}}.DeepEqual(t)
+	Test{err, nil}.Compare(t)
+	_, err = (&Options{Stages: "index", Outdir: "tmp/Missing.docset"}).stageOrder()
+	Test{err.Error(), "-stages leaves out extract, but tmp/Missing.docset holds no extracted content to run index on"}.Compare(t)
+	order, err = (&Options{Stages: "extract,transcode,sanitize,rewrite,anchor,index,package"}).stageOrder()
+	Test{order, []string{"extract", "transcode", "rewrite", "index", "package"}}.DeepEqual(t)
+	Test{err, nil}.Compare(t)
+	_, err = (&Options{Stages: "extract,scrub"}).stageOrder()
+	Test{err.Error(), `unknown stage "scrub" in -stages, expected some of read, extract, transcode, rewrite, index, package, export, or sanitize or anchor`}.Compare(t)
+	_, err = (&Options{Stages: "index,index"}).stageOrder()
+	Test{err.Error(), `stage "index" is given twice in -stages`}.Compare(t)
+}
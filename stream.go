@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// streamingExtractor is implemented by extractors that pass every file
+// they write to a callback, so that pages are scanned while in memory
+// instead of being read back from disk
+type streamingExtractor interface {
+	ExtractStreaming(ctx context.Context, source, destination string, keep func(name string) bool, visit func(name string, b []byte)) error
+}
+
+// streamedTitles holds the titles of the pages read while extracting, by
+// slash separated path below the content directory. The title scrape takes
+// them from here rather than opening the pages again. Rewrites leave
+// titles alone, so only moves need to be followed.
+type streamedTitles struct {
+	mu     sync.Mutex
+	titles map[string]string
+}
+
+func newStreamedTitles() *streamedTitles {
+	return &streamedTitles{titles: map[string]string{}}
+}
+
+// add records the title of an extracted page. Pages whose title cannot be
+// decoded are left to the title scrape, which reports them.
+func (s *streamedTitles) add(name string, b []byte) {
+	if !isHTMLFile(name) {
+		return
+	}
+	title, err := headerTitle(b[:min(len(b), headerReadLimit)])
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.titles[name] = title
+	s.mu.Unlock()
+}
+
+// lookup returns the title read while extracting a page. A nil set holds
+// no titles.
+func (s *streamedTitles) lookup(rel string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	title, ok := s.titles[rel]
+	return title, ok
+}
+
+// move follows the files moved by moveFiles, which lists every file kept
+func (s *streamedTitles) move(moves map[string]string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	titles := make(map[string]string, len(s.titles))
+	for old, new := range moves {
+		if title, ok := s.titles[old]; ok {
+			titles[new] = title
+		}
+	}
+	s.titles = titles
+}
+
+// clone returns a copy of the set, for a build sharing the extraction of
+// another one but moving its pages on its own
+func (s *streamedTitles) clone() *streamedTitles {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &streamedTitles{titles: maps.Clone(s.titles)}
+}
+
+// reset forgets every title, when another extractor writes the pages again
+func (s *streamedTitles) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.titles = map[string]string{}
+	s.mu.Unlock()
+}
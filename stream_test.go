@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamedTitles(t *testing.T) {
+	opts := &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp/foo.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	Test{opts.ExtractSource(), nil}.Compare(t)
+
+	for _, page := range []string{"index.htm", "page.htm", "sub/lost.htm"} {
+		expected, err := extractTitle(nil, filepath.Join(opts.ContentPath(), filepath.FromSlash(page)))
+		Test{err, nil}.Compare(t)
+		title, ok := opts.streamed.lookup(page)
+		Test{ok, true}.Compare(t)
+		Test{title, expected}.Compare(t)
+	}
+	_, ok := opts.streamed.lookup("img/logo.gif")
+	Test{ok, false}.Compare(t)
+
+	// Titles follow moved pages; pages left out are forgotten
+	opts.streamed.move(map[string]string{"index.htm": "Index.htm", "page.htm": "page.htm"})
+	_, ok = opts.streamed.lookup("index.htm")
+	Test{ok, false}.Compare(t)
+	_, ok = opts.streamed.lookup("Index.htm")
+	Test{ok, true}.Compare(t)
+	_, ok = opts.streamed.lookup("sub/lost.htm")
+	Test{ok, false}.Compare(t)
+}
+
+func TestStreamedTitlesFallback(t *testing.T) {
+	// Titles read by a failed built-in extraction are dropped when 7z
+	// writes the pages again
+	opts := &Options{SourcePath: "_fixtures/Sample.docset/Contents/Info.plist", Outdir: "tmp/foo.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	useFixtureBin()
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	_, ok := opts.streamed.lookup("sub/test.htm")
+	Test{ok, false}.Compare(t)
+	var nilTitles *streamedTitles
+	_, ok = nilTitles.lookup("sub/test.htm")
+	Test{ok, false}.Compare(t)
+}
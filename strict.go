@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"chm2docset/chm"
+)
+
+// errStrict is returned when -strict finds page errors
+var errStrict = errors.New("page errors with -strict")
+
+// pageErrorf reports a page that could not be processed as intended. By
+// default the page is skipped with a warning; with -strict the error is
+// recorded and fails the conversion once the current step is done.
+func (opts *Options) pageErrorf(format string, args ...interface{}) {
+	src := opts.sourceReport()
+	if !opts.Strict || src == nil {
+		opts.warnf(format, args...)
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Error: %s", msg)
+	opts.report.mu.Lock()
+	src.Errors = append(src.Errors, msg)
+	opts.report.mu.Unlock()
+}
+
+// strictErr returns an error summing up the page errors recorded so far, or
+// nil if there are none
+func (opts *Options) strictErr() error {
+	src := opts.sourceReport()
+	if src == nil {
+		return nil
+	}
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	switch len(src.Errors) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w: %s", errStrict, src.Errors[0])
+	}
+	return fmt.Errorf("%d %w, the first: %s", len(src.Errors), errStrict, src.Errors[0])
+}
+
+// CheckPages reports, with -strict, the broken links of the pages and the
+// pages whose text does not decode from their charset
+func (opts *Options) CheckPages() error {
+	if !opts.Strict {
+		return nil
+	}
+	root := opts.ContentPath()
+	// Without a CHM reader every broken link counts as broken in the source
+	r, err := chm.Open(opts.SourcePath)
+	if err == nil {
+		defer r.Close()
+	}
+	problems, err := checkLinks(r, root)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		opts.pageErrorf("%s: %s link to %s", p.Page, p.Reason, p.Target)
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if err := decodeCheck(b); err != nil {
+			opts.pageErrorf("%s: %v", filepath.ToSlash(rel), err)
+		}
+		return nil
+	})
+}
+
+// decodeCheck returns an error if a page names a charset that is not known
+// or is not valid in the charset it names
+func decodeCheck(b []byte) error {
+	charset := detectCharset(b, "")
+	switch charset {
+	case "":
+		return nil
+	case "utf-8", "utf8":
+		if !utf8.Valid(b) {
+			return fmt.Errorf("invalid UTF-8")
+		}
+		return nil
+	}
+	p := decoderPoolFor(charset)
+	if p.err != nil || p.enc == nil {
+		return fmt.Errorf("unknown charset %q", charset)
+	}
+	if _, err := p.enc.NewDecoder().Bytes(b); err != nil {
+		return fmt.Errorf("not valid %s: %v", charset, err)
+	}
+	return nil
+}
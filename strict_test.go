@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeCheck(t *testing.T) {
+	for _, test := range []struct {
+		page string
+		ok   bool
+	}{
+		{`<p>no charset</p>`, true},
+		{`<meta charset="utf-8"><p>Übersicht</p>`, true},
+		{"<meta charset=\"utf-8\"><p>\xdcbersicht</p>", false},
+		{"<meta http-equiv=\"Content-Type\" content=\"text/html; charset=windows-1252\"><p>\xdcbersicht</p>", true},
+		{`<meta charset="x-klingon"><p>nuqneH</p>`, false},
+	} {
+		Test{decodeCheck([]byte(test.page)) == nil, test.ok}.Compare(t)
+	}
+}
+
+func TestPageErrorf(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset"}
+	opts.report = opts.newReport()
+	opts.pageErrorf("skipping %s", "a.htm")
+	Test{len(opts.sourceReport().Warnings), 1}.Compare(t)
+	Test{opts.strictErr(), nil}.Compare(t)
+
+	opts.Strict = true
+	opts.pageErrorf("skipping %s", "b.htm")
+	Test{len(opts.sourceReport().Errors), 1}.Compare(t)
+	Test{opts.strictErr().Error(), "page errors with -strict: skipping b.htm"}.Compare(t)
+	opts.pageErrorf("skipping %s", "c.htm")
+	Test{opts.strictErr().Error(), "2 page errors with -strict, the first: skipping b.htm"}.Compare(t)
+}
+
+func TestStrictConversion(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp/sample.docset"}
+	Test{runBuilds([]*Options{opts}, 1), nil}.Compare(t)
+
+	opts = &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp/strict.docset", Strict: true}
+	err := runBuilds([]*Options{opts}, 1)
+	Test{errors.Is(err, errStrict), true}.Compare(t)
+	Test{opts.sourceReport().Errors, []string{"index.htm: broken in source link to missing.htm"}}.DeepEqual(t)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+// ReadSystem takes the title and the default topic from the #SYSTEM file
+// of the CHM, if it has one, or from the .hhp project given as source
+func (opts *Options) ReadSystem() error {
+	if opts.combined() {
+		// The sources of a combined docset are read as they are extracted
+		return nil
+	}
+	if opts.isProject() {
+		return opts.readProjectSystem()
+	}
+	if isHelp2File(opts.SourcePath) {
+		// Read from the .HxC collection once extracted by ConvertHelp2
+		return nil
+	}
+	r, err := chm.Open(opts.SourcePath)
+	if err != nil {
+		// CheckSource has already reported sources that cannot be read
+		return nil
+	}
+	defer r.Close()
+	s, err := r.System()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		opts.warnf("reading #SYSTEM: %v", err)
+		return nil
+	}
+	lcid := s.LanguageID
+	if lcid == 0 {
+		lcid = r.LanguageID
+	}
+	charset := lcidCharset(lcid)
+	opts.systemTitle = strings.TrimSpace(decodeCharset([]byte(s.Title), charset))
+	opts.defaultTopic = strings.TrimSpace(decodeCharset([]byte(s.DefaultTopic), charset))
+	return nil
+}
+
+// ReadTopics reads the page titles of the topic table of the CHM, so that
+// the title scan need not read those pages
+func (opts *Options) ReadTopics() error {
+	if opts.combined() || isHelp2File(opts.SourcePath) {
+		return nil
+	}
+	r, err := chm.Open(opts.SourcePath)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	topics, err := r.Topics()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		opts.warnf("reading the topic table: %v", err)
+		return nil
+	}
+	charset := chmCharset(r)
+	opts.topics = nil
+	for _, topic := range topics {
+		title := strings.TrimSpace(decodeCharset([]byte(topic.Title), charset))
+		if title != "" && topic.Local != "" {
+			opts.topics = append(opts.topics, chm.Topic{Title: title, Local: stripFragment(topic.Local)})
+		}
+	}
+	return nil
+}
+
+// chmCharset returns the charset of the ANSI strings of the CHM, after the
+// language of #SYSTEM or else of the file header
+func chmCharset(r *chm.Reader) string {
+	lcid := r.LanguageID
+	if s, err := r.System(); err == nil && s.LanguageID != 0 {
+		lcid = s.LanguageID
+	}
+	return lcidCharset(lcid)
+}
+
+// WriteBinaryTOC writes the binary table of contents of a CHM compiled
+// without its .hhc to an .hhc file of the content directory, so that the
+// TOC is indexed and rendered as usual
+func (opts *Options) WriteBinaryTOC() error {
+	basePath := opts.ContentPath()
+	if findFileByExt(basePath, ".hhc") != "" {
+		return nil
+	}
+	r, err := chm.Open(opts.SourcePath)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	toc, err := r.BinaryTOC()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		opts.warnf("reading the binary table of contents: %v", err)
+		return nil
+	}
+	path := filepath.Join(basePath, opts.Basename()+".hhc")
+	if err := os.WriteFile(path, []byte(tocSitemap(toc, chmCharset(r))), 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote the binary table of contents to %s", filepath.Base(path))
+	return nil
+}
+
+// tocSitemap returns entries as an HHC document, decoding their titles from
+// charset
+func tocSitemap(entries []chm.TOCEntry, charset string) string {
+	var b strings.Builder
+	b.WriteString("<HTML>\n<BODY>\n")
+	var write func(entries []chm.TOCEntry, indent string)
+	write = func(entries []chm.TOCEntry, indent string) {
+		b.WriteString(indent + "<UL>\n")
+		for _, e := range entries {
+			title := strings.TrimSpace(decodeCharset([]byte(e.Title), charset))
+			b.WriteString(indent + "\t<LI><OBJECT type=\"text/sitemap\">\n")
+			b.WriteString(indent + "\t\t<param name=\"Name\" value=\"" + html.EscapeString(title) + "\">\n")
+			if e.Local != "" {
+				b.WriteString(indent + "\t\t<param name=\"Local\" value=\"" + html.EscapeString(e.Local) + "\">\n")
+			}
+			b.WriteString(indent + "\t</OBJECT>\n")
+			if len(e.Children) > 0 {
+				write(e.Children, indent+"\t")
+			}
+		}
+		b.WriteString(indent + "</UL>\n")
+	}
+	write(entries, "")
+	b.WriteString("</BODY>\n</HTML>\n")
+	return b.String()
+}
+
+// topicTitles returns the titles of the topic table by the actual path of
+// their page in the content directory
+func (opts *Options) topicTitles() map[string]string {
+	titles := map[string]string{}
+	for _, topic := range opts.topics {
+		if page := opts.findContentFile(topic.Local); page != "" {
+			if _, ok := titles[page]; !ok {
+				titles[page] = topic.Title
+			}
+		}
+	}
+	return titles
+}
+
+// Where pageTitle found a title
+const (
+	titleFromTopics     = "topics"
+	titleFromExtraction = "extraction"
+	titleFromPage       = "page"
+)
+
+// pageTitle returns the title of the page rel, found at path, and where it
+// came from: the topic table, given as returned by topicTitles, ranks
+// first as it holds the titles set in the project; then the titles read
+// while extracting and last the <title> of the page
+func (opts *Options) pageTitle(topicTitles map[string]string, rel, path string) (string, string, error) {
+	if title, ok := topicTitles[rel]; ok {
+		return title, titleFromTopics, nil
+	}
+	if title, ok := opts.streamed.lookup(rel); ok {
+		return title, titleFromExtraction, nil
+	}
+	title, err := extractTitle(opts.pages, path)
+	return title, titleFromPage, err
+}
+
+// Title returns the name of the docset shown to readers: -name, the title
+// the CHM was compiled with or its file name
+func (opts *Options) Title() string {
+	if opts.Name == "" && opts.systemTitle != "" {
+		return opts.systemTitle
+	}
+	return opts.Basename()
+}
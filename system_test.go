@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chm2docset/chm"
+)
+
+func TestReadSystem(t *testing.T) {
+	opts := &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp/sample.docset"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	Test{opts.ReadSystem(), nil}.Compare(t)
+	Test{opts.Title(), "Sample Änderungen"}.Compare(t)
+	Test{opts.ExtractSource(), nil}.Compare(t)
+	Test{opts.ChooseIndexFile(), nil}.Compare(t)
+	Test{opts.IndexFilePath(), "page.htm"}.Compare(t)
+	opts.WritePlist()
+	b, _ := os.ReadFile(opts.PlistPath())
+	Test{strings.Contains(string(b), "<string>Sample Änderungen</string>"), true}.Compare(t)
+
+	opts.Name = "Sample"
+	Test{opts.Title(), "Sample"}.Compare(t)
+	Test{(&Options{SourcePath: "/foo/bar/baz.chm"}).Title(), "baz"}.Compare(t)
+}
+
+func TestLCIDCharset(t *testing.T) {
+	for _, test := range []Test{
+		{lcidCharset(0x0409), "windows-1252"},
+		{lcidCharset(0x0419), "windows-1251"},
+		{lcidCharset(0x0411), "shift_jis"},
+		{lcidCharset(0x0804), "gbk"},
+		{lcidCharset(0x0404), "big5"},
+		{lcidCharset(0x0405), "windows-1250"},
+		{lcidCharset(0x081a), "windows-1250"},
+		{lcidCharset(0x0c1a), "windows-1251"},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestTopicTitles(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.topics = []chm.Topic{
+		{Title: "Third", Local: "TEST3.htm"},
+		{Title: "First", Local: "test1.htm"},
+		{Title: "Again", Local: "test1.htm"},
+		{Title: "Missing", Local: "missing.htm"},
+	}
+	Test{opts.topicTitles(), map[string]string{"test3.htm": "Third", "test1.htm": "First"}}.DeepEqual(t)
+	Test{opts.CreateDatabase(), nil}.Compare(t)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT name, path FROM searchIndex ORDER BY path")
+	var entries []string
+	for rows.Next() {
+		var name, path string
+		rows.Scan(&name, &path)
+		entries = append(entries, name+" "+path)
+	}
+	Test{entries, []string{"test 4 sub/test4.htm", "First test1.htm", "test 2 yo test2.htm", "Third test3.htm"}}.DeepEqual(t)
+
+	opts = &Options{SourcePath: "_fixtures/sample.chm"}
+	Test{opts.ReadTopics(), nil}.Compare(t)
+	Test{len(opts.topics), 0}.Compare(t)
+}
+
+func TestPageTitle(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.streamed = newStreamedTitles()
+	opts.streamed.add("test1.htm", []byte("<title>Extracted</title>"))
+	opts.streamed.add("test3.htm", []byte("<title>Extracted</title>"))
+	topicTitles := map[string]string{"test1.htm": "From topics"}
+	for _, test := range []struct {
+		page, title, from string
+	}{
+		{"test1.htm", "From topics", titleFromTopics},
+		{"test3.htm", "Extracted", titleFromExtraction},
+		{"test2.htm", "test 2 yo", titleFromPage},
+	} {
+		title, from, err := opts.pageTitle(topicTitles, test.page, filepath.Join(opts.ContentPath(), test.page))
+		Test{err, nil}.Compare(t)
+		Test{title, test.title}.Compare(t)
+		Test{from, test.from}.Compare(t)
+	}
+}
+
+func TestTOCSitemap(t *testing.T) {
+	toc := []chm.TOCEntry{
+		{Title: "Einf\xfchrung", Local: "intro.htm"},
+		{Title: "Tom & Jerry", Children: []chm.TOCEntry{
+			{Title: "Cats", Local: "ref/cats.htm", Children: []chm.TOCEntry{
+				{Title: "Tom", Local: "ref/tom.htm#top"},
+			}},
+		}},
+	}
+	items := parseSitemap(tocSitemap(toc, "windows-1252"))
+	Test{items, []sitemapItem{
+		{Name: "Einführung", Local: "intro.htm"},
+		{Name: "Tom & Jerry"},
+		{Name: "Cats", Local: "ref/cats.htm", Parents: []string{"Tom & Jerry"}},
+		{Name: "Tom", Local: "ref/tom.htm#top", Parents: []string{"Tom & Jerry", "Cats"}},
+	}}.DeepEqual(t)
+}
+
+func TestWriteBinaryTOCKeepsHHC(t *testing.T) {
+	opts := &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp/Sample.docset"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	hhc := findFileByExt(opts.ContentPath(), ".hhc")
+	Test{opts.WriteBinaryTOC(), nil}.Compare(t)
+	Test{findFileByExt(opts.ContentPath(), ".hhc"), hhc}.Compare(t)
+}
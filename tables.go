@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	tableRE       = regexp.MustCompile(`(?is)<table\b[^>]*>(.*?)</table\s*>`)
+	trOpenRE      = regexp.MustCompile(`(?i)<tr\b[^>]*>`)
+	trEndRE       = regexp.MustCompile(`(?i)</tr\s*>|<tr\b|</table\s*>`)
+	cellOpenRE    = regexp.MustCompile(`(?i)<t[dh]\b[^>]*>`)
+	cellEndRE     = regexp.MustCompile(`(?i)</t[dh]\s*>|<t[dh]\b|</tr\s*>`)
+	symbolRE      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	numericRE     = regexp.MustCompile(`^([-+]?(?:0[xX][0-9A-Fa-f]+|\d[0-9A-Fa-f]*[hH]|\d[\d.,]*%?)[uUlL]*)(?:\s*\([-+]?(?:0[xX][0-9A-Fa-f]+|\d[0-9A-Fa-f]*[hH]|\d[\d.,]*%?)[uUlL]*\))?$`)
+	valueHeadRE   = regexp.MustCompile(`(?i)\b(value|code|number|hresult|hex|decimal)\b`)
+	nameHeadRE    = regexp.MustCompile(`(?i)\b(constant|name|symbol|identifier|macro|error|status|message)\b`)
+	errorHintRE   = regexp.MustCompile(`(?i)\b(error|hresult|status code|failure)s?\b`)
+	errorPrefixRE = regexp.MustCompile(`^(ERROR|E|ERR|WSAE|RPC_S|NTE|CO_E|DISP_E)_`)
+)
+
+// minTableRows is the number of symbol rows a table needs to be indexed
+const minTableRows = 2
+
+// tableEntry is a constant or error code row of an HTML table
+type tableEntry struct {
+	Name   string
+	Type   string
+	Anchor string
+}
+
+// tableRow is a <tr> with the plain text of its cells
+type tableRow struct {
+	tagEnd int // offset of the closing '>' of the <tr> tag
+	tag    []byte
+	body   []byte
+	cells  []string
+}
+
+// indexTables indexes constant and error code tables of every page
+func (opts *Options) indexTables(db *dbWriter) error {
+	w := newIndexWriter(db, opts, sourceConstants)
+
+	basePath := opts.ContentPath()
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isHTMLFile(path) {
+			return err
+		}
+		entries, err := tableEntries(opts.pages, path)
+		if err != nil {
+			opts.pageErrorf("skipping tables of %s due to error: %v", path, err)
+			return nil
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, e := range entries {
+			if err := w.Add(e.Name, e.Type, indexPath(relPath)+"#"+e.Anchor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		log.Printf("Indexed %d constants and error codes", w.count)
+	}
+	return nil
+}
+
+// tableEntries returns the rows of constant/error code tables of a page.
+// A table qualifies when its header row has a name column and a value
+// column and its rows hold symbol names with numeric values. Rows without
+// an id or named anchor get an id attribute and the page is rewritten.
+func tableEntries(pages *pageCache, path string) ([]tableEntry, error) {
+	b, err := pages.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	charset := detectCharset(b, "")
+	var pageIsErrors bool
+	if m := titleRE.FindSubmatch(b[:min(len(b), headerReadLimit)]); m != nil {
+		pageIsErrors = errorHintRE.Match(m[1])
+	}
+
+	var entries []tableEntry
+	var insertions []idInsertion
+	used := map[string]bool{}
+	for _, loc := range tableRE.FindAllSubmatchIndex(b, -1) {
+		rows := tableRows(b, loc[2], loc[3], charset)
+		if len(rows) <= minTableRows {
+			continue
+		}
+		nameCol, valueCol := symbolColumns(rows[0].cells)
+		if nameCol < 0 {
+			continue
+		}
+		entryType := "Constant"
+		if pageIsErrors || errorHintRE.MatchString(strings.Join(rows[0].cells, " ")) {
+			entryType = "Error"
+		}
+
+		var found []tableEntry
+		var pending []idInsertion
+		for _, row := range rows[1:] {
+			if nameCol >= len(row.cells) || valueCol >= len(row.cells) {
+				continue
+			}
+			name := row.cells[nameCol]
+			// The whole cell is the value, maybe followed by itself in
+			// another base, e.g. "0 (0x0)"
+			m := numericRE.FindStringSubmatch(row.cells[valueCol])
+			if !symbolRE.MatchString(name) || m == nil {
+				continue
+			}
+			value := m[1]
+			e := tableEntry{Name: name + " (" + value + ")", Type: entryType}
+			if entryType == "Constant" && errorPrefixRE.MatchString(name) {
+				e.Type = "Error"
+			}
+			if m := idAttrRE.FindSubmatch(row.tag); m != nil {
+				e.Anchor = string(m[1])
+			} else if m := nameAnchorRE.FindSubmatch(row.body); m != nil {
+				e.Anchor = string(m[1])
+			} else {
+				e.Anchor = uniqueAnchor("", name, used)
+				pending = append(pending, idInsertion{End: row.tagEnd, ID: e.Anchor})
+			}
+			used[e.Anchor] = true
+			found = append(found, e)
+		}
+		if len(found) < minTableRows {
+			continue
+		}
+		entries = append(entries, found...)
+		insertions = append(insertions, pending...)
+	}
+
+	if len(insertions) > 0 {
+		if err := pages.WriteFile(path, insertIDs(b, insertions)); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// tableRows splits the table content b[start:end] into rows and cells
+func tableRows(b []byte, start, end int, charset string) []tableRow {
+	var rows []tableRow
+	content := b[start:end]
+	for _, loc := range trOpenRE.FindAllIndex(content, -1) {
+		body := content[loc[1]:]
+		if e := trEndRE.FindIndex(body); e != nil {
+			body = body[:e[0]]
+		}
+		row := tableRow{
+			tagEnd: start + loc[1] - 1,
+			tag:    content[loc[0]:loc[1]],
+			body:   body,
+		}
+		for _, c := range cellOpenRE.FindAllIndex(body, -1) {
+			cell := body[c[1]:]
+			if e := cellEndRE.FindIndex(cell); e != nil {
+				cell = cell[:e[0]]
+			}
+			row.cells = append(row.cells, cellText(cell, charset))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// symbolColumns returns the indexes of the name and value columns of a
+// header row, or -1 if the table is not a constant table
+func symbolColumns(header []string) (int, int) {
+	valueCol := -1
+	for i, h := range header {
+		if valueHeadRE.MatchString(h) {
+			valueCol = i
+			break
+		}
+	}
+	if valueCol < 0 {
+		return -1, -1
+	}
+	for i, h := range header {
+		if i != valueCol && nameHeadRE.MatchString(h) {
+			return i, valueCol
+		}
+	}
+	return -1, -1
+}
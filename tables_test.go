@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTableEntries(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/codes.htm", []byte(`<html><head><title>System Error Codes</title></head><body>
+<table>
+<tr><th>Constant</th><th>Value</th><th>Description</th></tr>
+<tr><td>ERROR_SUCCESS</td><td>0 (0x0)</td><td>Done.</td></tr>
+<tr id="fnf"><td>ERROR_FILE_NOT_FOUND</td><td>2</td><td>Not found.</td></tr>
+<tr><td><a name="pnf"></a>ERROR_PATH_NOT_FOUND</td><td>3</td><td>Not found.</td></tr>
+<tr><td>Some prose</td><td>n/a</td><td>Skipped.</td></tr>
+<tr><td>ERROR_RETRIES</td><td>3 times at most</td><td>Skipped.</td></tr>
+</table>
+<table><tr><td>Layout</td><td>table</td></tr><tr><td>A</td><td>1</td></tr><tr><td>B</td><td>2</td></tr></table>
+</body></html>`), 0644)
+	entries, err := tableEntries(nil, "tmp/codes.htm")
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{entries, []tableEntry{
+		{"ERROR_SUCCESS (0)", "Error", "error-success"},
+		{"ERROR_FILE_NOT_FOUND (2)", "Error", "fnf"},
+		{"ERROR_PATH_NOT_FOUND (3)", "Error", "pnf"},
+	}}.DeepEqual(t)
+	b, _ := os.ReadFile("tmp/codes.htm")
+	Test{strings.Contains(string(b), `<tr id="error-success"><td>ERROR_SUCCESS</td>`), true}.Compare(t)
+}
+
+func TestTableEntriesConstants(t *testing.T) {
+	os.MkdirAll("tmp", 0755)
+	defer cleanTmp()
+	os.WriteFile("tmp/consts.htm", []byte(`<title>Window styles</title>
+<TABLE><TR><TD>Name<TD>Hex value
+<TR><TD>WS_BORDER<TD>0x00800000L
+<TR><TD>WS_CAPTION<TD>0x00C00000L
+<TR><TD>E_FAIL<TD>0x80004005
+</TABLE>`), 0644)
+	entries, _ := tableEntries(nil, "tmp/consts.htm")
+	Test{entries, []tableEntry{
+		{"WS_BORDER (0x00800000L)", "Constant", "ws-border"},
+		{"WS_CAPTION (0x00C00000L)", "Constant", "ws-caption"},
+		{"E_FAIL (0x80004005)", "Error", "e-fail"},
+	}}.DeepEqual(t)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const tagsHeader = "!_TAG_FILE_FORMAT\t2\t/extended format/\n" +
+	"!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n" +
+	"!_TAG_PROGRAM_NAME\tchm2docset\t//\n"
+
+// tag is a line of a ctags file
+type tag struct {
+	Name, File string
+	Line       int
+	Kind       string
+}
+
+// WriteTags writes the index entries to the -ctags file. Each tag points at
+// the line of the page holding the entry's anchor, with the entry type as
+// its kind, so that editors can jump from an identifier to its page.
+func (opts *Options) WriteTags() error {
+	if opts.Ctags == "" {
+		return nil
+	}
+	db, err := sql.Open(sqliteDriver, opts.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tagsDir, err := filepath.Abs(filepath.Dir(opts.Ctags))
+	if err != nil {
+		return err
+	}
+	basePath, err := filepath.Abs(opts.ContentPath())
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT name, type, path FROM searchIndex")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	anchors := map[string]map[string]int{}
+	var tags []tag
+	for rows.Next() {
+		var name, entryType, path string
+		if err := rows.Scan(&name, &entryType, &path); err != nil {
+			return err
+		}
+		page := pageOf(path)
+		file := filepath.Join(basePath, filepath.FromSlash(page))
+		lines, ok := anchors[page]
+		if !ok {
+			lines = anchorLines(file)
+			anchors[page] = lines
+		}
+		line := 1
+		if i := strings.IndexByte(path, '#'); i >= 0 {
+			if l, ok := lines[path[i+1:]]; ok {
+				line = l
+			}
+		}
+		if rel, err := filepath.Rel(tagsDir, file); err == nil {
+			file = rel
+		}
+		tags = append(tags, tag{tagField(name), filepath.ToSlash(file), line, tagField(entryType)})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := tags[i], tags[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	if err := writeTags(opts.Ctags, tags); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d tags to %s", len(tags), opts.Ctags)
+	return nil
+}
+
+func writeTags(path string, tags []tag) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(tagsHeader)
+	for _, t := range tags {
+		fmt.Fprintf(w, "%s\t%s\t%d;\"\tkind:%s\n", t.Name, t.File, t.Line, t.Kind)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// anchorLines returns the line numbers of the ids and named anchors of a
+// page
+func anchorLines(path string) map[string]int {
+	lines := map[string]int{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return lines
+	}
+	for _, re := range []*regexp.Regexp{idAttrRE, nameAnchorRE} {
+		for _, m := range re.FindAllSubmatchIndex(b, -1) {
+			anchor := string(b[m[2]:m[3]])
+			if _, ok := lines[anchor]; !ok {
+				lines[anchor] = bytes.Count(b[:m[2]], []byte("\n")) + 1
+			}
+		}
+	}
+	return lines
+}
+
+// tagField replaces the characters that delimit ctags fields
+func tagField(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestWriteTags(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", Ctags: "tmp/tags"}
+	defer cleanTmp()
+	opts.CreateDirectory()
+	os.WriteFile(opts.ContentPath()+"/forms.htm", []byte("<html>\n<h2 id=\"tform\">TForm</h2>\n<p>\n<a name=\"show\">Show</a>\n"), 0644)
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	db.Exec(dbSchema)
+	for _, e := range [][]string{
+		{"TForm.Show", "Method", "forms.htm#show"},
+		{"TForm", "Class", "forms.htm#tform"},
+		{"Forms\tunit", "Guide", "forms.htm"},
+	} {
+		db.Exec("INSERT INTO searchIndex(name, type, path) VALUES (?, ?, ?)", e[0], e[1], e[2])
+	}
+	db.Close()
+
+	if err := opts.WriteTags(); err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	b, _ := os.ReadFile("tmp/tags")
+	Test{string(b), tagsHeader +
+		"Forms unit\tbaz.docset/Contents/Resources/Documents/forms.htm\t1;\"\tkind:Guide\n" +
+		"TForm\tbaz.docset/Contents/Resources/Documents/forms.htm\t2;\"\tkind:Class\n" +
+		"TForm.Show\tbaz.docset/Contents/Resources/Documents/forms.htm\t4;\"\tkind:Method\n"}.Compare(t)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Exit code after an interrupt, as shells report SIGINT
+const exitInterrupted = 130
+
+// tempRoot is the single directory holding the intermediate files of a
+// run. It is created on first use and removed when the run ends or is
+// interrupted, unless -keep-temp is set.
+type tempRoot struct {
+	mu   sync.Mutex
+	dir  string
+	keep bool
+}
+
+func newTempRoot(keep bool) *tempRoot {
+	return &tempRoot{keep: keep}
+}
+
+// Dir creates a new directory below the root. Without a root it creates a
+// standalone temporary directory, which the caller removes.
+func (t *tempRoot) Dir(pattern string) (string, error) {
+	if t == nil {
+		return os.MkdirTemp("", "chm2docset-"+pattern+"-")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dir == "" {
+		dir, err := os.MkdirTemp("", "chm2docset-")
+		if err != nil {
+			return "", err
+		}
+		t.dir = dir
+	}
+	return os.MkdirTemp(t.dir, pattern+"-")
+}
+
+// Keep reports whether temporary files are kept for debugging
+func (t *tempRoot) Keep() bool {
+	return t != nil && t.keep
+}
+
+// Remove deletes the root with everything below it, or logs where it is
+// with -keep-temp
+func (t *tempRoot) Remove() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dir == "" {
+		return nil
+	}
+	if t.keep {
+		log.Printf("Kept temporary files in %s", t.dir)
+		return nil
+	}
+	err := os.RemoveAll(t.dir)
+	t.dir = ""
+	return err
+}
+
+// RemoveOnSignal removes the root when the process is interrupted or
+// terminated, then exits. The returned function stops watching.
+func (t *tempRoot) RemoveOnSignal() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			log.Printf("Interrupted, removing temporary files")
+			t.Remove()
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
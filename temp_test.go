@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTempRoot(t *testing.T) {
+	temp := newTempRoot(false)
+	Test{temp.Remove(), nil}.Compare(t)
+
+	a, err := temp.Dir("shared")
+	Test{err, nil}.Compare(t)
+	b, _ := temp.Dir("verify")
+	Test{filepath.Dir(a), filepath.Dir(b)}.Compare(t)
+	Test{filepath.Dir(a) == os.TempDir(), false}.Compare(t)
+
+	Test{temp.Remove(), nil}.Compare(t)
+	_, err = os.Stat(filepath.Dir(a))
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
+
+func TestTempRootKeep(t *testing.T) {
+	temp := newTempRoot(true)
+	dir, _ := temp.Dir("shared")
+	defer os.RemoveAll(filepath.Dir(dir))
+	temp.Remove()
+	_, err := os.Stat(dir)
+	Test{err, nil}.Compare(t)
+	Test{temp.Keep(), true}.Compare(t)
+
+	var none *tempRoot
+	Test{none.Keep(), false}.Compare(t)
+}
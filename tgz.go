@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/flate"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// writeTgz writes the directory dir as a gzip-compressed tar archive to w,
+// with the directory itself as the top entry, as Dash feeds expect of
+// docsets. The archive is streamed as it is compressed, on every CPU.
+func writeTgz(w io.Writer, dir string) error {
+	gz, err := newParallelGzip(w, flate.DefaultCompression, runtime.GOMAXPROCS(0))
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(gz)
+	parent := filepath.Dir(dir)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(parent, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// TgzPath returns the path of the archive written under -tgz
+func (opts *Options) TgzPath() string {
+	return filepath.Join(filepath.Dir(opts.DocsetPath()), opts.Basename()+".tgz")
+}
+
+// WriteTgz archives the docset next to it under -tgz, for publishing in a
+// Dash feed
+func (opts *Options) WriteTgz() error {
+	if !opts.Tgz {
+		return nil
+	}
+	path := opts.TgzPath()
+	f, err := os.Create(path + ".part")
+	if err != nil {
+		return err
+	}
+	err = writeTgz(f, opts.DocsetPath())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".part")
+		return err
+	}
+	if err := os.Rename(path+".part", path); err != nil {
+		return err
+	}
+	log.Printf("Archived the docset to %s", path)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestParallelGzip(t *testing.T) {
+	defer func(size int) { gzipBlockSize = size }(gzipBlockSize)
+	gzipBlockSize = 4096
+
+	var input bytes.Buffer
+	for i := 0; input.Len() < 200000; i++ {
+		fmt.Fprintf(&input, "<p>Entry %d of the index, %x</p>\n", i, i*i*7919)
+	}
+	for _, data := range [][]byte{input.Bytes(), input.Bytes()[:100], nil} {
+		var out bytes.Buffer
+		z, err := newParallelGzip(&out, flate.DefaultCompression, 4)
+		Test{err, nil}.Compare(t)
+		// Writes straddling blocks
+		for rest := data; len(rest) > 0; {
+			n := min(len(rest), 3000)
+			z.Write(rest[:n])
+			rest = rest[n:]
+		}
+		Test{z.Close(), nil}.Compare(t)
+
+		r, err := gzip.NewReader(&out)
+		Test{err, nil}.Compare(t)
+		// One member, as written by gzip itself
+		r.Multistream(false)
+		b, err := io.ReadAll(r)
+		Test{err, nil}.Compare(t)
+		Test{bytes.Equal(b, data), true}.Compare(t)
+		Test{out.Len(), 0}.Compare(t)
+	}
+
+	_, err := newParallelGzip(io.Discard, 12, 4)
+	Test{err != nil, true}.Compare(t)
+}
+
+func TestWriteTgz(t *testing.T) {
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts := &Options{SourcePath: "/foo/bar/Sample.chm", Outdir: "tmp", Tgz: true}
+	Test{opts.WriteTgz(), nil}.Compare(t)
+	Test{opts.TgzPath(), "tmp/Sample.tgz"}.Compare(t)
+
+	f, err := os.Open("tmp/Sample.tgz")
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	Test{err, nil}.Compare(t)
+	tr := tar.NewReader(gz)
+	names := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			Test{err, io.EOF}.Compare(t)
+			break
+		}
+		names[hdr.Name] = true
+	}
+	Test{names["Sample.docset/"], true}.Compare(t)
+	Test{names["Sample.docset/Contents/Resources/Documents/test1.htm"], true}.Compare(t)
+	_, err = os.Stat("tmp/Sample.tgz.part")
+	Test{os.IsNotExist(err), true}.Compare(t)
+}
+
+func TestConvertTgz(t *testing.T) {
+	defer cleanTmp()
+	opts := &Options{SourcePath: "_fixtures/sample.chm", Outdir: "tmp", Tgz: true}
+	Test{opts.Convert(nil), nil}.Compare(t)
+
+	f, err := os.Open(opts.TgzPath())
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	Test{err, nil}.Compare(t)
+	tr := tar.NewReader(gz)
+	names := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			Test{err, io.EOF}.Compare(t)
+			break
+		}
+		names[hdr.Name] = true
+	}
+	Test{names["sample.docset/Contents/Resources/"+storedReportFile], true}.Compare(t)
+	Test{names["sample.docset/Contents/Info.plist"], true}.Compare(t)
+
+	opts.Format = formatSite
+	Test{opts.checkFormat().Error(), "-tgz archives a docset, not the site format"}.Compare(t)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StageTiming is the time spent in one stage of a conversion. CPU time is
+// measured for the whole process, so it includes concurrent conversions
+// when -jobs is above 1.
+type StageTiming struct {
+	Stage string `json:"stage"`
+	Wall  int64  `json:"wall_ms"`
+	CPU   int64  `json:"cpu_ms"`
+
+	wall, cpu time.Duration
+}
+
+// timeStage runs fn and adds its wall and CPU time to stage when -timings
+// is set. Sub-stages are named "stage/pass".
+func (opts *Options) timeStage(stage string, fn func() error) error {
+	src := opts.sourceReport()
+	if !opts.Timings || src == nil {
+		return fn()
+	}
+	start, startCPU := time.Now(), processCPUTime()
+	err := fn()
+	wall, cpu := time.Since(start), processCPUTime()-startCPU
+
+	opts.report.mu.Lock()
+	defer opts.report.mu.Unlock()
+	var t *StageTiming
+	for _, s := range src.Timings {
+		if s.Stage == stage {
+			t = s
+		}
+	}
+	if t == nil {
+		t = &StageTiming{Stage: stage}
+		src.Timings = append(src.Timings, t)
+	}
+	t.wall += wall
+	t.cpu += cpu
+	t.Wall, t.CPU = t.wall.Milliseconds(), t.cpu.Milliseconds()
+	return err
+}
+
+// writeTimings prints a table of the stage timings of every source
+func writeTimings(w io.Writer, reports []*DocsetReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, r := range reports {
+		for _, src := range r.Sources {
+			if len(src.Timings) == 0 {
+				continue
+			}
+			var total time.Duration
+			for _, t := range src.Timings {
+				if !strings.Contains(t.Stage, "/") {
+					total += t.wall
+				}
+			}
+			fmt.Fprintf(tw, "%s\twall\tcpu\tshare\t\n", filepath.Base(src.Source))
+			for _, t := range src.Timings {
+				name := "  " + t.Stage
+				if i := strings.IndexByte(t.Stage, '/'); i >= 0 {
+					name = "    " + t.Stage[i+1:]
+				}
+				share := 0.0
+				if total > 0 {
+					share = 100 * float64(t.wall) / float64(total)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%.0f%%\t\n", name, formatDuration(t.wall), formatDuration(t.cpu), share)
+			}
+			fmt.Fprintf(tw, "  total\t%s\t\t\t\n", formatDuration(total))
+		}
+	}
+	tw.Flush()
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
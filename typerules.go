@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// typeRule gives the entries whose name and path match its expressions a
+// type. An expression left out matches everything.
+type typeRule struct {
+	Title *regexp.Regexp
+	Path  *regexp.Regexp
+	// From restricts the rule to entries of this type, e.g. Guide
+	From string
+	Type string
+}
+
+// readTypeRules reads a -type-rules file, a YAML list of rules with the
+// keys title, path, from and type
+func readTypeRules(path string) ([]typeRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []struct {
+		Title string `yaml:"title"`
+		Path  string `yaml:"path"`
+		From  string `yaml:"from"`
+		Type  string `yaml:"type"`
+	}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&items); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rules := make([]typeRule, 0, len(items))
+	for i, item := range items {
+		if item.Type == "" {
+			return nil, fmt.Errorf("%s: rule %d has no type", path, i+1)
+		}
+		if item.Title == "" && item.Path == "" {
+			return nil, fmt.Errorf("%s: rule %d has neither title nor path", path, i+1)
+		}
+		rule := typeRule{From: item.From, Type: item.Type}
+		for _, re := range []struct {
+			expr string
+			dst  **regexp.Regexp
+		}{{item.Title, &rule.Title}, {item.Path, &rule.Path}} {
+			if re.expr == "" {
+				continue
+			}
+			if *re.dst, err = regexp.Compile(re.expr); err != nil {
+				return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadTypeRules reads the -type-rules file, if any
+func (opts *Options) loadTypeRules() error {
+	opts.typeRules = nil
+	if opts.TypeRules == "" {
+		return nil
+	}
+	rules, err := readTypeRules(opts.TypeRules)
+	if err != nil {
+		return fmt.Errorf("-type-rules: %w", err)
+	}
+	opts.typeRules = rules
+	return nil
+}
+
+// ruleType returns the type the first matching -type-rules rule gives an
+// entry, or entryType if none matches
+func (opts *Options) ruleType(name, entryType, path string) string {
+	for _, rule := range opts.typeRules {
+		if rule.From != "" && rule.From != entryType ||
+			rule.Title != nil && !rule.Title.MatchString(name) ||
+			rule.Path != nil && !rule.Path.MatchString(path) {
+			continue
+		}
+		return rule.Type
+	}
+	return entryType
+}
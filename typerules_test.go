@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadTypeRules(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	for _, test := range []struct {
+		yaml, err string
+	}{
+		{"- title: ' Function$'\n  type: Function\n- path: ^api/\n  from: Guide\n  type: Class\n", ""},
+		{"- title: x\n", "rule 1 has no type"},
+		{"- type: Class\n", "rule 1 has neither title nor path"},
+		{"- title: x\n  type: Class\n- path: '('\n  type: Class\n", "rule 2: error parsing regexp"},
+		{"- titel: x\n  type: Class\n", "field titel not found"},
+	} {
+		os.WriteFile("tmp/types.yaml", []byte(test.yaml), 0644)
+		rules, err := readTypeRules("tmp/types.yaml")
+		if test.err == "" {
+			Test{err, nil}.Compare(t)
+			Test{len(rules), 2}.Compare(t)
+			continue
+		}
+		Test{err != nil && strings.Contains(err.Error(), test.err), true}.Compare(t)
+	}
+}
+
+func TestRuleType(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/types.yaml", []byte(`- title: ' (Function|Procedure)$'
+  type: Function
+- path: ^vcl/.*_props\.htm
+  type: Property
+- title: ^T[A-Z]\w*$
+  from: Guide
+  type: Class
+`), 0644)
+	opts := &Options{TypeRules: "tmp/types.yaml"}
+	Test{opts.loadTypeRules(), nil}.Compare(t)
+	for _, test := range []struct {
+		name, entryType, path, expected string
+	}{
+		{"ShowMessage Procedure", "Guide", "dialogs.htm", "Function"},
+		{"Caption", "Guide", "vcl/tform_props.htm#caption", "Property"},
+		{"TForm", "Guide", "vcl/tform.htm", "Class"},
+		{"TForm", "Section", "vcl/tform.htm", "Section"},
+		{"Overview", "Guide", "intro.htm", "Guide"},
+	} {
+		Test{opts.ruleType(test.name, test.entryType, test.path), test.expected}.Compare(t)
+	}
+
+	opts.TypeRules = "tmp/missing.yaml"
+	Test{opts.loadTypeRules() != nil, true}.Compare(t)
+}
+
+func TestIndexTypeRules(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/types.yaml", []byte("- path: ^api/\n  type: Class\n"), 0644)
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", TypeRules: "tmp/types.yaml", Classify: true}
+	opts.loadTypeRules()
+	opts.sourceRanks, _ = parseSourcePriority(defaultSourcePriority)
+	opts.entries = map[entryKey]entryOrigin{}
+	opts.CreateDirectory()
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	db.Exec(dbSchema)
+	w := newDBWriter(db, 0)
+
+	hhk := newIndexWriter(w, opts, sourceHHK)
+	hhk.Add("printf", "Guide", "api/printf.htm")
+	hhk.Add("CreateFile Function", "Guide", "createfile.htm")
+	w.Close()
+
+	rows, _ := db.Query("SELECT name, type FROM searchIndex ORDER BY name")
+	var entries []string
+	for rows.Next() {
+		var name, entryType string
+		rows.Scan(&name, &entryType)
+		entries = append(entries, name+"|"+entryType)
+	}
+	Test{entries, []string{"CreateFile Function|Function", "printf|Class"}}.DeepEqual(t)
+}
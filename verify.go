@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+var (
+	plistEntryRE = regexp.MustCompile(`<key>([^<]*)</key>\s*<string>([^<]*)</string>`)
+	absPathRE    = regexp.MustCompile(`^(?:/|[A-Za-z]:[\\/]|\\\\|file:)`)
+)
+
+// Info.plist keys Zeal needs to list a docset
+var requiredPlistKeys = []string{"CFBundleIdentifier", "CFBundleName", "DocSetPlatformFamily"}
+
+// verifyCommand implements the verify subcommand
+func verifyCommand(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s verify docset|inputfile\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+	if info, err := os.Stat(flags.Arg(0)); err == nil && info.Mode().IsRegular() {
+		return verifyCHM(os.Stdout, flags.Arg(0))
+	}
+
+	problems, err := verifyDocset(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d layout problems", len(problems))
+	}
+	fmt.Println("Docset layout OK")
+	return nil
+}
+
+// verifyCHM reads every file and compressed frame of a CHM and prints the
+// truncated or corrupt ones, to tell a damaged CHM from a conversion problem
+func verifyCHM(w io.Writer, path string) error {
+	r, err := chm.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	check := r.Verify()
+	for _, problem := range check.Problems {
+		fmt.Fprintln(w, problem)
+	}
+	if len(check.Problems) > 0 {
+		return fmt.Errorf("%d corrupt entries in %s", len(check.Problems), path)
+	}
+	fmt.Fprintf(w, "CHM OK: %d files, %d compressed frames\n", check.Files, check.Frames)
+	return nil
+}
+
+// verifyDocset checks a docset bundle without modifying it for the layout
+// problems Zeal, being stricter than Dash, fails on
+func verifyDocset(dir string) ([]string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	opts := &Options{Outdir: dir}
+
+	var problems []string
+	if !strings.HasSuffix(filepath.Base(filepath.Clean(dir)), ".docset") {
+		problems = append(problems, "bundle name does not end in .docset")
+	}
+	for _, p := range []struct {
+		path string
+		dir  bool
+	}{
+		{"Contents", true},
+		{"Contents/Info.plist", false},
+		{"Contents/Resources", true},
+		{"Contents/Resources/docSet.dsidx", false},
+		{"Contents/Resources/Documents", true},
+	} {
+		if problem := checkEntry(dir, p.path, p.dir); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		switch name := d.Name(); {
+		case d.Type()&fs.ModeSymlink != 0:
+			problems = append(problems, fmt.Sprintf("%s is a symlink", rel))
+		case name == ":memory:":
+			problems = append(problems, fmt.Sprintf("%s is a stray in-memory database file", rel))
+		case strings.HasPrefix(name, "docSet.dsidx-"):
+			problems = append(problems, fmt.Sprintf("%s is a leftover database journal", rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plistProblems, err := verifyPlist(opts)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, plistProblems...)
+	if fileExists(opts.DatabasePath()) {
+		problems = append(problems, verifyIndex(opts)...)
+	}
+	return problems, nil
+}
+
+// checkEntry reports a required entry that is missing, of the wrong kind,
+// or differs in case from the name Zeal looks for
+func checkEntry(root, rel string, dir bool) string {
+	parent := filepath.Join(root, filepath.FromSlash(path.Dir(rel)))
+	name := path.Base(rel)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return fmt.Sprintf("%s is missing", rel)
+	}
+	for _, e := range entries {
+		if e.Name() == name {
+			if e.IsDir() != dir {
+				return fmt.Sprintf("%s has the wrong type", rel)
+			}
+			return ""
+		}
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), name) {
+			return fmt.Sprintf("%s is named %s; Zeal needs this exact case", rel, e.Name())
+		}
+	}
+	return fmt.Sprintf("%s is missing", rel)
+}
+
+// verifyPlist checks the keys of Info.plist, its start page, and that it
+// holds no absolute paths
+func verifyPlist(opts *Options) ([]string, error) {
+	b, err := os.ReadFile(opts.PlistPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, m := range plistEntryRE.FindAllStringSubmatch(string(b), -1) {
+		values[m[1]] = html.UnescapeString(m[2])
+	}
+
+	var problems []string
+	for _, key := range requiredPlistKeys {
+		if values[key] == "" {
+			problems = append(problems, fmt.Sprintf("Info.plist lacks %s", key))
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if absPathRE.MatchString(values[key]) {
+			problems = append(problems, fmt.Sprintf("Info.plist %s is an absolute path: %s", key, values[key]))
+		}
+	}
+	if start := values["dashIndexFilePath"]; start != "" && !absPathRE.MatchString(start) {
+		if !fileExists(filepath.Join(opts.ContentPath(), filepath.FromSlash(pageOf(start)))) {
+			problems = append(problems, fmt.Sprintf("Info.plist start page %s does not exist", start))
+		}
+	}
+	return problems, nil
+}
+
+// verifyIndex checks that the index opens read-only with the searchIndex
+// table Zeal queries, and that its entries point at existing pages
+func verifyIndex(opts *Options) []string {
+	db, err := sql.Open(sqliteDriver, "file:"+filepath.ToSlash(opts.DatabasePath())+"?mode=ro")
+	if err != nil {
+		return []string{fmt.Sprintf("docSet.dsidx does not open: %v", err)}
+	}
+	defer db.Close()
+
+	columns := map[string]bool{}
+	rows, err := db.Query("PRAGMA table_info(searchIndex)")
+	if err != nil {
+		return []string{fmt.Sprintf("docSet.dsidx does not open: %v", err)}
+	}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk) == nil {
+			columns[name] = true
+		}
+	}
+	rows.Close()
+	var problems []string
+	for _, col := range []string{"id", "name", "type", "path"} {
+		if !columns[col] {
+			problems = append(problems, fmt.Sprintf("docSet.dsidx searchIndex lacks column %s", col))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	broken, err := opts.brokenPaths(db)
+	if err != nil {
+		return []string{fmt.Sprintf("reading docSet.dsidx: %v", err)}
+	}
+	if broken > 0 {
+		problems = append(problems, fmt.Sprintf("%d index entries point at missing pages", broken))
+	}
+	return problems
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDocset(t *testing.T) {
+	opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/Sample.docset", Platform: "sample"}
+	defer cleanTmp()
+	CopyDir("_fixtures/Sample.docset", "tmp/Sample.docset")
+	opts.CreateDatabase()
+	opts.ChooseIndexFile()
+	opts.WritePlist()
+
+	problems, err := verifyDocset("tmp/Sample.docset")
+	Test{err, nil}.Compare(t)
+	Test{len(problems), 0}.Compare(t)
+
+	os.WriteFile("tmp/Sample.docset/Contents/Resources/:memory:", nil, 0644)
+	os.Symlink("test1.htm", opts.ContentPath()+"/link.htm")
+	plist, _ := os.ReadFile(opts.PlistPath())
+	os.WriteFile(opts.PlistPath(), []byte(
+		replaceOnce(string(plist), "<string>"+opts.IndexFilePath()+"</string>", "<string>/home/me/index.htm</string>")), 0644)
+
+	problems, _ = verifyDocset("tmp/Sample.docset")
+	Test{problems, []string{
+		"Contents/Resources/:memory: is a stray in-memory database file",
+		"Contents/Resources/Documents/link.htm is a symlink",
+		"Info.plist dashIndexFilePath is an absolute path: /home/me/index.htm",
+	}}.DeepEqual(t)
+}
+
+func TestVerifyDocsetCase(t *testing.T) {
+	defer cleanTmp()
+	os.MkdirAll("tmp/Bad/Contents/Resources/documents", 0755)
+	problems, err := verifyDocset("tmp/Bad")
+	Test{err, nil}.Compare(t)
+	Test{problems, []string{
+		"bundle name does not end in .docset",
+		"Contents/Info.plist is missing",
+		"Contents/Resources/docSet.dsidx is missing",
+		"Contents/Resources/Documents is named documents; Zeal needs this exact case",
+	}}.DeepEqual(t)
+}
+
+func replaceOnce(s, old, new string) string {
+	return strings.Replace(s, old, new, 1)
+}
+
+func TestVerifyCHM(t *testing.T) {
+	var b bytes.Buffer
+	Test{verifyCHM(&b, "_fixtures/sample.chm"), nil}.Compare(t)
+	Test{b.String(), "CHM OK: 5 files, 0 compressed frames\n"}.Compare(t)
+
+	defer cleanTmp()
+	image, _ := os.ReadFile("_fixtures/sample.chm")
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/damaged.chm", image[:len(image)-40], 0644)
+	b.Reset()
+	err := verifyCHM(&b, "tmp/damaged.chm")
+	Test{err != nil, true}.Compare(t)
+	Test{strings.Contains(b.String(), "is truncated"), true}.Compare(t)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"chm2docset/chm"
+)
+
+var (
+	linkRE   = regexp.MustCompile(`(?i)\b(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	schemeRE = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+)
+
+const (
+	reasonBrokenInSource = "broken in source"
+	reasonLostExtraction = "lost in extraction"
+	// reasonCaseMismatch is a link differing in case from the extracted
+	// file, which the help viewer follows but case-sensitive systems miss
+	reasonCaseMismatch = "case mismatch"
+)
+
+// linkProblem is a link whose target is missing from the extracted tree
+type linkProblem struct {
+	Page   string
+	Target string
+	Reason string
+}
+
+// verifyLinksCommand implements the verify-links subcommand
+func verifyLinksCommand(args []string) error {
+	flags := flag.NewFlagSet("verify-links", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s verify-links inputfile\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	keepTemp := flags.Bool("keep-temp", false, "Keep the extracted files for debugging")
+	extractor := flags.String("extractor", extractorBuiltin, "CHM extractor: "+strings.Join(extractorNames(), ", "))
+	timeout := flags.Duration("extract-timeout", defaultExtractTimeout, "Stop an external extractor running longer than this")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+	source := flags.Arg(0)
+
+	r, err := chm.Open(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	temp := newTempRoot(*keepTemp)
+	defer temp.Remove()
+	defer temp.RemoveOnSignal()()
+	tmp, err := temp.Dir("verify")
+	if err != nil {
+		return err
+	}
+
+	opts := &Options{SourcePath: source, Outdir: tmp, Extractor: *extractor, ExtractTimeout: *timeout}
+	if err := opts.CreateDirectory(); err != nil {
+		return err
+	}
+	if err := opts.ExtractSource(); err != nil {
+		return fmt.Errorf("extracting source: %w", err)
+	}
+
+	problems, err := checkLinks(r, opts.ContentPath())
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %s -> %s\n", p.Reason, p.Page, p.Target)
+	}
+	lost, err := lostFiles(r, opts.ContentPath())
+	if err != nil {
+		return err
+	}
+	for _, name := range lost {
+		fmt.Printf("not extracted: %s\n", name)
+	}
+	if len(problems) > 0 || len(lost) > 0 {
+		return fmt.Errorf("%d broken links, %d files not extracted", len(problems), len(lost))
+	}
+	fmt.Println("All links resolved")
+	return nil
+}
+
+// checkLinks resolves the links of every HTML page below root and classifies
+// the ones that cannot be followed using the CHM's own listing, if r is not
+// nil
+func checkLinks(r *chm.Reader, root string) ([]linkProblem, error) {
+	files, err := extractedFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var problems []linkProblem
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isHTMLFile(p) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		page := filepath.ToSlash(rel)
+
+		seen := map[string]bool{}
+		for _, link := range findLinks(decodeToUTF8(b, "")) {
+			target, ok := resolveLink(page, link)
+			if !ok || seen[target] {
+				continue
+			}
+			seen[target] = true
+			if target == "" {
+				problems = append(problems, linkProblem{page, link, reasonBrokenInSource})
+				continue
+			}
+			found, ok := files[strings.ToLower(target)]
+			if ok && found == target {
+				continue
+			}
+			reason := reasonBrokenInSource
+			switch {
+			case ok:
+				reason = reasonCaseMismatch
+			case r != nil:
+				if _, ok := r.Stat("/" + target); ok {
+					reason = reasonLostExtraction
+				}
+			}
+			problems = append(problems, linkProblem{page, link, reason})
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// extractedFiles returns the files below root by lower-cased path, for
+// links and listings to be looked up regardless of case, as the help viewer
+// does
+func extractedFiles(root string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files[strings.ToLower(rel)] = rel
+		return nil
+	})
+	return files, err
+}
+
+// lostFiles returns content files listed in the CHM but missing below root
+// in any case
+func lostFiles(r *chm.Reader, root string) ([]string, error) {
+	files, err := extractedFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var lost []string
+	for _, f := range r.Files() {
+		if !f.IsContent() {
+			continue
+		}
+		if _, ok := files[strings.ToLower(f.Name[1:])]; !ok {
+			lost = append(lost, f.Name)
+		}
+	}
+	return lost, nil
+}
+
+// findLinks returns the href and src attribute values of an HTML document
+func findLinks(content string) []string {
+	var links []string
+	for _, m := range linkRE.FindAllStringSubmatch(content, -1) {
+		link := m[1] + m[2] + m[3]
+		links = append(links, strings.TrimSpace(html.UnescapeString(link)))
+	}
+	sort.Strings(links)
+	return links
+}
+
+// resolveLink resolves link relative to page. It reports false for links
+// that do not point into the document tree (fragments, other schemes);
+// an empty target means the link escapes the tree.
+func resolveLink(page, link string) (string, bool) {
+	if link == "" || strings.HasPrefix(link, "#") || schemeRE.MatchString(link) {
+		return "", false
+	}
+	if i := strings.IndexAny(link, "#?"); i >= 0 {
+		link = link[:i]
+	}
+	if unescaped, err := url.PathUnescape(link); err == nil {
+		link = unescaped
+	}
+	link = strings.ReplaceAll(link, "\\", "/")
+	var target string
+	if strings.HasPrefix(link, "/") {
+		target = path.Clean(link)[1:]
+	} else {
+		target = path.Join(path.Dir(page), link)
+	}
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", true
+	}
+	return target, true
+}
+
+func isHTMLFile(p string) bool {
+	ext := filepath.Ext(p)
+	return strings.EqualFold(ext, ".htm") || strings.EqualFold(ext, ".html")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"chm2docset/chm"
+)
+
+func TestResolveLink(t *testing.T) {
+	for _, test := range []struct {
+		page, link, target string
+		ok                 bool
+	}{
+		{"index.htm", "page.htm", "page.htm", true},
+		{"sub/a.htm", "../b.htm#x", "b.htm", true},
+		{"sub/a.htm", "c%20d.htm?q", "sub/c d.htm", true},
+		{"sub/a.htm", "\\img\\x.gif", "img/x.gif", true},
+		{"a.htm", "../../etc/passwd", "", true},
+		{"a.htm", "#top", "", false},
+		{"a.htm", "http://example.com/", "", false},
+		{"a.htm", "mk:@MSITStore:other.chm::/a.htm", "", false},
+	} {
+		target, ok := resolveLink(test.page, test.link)
+		Test{target, test.target}.Compare(t)
+		Test{ok, test.ok}.Compare(t)
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	defer cleanTmp()
+	r, err := chm.Open("_fixtures/sample.chm")
+	if err != nil {
+		t.Fatalf("Expected nil but got %v", err)
+	}
+	defer r.Close()
+
+	// Simulate an extraction that lost sub/lost.htm
+	os.MkdirAll("tmp/docs/img", 0755)
+	os.WriteFile("tmp/docs/index.htm", []byte(`<a href="page.htm">page</a>
+<a href="sub/lost.htm#top">lost</a>
+<a href='missing.htm'>missing</a>
+<a href="Page.htm">other case</a>
+<a href="http://example.com/">external</a>
+<img src=img/logo.gif>`), 0644)
+	os.WriteFile("tmp/docs/page.htm", []byte(`<a href="index.htm">back</a>`), 0644)
+	os.WriteFile("tmp/docs/img/logo.gif", []byte("GIF89a"), 0644)
+
+	problems, err := checkLinks(r, "tmp/docs")
+	if err != nil {
+		t.Errorf("Expected nil but got %v", err)
+	}
+	Test{problems, []linkProblem{
+		{"index.htm", "Page.htm", reasonCaseMismatch},
+		{"index.htm", "missing.htm", reasonBrokenInSource},
+		{"index.htm", "sub/lost.htm#top", reasonLostExtraction},
+	}}.DeepEqual(t)
+	lost, err := lostFiles(r, "tmp/docs")
+	Test{err, nil}.Compare(t)
+	Test{lost, []string{"/sub/lost.htm"}}.DeepEqual(t)
+}
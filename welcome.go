@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// -start-contents modes
+const (
+	startContentsReplace = "replace"
+	startContentsAppend  = "append"
+)
+
+const (
+	contentsFile = "chm2docset-contents.html"
+
+	contentsTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s</title>
+</head>
+<body>
+<h1>%[1]s</h1>
+%[2]s</body>
+</html>
+`
+)
+
+// AddStartContents replaces the start page, when it is an empty or cover
+// page, by a page listing the table of contents under -start-contents
+// replace, or appends the table to it under -start-contents append
+func (opts *Options) AddStartContents() error {
+	switch opts.StartContents {
+	case "":
+		return nil
+	case startContentsReplace, startContentsAppend:
+	default:
+		return fmt.Errorf("unknown -start-contents %q, expected %s or %s", opts.StartContents, startContentsReplace, startContentsAppend)
+	}
+	page := pageOf(opts.IndexFilePath())
+	path := filepath.Join(opts.ContentPath(), filepath.FromSlash(page))
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if page != coverFile && !isTinyPage(b) {
+		return nil
+	}
+
+	if opts.StartContents == startContentsReplace {
+		list, err := opts.contentsList(contentsFile)
+		if err != nil || list == "" {
+			return err
+		}
+		title := asciiHTML(opts.Title())
+		if err := os.WriteFile(filepath.Join(opts.ContentPath(), contentsFile), []byte(fmt.Sprintf(contentsTemplate, title, list)), 0644); err != nil {
+			return err
+		}
+		log.Printf("Start page %s is nearly empty, opening on the table of contents instead", page)
+		opts.indexFile = contentsFile
+		return nil
+	}
+
+	list, err := opts.contentsList(page)
+	if err != nil || list == "" {
+		return err
+	}
+	b = insertInBody(b, "", list)
+	log.Printf("Start page %s is nearly empty, appending the table of contents", page)
+	return os.WriteFile(path, b, 0644)
+}
+
+// contentsList renders the table of contents as nested lists of links
+// relative to the page from, or returns "" without an HHC file. Text is
+// written as ASCII with character references, so that it reads the same in
+// the charset of any page it is added to.
+func (opts *Options) contentsList(from string) (string, error) {
+	hhcPath := findFileByExt(opts.ContentPath(), ".hhc")
+	if hhcPath == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(hhcPath)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	depth := 0
+	for _, item := range parseSitemap(decodeToUTF8(b, defaultSitemapEncoding)) {
+		level := len(item.Parents) + 1
+		for ; depth < level; depth++ {
+			out.WriteString("<ul>\n")
+		}
+		for ; depth > level; depth-- {
+			out.WriteString("</ul>\n")
+		}
+		name := asciiHTML(item.Name)
+		page, fragment, ok := opts.resolveLocal(item.Local)
+		if item.Local == "" || !ok {
+			out.WriteString("<li>" + name + "</li>\n")
+			continue
+		}
+		href := html.EscapeString(escapeLink(relativeLink(from, page)) + fragment)
+		out.WriteString(`<li><a href="` + href + `">` + name + "</a></li>\n")
+	}
+	for ; depth > 0; depth-- {
+		out.WriteString("</ul>\n")
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAddStartContents(t *testing.T) {
+	defer cleanTmp()
+	setup := func(mode string) *Options {
+		cleanTmp()
+		opts := &Options{SourcePath: "/foo/bar/baz.chm", Outdir: "tmp/baz.docset", Name: "Café", StartContents: mode, indexFile: "sub/cover.htm"}
+		opts.CreateDirectory()
+		content := opts.ContentPath()
+		os.MkdirAll(content+"/sub", 0755)
+		os.WriteFile(content+"/sub/cover.htm", []byte(`<html><body><img src="logo.gif"></body></html>`), 0644)
+		os.WriteFile(content+"/a.htm", []byte("a"), 0644)
+		os.WriteFile(content+"/sub/b.htm", []byte("b"), 0644)
+		os.WriteFile(content+"/toc.hhc", []byte(`<meta charset="utf-8"><UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Über"><param name="Local" value="a.htm"></OBJECT>
+<UL><LI><OBJECT type="text/sitemap"><param name="Name" value="B"><param name="Local" value="sub/b.htm#x"></OBJECT></UL>
+<LI><OBJECT type="text/sitemap"><param name="Name" value="Folder"></OBJECT>
+</UL>`), 0644)
+		return opts
+	}
+	list := "<ul>\n<li><a href=\"%s\">&#220;ber</a></li>\n<ul>\n<li><a href=\"%s\">B</a></li>\n</ul>\n<li>Folder</li>\n</ul>\n"
+
+	opts := setup(startContentsAppend)
+	Test{opts.AddStartContents(), nil}.Compare(t)
+	b, _ := os.ReadFile(opts.ContentPath() + "/sub/cover.htm")
+	Test{string(b), `<html><body><img src="logo.gif">` + fmt.Sprintf(list, "../a.htm", "b.htm#x") + `</body></html>`}.Compare(t)
+	Test{opts.IndexFilePath(), "sub/cover.htm"}.Compare(t)
+
+	opts = setup(startContentsReplace)
+	Test{opts.AddStartContents(), nil}.Compare(t)
+	Test{opts.IndexFilePath(), contentsFile}.Compare(t)
+	b, _ = os.ReadFile(opts.ContentPath() + "/" + contentsFile)
+	Test{strings.Contains(string(b), "<h1>Caf&#233;</h1>\n<ul>\n<li><a href=\"a.htm\">&#220;ber</a></li>"), true}.Compare(t)
+	Test{strings.Contains(string(b), `<a href="sub/b.htm#x">B</a>`), true}.Compare(t)
+
+	opts = setup(startContentsReplace)
+	os.WriteFile(opts.ContentPath()+"/sub/cover.htm", []byte("<body>"+strings.Repeat("Plenty of text. ", 50)+"</body>"), 0644)
+	Test{opts.AddStartContents(), nil}.Compare(t)
+	Test{opts.IndexFilePath(), "sub/cover.htm"}.Compare(t)
+
+	opts.StartContents = "prepend"
+	Test{opts.AddStartContents().Error(), `unknown -start-contents "prepend", expected replace or append`}.Compare(t)
+}
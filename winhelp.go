@@ -0,0 +1,30 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// defaultHLPHelper is the program converting WinHelp files unless
+// -hlp-helper names another
+const defaultHLPHelper = "hlp2html"
+
+// isHLPFile reports whether a source is a WinHelp (.hlp) file, which no
+// extractor reads: an external helper converts its topics to HTML pages
+func isHLPFile(source string) bool {
+	return strings.EqualFold(filepath.Ext(source), ".hlp")
+}
+
+// hlpExtractor returns the extractor running the -hlp-helper program as
+// PROGRAM input.hlp outdir. The helper writes a page per topic, and may
+// write an .hhc table of contents and .hhk index to be indexed as for a
+// CHM.
+func (opts *Options) hlpExtractor() Extractor {
+	bin := opts.HLPHelper
+	if bin == "" {
+		bin = defaultHLPHelper
+	}
+	return commandExtractor{bin: bin, args: func(source, destination string) []string {
+		return []string{source, destination}
+	}}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertHLP(t *testing.T) {
+	defer cleanTmp()
+	useFixtureBin()
+	os.MkdirAll("tmp", 0755)
+	os.WriteFile("tmp/legacy.HLP", []byte("?_\x03\x00"), 0644)
+	opts := &Options{SourcePath: "tmp/legacy.HLP", Outdir: "tmp/out"}
+	Test{opts.Convert(nil), nil}.Compare(t)
+
+	b, _ := os.ReadFile(opts.ContentPath() + "/args.txt")
+	source, _ := filepath.Abs("tmp/legacy.HLP")
+	Test{strings.HasPrefix(string(b), source+" "), true}.Compare(t)
+
+	db, _ := sql.Open(sqliteDriver, opts.DatabasePath())
+	defer db.Close()
+	var entries string
+	db.QueryRow("SELECT group_concat(name || ' ' || path, ', ') FROM (SELECT * FROM searchIndex ORDER BY name)").Scan(&entries)
+	Test{entries, "Contents index.htm, Opening files topics/open.htm"}.Compare(t)
+
+	opts = &Options{SourcePath: "tmp/legacy.hlp", Outdir: "tmp/out", HLPHelper: "no-such-hlp-helper"}
+	err := opts.ExtractSource()
+	Test{err != nil && strings.Contains(err.Error(), "no-such-hlp-helper is required but not found in PATH"), true}.Compare(t)
+}